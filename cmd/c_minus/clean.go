@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/elijahmorgan/c_minus/internal/manifest"
+	"github.com/elijahmorgan/c_minus/internal/project"
+)
+
+// runClean removes the files earlier builds recorded in .c_minus/.manifest:
+// generated sources, objects, and the binaries and libraries they linked.
+// Anything else in .c_minus is left alone.
+func runClean(args []string) error {
+	verbose := false
+	for _, arg := range args {
+		switch arg {
+		case "-v":
+			verbose = true
+		default:
+			return fmt.Errorf("usage: c_minus clean [-v]")
+		}
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get working directory: %w", err)
+	}
+	root, _, err := project.FindRoot(cwd)
+	if err != nil {
+		return err
+	}
+
+	removed, err := manifest.Clean(root, filepath.Join(root, ".c_minus"))
+	if verbose {
+		for _, f := range removed {
+			fmt.Println("removed", f)
+		}
+	}
+	return err
+}
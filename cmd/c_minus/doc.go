@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/elijahmorgan/c_minus/internal/doc"
+	"github.com/elijahmorgan/c_minus/internal/project"
+)
+
+// runDoc prints the documentation of a module, or lists the project's
+// modules when none is named
+func runDoc(args []string) error {
+	all := false
+	module := ""
+	for _, arg := range args {
+		switch {
+		case arg == "-all" || arg == "--all":
+			all = true
+		case module == "" && arg != "" && arg[0] != '-':
+			module = arg
+		default:
+			return fmt.Errorf("usage: c_minus doc [-all] [module]")
+		}
+	}
+
+	loaded, err := project.Load(".", nil)
+	if err != nil {
+		return fmt.Errorf("project load failed: %w", err)
+	}
+	if module == "" {
+		doc.Index(os.Stdout, loaded)
+		return nil
+	}
+	return doc.Module(os.Stdout, loaded, module, all)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/elijahmorgan/c_minus/internal/project"
+)
+
+// Check statuses printed by doctor
+const (
+	checkOK   = "ok"
+	checkWarn = "warn" // Optional tool missing; does not fail doctor
+	checkFail = "FAIL"
+)
+
+// checkResult is one line of the doctor checklist
+type checkResult struct {
+	name   string
+	status string
+	detail string
+}
+
+// runDoctor checks the toolchain and the project in the current directory
+// and prints a checklist, failing if any required check fails. The C
+// compiler checked is the one a build would run: -cc, cm.build's cc, $CC,
+// or gcc.
+func runDoctor(args []string) error {
+	cfg, err := loadBuildConfig()
+	if err != nil {
+		return err
+	}
+	opts := cfg.Options
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-cc":
+			if i+1 >= len(args) {
+				return fmt.Errorf("-cc requires an argument")
+			}
+			opts.CC = args[i+1]
+			i++
+		default:
+			return fmt.Errorf("unknown doctor flag: %s", args[i])
+		}
+	}
+
+	results := []checkResult{
+		checkTool(opts.Compiler(), true, "--version"),
+		checkTool("ar", true, "--version"),
+		checkTool("clangd", false, "--version"),
+	}
+	results = append(results, checkProject(".")...)
+
+	failed := 0
+	for _, r := range results {
+		fmt.Printf("%-6s %-8s %s\n", "["+r.status+"]", r.name, r.detail)
+		if r.status == checkFail {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+	return nil
+}
+
+// checkTool looks the program of a command up in PATH and reports the first
+// line of the command's version output. The command may carry arguments, as
+// a compiler does in CC="ccache gcc".
+func checkTool(name string, required bool, versionFlag string) checkResult {
+	fields := strings.Fields(name)
+	if len(fields) == 0 {
+		return checkResult{name, checkFail, "empty command"}
+	}
+	path, err := exec.LookPath(fields[0])
+	if err != nil {
+		if required {
+			return checkResult{name, checkFail, "not found in PATH"}
+		}
+		return checkResult{name, checkWarn, "not found in PATH (only needed by the language server)"}
+	}
+	out, err := exec.Command(path, append(fields[1:], versionFlag)...).Output()
+	version, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	if err != nil || version == "" {
+		return checkResult{name, checkOK, path}
+	}
+	return checkResult{name, checkOK, fmt.Sprintf("%s (%s)", path, version)}
+}
+
+// checkProject checks that cm.mod exists and parses, then that the modules
+// validate and form no cycles
+func checkProject(dir string) []checkResult {
+	root, module, err := project.FindRoot(dir)
+	if err != nil {
+		return []checkResult{
+			{"cm.mod", checkFail, err.Error()},
+			{"modules", checkFail, "skipped: no valid cm.mod"},
+		}
+	}
+	results := []checkResult{{"cm.mod", checkOK, fmt.Sprintf("%s (module %q)", filepath.Join(root, "cm.mod"), module)}}
+
+	proj, err := project.Discover(root)
+	if err != nil {
+		return append(results, checkResult{"modules", checkFail, err.Error()})
+	}
+	return append(results, checkResult{"modules", checkOK, fmt.Sprintf("%d module(s), no cycles", len(proj.Modules))})
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/elijahmorgan/c_minus/internal/build"
+	"github.com/elijahmorgan/c_minus/internal/diag"
 	"github.com/elijahmorgan/c_minus/internal/project"
 )
 
@@ -19,7 +20,7 @@ func main() {
 
 func run() error {
 	if len(os.Args) < 2 {
-		return fmt.Errorf("usage: c_minus <command> [args...]\n\nCommands:\n  build    Build the project")
+		return fmt.Errorf("usage: c_minus <command> [args...]\n\nCommands:\n  build      Build the project\n  clean      Remove the files builds generated\n  doc        Print the API of a module from its doc comments\n  doctor     Check the toolchain and project\n  explain    Explain a diagnostic code\n  modules    List the modules, their files, and imports for the build tags\n  transpile  Print the C generated for one .cm file, or write the project's C with -o\n  vet        Report warnings about the sources without building")
 	}
 
 	cmd := os.Args[1]
@@ -27,23 +28,42 @@ func run() error {
 	switch cmd {
 	case "build":
 		return runBuild()
+	case "clean":
+		return runClean(os.Args[2:])
+	case "doc":
+		return runDoc(os.Args[2:])
+	case "doctor":
+		return runDoctor(os.Args[2:])
+	case "explain":
+		return runExplain(os.Args[2:])
+	case "modules":
+		return runModules(os.Args[2:])
+	case "transpile":
+		return runTranspile(os.Args[2:])
+	case "vet":
+		return runVet(os.Args[2:])
 	default:
 		return fmt.Errorf("unknown command: %s", cmd)
 	}
 }
 
 func runBuild() error {
-	// Parse flags
-	opts := build.Options{
-		Jobs:       runtime.GOMAXPROCS(0),
-		OutputPath: "",
+	// Flags are applied on top of the project's cm.build
+	cfg, err := loadBuildConfig()
+	if err != nil {
+		return err
+	}
+	opts := cfg.Options
+	if opts.Jobs == 0 {
+		opts.Jobs = runtime.GOMAXPROCS(0)
 	}
 
 	// Build context for build tags
-	var customTags []string
-	release := false
+	customTags := cfg.Tags
+	release := cfg.Release
 
 	// Parse flags from remaining args
+	listOnly := false
 	args := os.Args[2:]
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
@@ -76,17 +96,115 @@ func runBuild() error {
 			i++
 		case "--release":
 			release = true
+		case "--list-modules":
+			listOnly = true
+		case "--profile":
+			opts.Profile = build.NewProfile()
+		case "--pch":
+			opts.PCH = true
+		case "-Werror":
+			opts.Werror = true
+		case "--self-contained":
+			opts.SelfContained = true
+		case "--unity":
+			opts.Unity = true
+		case "--depfiles":
+			opts.Depfiles = true
+		case "--harden":
+			opts.Harden = true
+		case "--split-dwarf":
+			opts.SplitDWARF = true
+		case "--checks":
+			opts.Checks = true
+		case "--unused":
+			opts.Unused = true
+		case "--no-unused-imports":
+			opts.NoImports = true
+		case "--trace-includes":
+			opts.TraceIncludes = true
+		case "--mirror-objects":
+			opts.MirrorObjects = true
+		case "--group-errors":
+			opts.GroupErrors = true
+		case "-target-name":
+			if i+1 >= len(args) {
+				return fmt.Errorf("-target-name requires an argument")
+			}
+			opts.Target = args[i+1]
+			i++
+		case "--mangling":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--mangling requires an argument")
+			}
+			opts.Mangling = args[i+1]
+			i++
+		case "-D":
+			if i+1 >= len(args) {
+				return fmt.Errorf("-D requires an argument")
+			}
+			def, err := build.ParseDefine(args[i+1])
+			if err != nil {
+				return err
+			}
+			opts.Defines = append(opts.Defines, def)
+			i++
+		case "-cc":
+			if i+1 >= len(args) {
+				return fmt.Errorf("-cc requires an argument")
+			}
+			opts.CC = args[i+1]
+			i++
+		case "-linker":
+			if i+1 >= len(args) {
+				return fmt.Errorf("-linker requires an argument")
+			}
+			opts.Linker = args[i+1]
+			i++
+		case "-std":
+			if i+1 >= len(args) {
+				return fmt.Errorf("-std requires an argument")
+			}
+			opts.CStandard = args[i+1]
+			i++
+		case "-sanitize":
+			if i+1 >= len(args) {
+				return fmt.Errorf("-sanitize requires an argument")
+			}
+			opts.Sanitize = args[i+1]
+			i++
+		default:
+			// Accept the attached forms -DNAME[=VALUE], -std=STD and -sanitize=LIST as gcc does
+			if std, ok := strings.CutPrefix(args[i], "-std="); ok {
+				opts.CStandard = std
+			} else if list, ok := strings.CutPrefix(args[i], "-sanitize="); ok {
+				opts.Sanitize = list
+			} else if strings.HasPrefix(args[i], "-D") {
+				def, err := build.ParseDefine(strings.TrimPrefix(args[i], "-D"))
+				if err != nil {
+					return err
+				}
+				opts.Defines = append(opts.Defines, def)
+			}
 		}
 	}
 
 	// Create build context
 	ctx := project.NewBuildContext(customTags, release)
 
+	// Print the timing breakdown once the build finishes, even on failure
+	defer opts.Profile.Write(os.Stderr)
+
 	// Discover project from current directory with build context
+	stopDiscovery := opts.Profile.Track(build.PhaseDiscovery, "")
 	proj, err := project.DiscoverWithContext(".", ctx)
+	stopDiscovery()
 	if err != nil {
 		return fmt.Errorf("project discovery failed: %w", err)
 	}
+	if listOnly {
+		listModules(os.Stdout, proj)
+		return nil
+	}
 
 	// Build the project
 	if err := build.Build(proj, opts); err != nil {
@@ -96,3 +214,41 @@ func runBuild() error {
 	fmt.Println("Build succeeded")
 	return nil
 }
+
+// loadBuildConfig reads cm.build from the project containing the current
+// directory. Outside a project it returns an empty configuration and leaves
+// reporting the missing cm.mod to project discovery.
+func loadBuildConfig() (*build.Config, error) {
+	root, _, err := project.FindRoot(".")
+	if err != nil {
+		return &build.Config{}, nil
+	}
+	return build.LoadConfig(root)
+}
+
+// runExplain prints the explanation for each code or rule name in args,
+// or lists every code when args is empty
+func runExplain(args []string) error {
+	if len(args) == 0 {
+		entries := diag.All()
+		width := 0
+		for _, e := range entries {
+			width = max(width, len(e.Name))
+		}
+		for _, e := range entries {
+			fmt.Printf("%s  %-*s %s\n", e.Code, width, e.Name, e.Summary)
+		}
+		return nil
+	}
+	for i, key := range args {
+		e, ok := diag.Lookup(key)
+		if !ok {
+			return fmt.Errorf("unknown diagnostic %q (run c_minus explain to list codes)", key)
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Print(e.String())
+	}
+	return nil
+}
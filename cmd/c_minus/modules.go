@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/elijahmorgan/c_minus/internal/project"
+)
+
+// runModules prints the modules discovered with the build context the
+// flags and cm.build select, to check tag filtering and file grouping
+func runModules(args []string) error {
+	cfg, err := loadBuildConfig()
+	if err != nil {
+		return err
+	}
+	customTags := cfg.Tags
+	release := cfg.Release
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-tags":
+			if i+1 >= len(args) {
+				return fmt.Errorf("-tags requires an argument")
+			}
+			for _, tag := range strings.Split(args[i+1], ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					customTags = append(customTags, tag)
+				}
+			}
+			i++
+		case "--release":
+			release = true
+		default:
+			return fmt.Errorf("usage: c_minus modules [-tags tag,...] [--release]")
+		}
+	}
+
+	proj, err := project.DiscoverWithContext(".", project.NewBuildContext(customTags, release))
+	if err != nil {
+		return fmt.Errorf("project discovery failed: %w", err)
+	}
+	listModules(os.Stdout, proj)
+	return nil
+}
+
+// listModules writes each module's import path and directory, then its files
+// and imports. Paths inside the project are relative to its root.
+func listModules(w io.Writer, proj *project.Project) {
+	rel := func(path string) string {
+		if r, err := filepath.Rel(proj.RootPath, path); err == nil && !strings.HasPrefix(r, "..") {
+			return r
+		}
+		return path
+	}
+
+	importPaths := make([]string, 0, len(proj.Modules))
+	for importPath := range proj.Modules {
+		importPaths = append(importPaths, importPath)
+	}
+	sort.Strings(importPaths)
+
+	for _, importPath := range importPaths {
+		mod := proj.Modules[importPath]
+		external := ""
+		if mod.External {
+			external = " (required)"
+		}
+		fmt.Fprintf(w, "%s  %s%s\n", importPath, rel(mod.DirPath), external)
+
+		files := make([]string, len(mod.Files))
+		for i, f := range mod.Files {
+			files[i] = filepath.Base(f)
+		}
+		sort.Strings(files)
+		fmt.Fprintf(w, "    files:   %s\n", strings.Join(files, " "))
+
+		imports := append([]string{}, mod.Imports...)
+		sort.Strings(imports)
+		if len(imports) > 0 {
+			fmt.Fprintf(w, "    imports: %s\n", strings.Join(imports, " "))
+		}
+	}
+}
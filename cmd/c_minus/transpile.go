@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/elijahmorgan/c_minus/internal/build"
+	"github.com/elijahmorgan/c_minus/internal/parser"
+	"github.com/elijahmorgan/c_minus/internal/project"
+)
+
+// runTranspile generates C for a single .cm file, without project discovery,
+// and prints the generated files to stdout. A file argument of "-" reads the
+// source from stdin; --path then gives its logical name. With -o it instead
+// writes the C of the whole project to a directory.
+func runTranspile(args []string) error {
+	for _, arg := range args {
+		if arg == "-o" {
+			return runTranspileProject(args)
+		}
+	}
+
+	usage := fmt.Errorf("usage: c_minus transpile [--path name.cm] [--mangling scheme] <file.cm | ->\n       c_minus transpile -o dir [--mirror-objects] [flags]")
+	var input, logicalPath, mangling string
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--path":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--path requires an argument")
+			}
+			logicalPath = args[i+1]
+			i++
+		case args[i] == "--mangling":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--mangling requires an argument")
+			}
+			mangling = args[i+1]
+			i++
+		case input == "":
+			input = args[i]
+		default:
+			return usage
+		}
+	}
+	if input == "" {
+		return usage
+	}
+
+	name := input
+	if input == "-" {
+		name = logicalPath
+		if name == "" {
+			name = "stdin.cm"
+		}
+	} else if logicalPath != "" {
+		return fmt.Errorf("--path is only used when reading from stdin")
+	}
+	cmPath, err := filepath.Abs(name)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	var file *parser.File
+	if input == "-" {
+		source, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("failed to read stdin: %w", err)
+		}
+		file, err = parser.ParseSource(string(source), cmPath)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+	} else if file, err = parser.ParseFile(cmPath); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	if file.Module == nil {
+		return fmt.Errorf("%s has no module declaration", name)
+	}
+
+	buildDir, err := os.MkdirTemp("", "c_minus_transpile")
+	if err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	defer os.RemoveAll(buildDir)
+
+	mod := &project.ModuleInfo{ImportPath: file.Module.Path, DirPath: filepath.Dir(cmPath), Files: []string{cmPath}}
+	// Inside a project, the imported modules tell enum members from fields,
+	// and the project's mangling names the symbols as a build would
+	imported := build.ImportedFiles(filepath.Dir(cmPath), file)
+	n, err := build.FileNaming(filepath.Dir(cmPath), mangling)
+	if err != nil {
+		return err
+	}
+	if err := build.TranspileFile(file, mod, imported, buildDir, n); err != nil {
+		return err
+	}
+
+	outputs := []string{
+		n.ModuleHeaderPath(buildDir, mod.ImportPath),
+		n.ModuleInternalHeaderPath(buildDir, mod.ImportPath),
+		n.ModuleCFilePath(buildDir, mod.ImportPath, filepath.Base(cmPath)),
+	}
+	for i, out := range outputs {
+		content, err := os.ReadFile(out)
+		if err != nil {
+			return fmt.Errorf("failed to read generated %s: %w", filepath.Base(out), err)
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("// ==> %s <==\n%s", filepath.Base(out), content)
+	}
+	return nil
+}
+
+// runTranspileProject discovers the project in the current directory and
+// writes its generated C, with a compile_commands.json, to the -o directory
+func runTranspileProject(args []string) error {
+	cfg, err := loadBuildConfig()
+	if err != nil {
+		return err
+	}
+	// Unity builds only change how the C is compiled
+	opts := cfg.Options
+	opts.Unity = false
+	var outDir string
+	customTags := cfg.Tags
+	release := cfg.Release
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-o":
+			if i+1 >= len(args) {
+				return fmt.Errorf("-o requires an argument")
+			}
+			outDir = args[i+1]
+			i++
+		case "-tags":
+			if i+1 >= len(args) {
+				return fmt.Errorf("-tags requires an argument")
+			}
+			for _, tag := range strings.Split(args[i+1], ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					customTags = append(customTags, tag)
+				}
+			}
+			i++
+		case "--release":
+			release = true
+		case "--mirror-objects":
+			opts.MirrorObjects = true
+		case "--self-contained":
+			opts.SelfContained = true
+		case "--mangling":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--mangling requires an argument")
+			}
+			opts.Mangling = args[i+1]
+			i++
+		case "-cc":
+			if i+1 >= len(args) {
+				return fmt.Errorf("-cc requires an argument")
+			}
+			opts.CC = args[i+1]
+			i++
+		default:
+			if std, ok := strings.CutPrefix(args[i], "-std="); ok {
+				opts.CStandard = std
+			} else if strings.HasPrefix(args[i], "-D") && len(args[i]) > 2 {
+				def, err := build.ParseDefine(strings.TrimPrefix(args[i], "-D"))
+				if err != nil {
+					return err
+				}
+				opts.Defines = append(opts.Defines, def)
+			} else {
+				return fmt.Errorf("unknown transpile flag %s", args[i])
+			}
+		}
+	}
+
+	proj, err := project.DiscoverWithContext(".", project.NewBuildContext(customTags, release))
+	if err != nil {
+		return fmt.Errorf("project discovery failed: %w", err)
+	}
+	if err := build.Transpile(proj, outDir, opts); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote generated C to %s\n", outDir)
+	return nil
+}
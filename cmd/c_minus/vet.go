@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/elijahmorgan/c_minus/internal/build"
+	"github.com/elijahmorgan/c_minus/internal/check"
+	"github.com/elijahmorgan/c_minus/internal/project"
+)
+
+// runVet reports warnings about the project's sources without building it.
+// It runs the passes a build runs, selected by the same flags and cm.build
+// keys, plus style checks that only vet offers. Any warning makes the
+// command fail.
+func runVet(args []string) error {
+	cfg, err := loadBuildConfig()
+	if err != nil {
+		return err
+	}
+	opts := check.Options{Heuristics: cfg.Options.Checks, Unused: cfg.Options.Unused, NoImports: cfg.Options.NoImports}
+	customTags := cfg.Tags
+	release := cfg.Release
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--checks":
+			opts.Heuristics = true
+		case "--unused":
+			opts.Unused = true
+		case "--no-unused-imports":
+			opts.NoImports = true
+		case "--const-params":
+			opts.ConstParams = true
+		case "-tags":
+			if i+1 >= len(args) {
+				return fmt.Errorf("-tags requires an argument")
+			}
+			for _, tag := range strings.Split(args[i+1], ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					customTags = append(customTags, tag)
+				}
+			}
+			i++
+		case "--release":
+			release = true
+		default:
+			return fmt.Errorf("usage: c_minus vet [--checks] [--unused] [--no-unused-imports] [--const-params] [-tags tag,...] [--release]")
+		}
+	}
+
+	proj, err := project.DiscoverWithContext(".", project.NewBuildContext(customTags, release))
+	if err != nil {
+		return fmt.Errorf("project discovery failed: %w", err)
+	}
+	warnings, err := build.Vet(proj, opts, os.Stderr)
+	if err != nil {
+		return err
+	}
+	if warnings > 0 {
+		return fmt.Errorf("%d warning(s)", warnings)
+	}
+	return nil
+}
@@ -1,16 +1,24 @@
 package build
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/elijahmorgan/c_minus/internal/check"
 	"github.com/elijahmorgan/c_minus/internal/codegen"
+	"github.com/elijahmorgan/c_minus/internal/diag"
+	"github.com/elijahmorgan/c_minus/internal/manifest"
 	"github.com/elijahmorgan/c_minus/internal/parser"
 	"github.com/elijahmorgan/c_minus/internal/paths"
 	"github.com/elijahmorgan/c_minus/internal/project"
@@ -18,8 +26,101 @@ import (
 
 // Options contains build configuration
 type Options struct {
-	Jobs       int    // Number of parallel compile jobs
-	OutputPath string // Output binary path (empty = default)
+	Jobs          int       // Number of parallel compile jobs
+	OutputPath    string    // Output binary path (empty = default)
+	Profile       *Profile  // Records per-phase timings when non-nil
+	Defines       []string  // Macro definitions ("NAME" or "NAME=VALUE") passed as -D to every compile
+	PCH           bool      // Precompile each module's internal header and include it in the module's compiles
+	Werror        bool      // Fail the build if any analysis warning is reported
+	SelfContained bool      // Inline private declarations into each .c instead of writing _internal.h
+	SplitDWARF    bool      // Compile with -gsplit-dwarf; debug info goes to .dwo files beside the objects
+	Checks        bool      // Also run heuristic analysis passes (undefined identifiers)
+	Unused        bool      // Report private declarations never used in their module
+	NoImports     bool      // Don't report imports whose prefix is never used
+	Mangling      string    // Mangling scheme (paths.Mangling*); empty = cm.mod setting, else underscore
+	CC            string    // C compiler command (empty = $CC, else gcc)
+	Linker        string    // Command that links executables (empty = $LD, else the C compiler)
+	CStandard     string    // C standard passed to gcc as -std= (empty = DefaultCStandard)
+	TraceIncludes bool      // Print the includes of each generated .c file and why each is there
+	MirrorObjects bool      // Place generated .c files and objects under .c_minus/obj/<module path>/
+	GroupErrors   bool      // Show only the first compiler diagnostic per source line and severity
+	Unity         bool      // Compile each module as one translation unit that includes all its .c files
+	Depfiles      bool      // Write a gcc depfile per object and a combined .c_minus/deps.d for make and ninja
+	Sanitize      string    // Comma-separated sanitizers passed as -fsanitize= to compile and link (e.g. "address,undefined")
+	Harden        bool      // Compile with stack protection, _FORTIFY_SOURCE, and -fPIE, and link a position-independent executable
+	Target        string    // Build only the cm.mod target with this name (empty = all targets)
+	Output        io.Writer // Receives compiler output and warnings (nil = stdout/stderr)
+
+	manifest *manifest.Manifest // Records the files the build writes, for clean
+	hashes   *objectHashes      // What each object was last compiled from
+}
+
+// DefaultCStandard is the C standard used when Options.CStandard is empty
+const DefaultCStandard = "gnu11"
+
+// cStandard returns the value passed to gcc as -std=
+func (o Options) cStandard() string {
+	if o.CStandard != "" {
+		return o.CStandard
+	}
+	return DefaultCStandard
+}
+
+// Compiler returns the C compiler command used to compile and link: CC
+// (the -cc flag or cm.build's cc), else $CC, else gcc. As with make, it may
+// carry a launcher or arguments ("ccache gcc"); commandLine splits it.
+func (o Options) Compiler() string {
+	if o.CC != "" {
+		return o.CC
+	}
+	if cc := strings.TrimSpace(os.Getenv("CC")); cc != "" {
+		return cc
+	}
+	return "gcc"
+}
+
+// CompilerCommand returns the program and arguments that run the C compiler
+// with args
+func (o Options) CompilerCommand(args ...string) []string {
+	return commandLine(o.Compiler(), args...)
+}
+
+// commandLine splits a compiler or linker command into the program and its
+// leading arguments, followed by args
+func commandLine(command string, args ...string) []string {
+	return append(strings.Fields(command), args...)
+}
+
+// naming returns how generated names and files are laid out for this build
+func (o Options) naming() paths.Naming {
+	return paths.Naming{Mangling: o.Mangling, MirrorObjects: o.MirrorObjects}
+}
+
+// linker returns the command used to link executables
+func (o Options) linker() string {
+	if o.Linker != "" {
+		return o.Linker
+	}
+	if ld := strings.TrimSpace(os.Getenv("LD")); ld != "" {
+		return ld
+	}
+	return o.Compiler()
+}
+
+// stdout returns where tool output goes
+func (o Options) stdout() io.Writer {
+	if o.Output != nil {
+		return o.Output
+	}
+	return os.Stdout
+}
+
+// stderr returns where diagnostics go
+func (o Options) stderr() io.Writer {
+	if o.Output != nil {
+		return o.Output
+	}
+	return os.Stderr
 }
 
 // FileFlags stores per-file compiler flags
@@ -29,72 +130,417 @@ type FileFlags struct {
 }
 
 // Build orchestrates the entire build process
-func Build(proj *project.Project, opts Options) error {
+func Build(proj *project.Project, opts Options) (err error) {
+	if opts.PCH && opts.SelfContained {
+		return fmt.Errorf("--pch precompiles the internal header, which --self-contained does not generate")
+	}
+	if opts.Unity && opts.SelfContained {
+		return fmt.Errorf("--unity merges a module's .c files, which --self-contained gives duplicate private declarations")
+	}
+	// The command line overrides the scheme chosen in cm.mod
+	if opts.Mangling == "" {
+		opts.Mangling = proj.Mangling
+	}
+	if err := paths.CheckMangling(opts.Mangling); err != nil {
+		return err
+	}
+
+	targets, err := selectTargets(proj, opts)
+	if err != nil {
+		return err
+	}
+	if err := checkImports(proj); err != nil {
+		return err
+	}
+	if err := checkTools(targets, opts); err != nil {
+		return err
+	}
+
 	// Create .c_minus directory for intermediate files
 	buildDir := filepath.Join(proj.RootPath, ".c_minus")
 	if err := os.MkdirAll(buildDir, 0755); err != nil {
 		return fmt.Errorf("failed to create .c_minus directory: %w", err)
 	}
 
+	// Record what this build writes, even if it fails part way
+	m, err := manifest.Load(proj.RootPath, buildDir)
+	if err != nil {
+		return err
+	}
+	opts.manifest = m
+	opts.hashes = loadObjectHashes(buildDir)
+	m.Add(opts.hashes.path)
+	defer func() {
+		if saveErr := opts.hashes.save(); err == nil {
+			err = saveErr
+		}
+		if saveErr := m.Save(); err == nil {
+			err = saveErr
+		}
+	}()
+
 	// Transpile all modules and collect flags
-	fileFlags, err := transpileModules(proj, buildDir)
+	fileFlags, err := transpileModules(proj, buildDir, opts)
 	if err != nil {
 		return fmt.Errorf("transpilation failed: %w", err)
 	}
+	if opts.Unity {
+		if err := writeUnitySources(proj, buildDir, fileFlags, opts); err != nil {
+			return err
+		}
+	}
 
 	// Compile .c files to .o files (parallel)
-	if err := compileModules(proj, buildDir, opts.Jobs, fileFlags); err != nil {
+	if err := compileModules(proj, buildDir, opts, fileFlags); err != nil {
 		return fmt.Errorf("compilation failed: %w", err)
 	}
 
-	// Link into final binary at project root
-	outputPath := opts.OutputPath
-	if outputPath == "" {
-		// Default to project root with project name
-		outputPath = filepath.Join(proj.RootPath, filepath.Base(proj.RootPath))
+	if opts.Depfiles {
+		if err := writeDepfile(proj, buildDir, opts); err != nil {
+			return err
+		}
+	}
+
+	// Link each target from the shared objects
+	for _, t := range targets {
+		if err := buildTarget(proj, buildDir, t, opts, fileFlags); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// selectTargets returns the targets to build: the one named by opts.Target,
+// or every target in cm.mod. A project without targets builds one executable
+// of all modules, named after the project directory, or a static library
+// when it has no main module (only modules in subdirectories).
+func selectTargets(proj *project.Project, opts Options) ([]project.Target, error) {
+	targets := proj.Targets
+	if len(targets) == 0 {
+		if opts.Target != "" {
+			return nil, fmt.Errorf("no target %q: cm.mod declares no targets", opts.Target)
+		}
+		kind := project.TargetExecutable
+		if _, ok := proj.Modules["main"]; !ok {
+			kind = project.TargetLibrary
+		}
+		return []project.Target{{Name: filepath.Base(proj.RootPath), Kind: kind}}, nil
+	}
+
+	if opts.Target != "" {
+		for _, t := range targets {
+			if t.Name == opts.Target {
+				return []project.Target{t}, checkExecutableTargets(proj, []project.Target{t})
+			}
+		}
+		return nil, fmt.Errorf("no target %q in cm.mod", opts.Target)
 	}
 
-	// Collect all LDFLAGS
-	allLDFlags := collectLDFlags(fileFlags)
+	if opts.OutputPath != "" && len(targets) > 1 {
+		return nil, fmt.Errorf("-o needs a single target; select one with -target-name")
+	}
+	return targets, checkExecutableTargets(proj, targets)
+}
 
-	if err := linkBinary(proj, buildDir, outputPath, allLDFlags); err != nil {
+// checkExecutableTargets reports an executable target in a project without
+// a main module: only main's main() is left unmangled, so the link would fail
+// with an undefined reference to main.
+func checkExecutableTargets(proj *project.Project, targets []project.Target) error {
+	if _, ok := proj.Modules["main"]; ok {
+		return nil
+	}
+	for _, t := range targets {
+		if t.Kind == project.TargetExecutable {
+			return fmt.Errorf("target %s is an executable, but the project has no main module: add a .cm file with module \"main\" at the project root, or declare the target as lib", t.Name)
+		}
+	}
+	return nil
+}
+
+// buildTarget links an executable or archives a static library for t
+func buildTarget(proj *project.Project, buildDir string, t project.Target, opts Options, fileFlags map[string]*FileFlags) error {
+	oFiles, targetFlags, err := targetInputs(proj, buildDir, t, fileFlags, opts)
+	if err != nil {
+		return err
+	}
+
+	outputPath := targetOutputPath(proj, t, opts)
+	for _, o := range oFiles {
+		opts.manifest.Add(o)
+	}
+	opts.manifest.Add(outputPath)
+
+	// Only name the timing when cm.mod declares targets
+	name := ""
+	if len(proj.Targets) > 0 {
+		name = t.Name
+	}
+	stopLink := opts.Profile.Track(PhaseLink, name)
+	if t.Kind == project.TargetLibrary {
+		err = archiveLibrary(oFiles, outputPath, opts)
+	} else {
+		err = linkBinary(oFiles, outputPath, collectLDFlags(targetFlags), opts)
+	}
+	stopLink()
+	if err != nil {
 		return fmt.Errorf("linking failed: %w", err)
 	}
 
 	return nil
 }
 
+// checkTools reports a missing C compiler or linker, or a missing ar when a
+// library target is built, before any work is done. exec would otherwise fail
+// with a bare "executable file not found" after transpiling.
+func checkTools(targets []project.Target, opts Options) error {
+	cc := opts.Compiler()
+	if _, err := exec.LookPath(commandLine(cc)[0]); err != nil {
+		return fmt.Errorf("C compiler %q not found: install gcc or clang, or select a compiler with -cc or the CC environment variable", cc)
+	}
+	for _, t := range targets {
+		if t.Kind == project.TargetLibrary {
+			if _, err := exec.LookPath("ar"); err != nil {
+				return fmt.Errorf("ar not found: install binutils to build library target %s", t.Name)
+			}
+			break
+		}
+	}
+	for _, t := range targets {
+		if t.Kind != project.TargetLibrary {
+			if ld := opts.linker(); ld != cc {
+				if _, err := exec.LookPath(commandLine(ld)[0]); err != nil {
+					return fmt.Errorf("linker %q not found: select a linker with -linker or the LD environment variable", ld)
+				}
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// targetInputs returns the objects and per-file flags of t's modules only.
+// Modules excluded by build tags are absent from proj.Modules, so any objects
+// left in buildDir from an earlier build with other tags are never linked.
+func targetInputs(proj *project.Project, buildDir string, t project.Target, fileFlags map[string]*FileFlags, opts Options) ([]string, map[string]*FileFlags, error) {
+	mods, err := targetModules(proj, t.Root)
+	if err != nil {
+		return nil, nil, fmt.Errorf("target %s: %w", t.Name, err)
+	}
+
+	var oFiles []string
+	targetFlags := make(map[string]*FileFlags)
+	for _, mod := range mods {
+		for _, obj := range moduleObjects(mod, buildDir, opts) {
+			oFiles = append(oFiles, obj.o)
+			if flags, ok := fileFlags[obj.c]; ok {
+				targetFlags[obj.c] = flags
+			}
+		}
+	}
+	return oFiles, targetFlags, nil
+}
+
+// checkImports reports an import of a module that has no files in this
+// build, usually because build tags exclude all of them. Without it gcc
+// would compile against a header left from an earlier build and fail at link
+// time, or fail to find the header at all.
+func checkImports(proj *project.Project) error {
+	names := make([]string, 0, len(proj.Modules))
+	for name := range proj.Modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		mod := proj.Modules[name]
+		imports := append([]string(nil), mod.Imports...)
+		sort.Strings(imports)
+		for _, imp := range imports {
+			if _, ok := proj.Modules[imp]; !ok {
+				return fmt.Errorf("module %s imports %q, which has no files in this build (missing, or excluded by build tags)", name, imp)
+			}
+		}
+	}
+	return nil
+}
+
+// targetOutputPath returns where t is written: -o when given, otherwise the
+// project root, named after the target
+func targetOutputPath(proj *project.Project, t project.Target, opts Options) string {
+	if opts.OutputPath != "" {
+		return opts.OutputPath
+	}
+	if t.Kind == project.TargetLibrary {
+		return filepath.Join(proj.RootPath, "lib"+t.Name+".a")
+	}
+	return filepath.Join(proj.RootPath, t.Name)
+}
+
+// ExecutablePath returns the path of the first executable Build produces
+// with opts, for callers that run the program after building it
+func ExecutablePath(proj *project.Project, opts Options) (string, error) {
+	targets, err := selectTargets(proj, opts)
+	if err != nil {
+		return "", err
+	}
+	for _, t := range targets {
+		if t.Kind == project.TargetExecutable {
+			return targetOutputPath(proj, t, opts), nil
+		}
+	}
+	return "", fmt.Errorf("no executable target to run")
+}
+
+// targetModules returns root and the modules it imports, directly or
+// transitively, sorted by import path. An empty root selects every module.
+func targetModules(proj *project.Project, root string) ([]*project.ModuleInfo, error) {
+	var mods []*project.ModuleInfo
+	if root == "" {
+		for _, mod := range proj.Modules {
+			mods = append(mods, mod)
+		}
+	} else {
+		if _, ok := proj.Modules[root]; !ok {
+			return nil, fmt.Errorf("root module %q not found", root)
+		}
+		seen := map[string]bool{root: true}
+		queue := []string{root}
+		for len(queue) > 0 {
+			mod := proj.Modules[queue[0]]
+			queue = queue[1:]
+			mods = append(mods, mod)
+			for _, imp := range mod.Imports {
+				if _, ok := proj.Modules[imp]; ok && !seen[imp] {
+					seen[imp] = true
+					queue = append(queue, imp)
+				}
+			}
+		}
+	}
+
+	sort.Slice(mods, func(i, j int) bool { return mods[i].ImportPath < mods[j].ImportPath })
+	return mods, nil
+}
+
 // transpileModules converts all .cm files to .h/.c files and returns per-file flags
-func transpileModules(proj *project.Project, buildDir string) (map[string]*FileFlags, error) {
+func transpileModules(proj *project.Project, buildDir string, opts Options) (map[string]*FileFlags, error) {
 	fileFlags := make(map[string]*FileFlags)
-
+	pkgs := newPkgConfig()
+	profile := opts.Profile
+	warnings := 0
+
+	// Parse every module first so code generation can see imported declarations.
+	// Files are independent, so every parse error is collected and reported
+	// together instead of stopping at the first broken file.
+	modules := make([]*project.ModuleInfo, 0, len(proj.Modules))
 	for _, mod := range proj.Modules {
-		// Parse all files in this module
+		modules = append(modules, mod)
+	}
+	sort.Slice(modules, func(i, j int) bool { return modules[i].ImportPath < modules[j].ImportPath })
+
+	// A module's transpile time is its parse plus its generation, recorded
+	// once generation finishes
+	parseTimes := make(map[string]time.Duration, len(proj.Modules))
+	parsed := make(map[string][]*parser.File, len(proj.Modules))
+	var parseErrs []error
+	for _, mod := range modules {
+		start := time.Now()
 		parsedFiles := make([]*parser.File, 0, len(mod.Files))
 		for _, filePath := range mod.Files {
 			file, err := parser.ParseFile(filePath)
 			if err != nil {
-				return nil, fmt.Errorf("failed to parse %s: %w", filePath, err)
+				parseErrs = append(parseErrs, fmt.Errorf("failed to parse %s: %w", filePath, err))
+				continue
 			}
 			parsedFiles = append(parsedFiles, file)
 
 			// Extract and filter CGo flags for this file
-			flags := extractFileFlags(file.CGoFlags)
-			cFilePath := paths.ModuleCFilePath(buildDir, mod.ImportPath, filepath.Base(filePath))
+			flags, err := extractFileFlags(file.CGoFlags, pkgs)
+			if err != nil {
+				parseErrs = append(parseErrs, fmt.Errorf("%s: %w", filePath, err))
+				continue
+			}
+			cFilePath := opts.naming().ModuleCFilePath(buildDir, mod.ImportPath, filepath.Base(filePath))
 			fileFlags[cFilePath] = flags
 		}
+		parsed[mod.ImportPath] = parsedFiles
+		parseTimes[mod.ImportPath] = time.Since(start)
+	}
+	if len(parseErrs) > 0 {
+		return nil, errors.Join(parseErrs...)
+	}
+
+	for _, mod := range modules {
+		parsedFiles := parsed[mod.ImportPath]
+		if err := checkDuplicateGlobals(mod, parsedFiles); err != nil {
+			return nil, err
+		}
+		if opts.Unity {
+			if err := checkUnityStatics(mod, parsedFiles); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, w := range check.Files(mod.Files, parsedFiles, check.Options{Heuristics: opts.Checks, Unused: opts.Unused, NoImports: opts.NoImports}) {
+			fmt.Fprintln(opts.stderr(), w)
+			warnings++
+		}
+	}
 
+	if opts.Werror && warnings > 0 {
+		return nil, fmt.Errorf("%d warning(s) treated as errors (-Werror)", warnings)
+	}
+
+	for _, mod := range proj.Modules {
+		start := time.Now()
 		// Generate code for this module
-		if err := codegen.GenerateModule(mod, parsedFiles, buildDir); err != nil {
+		genOpts := codegen.Options{Imported: parsed, Naming: opts.naming(), SelfContained: opts.SelfContained, C23: enablesC23(opts.cStandard()), Manifest: opts.manifest}
+		if opts.TraceIncludes {
+			genOpts.TraceIncludes = opts.stdout()
+		}
+		if err := codegen.GenerateModuleWithOptions(mod, parsed[mod.ImportPath], buildDir, genOpts); err != nil {
 			return nil, fmt.Errorf("failed to generate code for module %s: %w", mod.ImportPath, err)
 		}
+		profile.Record(PhaseTranspile, mod.ImportPath, parseTimes[mod.ImportPath]+time.Since(start))
 	}
 
 	return fileFlags, nil
 }
 
-// extractFileFlags extracts and filters CGo flags based on current platform
-func extractFileFlags(cgoFlags []*parser.CGoFlag) *FileFlags {
+// checkDuplicateGlobals reports non-static globals declared in more than one
+// file of a module. Both mangle to module_name, so gcc would only fail at link
+// time with no reference back to the .cm sources.
+// Static globals are file-local and never collide, and extern globals are
+// only declarations, which C allows to repeat.
+func checkDuplicateGlobals(mod *project.ModuleInfo, files []*parser.File) error {
+	type location struct {
+		path string
+		line int
+	}
+	seen := make(map[string]location)
+
+	for i, file := range files {
+		for _, decl := range file.Decls {
+			g := decl.Global
+			if g == nil || g.Static || g.Extern {
+				continue
+			}
+			loc := location{path: mod.Files[i], line: g.Line}
+			if first, ok := seen[g.Name]; ok {
+				return fmt.Errorf("duplicate global %q in module %s [%s]:\n  %s:%d: first declared here\n  %s:%d: declared again here",
+					g.Name, mod.ImportPath, diag.DuplicateGlobal, first.path, first.line, loc.path, loc.line)
+			}
+			seen[g.Name] = loc
+		}
+	}
+
+	return nil
+}
+
+// extractFileFlags extracts and filters CGo flags based on current platform.
+// pkg-config directives are expanded through pkgs.
+func extractFileFlags(cgoFlags []*parser.CGoFlag, pkgs *pkgConfig) (*FileFlags, error) {
 	flags := &FileFlags{
 		CFlags:  []string{},
 		LDFlags: []string{},
@@ -116,10 +562,19 @@ func extractFileFlags(cgoFlags []*parser.CGoFlag) *FileFlags {
 			flags.CFlags = append(flags.CFlags, flagParts...)
 		case "LDFLAGS":
 			flags.LDFlags = append(flags.LDFlags, flagParts...)
+		case "pkg-config":
+			for _, pkg := range flagParts {
+				cflags, libs, err := pkgs.flags(pkg)
+				if err != nil {
+					return nil, err
+				}
+				flags.CFlags = append(flags.CFlags, cflags...)
+				flags.LDFlags = append(flags.LDFlags, libs...)
+			}
 		}
 	}
 
-	return flags
+	return flags, nil
 }
 
 // parseFlags splits a flags string into individual flags, preserving quoted values
@@ -174,13 +629,16 @@ func collectLDFlags(fileFlags map[string]*FileFlags) []string {
 }
 
 // compileModules compiles all .c files to .o files in parallel
-func compileModules(proj *project.Project, buildDir string, jobs int, fileFlags map[string]*FileFlags) error {
-	sem := make(chan struct{}, jobs)
+func compileModules(proj *project.Project, buildDir string, opts Options, fileFlags map[string]*FileFlags) error {
+	// Jobs overlap, so the phase is timed as a whole as well as per file
+	defer opts.Profile.Track(PhaseCompile, "")()
+
+	sem := make(chan struct{}, opts.Jobs)
 	var wg sync.WaitGroup
 	errChan := make(chan error, len(proj.Modules))
 
 	for _, mod := range proj.Modules {
-		if !needsRecompile(mod, buildDir) {
+		if !needsRecompile(proj, mod, buildDir, opts, fileFlags) {
 			continue
 		}
 
@@ -191,7 +649,7 @@ func compileModules(proj *project.Project, buildDir string, jobs int, fileFlags
 			defer wg.Done()
 			defer func() { <-sem }()
 
-			if err := compileModule(m, buildDir, fileFlags); err != nil {
+			if err := compileModule(proj, m, buildDir, opts, fileFlags); err != nil {
 				errChan <- err
 			}
 		}(mod)
@@ -208,108 +666,339 @@ func compileModules(proj *project.Project, buildDir string, jobs int, fileFlags
 	return nil
 }
 
-// needsRecompile checks if module needs recompilation
-func needsRecompile(mod *project.ModuleInfo, buildDir string) bool {
-	// Check each .c file against its corresponding .o file
-	for _, srcFile := range mod.Files {
-		cFile := paths.ModuleCFilePath(buildDir, mod.ImportPath, filepath.Base(srcFile))
-		oFile := paths.ModuleOFilePath(buildDir, mod.ImportPath, filepath.Base(srcFile))
-
-		oInfo, err := os.Stat(oFile)
+// needsRecompile checks if module needs recompilation. An object older
+// than its inputs is only stale if the hash of its compile changed, since
+// code generation rewrites .c files even when their content is the same.
+func needsRecompile(proj *project.Project, mod *project.ModuleInfo, buildDir string, opts Options, fileFlags map[string]*FileFlags) bool {
+	// Check each object against the .c files it is built from
+	for _, obj := range moduleObjects(mod, buildDir, opts) {
+		oInfo, err := os.Stat(obj.o)
 		if err != nil {
 			// .o doesn't exist, need to compile
 			return true
 		}
+		if opts.Depfiles {
+			if _, err := os.Stat(obj.dep); err != nil {
+				// Built without --depfiles: compile again to write one
+				return true
+			}
+		}
 
-		cInfo, err := os.Stat(cFile)
-		if err != nil || cInfo.ModTime().After(oInfo.ModTime()) {
-			return true
+		for _, cFile := range obj.inputs {
+			cInfo, err := os.Stat(cFile)
+			if err != nil {
+				return true
+			}
+			if !cInfo.ModTime().After(oInfo.ModTime()) {
+				continue
+			}
+			hash, err := compileHash(proj, mod, obj, buildDir, opts.naming(), objectCompileArgs(mod, obj, buildDir, opts, fileFlags))
+			if err != nil || !opts.hashes.matches(obj.o, hash) {
+				return true
+			}
+			break
 		}
 	}
 
 	return false
 }
 
+// objectCompileArgs returns the compiler command and arguments for obj
+func objectCompileArgs(mod *project.ModuleInfo, obj objectFile, buildDir string, opts Options, fileFlags map[string]*FileFlags) []string {
+	args := opts.CompilerCommand(compileArgs(mod, obj.c, obj.o, buildDir, opts, fileFlags[obj.c])...)
+	if opts.Depfiles {
+		args = append(args, depfileArgs(obj)...)
+	}
+	return args
+}
+
 // compileModule compiles all .c files for a module
-// Each .c file is compiled to a .o file, which are collected for linking
-func compileModule(mod *project.ModuleInfo, buildDir string, fileFlags map[string]*FileFlags) error {
+// Each .c file is compiled to a .o file, which are collected for linking;
+// with --unity the module's unity file is compiled to a single .o
+func compileModule(proj *project.Project, mod *project.ModuleInfo, buildDir string, opts Options, fileFlags map[string]*FileFlags) error {
+	if opts.PCH {
+		if err := precompileHeader(proj, mod, buildDir, opts, fileFlags); err != nil {
+			return err
+		}
+	}
+
 	// Compile each .c file to its own .o file
-	for _, srcFile := range mod.Files {
-		cFile := paths.ModuleCFilePath(buildDir, mod.ImportPath, filepath.Base(srcFile))
-		oFile := paths.ModuleOFilePath(buildDir, mod.ImportPath, filepath.Base(srcFile))
+	for _, obj := range moduleObjects(mod, buildDir, opts) {
+		cFile, oFile := obj.c, obj.o
+
+		// A .dwo left from an earlier split-DWARF build would not match the new object
+		if !opts.SplitDWARF {
+			os.Remove(obj.dwo)
+		} else {
+			opts.manifest.Add(obj.dwo)
+		}
 
-		// Build gcc command for this single file
-		args := []string{"-c", cFile, "-o", oFile, "-I", buildDir}
+		args := objectCompileArgs(mod, obj, buildDir, opts, fileFlags)
+		if opts.Depfiles {
+			opts.manifest.Add(obj.dep)
+		}
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdout = opts.stdout()
+		cmd.Stderr = opts.stderr()
+		var diagOutput bytes.Buffer
+		if opts.GroupErrors {
+			cmd.Stderr = &diagOutput
+		}
 
-		// Add per-file CFLAGS if present
-		if flags, ok := fileFlags[cFile]; ok && len(flags.CFlags) > 0 {
-			args = append(args, flags.CFlags...)
+		stop := opts.Profile.Track(PhaseCompile, filepath.Base(cFile))
+		err := cmd.Run()
+		stop()
+		if opts.GroupErrors {
+			// Collapse the cascade that follows each mistake
+			for _, d := range diag.GroupCompilerDiags(diag.ParseCompilerOutput(diagOutput.String())) {
+				fmt.Fprint(opts.stderr(), d.String())
+			}
 		}
+		if err != nil {
+			return fmt.Errorf("%s failed for %s: %w", opts.Compiler(), cFile, err)
+		}
+		// Hashed after compiling, so the hash covers the depfile just written
+		if hash, err := compileHash(proj, mod, obj, buildDir, opts.naming(), args); err == nil {
+			opts.hashes.set(oFile, hash)
+		}
+	}
 
-		cmd := exec.Command("gcc", args...)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+	return nil
+}
 
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("gcc failed for %s: %w", cFile, err)
-		}
+// enablesC23 reports whether a -std value makes bool, true, false, and
+// nullptr keywords
+func enablesC23(std string) bool {
+	switch std {
+	case "c23", "c2x", "gnu23", "gnu2x":
+		return true
+	}
+	return false
+}
+
+// compileArgs builds the gcc arguments for compiling one generated .c file
+func compileArgs(mod *project.ModuleInfo, cFile, oFile, buildDir string, opts Options, flags *FileFlags) []string {
+	args := []string{"-c", cFile, "-o", oFile, "-I", buildDir, "-std=" + opts.cStandard()}
+
+	// Add command-line macro definitions
+	for _, def := range opts.Defines {
+		args = append(args, "-D"+def)
+	}
+
+	// Debug info is written to a .dwo next to the object (inside buildDir).
+	// -g is needed as well: newer gcc no longer implies it from -gsplit-dwarf.
+	if opts.SplitDWARF {
+		args = append(args, "-g", "-gsplit-dwarf")
+	}
+	args = append(args, sanitizeCompileArgs(opts)...)
+	args = append(args, hardenCompileArgs(opts)...)
+
+	// Force-include the internal header so gcc picks up its .gch.
+	// -Winvalid-pch reports a stale or mismatched .gch instead of silently
+	// falling back to parsing the header.
+	if opts.PCH {
+		args = append(args, "-include", opts.naming().ModuleInternalHeaderPath(buildDir, mod.ImportPath), "-Winvalid-pch")
+	}
+
+	// Add per-file CFLAGS if present
+	if flags != nil && len(flags.CFlags) > 0 {
+		args = append(args, flags.CFlags...)
+	}
+
+	return args
+}
+
+// precompileHeader builds the module's internal header into a .gch when the
+// hash of its compile changed. The .gch is built with the objects' #cgo
+// CFLAGS, since gcc rejects one built with different options; when the
+// module's files disagree on them, no .gch is built and each compile parses
+// the header.
+func precompileHeader(proj *project.Project, mod *project.ModuleInfo, buildDir string, opts Options, fileFlags map[string]*FileFlags) error {
+	header := opts.naming().ModuleInternalHeaderPath(buildDir, mod.ImportPath)
+	pch := opts.naming().ModulePCHPath(buildDir, mod.ImportPath)
+	flags, ok := pchFlags(mod, buildDir, opts, fileFlags)
+	if !ok {
+		os.Remove(pch)
+		return nil
+	}
+	opts.manifest.Add(pch)
+
+	args := opts.CompilerCommand(pchArgs(header, pch, buildDir, opts, flags)...)
+	hash, err := compileHash(proj, mod, objectFile{}, buildDir, opts.naming(), args)
+	if !needsPCH(pch, hash, err, opts.hashes) {
+		return nil
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = opts.stdout()
+	cmd.Stderr = opts.stderr()
+
+	stop := opts.Profile.Track(PhaseCompile, filepath.Base(pch))
+	err = cmd.Run()
+	stop()
+	if err != nil {
+		return fmt.Errorf("%s failed to precompile %s: %w", opts.Compiler(), header, err)
+	}
+	if hash != "" {
+		opts.hashes.set(pch, hash)
 	}
 
 	return nil
 }
 
-// linkBinary links all .o files into final executable
-func linkBinary(proj *project.Project, buildDir string, outputPath string, ldFlags []string) error {
+// pchFlags returns the #cgo flags every object of the module is compiled
+// with, or false if they differ between the module's files
+func pchFlags(mod *project.ModuleInfo, buildDir string, opts Options, fileFlags map[string]*FileFlags) (*FileFlags, bool) {
+	var flags *FileFlags
+	for i, obj := range moduleObjects(mod, buildDir, opts) {
+		f := fileFlags[obj.c]
+		if i == 0 {
+			flags = f
+			continue
+		}
+		var a, b []string
+		if flags != nil {
+			a = flags.CFlags
+		}
+		if f != nil {
+			b = f.CFlags
+		}
+		if !slices.Equal(a, b) {
+			return nil, false
+		}
+	}
+	return flags, true
+}
+
+// pchArgs builds the gcc arguments for precompiling a header.
+// Macro definitions and flags must match the compiles that use the .gch.
+func pchArgs(header, pch, buildDir string, opts Options, flags *FileFlags) []string {
+	args := []string{"-x", "c-header", header, "-o", pch, "-I", buildDir, "-std=" + opts.cStandard()}
+	for _, def := range opts.Defines {
+		args = append(args, "-D"+def)
+	}
+	// gcc rejects a .gch built without debug info in a -g compile
+	if opts.SplitDWARF {
+		args = append(args, "-g", "-gsplit-dwarf")
+	}
+	args = append(args, sanitizeCompileArgs(opts)...)
+	args = append(args, hardenCompileArgs(opts)...)
+	if flags != nil {
+		args = append(args, flags.CFlags...)
+	}
+	return args
+}
+
+// sanitizeCompileArgs returns the compile flags for opts.Sanitize. Sanitizer
+// reports need debug info and frame pointers to show useful stack traces.
+func sanitizeCompileArgs(opts Options) []string {
+	if opts.Sanitize == "" {
+		return nil
+	}
+	args := []string{"-fsanitize=" + opts.Sanitize, "-fno-omit-frame-pointer"}
+	if !opts.SplitDWARF {
+		args = append(args, "-g")
+	}
+	return args
+}
+
+// hardenCompileArgs returns the compile flags for opts.Harden. A
+// _FORTIFY_SOURCE the compiler defines by default is replaced rather than
+// redefined; it only takes effect with optimization (-O in #cgo CFLAGS).
+func hardenCompileArgs(opts Options) []string {
+	if !opts.Harden {
+		return nil
+	}
+	return []string{"-fstack-protector-strong", "-U_FORTIFY_SOURCE", "-D_FORTIFY_SOURCE=2", "-fPIE"}
+}
+
+// needsPCH checks if a precompiled header is missing or was built from a
+// different compile: other flags, or a change to the internal header or the
+// headers it includes. Code generation rewrites the headers every build, so
+// their modification times say nothing. A hash that could not be computed
+// (hashErr) always rebuilds.
+func needsPCH(pch, hash string, hashErr error, hashes *objectHashes) bool {
+	if _, err := os.Stat(pch); err != nil {
+		return true
+	}
+	return hashErr != nil || !hashes.matches(pch, hash)
+}
+
+// linkBinary links the given .o files into an executable
+func linkBinary(oFiles []string, outputPath string, ldFlags []string, opts Options) error {
 	// Check if relinking is needed
-	if !needsRelink(proj, buildDir, outputPath) {
+	if !needsRelink(oFiles, outputPath) {
 		return nil
 	}
 
-	// Collect all .o files from all source files in all modules
-	oFiles := []string{}
-	for _, mod := range proj.Modules {
-		for _, srcFile := range mod.Files {
-			oFile := paths.ModuleOFilePath(buildDir, mod.ImportPath, filepath.Base(srcFile))
-			oFiles = append(oFiles, oFile)
-		}
+	args := commandLine(opts.linker(), linkArgs(oFiles, outputPath, ldFlags, opts)...)
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = opts.stdout()
+	cmd.Stderr = opts.stderr()
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w", opts.linker(), err)
 	}
 
-	// Build gcc command
-	args := oFiles
+	return nil
+}
+
+// linkArgs builds the gcc arguments for linking an executable
+func linkArgs(oFiles []string, outputPath string, ldFlags []string, opts Options) []string {
+	args := append([]string{}, oFiles...)
 	args = append(args, "-o", outputPath)
 
+	// gcc links the sanitizer runtimes when -fsanitize is given at link time
+	if opts.Sanitize != "" {
+		args = append(args, "-fsanitize="+opts.Sanitize)
+	}
+	// Objects compiled with -fPIE link into a position-independent executable
+	if opts.Harden {
+		args = append(args, "-pie")
+	}
+
 	// Add aggregated LDFLAGS
 	if len(ldFlags) > 0 {
 		args = append(args, ldFlags...)
 	}
+	return args
+}
+
+// archiveLibrary bundles the given .o files into a static library
+func archiveLibrary(oFiles []string, outputPath string, opts Options) error {
+	if !needsRelink(oFiles, outputPath) {
+		return nil
+	}
 
-	cmd := exec.Command("gcc", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	// ar only adds and replaces members, so start fresh to drop removed files
+	if err := os.Remove(outputPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove old %s: %w", outputPath, err)
+	}
+
+	cmd := exec.Command("ar", append([]string{"rcs", outputPath}, oFiles...)...)
+	cmd.Stdout = opts.stdout()
+	cmd.Stderr = opts.stderr()
 
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("linking failed: %w", err)
+		return fmt.Errorf("archiving failed: %w", err)
 	}
 
 	return nil
 }
 
 // needsRelink checks if relinking is necessary
-func needsRelink(proj *project.Project, buildDir string, outputPath string) bool {
+func needsRelink(oFiles []string, outputPath string) bool {
 	binInfo, err := os.Stat(outputPath)
 	if err != nil {
-		// Binary doesn't exist, need to link
+		// Output doesn't exist, need to link
 		return true
 	}
 
-	// Check if any .o file is newer than binary
-	for _, mod := range proj.Modules {
-		for _, srcFile := range mod.Files {
-			oFile := paths.ModuleOFilePath(buildDir, mod.ImportPath, filepath.Base(srcFile))
-			oInfo, err := os.Stat(oFile)
-			if err != nil || oInfo.ModTime().After(binInfo.ModTime()) {
-				return true
-			}
+	// Check if any .o file is newer than the output
+	for _, oFile := range oFiles {
+		oInfo, err := os.Stat(oFile)
+		if err != nil || oInfo.ModTime().After(binInfo.ModTime()) {
+			return true
 		}
 	}
 
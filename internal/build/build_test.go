@@ -0,0 +1,519 @@
+package build
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elijahmorgan/c_minus/internal/parser"
+	"github.com/elijahmorgan/c_minus/internal/paths"
+	"github.com/elijahmorgan/c_minus/internal/project"
+)
+
+func TestCompileArgsPCH(t *testing.T) {
+	mod := &project.ModuleInfo{ImportPath: "fileio/ticketio"}
+	buildDir := "/build"
+	flags := &FileFlags{CFlags: []string{"-O2"}}
+
+	args := strings.Join(compileArgs(mod, "/build/a.c", "/build/a.o", buildDir, Options{Defines: []string{"X=1"}}, flags), " ")
+	if strings.Contains(args, "-include") {
+		t.Errorf("unexpected -include without PCH: %s", args)
+	}
+
+	args = strings.Join(compileArgs(mod, "/build/a.c", "/build/a.o", buildDir, Options{PCH: true, Defines: []string{"X=1"}}, flags), " ")
+	want := "-c /build/a.c -o /build/a.o -I /build -std=gnu11 -DX=1 -include " + filepath.Join(buildDir, "fileio_ticketio_internal.h") + " -Winvalid-pch -O2"
+	if args != want {
+		t.Errorf("compileArgs = %q, expected %q", args, want)
+	}
+
+	pch := strings.Join(pchArgs("/build/m_internal.h", "/build/m_internal.h.gch", buildDir, Options{Defines: []string{"X=1"}}, flags), " ")
+	if pch != "-x c-header /build/m_internal.h -o /build/m_internal.h.gch -I /build -std=gnu11 -DX=1 -O2" {
+		t.Errorf("pchArgs = %q", pch)
+	}
+}
+
+func TestCompileArgsCStandard(t *testing.T) {
+	mod := &project.ModuleInfo{ImportPath: "math"}
+
+	for _, tt := range []struct {
+		std  string
+		want string
+	}{
+		{"", "-std=gnu11"},
+		{"c99", "-std=c99"},
+		{"c17", "-std=c17"},
+	} {
+		opts := Options{CStandard: tt.std}
+		args := compileArgs(mod, "/build/a.c", "/build/a.o", "/build", opts, nil)
+		found := 0
+		for _, arg := range args {
+			if strings.HasPrefix(arg, "-std=") {
+				found++
+				if arg != tt.want {
+					t.Errorf("CStandard %q: compileArgs has %s, expected %s", tt.std, arg, tt.want)
+				}
+			}
+		}
+		if found != 1 {
+			t.Errorf("CStandard %q: expected one -std flag, got %v", tt.std, args)
+		}
+		pch := strings.Join(pchArgs("/build/m_internal.h", "/build/m_internal.h.gch", "/build", opts, nil), " ")
+		if !strings.Contains(pch, " "+tt.want) {
+			t.Errorf("CStandard %q: pchArgs = %q, expected %s", tt.std, pch, tt.want)
+		}
+	}
+}
+
+func TestCompileArgsSplitDWARF(t *testing.T) {
+	mod := &project.ModuleInfo{ImportPath: "math"}
+
+	args := strings.Join(compileArgs(mod, "/build/a.c", "/build/a.o", "/build", Options{SplitDWARF: true}, nil), " ")
+	if args != "-c /build/a.c -o /build/a.o -I /build -std=gnu11 -g -gsplit-dwarf" {
+		t.Errorf("compileArgs = %q", args)
+	}
+}
+
+func TestDepfileArgs(t *testing.T) {
+	mod := &project.ModuleInfo{ImportPath: "math", Files: []string{"/src/math/vec.cm"}}
+
+	objs := moduleObjects(mod, "/build", Options{})
+	if len(objs) != 1 || objs[0].dep != "/build/math_vec.d" {
+		t.Fatalf("expected the depfile beside the object, got %+v", objs)
+	}
+	if args := strings.Join(depfileArgs(objs[0]), " "); args != "-MMD -MF /build/math_vec.d -MT /build/math_vec.o" {
+		t.Errorf("depfileArgs = %q", args)
+	}
+	if got := escapeMakePath("/my src/a#1$.cm"); got != `/my\ src/a\#1$$.cm` {
+		t.Errorf("escapeMakePath = %q", got)
+	}
+}
+
+func TestSanitizeArgs(t *testing.T) {
+	mod := &project.ModuleInfo{ImportPath: "math"}
+	opts := Options{Sanitize: "address,undefined"}
+
+	args := strings.Join(compileArgs(mod, "/build/a.c", "/build/a.o", "/build", opts, nil), " ")
+	if args != "-c /build/a.c -o /build/a.o -I /build -std=gnu11 -fsanitize=address,undefined -fno-omit-frame-pointer -g" {
+		t.Errorf("compileArgs = %q", args)
+	}
+
+	// -gsplit-dwarf already brings -g
+	opts.SplitDWARF = true
+	args = strings.Join(compileArgs(mod, "/build/a.c", "/build/a.o", "/build", opts, nil), " ")
+	if args != "-c /build/a.c -o /build/a.o -I /build -std=gnu11 -g -gsplit-dwarf -fsanitize=address,undefined -fno-omit-frame-pointer" {
+		t.Errorf("compileArgs with split DWARF = %q", args)
+	}
+
+	link := strings.Join(linkArgs([]string{"/build/a.o"}, "/out/app", []string{"-lm"}, opts), " ")
+	if link != "/build/a.o -o /out/app -fsanitize=address,undefined -lm" {
+		t.Errorf("linkArgs = %q", link)
+	}
+}
+
+func TestHardenArgs(t *testing.T) {
+	mod := &project.ModuleInfo{ImportPath: "math"}
+	opts := Options{Harden: true}
+
+	args := strings.Join(compileArgs(mod, "/build/a.c", "/build/a.o", "/build", opts, nil), " ")
+	if args != "-c /build/a.c -o /build/a.o -I /build -std=gnu11 -fstack-protector-strong -U_FORTIFY_SOURCE -D_FORTIFY_SOURCE=2 -fPIE" {
+		t.Errorf("compileArgs = %q", args)
+	}
+	pch := strings.Join(pchArgs("/build/m_internal.h", "/build/m_internal.h.gch", "/build", opts, nil), " ")
+	if !strings.HasSuffix(pch, "-D_FORTIFY_SOURCE=2 -fPIE") {
+		t.Errorf("pchArgs must match the compiles, got %q", pch)
+	}
+
+	link := strings.Join(linkArgs([]string{"/build/a.o"}, "/out/app", []string{"-lm"}, opts), " ")
+	if link != "/build/a.o -o /out/app -pie -lm" {
+		t.Errorf("linkArgs = %q", link)
+	}
+}
+
+func TestNeedsPCH(t *testing.T) {
+	buildDir := t.TempDir()
+	pch := filepath.Join(buildDir, "app_internal.h.gch")
+	hashes := loadObjectHashes(buildDir)
+
+	if !needsPCH(pch, "h1", nil, hashes) {
+		t.Fatalf("expected a missing .gch to need building")
+	}
+
+	if err := os.WriteFile(pch, []byte("\n"), 0644); err != nil {
+		t.Fatalf("write .gch: %v", err)
+	}
+	hashes.set(pch, "h1")
+	if needsPCH(pch, "h1", nil, hashes) {
+		t.Fatalf("expected a .gch built from the same compile to be reused")
+	}
+
+	// Other flags or header contents give another hash
+	if !needsPCH(pch, "h2", nil, hashes) {
+		t.Fatalf("expected a changed compile to rebuild the .gch")
+	}
+	if !needsPCH(pch, "", os.ErrNotExist, hashes) {
+		t.Fatalf("expected a failed hash to rebuild the .gch")
+	}
+}
+
+func TestPCHFlags(t *testing.T) {
+	mod := &project.ModuleInfo{ImportPath: "app", Files: []string{"/src/app/a.cm", "/src/app/b.cm"}}
+	a, b := "/build/app_a.c", "/build/app_b.c"
+
+	flags, ok := pchFlags(mod, "/build", Options{}, map[string]*FileFlags{})
+	if !ok || flags != nil {
+		t.Errorf("files without flags: got %v, %v", flags, ok)
+	}
+
+	shared := map[string]*FileFlags{a: {CFlags: []string{"-DX=1", "-fPIC"}}, b: {CFlags: []string{"-DX=1", "-fPIC"}}}
+	if flags, ok := pchFlags(mod, "/build", Options{}, shared); !ok || strings.Join(flags.CFlags, " ") != "-DX=1 -fPIC" {
+		t.Errorf("shared flags: got %v, %v", flags, ok)
+	}
+
+	if _, ok := pchFlags(mod, "/build", Options{}, map[string]*FileFlags{a: {CFlags: []string{"-fPIC"}}}); ok {
+		t.Errorf("expected files with different flags to get no .gch")
+	}
+}
+
+func TestSelectTargets(t *testing.T) {
+	proj := &project.Project{RootPath: "/src/demo", Modules: map[string]*project.ModuleInfo{"main": {ImportPath: "main"}}}
+
+	targets, err := selectTargets(proj, Options{})
+	if err != nil || len(targets) != 1 || targets[0].Name != "demo" || targets[0].Kind != project.TargetExecutable {
+		t.Errorf("expected implicit demo executable, got %v (err %v)", targets, err)
+	}
+	if _, err := selectTargets(proj, Options{Target: "app"}); err == nil {
+		t.Error("expected an error selecting a target cm.mod does not declare")
+	}
+
+	proj.Targets = []project.Target{
+		{Name: "app", Kind: project.TargetExecutable, Root: "main"},
+		{Name: "vec", Kind: project.TargetLibrary, Root: "math"},
+	}
+	if targets, err := selectTargets(proj, Options{}); err != nil || len(targets) != 2 {
+		t.Errorf("expected both targets, got %v (err %v)", targets, err)
+	}
+	if targets, err := selectTargets(proj, Options{Target: "vec"}); err != nil || len(targets) != 1 || targets[0].Root != "math" {
+		t.Errorf("expected vec target, got %v (err %v)", targets, err)
+	}
+	if _, err := selectTargets(proj, Options{OutputPath: "out"}); err == nil {
+		t.Error("expected -o with several targets to fail")
+	}
+}
+
+func TestSelectTargetsWithoutMain(t *testing.T) {
+	proj := &project.Project{RootPath: "/src/vec", Modules: map[string]*project.ModuleInfo{"math": {ImportPath: "math"}}}
+
+	targets, err := selectTargets(proj, Options{})
+	if err != nil || len(targets) != 1 || targets[0].Name != "vec" || targets[0].Kind != project.TargetLibrary {
+		t.Errorf("expected implicit vec library, got %v (err %v)", targets, err)
+	}
+
+	proj.Targets = []project.Target{
+		{Name: "app", Kind: project.TargetExecutable, Root: "main"},
+		{Name: "vec", Kind: project.TargetLibrary, Root: "math"},
+	}
+	if _, err := selectTargets(proj, Options{}); err == nil || !strings.Contains(err.Error(), "no main module") {
+		t.Errorf("expected an error for an executable without main, got %v", err)
+	}
+	if targets, err := selectTargets(proj, Options{Target: "vec"}); err != nil || len(targets) != 1 {
+		t.Errorf("expected the library target alone to build, got %v (err %v)", targets, err)
+	}
+}
+
+func TestTargetModules(t *testing.T) {
+	proj := &project.Project{Modules: map[string]*project.ModuleInfo{
+		"main":  {ImportPath: "main", Imports: []string{"app"}},
+		"app":   {ImportPath: "app", Imports: []string{"math"}},
+		"math":  {ImportPath: "math"},
+		"tools": {ImportPath: "tools", Imports: []string{"math"}},
+	}}
+
+	names := func(mods []*project.ModuleInfo) string {
+		var out []string
+		for _, m := range mods {
+			out = append(out, m.ImportPath)
+		}
+		return strings.Join(out, " ")
+	}
+
+	mods, err := targetModules(proj, "app")
+	if err != nil || names(mods) != "app math" {
+		t.Errorf("expected app math, got %q (err %v)", names(mods), err)
+	}
+	mods, err = targetModules(proj, "")
+	if err != nil || names(mods) != "app main math tools" {
+		t.Errorf("expected all modules, got %q (err %v)", names(mods), err)
+	}
+	if _, err := targetModules(proj, "missing"); err == nil {
+		t.Error("expected an error for a missing root module")
+	}
+}
+
+func TestTargetInputsSkipTagExcludedModule(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"cm.mod":           `module "tags"`,
+		"main.cm":          "module \"main\"\n\nfunc main() int {\n    return 0;\n}\n",
+		"trace/trace.cm":   "// +build trace\n\nmodule \"trace\"\n\npub func on() int {\n    return 1;\n}\n",
+		"trace/extra.cm":   "// +build trace\n\nmodule \"trace\"\n",
+		"util/util.cm":     "module \"util\"\n",
+		"util/util_dbg.cm": "// +build trace\n\nmodule \"util\"\n",
+	}
+	for rel, content := range files {
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	proj, err := project.DiscoverWithContext(root, project.NewBuildContext(nil, false))
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	if _, ok := proj.Modules["trace"]; ok {
+		t.Fatal("expected the tag-excluded module to be absent")
+	}
+
+	buildDir := filepath.Join(root, ".c_minus")
+	oFiles, _, err := targetInputs(proj, buildDir, project.Target{Name: "tags"}, nil, Options{})
+	if err != nil {
+		t.Fatalf("targetInputs: %v", err)
+	}
+	var names []string
+	for _, o := range oFiles {
+		names = append(names, filepath.Base(o))
+	}
+	if got := strings.Join(names, " "); got != "main_main.o util_util.o" {
+		t.Errorf("link objects = %q", got)
+	}
+
+	// With the tag, both modules contribute every file
+	proj, err = project.DiscoverWithContext(root, project.NewBuildContext([]string{"trace"}, false))
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	oFiles, _, err = targetInputs(proj, buildDir, project.Target{Name: "tags"}, nil, Options{})
+	if err != nil || len(oFiles) != 5 {
+		t.Errorf("expected 5 objects with -tags trace, got %v (err %v)", oFiles, err)
+	}
+}
+
+func TestCheckImports(t *testing.T) {
+	proj := &project.Project{Modules: map[string]*project.ModuleInfo{
+		"main": {ImportPath: "main", Imports: []string{"util"}},
+		"util": {ImportPath: "util"},
+	}}
+	if err := checkImports(proj); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	proj.Modules["main"].Imports = append(proj.Modules["main"].Imports, "trace")
+	err := checkImports(proj)
+	if err == nil || !strings.Contains(err.Error(), `module main imports "trace", which has no files in this build`) {
+		t.Errorf("expected a missing import error, got %v", err)
+	}
+}
+
+func TestCheckDuplicateGlobals(t *testing.T) {
+	parse := func(name, src string) *parser.File {
+		file, err := parser.ParseSource("module \"state\"\n\n"+src, name)
+		if err != nil {
+			t.Fatalf("parse %s: %v", name, err)
+		}
+		return file
+	}
+	mod := &project.ModuleInfo{ImportPath: "state", Files: []string{"a.cm", "b.cm"}}
+
+	// The same extern may be declared by every file that uses it
+	files := []*parser.File{
+		parse("a.cm", "pub extern int shared;\n"),
+		parse("b.cm", "extern int shared;\n"),
+	}
+	if err := checkDuplicateGlobals(mod, files); err != nil {
+		t.Errorf("expected repeated extern declarations to be allowed, got %v", err)
+	}
+
+	files = []*parser.File{
+		parse("a.cm", "pub int counter = 0;\n"),
+		parse("b.cm", "int counter = 1;\n"),
+	}
+	if err := checkDuplicateGlobals(mod, files); err == nil || !strings.Contains(err.Error(), `duplicate global "counter"`) {
+		t.Errorf("expected a duplicate global error, got %v", err)
+	}
+}
+
+func TestCheckToolsMissingCompiler(t *testing.T) {
+	t.Setenv("CC", "")
+	if got := (Options{}).Compiler(); got != "gcc" {
+		t.Errorf("expected gcc by default, got %q", got)
+	}
+	t.Setenv("CC", "cc-from-env")
+	if got := (Options{}).Compiler(); got != "cc-from-env" {
+		t.Errorf("expected $CC to select the compiler, got %q", got)
+	}
+	if got := (Options{CC: "clang"}).Compiler(); got != "clang" {
+		t.Errorf("expected -cc to override $CC, got %q", got)
+	}
+
+	t.Setenv("LD", "")
+	if got := (Options{CC: "clang"}).linker(); got != "clang" {
+		t.Errorf("expected the compiler to link by default, got %q", got)
+	}
+	t.Setenv("LD", "ld-from-env")
+	if got := (Options{CC: "clang"}).linker(); got != "ld-from-env" {
+		t.Errorf("expected $LD to select the linker, got %q", got)
+	}
+	if got := (Options{Linker: "g++"}).linker(); got != "g++" {
+		t.Errorf("expected -linker to override $LD, got %q", got)
+	}
+
+	err := checkTools(nil, Options{CC: "no-such-cc"})
+	if err == nil || !strings.Contains(err.Error(), `C compiler "no-such-cc" not found`) || !strings.Contains(err.Error(), "-cc") {
+		t.Errorf("expected an actionable missing compiler error, got %v", err)
+	}
+
+	// A compiler command with a launcher is looked up by its program
+	if err := checkTools(nil, Options{CC: "gcc -m64"}); err != nil {
+		t.Errorf("expected CC with arguments to be found, got %v", err)
+	}
+	if got := strings.Join((Options{CC: "ccache gcc"}).CompilerCommand("-c", "a.c"), " "); got != "ccache gcc -c a.c" {
+		t.Errorf("CompilerCommand = %q", got)
+	}
+}
+
+func TestExtractFileFlagsPkgConfig(t *testing.T) {
+	if _, err := exec.LookPath("pkg-config"); err != nil {
+		t.Skip("pkg-config not installed")
+	}
+	pcDir := t.TempDir()
+	pc := "Name: demo\nDescription: demo\nVersion: 1.0\nCflags: -DDEMO=1 -I/opt/demo/include\nLibs: -L/opt/demo/lib -ldemo\n"
+	if err := os.WriteFile(filepath.Join(pcDir, "demo.pc"), []byte(pc), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PKG_CONFIG_PATH", pcDir)
+	t.Setenv("PKG_CONFIG_LIBDIR", pcDir)
+
+	pkgs := newPkgConfig()
+	flags, err := extractFileFlags([]*parser.CGoFlag{
+		{Type: "CFLAGS", Flags: "-O1"},
+		{Type: "pkg-config", Flags: "demo"},
+	}, pkgs)
+	if err != nil {
+		t.Fatalf("extractFileFlags: %v", err)
+	}
+	if got := strings.Join(flags.CFlags, " "); got != "-O1 -DDEMO=1 -I/opt/demo/include" {
+		t.Errorf("CFlags = %q", got)
+	}
+	if got := strings.Join(flags.LDFlags, " "); got != "-L/opt/demo/lib -ldemo" {
+		t.Errorf("LDFlags = %q", got)
+	}
+
+	// The result is cached for the rest of the build
+	if err := os.Remove(filepath.Join(pcDir, "demo.pc")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := pkgs.flags("demo"); err != nil {
+		t.Errorf("expected cached flags, got %v", err)
+	}
+
+	_, err = extractFileFlags([]*parser.CGoFlag{{Type: "pkg-config", Flags: "no-such-package"}}, pkgs)
+	if err == nil || !strings.Contains(err.Error(), "package no-such-package not found") {
+		t.Errorf("expected a missing package error, got %v", err)
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	_, err = extractFileFlags([]*parser.CGoFlag{{Type: "pkg-config", Flags: "other"}}, newPkgConfig())
+	if err == nil || !strings.Contains(err.Error(), "pkg-config not found on PATH") {
+		t.Errorf("expected a missing pkg-config error, got %v", err)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	root := t.TempDir()
+	cfg, err := LoadConfig(root)
+	if err != nil || cfg.Options.CC != "" || len(cfg.Tags) != 0 {
+		t.Fatalf("expected an empty config without cm.build, got %+v, %v", cfg, err)
+	}
+
+	config := `# Project build settings
+cc: clang
+std: c17
+jobs: 2
+output: bin/app
+define: LOG_LEVEL=2
+define: FAST
+tags: linux, experimental
+release: true
+werror: true
+depfiles: false
+`
+	if err := os.WriteFile(filepath.Join(root, ConfigFileName), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err = LoadConfig(root)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	opts := cfg.Options
+	if opts.CC != "clang" || opts.CStandard != "c17" || opts.Jobs != 2 || !opts.Werror || opts.Depfiles {
+		t.Errorf("unexpected options %+v", opts)
+	}
+	if opts.OutputPath != filepath.Join(root, "bin/app") {
+		t.Errorf("expected output relative to the project root, got %s", opts.OutputPath)
+	}
+	if strings.Join(opts.Defines, " ") != "LOG_LEVEL=2 FAST" {
+		t.Errorf("unexpected defines %v", opts.Defines)
+	}
+	if strings.Join(cfg.Tags, ",") != "linux,experimental" || !cfg.Release {
+		t.Errorf("unexpected tags %v or release %v", cfg.Tags, cfg.Release)
+	}
+
+	for config, want := range map[string]string{
+		"cc clang\n":         `cm.build:1: expected "key: value"`,
+		"\noptimize: 3\n":    `cm.build:2: unknown key "optimize"`,
+		"unity: yes\n":       `cm.build:1: unity must be true or false, got "yes"`,
+		"jobs: 0\n":          `cm.build:1: jobs must be a positive number, got "0"`,
+		"define: 1X\n":       `cm.build:1: invalid -D value "1X": "1X" is not a valid macro name`,
+		"// comment\nstd:\n": `cm.build:2: std requires a value`,
+	} {
+		if err := os.WriteFile(filepath.Join(root, ConfigFileName), []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadConfig(root); err == nil || err.Error() != want {
+			t.Errorf("LoadConfig(%q): expected %q, got %v", config, want, err)
+		}
+	}
+}
+
+func TestTranspileFile(t *testing.T) {
+	file, err := parser.ParseSource("module \"geo/shapes\"\n\npub func area(int w, int h) int {\n    return w * h;\n}\n", "shapes.cm")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	buildDir := t.TempDir()
+	if err := TranspileFile(file, nil, nil, buildDir, paths.Naming{}); err != nil {
+		t.Fatalf("TranspileFile failed: %v", err)
+	}
+
+	header, err := os.ReadFile(paths.Naming{}.ModuleHeaderPath(buildDir, "geo/shapes"))
+	if err != nil {
+		t.Fatalf("read header: %v", err)
+	}
+	if !strings.Contains(string(header), "int geo_shapes_area(int w, int h);") {
+		t.Errorf("header missing prototype:\n%s", header)
+	}
+	if _, err := os.Stat(paths.Naming{}.ModuleCFilePath(buildDir, "geo/shapes", "shapes.cm")); err != nil {
+		t.Errorf("expected generated C file: %v", err)
+	}
+
+	mod := &project.ModuleInfo{ImportPath: "geo/shapes"}
+	if err := TranspileFile(file, mod, nil, buildDir, paths.Naming{}); err == nil {
+		t.Error("expected an error for a module without files")
+	}
+}
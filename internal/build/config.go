@@ -0,0 +1,159 @@
+package build
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ConfigFileName is the optional build configuration at the project root
+const ConfigFileName = "cm.build"
+
+// Config is the build configuration read from cm.build. Command-line flags
+// are applied on top of it.
+type Config struct {
+	Options Options
+	Tags    []string // Custom build tags, as given to -tags
+	Release bool     // Build in release mode, as with --release
+}
+
+// configBools are the cm.build keys that switch on a boolean option
+var configBools = map[string]func(*Options) *bool{
+	"pch":               func(o *Options) *bool { return &o.PCH },
+	"werror":            func(o *Options) *bool { return &o.Werror },
+	"self-contained":    func(o *Options) *bool { return &o.SelfContained },
+	"split-dwarf":       func(o *Options) *bool { return &o.SplitDWARF },
+	"checks":            func(o *Options) *bool { return &o.Checks },
+	"unused":            func(o *Options) *bool { return &o.Unused },
+	"no-unused-imports": func(o *Options) *bool { return &o.NoImports },
+	"mirror-objects":    func(o *Options) *bool { return &o.MirrorObjects },
+	"group-errors":      func(o *Options) *bool { return &o.GroupErrors },
+	"unity":             func(o *Options) *bool { return &o.Unity },
+	"depfiles":          func(o *Options) *bool { return &o.Depfiles },
+	"harden":            func(o *Options) *bool { return &o.Harden },
+}
+
+// configStrings are the cm.build keys that set a string option
+var configStrings = map[string]func(*Options) *string{
+	"output":   func(o *Options) *string { return &o.OutputPath },
+	"cc":       func(o *Options) *string { return &o.CC },
+	"linker":   func(o *Options) *string { return &o.Linker },
+	"std":      func(o *Options) *string { return &o.CStandard },
+	"sanitize": func(o *Options) *string { return &o.Sanitize },
+	"mangling": func(o *Options) *string { return &o.Mangling },
+	"target":   func(o *Options) *string { return &o.Target },
+}
+
+// LoadConfig reads cm.build from the project root. A missing file gives an
+// empty configuration.
+//
+// Each line is "key: value"; blank lines and lines starting with # or // are
+// ignored. Keys are the build flags without their dashes: boolean flags take
+// true or false, "define" may repeat, and "tags" is a comma-separated list.
+func LoadConfig(root string) (*Config, error) {
+	path := filepath.Join(root, ConfigFileName)
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", ConfigFileName, err)
+	}
+	defer f.Close()
+
+	cfg := &Config{}
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected \"key: value\"", ConfigFileName, lineNum)
+		}
+		if err := cfg.set(strings.TrimSpace(key), strings.TrimSpace(value)); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", ConfigFileName, lineNum, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", ConfigFileName, err)
+	}
+
+	// The output path is relative to the project, not the working directory
+	if out := cfg.Options.OutputPath; out != "" && !filepath.IsAbs(out) {
+		cfg.Options.OutputPath = filepath.Join(root, out)
+	}
+	return cfg, nil
+}
+
+// set applies one cm.build setting
+func (c *Config) set(key, value string) error {
+	if field, ok := configBools[key]; ok {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s must be true or false, got %q", key, value)
+		}
+		*field(&c.Options) = b
+		return nil
+	}
+	if value == "" {
+		return fmt.Errorf("%s requires a value", key)
+	}
+	if field, ok := configStrings[key]; ok {
+		*field(&c.Options) = value
+		return nil
+	}
+
+	switch key {
+	case "jobs":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return fmt.Errorf("jobs must be a positive number, got %q", value)
+		}
+		c.Options.Jobs = n
+	case "define":
+		def, err := ParseDefine(value)
+		if err != nil {
+			return err
+		}
+		c.Options.Defines = append(c.Options.Defines, def)
+	case "tags":
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				c.Tags = append(c.Tags, tag)
+			}
+		}
+	case "release":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("release must be true or false, got %q", value)
+		}
+		c.Release = b
+	default:
+		return fmt.Errorf("unknown key %q", key)
+	}
+	return nil
+}
+
+// ParseDefine validates a -D argument of the form NAME or NAME=VALUE
+func ParseDefine(def string) (string, error) {
+	name, _, _ := strings.Cut(def, "=")
+	if name == "" {
+		return "", fmt.Errorf("invalid -D value %q: missing macro name", def)
+	}
+	for i, ch := range name {
+		isLetter := ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+		if !isLetter && (i == 0 || ch < '0' || ch > '9') {
+			return "", fmt.Errorf("invalid -D value %q: %q is not a valid macro name", def, name)
+		}
+	}
+	return def, nil
+}
@@ -0,0 +1,72 @@
+package build
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/elijahmorgan/c_minus/internal/project"
+)
+
+// DepfileName is the combined depfile written to the build directory with --depfiles
+const DepfileName = "deps.d"
+
+// depfileArgs makes gcc write obj's depfile: the headers outside system
+// directories that the object includes, the generated module headers among them
+func depfileArgs(obj objectFile) []string {
+	return []string{"-MMD", "-MF", obj.dep, "-MT", obj.o}
+}
+
+// writeDepfile writes deps.d, collecting every object's gcc depfile and
+// adding a rule that makes each object depend on the .cm files it is
+// generated from. An external driver can include it to rebuild when a
+// source or header changes.
+func writeDepfile(proj *project.Project, buildDir string, opts Options) error {
+	var importPaths []string
+	for importPath := range proj.Modules {
+		importPaths = append(importPaths, importPath)
+	}
+	sort.Strings(importPaths)
+
+	var sb bytes.Buffer
+	sb.WriteString("# Dependencies of the objects built by c_minus. Generated by c_minus - do not edit.\n")
+	for _, importPath := range importPaths {
+		for _, obj := range moduleObjects(proj.Modules[importPath], buildDir, opts) {
+			fmt.Fprintf(&sb, "%s: %s\n", escapeMakePath(obj.o), escapeMakePaths(obj.sources))
+			data, err := os.ReadFile(obj.dep)
+			if err != nil {
+				return fmt.Errorf("failed to read depfile: %w", err)
+			}
+			sb.Write(data)
+			if len(data) > 0 && data[len(data)-1] != '\n' {
+				sb.WriteByte('\n')
+			}
+		}
+	}
+
+	path := filepath.Join(buildDir, DepfileName)
+	opts.manifest.Add(path)
+	if err := os.WriteFile(path, sb.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// escapeMakePaths escapes paths for a make rule and joins them with spaces
+func escapeMakePaths(files []string) string {
+	escaped := make([]string, len(files))
+	for i, f := range files {
+		escaped[i] = escapeMakePath(f)
+	}
+	return strings.Join(escaped, " ")
+}
+
+// escapeMakePath escapes the characters make treats specially in a rule
+func escapeMakePath(path string) string {
+	path = strings.ReplaceAll(path, " ", "\\ ")
+	path = strings.ReplaceAll(path, "#", "\\#")
+	return strings.ReplaceAll(path, "$", "$$")
+}
@@ -0,0 +1,262 @@
+package build
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/elijahmorgan/c_minus/internal/paths"
+	"github.com/elijahmorgan/c_minus/internal/project"
+)
+
+// HashesFileName is the file in the build directory that records what each
+// object was compiled from
+const HashesFileName = ".hashes"
+
+// objectHashes maps each object to a hash of its compile: the arguments and
+// the contents of the files it was built from. Code generation rewrites every
+// .c file, so an object whose hash is unchanged is not compiled again even
+// though its inputs are newer. It is safe for concurrent use, and a nil
+// *objectHashes records nothing.
+type objectHashes struct {
+	mu     sync.Mutex
+	path   string
+	hashes map[string]string // Object path -> hex SHA-256
+}
+
+// loadObjectHashes reads the hashes recorded in buildDir. A missing or
+// unreadable file starts empty, which only costs a recompile.
+func loadObjectHashes(buildDir string) *objectHashes {
+	h := &objectHashes{path: filepath.Join(buildDir, HashesFileName), hashes: make(map[string]string)}
+	f, err := os.Open(h.path)
+	if err != nil {
+		return h
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if hash, obj, ok := strings.Cut(line, " "); ok {
+			h.hashes[obj] = hash
+		}
+	}
+	return h
+}
+
+// matches reports whether obj was last compiled with the given hash
+func (h *objectHashes) matches(obj, hash string) bool {
+	if h == nil {
+		return false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.hashes[obj] == hash
+}
+
+// set records the hash obj was compiled with
+func (h *objectHashes) set(obj, hash string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	h.hashes[obj] = hash
+	h.mu.Unlock()
+}
+
+// save writes the hashes of the objects that still exist
+func (h *objectHashes) save() error {
+	h.mu.Lock()
+	objs := make([]string, 0, len(h.hashes))
+	for obj := range h.hashes {
+		if _, err := os.Stat(obj); err == nil {
+			objs = append(objs, obj)
+		}
+	}
+	sort.Strings(objs)
+	var sb strings.Builder
+	sb.WriteString("# Hashes of the compiles of c_minus objects. Do not edit.\n")
+	for _, obj := range objs {
+		sb.WriteString(h.hashes[obj] + " " + obj + "\n")
+	}
+	h.mu.Unlock()
+
+	if err := os.WriteFile(h.path, []byte(sb.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", h.path, err)
+	}
+	return nil
+}
+
+// compileHash hashes the arguments of an object's compile and the contents
+// of its inputs and of the headers they can include: the module's generated
+// headers, the public headers of every module it imports directly or
+// indirectly, the headers they #include that the compile's include
+// directories resolve (hand-written headers a module cimports), and the
+// headers listed in the object's depfile, if it has one.
+func compileHash(proj *project.Project, mod *project.ModuleInfo, obj objectFile, buildDir string, n paths.Naming, args []string) (string, error) {
+	files := append([]string{}, obj.inputs...)
+	files = append(files, moduleHeaders(proj, mod, buildDir, n)...)
+	files = append(files, includedHeaders(files, args)...)
+	deps, err := depfileHeaders(obj.dep)
+	if err != nil {
+		return "", err
+	}
+	files = append(files, deps...)
+	// Import order comes from maps; hash the inputs in a stable order
+	sort.Strings(files)
+
+	sum := sha256.New()
+	for _, arg := range args {
+		fmt.Fprintf(sum, "%s\x00", arg)
+	}
+	seen := make(map[string]bool)
+	for _, file := range files {
+		if seen[file] {
+			continue
+		}
+		seen[file] = true
+		data, err := os.ReadFile(file)
+		if errors.Is(err, fs.ErrNotExist) {
+			fmt.Fprintf(sum, "\x01%s\x00missing\x00", file)
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to hash %s: %w", file, err)
+		}
+		fmt.Fprintf(sum, "\x01%s\x00%d\x00", file, len(data))
+		sum.Write(data)
+	}
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// moduleHeaders returns the generated headers a module's .c files see: its
+// own headers and the public headers of all of its imports, transitively
+func moduleHeaders(proj *project.Project, mod *project.ModuleInfo, buildDir string, n paths.Naming) []string {
+	headers := []string{
+		n.ModuleInternalHeaderPath(buildDir, mod.ImportPath),
+		n.ModuleHeaderPath(buildDir, mod.ImportPath),
+	}
+	seen := map[string]bool{mod.ImportPath: true}
+	queue := append([]string{}, mod.Imports...)
+	for len(queue) > 0 {
+		imp := queue[0]
+		queue = queue[1:]
+		if seen[imp] {
+			continue
+		}
+		seen[imp] = true
+		headers = append(headers, n.ModuleHeaderPath(buildDir, imp))
+		if m, ok := proj.Modules[imp]; ok {
+			queue = append(queue, m.Imports...)
+		}
+	}
+	return headers
+}
+
+// includeDirective matches an #include line, capturing the delimiter and name
+var includeDirective = regexp.MustCompile(`^\s*#\s*include\s*([<"])([^>"]+)[>"]`)
+
+// includedHeaders follows the #include lines of files, and of the headers
+// they reach, to the headers that exist in the including file's directory
+// (for "name") or in a directory given by -I, -iquote, or -isystem in args.
+// Headers only found on the compiler's default path are system headers and
+// are not followed.
+func includedHeaders(files, args []string) []string {
+	var dirs, quoteDirs []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		for _, flag := range []string{"-I", "-iquote", "-isystem"} {
+			dir, ok := strings.CutPrefix(arg, flag)
+			if !ok {
+				continue
+			}
+			if dir == "" && i+1 < len(args) {
+				i++
+				dir = args[i]
+			}
+			if flag == "-iquote" {
+				quoteDirs = append(quoteDirs, dir)
+			} else {
+				dirs = append(dirs, dir)
+			}
+			break
+		}
+	}
+
+	var headers []string
+	seen := make(map[string]bool)
+	for _, f := range files {
+		seen[f] = true
+	}
+	queue := append([]string{}, files...)
+	for len(queue) > 0 {
+		file := queue[0]
+		queue = queue[1:]
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			m := includeDirective.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			search := dirs
+			if m[1] == `"` {
+				search = append(append([]string{filepath.Dir(file)}, quoteDirs...), dirs...)
+			}
+			for _, dir := range search {
+				header := filepath.Join(dir, m[2])
+				if _, err := os.Stat(header); err != nil {
+					continue
+				}
+				if !seen[header] {
+					seen[header] = true
+					headers = append(headers, header)
+					queue = append(queue, header)
+				}
+				break
+			}
+		}
+	}
+	return headers
+}
+
+// depfileHeaders returns the prerequisites listed in a gcc depfile, or
+// nothing if there is no depfile
+func depfileHeaders(dep string) ([]string, error) {
+	data, err := os.ReadFile(dep)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read depfile: %w", err)
+	}
+
+	// "obj.o: a.c b.h \<newline> c.h", with spaces in names escaped
+	text := strings.ReplaceAll(string(data), "\\\n", " ")
+	var files []string
+	for _, rule := range strings.Split(text, "\n") {
+		_, prereqs, ok := strings.Cut(rule, ": ")
+		if !ok {
+			continue
+		}
+		prereqs = strings.ReplaceAll(prereqs, "\\ ", "\x00")
+		for _, f := range strings.Fields(prereqs) {
+			files = append(files, strings.ReplaceAll(f, "\x00", " "))
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,132 @@
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elijahmorgan/c_minus/internal/paths"
+	"github.com/elijahmorgan/c_minus/internal/project"
+)
+
+func TestNeedsRecompileHashes(t *testing.T) {
+	buildDir := t.TempDir()
+	app := &project.ModuleInfo{ImportPath: "app", Files: []string{"/src/app/app.cm"}, Imports: []string{"util"}}
+	proj := &project.Project{Modules: map[string]*project.ModuleInfo{
+		"app":  app,
+		"util": {ImportPath: "util", Imports: []string{"base"}},
+		"base": {ImportPath: "base"},
+	}}
+	obj := moduleObjects(app, buildDir, Options{})[0]
+
+	write := func(path, content string, mtime time.Time) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatalf("chtimes %s: %v", path, err)
+		}
+	}
+	old := time.Now().Add(-time.Hour)
+	write(obj.c, "int app_f(void) { return 1; }\n", old)
+	for _, h := range moduleHeaders(proj, app, buildDir, paths.Naming{}) {
+		write(h, "// "+filepath.Base(h)+"\n", old)
+	}
+	write(obj.o, "object", time.Now())
+
+	opts := Options{hashes: loadObjectHashes(buildDir)}
+	if needsRecompile(proj, app, buildDir, opts, nil) {
+		t.Fatalf("expected an object newer than its .c to be up to date")
+	}
+
+	// Regenerating identical content makes the .c newer, but the hash holds
+	hash, err := compileHash(proj, app, obj, buildDir, opts.naming(), objectCompileArgs(app, obj, buildDir, opts, nil))
+	if err != nil {
+		t.Fatalf("compileHash: %v", err)
+	}
+	opts.hashes.set(obj.o, hash)
+	write(obj.c, "int app_f(void) { return 1; }\n", time.Now().Add(time.Hour))
+	if needsRecompile(proj, app, buildDir, opts, nil) {
+		t.Errorf("expected identical regenerated content not to recompile")
+	}
+
+	// The recorded hashes survive a reload
+	if err := opts.hashes.save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	opts.hashes = loadObjectHashes(buildDir)
+	if needsRecompile(proj, app, buildDir, opts, nil) {
+		t.Errorf("expected the saved hash to be used after a reload")
+	}
+
+	// A header of an indirect import changes what the .c compiles to
+	base := opts.naming().ModuleHeaderPath(buildDir, "base")
+	write(base, "// base.h changed\n", old)
+	if !needsRecompile(proj, app, buildDir, opts, nil) {
+		t.Errorf("expected a changed indirect import header to recompile")
+	}
+	write(base, "// base.h\n", old)
+
+	// So do the compile arguments and the .c content
+	if !needsRecompile(proj, app, buildDir, Options{hashes: opts.hashes, Defines: []string{"X"}}, nil) {
+		t.Errorf("expected a new -D to recompile")
+	}
+	write(obj.c, "int app_f(void) { return 2; }\n", time.Now().Add(time.Hour))
+	if !needsRecompile(proj, app, buildDir, opts, nil) {
+		t.Errorf("expected changed .c content to recompile")
+	}
+}
+
+func TestDepfileHeaders(t *testing.T) {
+	dep := filepath.Join(t.TempDir(), "main_main.d")
+	if files, err := depfileHeaders(dep); err != nil || files != nil {
+		t.Fatalf("expected nothing without a depfile, got %v, %v", files, err)
+	}
+
+	content := "/b/main_main.o: /b/main_main.c /b/main_internal.h \\\n /src/my\\ dir/local.h\n"
+	if err := os.WriteFile(dep, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	files, err := depfileHeaders(dep)
+	if err != nil {
+		t.Fatalf("depfileHeaders: %v", err)
+	}
+	want := "/b/main_main.c|/b/main_internal.h|/src/my dir/local.h"
+	if got := strings.Join(files, "|"); got != want {
+		t.Errorf("depfileHeaders = %q, want %q", got, want)
+	}
+}
+
+func TestIncludedHeaders(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"build/app_app.c":         "#include \"app_internal.h\"\n#include <stdio.h>\n",
+		"build/app_internal.h":    "#include <config.h>\n",
+		"include/config.h":        "# include \"detail/limits.h\"\n#include \"missing.h\"\n",
+		"include/detail/limits.h": "#define LIMIT 3\n",
+		"quote/local.h":           "",
+	}
+	for rel, content := range files {
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := filepath.Join(root, "build", "app_app.c")
+	args := []string{"-c", c, "-I", filepath.Join(root, "build"), "-I" + filepath.Join(root, "include"), "-iquote", filepath.Join(root, "quote")}
+	got := includedHeaders([]string{c}, args)
+	want := []string{
+		filepath.Join(root, "build", "app_internal.h"),
+		filepath.Join(root, "include", "config.h"),
+		filepath.Join(root, "include", "detail", "limits.h"),
+	}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("includedHeaders = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,61 @@
+package build
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// pkgConfig runs pkg-config for "#cgo pkg-config:" directives and caches the
+// flags of each package, so files sharing a package query it once per build
+type pkgConfig struct {
+	mu    sync.Mutex
+	cache map[string]pkgConfigResult
+}
+
+type pkgConfigResult struct {
+	cflags []string
+	libs   []string
+	err    error
+}
+
+func newPkgConfig() *pkgConfig {
+	return &pkgConfig{cache: make(map[string]pkgConfigResult)}
+}
+
+// flags returns the compile and link flags pkg-config reports for pkg
+func (p *pkgConfig) flags(pkg string) ([]string, []string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if r, ok := p.cache[pkg]; ok {
+		return r.cflags, r.libs, r.err
+	}
+
+	var r pkgConfigResult
+	if _, err := exec.LookPath("pkg-config"); err != nil {
+		r.err = fmt.Errorf("#cgo pkg-config: %s: pkg-config not found on PATH: install pkg-config, or use #cgo CFLAGS and LDFLAGS instead", pkg)
+	} else if r.cflags, r.err = runPkgConfig("--cflags", pkg); r.err == nil {
+		r.libs, r.err = runPkgConfig("--libs", pkg)
+	}
+	p.cache[pkg] = r
+	return r.cflags, r.libs, r.err
+}
+
+// runPkgConfig runs "pkg-config <query> <pkg>" and splits its output into flags
+func runPkgConfig(query, pkg string) ([]string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("pkg-config", query, pkg)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, fmt.Errorf("#cgo pkg-config: package %s not found: %s", pkg, msg)
+	}
+	return parseFlags(strings.TrimSpace(stdout.String())), nil
+}
@@ -0,0 +1,111 @@
+package build
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Profile phases, reported in this order
+const (
+	PhaseDiscovery = "discovery"
+	PhaseTranspile = "transpile"
+	PhaseCompile   = "compile"
+	PhaseLink      = "link"
+)
+
+var profilePhases = []string{PhaseDiscovery, PhaseTranspile, PhaseCompile, PhaseLink}
+
+// Profile records wall-clock timings for build phases.
+// A nil *Profile is valid and records nothing, so callers need no checks.
+type Profile struct {
+	mu      sync.Mutex
+	entries []profileEntry
+}
+
+type profileEntry struct {
+	phase    string
+	name     string // module or file the timing belongs to (empty for whole-phase timings)
+	duration time.Duration
+}
+
+// NewProfile creates an empty build profile
+func NewProfile() *Profile {
+	return &Profile{}
+}
+
+// Track starts timing an item and returns a function that stops the timer
+// and records the elapsed time. time.Now carries a monotonic reading, so
+// the measurement is unaffected by wall-clock adjustments.
+func (p *Profile) Track(phase, name string) func() {
+	if p == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		p.Record(phase, name, time.Since(start))
+	}
+}
+
+// Record adds a timing entry
+func (p *Profile) Record(phase, name string, d time.Duration) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.entries = append(p.entries, profileEntry{phase: phase, name: name, duration: d})
+}
+
+// Write prints a per-phase breakdown of the recorded timings. A phase's
+// total is the sum of its whole-phase timings when it has any, so the
+// compile phase reports wall time although its parallel jobs overlap.
+func (p *Profile) Write(w io.Writer) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	fmt.Fprintln(w, "Build profile:")
+	var total time.Duration
+	for _, phase := range profilePhases {
+		var items []profileEntry
+		var itemTotal, wallTotal time.Duration
+		wall := false
+		for _, e := range p.entries {
+			if e.phase != phase {
+				continue
+			}
+			items = append(items, e)
+			if e.name == "" {
+				wall = true
+				wallTotal += e.duration
+			} else {
+				itemTotal += e.duration
+			}
+		}
+		if len(items) == 0 {
+			continue
+		}
+		phaseTotal := itemTotal
+		if wall {
+			phaseTotal = wallTotal
+		}
+		total += phaseTotal
+
+		fmt.Fprintf(w, "  %-12s %12s\n", phase, phaseTotal.Round(time.Microsecond))
+
+		// Compile jobs finish in arbitrary order; sort so output is stable
+		sort.SliceStable(items, func(i, j int) bool { return items[i].name < items[j].name })
+		for _, e := range items {
+			if e.name == "" {
+				continue
+			}
+			fmt.Fprintf(w, "    %-40s %12s\n", e.name, e.duration.Round(time.Microsecond))
+		}
+	}
+	fmt.Fprintf(w, "  %-12s %12s\n", "total", total.Round(time.Microsecond))
+}
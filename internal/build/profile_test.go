@@ -0,0 +1,36 @@
+package build
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProfileWrite(t *testing.T) {
+	p := NewProfile()
+	p.Record(PhaseTranspile, "main", 2*time.Millisecond)
+	p.Record(PhaseTranspile, "util", 3*time.Millisecond)
+	// Two overlapping jobs in a phase that took 4ms of wall time
+	p.Record(PhaseCompile, "", 4*time.Millisecond)
+	p.Record(PhaseCompile, "main_main.c", 3*time.Millisecond)
+	p.Record(PhaseCompile, "util_util.c", 3*time.Millisecond)
+
+	var out bytes.Buffer
+	p.Write(&out)
+	lines := strings.Fields(out.String())
+	for _, want := range [][2]string{{"transpile", "5ms"}, {"compile", "4ms"}, {"total", "9ms"}} {
+		found := false
+		for i := 0; i+1 < len(lines); i++ {
+			if lines[i] == want[0] && lines[i+1] == want[1] {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected %s %s in:\n%s", want[0], want[1], out.String())
+		}
+	}
+	if n := strings.Count(out.String(), "main_main.c"); n != 1 {
+		t.Errorf("expected main_main.c listed once, got %d in:\n%s", n, out.String())
+	}
+}
@@ -0,0 +1,84 @@
+package build
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/elijahmorgan/c_minus/internal/codegen"
+	"github.com/elijahmorgan/c_minus/internal/parser"
+	"github.com/elijahmorgan/c_minus/internal/paths"
+	"github.com/elijahmorgan/c_minus/internal/project"
+)
+
+// TranspileFile generates C for one parsed file without project discovery,
+// treating it as the only file of mod. A nil mod stands for a synthetic module
+// named by the file's module declaration, whose file is "<last segment>.cm".
+// Imported modules are referenced but not generated; imported holds the
+// parsed files of those that are known, so their enum members are qualified.
+// n names the generated symbols and files, as FileNaming gives for a build.
+func TranspileFile(file *parser.File, mod *project.ModuleInfo, imported map[string][]*parser.File, buildDir string, n paths.Naming) error {
+	if file.Module == nil {
+		return fmt.Errorf("file has no module declaration")
+	}
+	if mod == nil {
+		mod = &project.ModuleInfo{
+			ImportPath: file.Module.Path,
+			Files:      []string{path.Base(file.Module.Path) + ".cm"},
+		}
+	}
+	if len(mod.Files) != 1 {
+		return fmt.Errorf("module %s must list exactly one file, got %d", mod.ImportPath, len(mod.Files))
+	}
+	opts := codegen.Options{Imported: imported, Naming: n}
+	if err := codegen.GenerateModuleWithOptions(mod, []*parser.File{file}, buildDir, opts); err != nil {
+		return fmt.Errorf("failed to generate code for module %s: %w", mod.ImportPath, err)
+	}
+	return nil
+}
+
+// ImportedFiles parses the modules file imports when dir is inside a
+// project. It returns nil outside a project, and skips imports the project
+// does not have or that fail to parse.
+func ImportedFiles(dir string, file *parser.File) map[string][]*parser.File {
+	proj, err := project.Discover(dir)
+	if err != nil {
+		return nil
+	}
+	imported := make(map[string][]*parser.File)
+	for _, imp := range file.Imports {
+		mod, ok := proj.Modules[imp.Path]
+		if !ok {
+			continue
+		}
+		for _, f := range mod.Files {
+			if parsed, err := parser.ParseFile(f); err == nil {
+				imported[imp.Path] = append(imported[imp.Path], parsed)
+			}
+		}
+	}
+	return imported
+}
+
+// FileNaming returns the naming a build of the project containing dir uses:
+// the mangling scheme given (from a flag), else cm.build's, else cm.mod's.
+// Outside a project only the given scheme applies.
+func FileNaming(dir, mangling string) (paths.Naming, error) {
+	if root, _, err := project.FindRoot(dir); err == nil {
+		if mangling == "" {
+			cfg, err := LoadConfig(root)
+			if err != nil {
+				return paths.Naming{}, err
+			}
+			mangling = cfg.Options.Mangling
+		}
+		if mangling == "" {
+			if proj, err := project.Discover(root); err == nil {
+				mangling = proj.Mangling
+			}
+		}
+	}
+	if err := paths.CheckMangling(mangling); err != nil {
+		return paths.Naming{}, err
+	}
+	return paths.Naming{Mangling: mangling}, nil
+}
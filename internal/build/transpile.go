@@ -0,0 +1,74 @@
+package build
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/elijahmorgan/c_minus/internal/paths"
+	"github.com/elijahmorgan/c_minus/internal/project"
+)
+
+// CompileCommandsName is the compilation database Transpile writes beside the generated C
+const CompileCommandsName = "compile_commands.json"
+
+// compileCommand is one entry of a compile_commands.json
+type compileCommand struct {
+	Directory string   `json:"directory"`
+	File      string   `json:"file"`
+	Arguments []string `json:"arguments"`
+}
+
+// Transpile generates the headers and .c files of every module of proj into
+// outDir without compiling them, for use by another build system. Files are
+// flat under mangled names, or under obj/<module path>/ with
+// opts.MirrorObjects. outDir also gets a compile_commands.json giving each
+// .c file the arguments Build would compile it with.
+func Transpile(proj *project.Project, outDir string, opts Options) error {
+	if opts.Unity {
+		return fmt.Errorf("--unity is only used when compiling")
+	}
+	if opts.Mangling == "" {
+		opts.Mangling = proj.Mangling
+	}
+	if err := paths.CheckMangling(opts.Mangling); err != nil {
+		return err
+	}
+	if err := checkImports(proj); err != nil {
+		return err
+	}
+
+	outDir, err := filepath.Abs(outDir)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", outDir, err)
+	}
+
+	fileFlags, err := transpileModules(proj, outDir, opts)
+	if err != nil {
+		return fmt.Errorf("transpilation failed: %w", err)
+	}
+
+	var cmds []compileCommand
+	for _, mod := range proj.Modules {
+		for _, obj := range moduleObjects(mod, outDir, opts) {
+			args := opts.CompilerCommand(compileArgs(mod, obj.c, obj.o, outDir, opts, fileFlags[obj.c])...)
+			cmds = append(cmds, compileCommand{Directory: outDir, File: obj.c, Arguments: args})
+		}
+	}
+	sort.Slice(cmds, func(i, j int) bool { return cmds[i].File < cmds[j].File })
+
+	data, err := json.MarshalIndent(cmds, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(outDir, CompileCommandsName)
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package build
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/elijahmorgan/c_minus/internal/parser"
+	"github.com/elijahmorgan/c_minus/internal/project"
+)
+
+// objectFile is one compile of a module: the .c file given to the compiler,
+// the object it produces, and the generated .c files it is built from
+type objectFile struct {
+	c       string
+	o       string
+	dwo     string
+	dep     string // Depfile gcc writes with --depfiles
+	inputs  []string
+	sources []string // .cm files the generated .c files come from
+}
+
+// moduleObjects returns the compiles of a module: one per .cm file, or a
+// single unity translation unit with --unity
+func moduleObjects(mod *project.ModuleInfo, buildDir string, opts Options) []objectFile {
+	n := opts.naming()
+	var objs []objectFile
+	for _, srcFile := range mod.Files {
+		name := filepath.Base(srcFile)
+		cFile := n.ModuleCFilePath(buildDir, mod.ImportPath, name)
+		oFile := n.ModuleOFilePath(buildDir, mod.ImportPath, name)
+		objs = append(objs, objectFile{
+			c:       cFile,
+			o:       oFile,
+			dwo:     n.ModuleDWOFilePath(buildDir, mod.ImportPath, name),
+			dep:     oFile[:len(oFile)-2] + ".d",
+			inputs:  []string{cFile},
+			sources: []string{srcFile},
+		})
+	}
+	if !opts.Unity {
+		return objs
+	}
+
+	unity := objectFile{c: n.ModuleUnityCFilePath(buildDir, mod.ImportPath)}
+	unity.o = unity.c[:len(unity.c)-2] + ".o"
+	unity.dwo = unity.c[:len(unity.c)-2] + ".dwo"
+	unity.dep = unity.c[:len(unity.c)-2] + ".d"
+	unity.inputs = append([]string{unity.c}, unityInputs(objs)...)
+	unity.sources = mod.Files
+	return []objectFile{unity}
+}
+
+// unityInputs returns the generated .c files of objs in a stable order
+func unityInputs(objs []objectFile) []string {
+	var cFiles []string
+	for _, obj := range objs {
+		cFiles = append(cFiles, obj.c)
+	}
+	sort.Strings(cFiles)
+	return cFiles
+}
+
+// writeUnitySources writes each module's unity translation unit, which
+// #includes the module's generated .c files so their #line directives still
+// point at the .cm sources. The files' CFLAGS and LDFLAGS are merged into
+// the unity file's entry in fileFlags. A unity file is only rewritten when
+// its contents change, so an unchanged module is not recompiled.
+func writeUnitySources(proj *project.Project, buildDir string, fileFlags map[string]*FileFlags, opts Options) error {
+	perFile := opts
+	perFile.Unity = false
+	for _, mod := range proj.Modules {
+		var sb bytes.Buffer
+		sb.WriteString("// Unity build of module " + mod.ImportPath + ". Generated by c_minus - do not edit.\n")
+		merged := &FileFlags{}
+		seen := make(map[string]bool)
+		for _, cFile := range unityInputs(moduleObjects(mod, buildDir, perFile)) {
+			fmt.Fprintf(&sb, "#include %q\n", cFile)
+			if flags := fileFlags[cFile]; flags != nil {
+				for _, f := range flags.CFlags {
+					if !seen[f] {
+						seen[f] = true
+						merged.CFlags = append(merged.CFlags, f)
+					}
+				}
+				merged.LDFlags = append(merged.LDFlags, flags.LDFlags...)
+			}
+		}
+
+		unityPath := opts.naming().ModuleUnityCFilePath(buildDir, mod.ImportPath)
+		fileFlags[unityPath] = merged
+		opts.manifest.Add(unityPath)
+		if old, err := os.ReadFile(unityPath); err == nil && bytes.Equal(old, sb.Bytes()) {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(unityPath), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", unityPath, err)
+		}
+		if err := os.WriteFile(unityPath, sb.Bytes(), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", unityPath, err)
+		}
+	}
+	return nil
+}
+
+// checkUnityStatics reports static globals of the same name in two files of
+// a module. They are separate variables in separate translation units, but
+// would be redefinitions once the files are merged into one.
+func checkUnityStatics(mod *project.ModuleInfo, files []*parser.File) error {
+	type location struct {
+		path string
+		line int
+	}
+	seen := make(map[string]location)
+
+	for i, file := range files {
+		for _, decl := range file.Decls {
+			g := decl.Global
+			if g == nil || !g.Static {
+				continue
+			}
+			loc := location{path: mod.Files[i], line: g.Line}
+			if first, ok := seen[g.Name]; ok && first.path != loc.path {
+				return fmt.Errorf("static global %q in module %s is declared in two files, which --unity merges into one translation unit; rename one or build without --unity:\n  %s:%d\n  %s:%d",
+					g.Name, mod.ImportPath, first.path, first.line, loc.path, loc.line)
+			}
+			seen[g.Name] = loc
+		}
+	}
+
+	return nil
+}
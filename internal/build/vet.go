@@ -0,0 +1,48 @@
+package build
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/elijahmorgan/c_minus/internal/check"
+	"github.com/elijahmorgan/c_minus/internal/parser"
+	"github.com/elijahmorgan/c_minus/internal/project"
+)
+
+// Vet parses every module and runs the analysis passes selected by opts
+// without generating or compiling anything. Warnings are written to w; the
+// count is returned. Parse errors of every file are reported together.
+func Vet(proj *project.Project, opts check.Options, w io.Writer) (int, error) {
+	modules := make([]*project.ModuleInfo, 0, len(proj.Modules))
+	for _, mod := range proj.Modules {
+		modules = append(modules, mod)
+	}
+	sort.Slice(modules, func(i, j int) bool { return modules[i].ImportPath < modules[j].ImportPath })
+
+	parsed := make(map[string][]*parser.File, len(modules))
+	var parseErrs []error
+	for _, mod := range modules {
+		for _, filePath := range mod.Files {
+			file, err := parser.ParseFile(filePath)
+			if err != nil {
+				parseErrs = append(parseErrs, fmt.Errorf("failed to parse %s: %w", filePath, err))
+				continue
+			}
+			parsed[mod.ImportPath] = append(parsed[mod.ImportPath], file)
+		}
+	}
+	if len(parseErrs) > 0 {
+		return 0, errors.Join(parseErrs...)
+	}
+
+	warnings := 0
+	for _, mod := range modules {
+		for _, warning := range check.Files(mod.Files, parsed[mod.ImportPath], opts) {
+			fmt.Fprintln(w, warning)
+			warnings++
+		}
+	}
+	return warnings, nil
+}
@@ -0,0 +1,282 @@
+// Package check implements analysis passes that report warnings about C-minus source.
+package check
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/elijahmorgan/c_minus/internal/parser"
+	"github.com/elijahmorgan/c_minus/internal/transform"
+)
+
+// Rule names, used in warnings and in "// cminus:ignore <rule>" comments
+const (
+	RuleUnusedImport   = "unused-import"
+	RuleShadowedImport = "shadowed-import"
+	RulePubInMain      = "pub-in-main"
+	RuleDuplicateEnum  = "duplicate-enum-member"
+	RuleMissingReturn  = "missing-return"
+
+	// RuleUndefinedIdentifier and RuleIncompleteSwitch are heuristic and only
+	// run with Options.Heuristics
+	RuleUndefinedIdentifier = "undefined-identifier"
+	RuleIncompleteSwitch    = "incomplete-switch"
+
+	// RuleUnusedPrivate only runs with Options.Unused
+	RuleUnusedPrivate = "unused-private"
+
+	// RuleConstParam only runs with Options.ConstParams
+	RuleConstParam = "const-param"
+)
+
+// Options selects optional analysis passes
+type Options struct {
+	Heuristics  bool // Run heuristic passes that may miss cases (enabled by --checks)
+	Unused      bool // Report private declarations never used in their module (enabled by --unused)
+	NoImports   bool // Skip the unused-import pass (enabled by --no-unused-imports)
+	ConstParams bool // Suggest const for pointer parameters only read through (enabled by vet --const-params)
+}
+
+// Warning is a diagnostic that does not stop the build on its own
+type Warning struct {
+	File     string
+	Line     int // 1-based line number
+	DeclLine int // Line of the enclosing declaration if it differs from Line (0 otherwise)
+	Rule     string
+	Msg      string
+}
+
+// String formats the warning like a compiler diagnostic
+func (w Warning) String() string {
+	return fmt.Sprintf("%s:%d: warning: %s [%s]", w.File, w.Line, w.Msg, w.Rule)
+}
+
+// Files runs every pass over the parsed files of one module.
+// paths[i] is the source path of files[i]. Warnings silenced by a
+// "// cminus:ignore <rule>" comment above the item or its enclosing
+// declaration are dropped.
+func Files(paths []string, files []*parser.File, opts Options) []Warning {
+	module := moduleSymbols(files)
+
+	byPath := make(map[string]*parser.File, len(files))
+	var all []Warning
+	for i, file := range files {
+		byPath[paths[i]] = file
+		all = append(all, checkFile(paths[i], file, module, opts)...)
+	}
+	all = append(all, duplicateEnumMembers(paths, files)...)
+	all = append(all, missingReturns(paths, files)...)
+	if opts.Heuristics {
+		all = append(all, incompleteSwitches(paths, files)...)
+	}
+	if opts.Unused {
+		all = append(all, unusedDecls(paths, files)...)
+	}
+	if opts.ConstParams {
+		all = append(all, constParams(paths, files)...)
+	}
+
+	var warnings []Warning
+	for _, w := range all {
+		file := byPath[w.File]
+		if file.Ignored(w.Line, w.Rule) || (w.DeclLine > 0 && file.Ignored(w.DeclLine, w.Rule)) {
+			continue
+		}
+		warnings = append(warnings, w)
+	}
+
+	sort.SliceStable(warnings, func(i, j int) bool {
+		if warnings[i].File != warnings[j].File {
+			return warnings[i].File < warnings[j].File
+		}
+		return warnings[i].Line < warnings[j].Line
+	})
+	return warnings
+}
+
+func checkFile(path string, file *parser.File, module map[string]bool, opts Options) []Warning {
+	importMap, err := transform.BuildImportMap(file.Imports)
+	if err != nil {
+		// Prefix collisions are reported as errors by code generation
+		return nil
+	}
+	cimportMap, err := transform.BuildCImportMap(file.CImports)
+	if err != nil {
+		return nil
+	}
+
+	var warnings []Warning
+	if !opts.NoImports {
+		warnings = append(warnings, unusedImports(path, file, importMap)...)
+	}
+	warnings = append(warnings, shadowedImports(path, file, importMap, cimportMap)...)
+	warnings = append(warnings, pubInMain(path, file)...)
+	if opts.Heuristics {
+		warnings = append(warnings, undefinedIdentifiers(path, file, module, importMap, cimportMap)...)
+	}
+	return warnings
+}
+
+// unusedImports reports c_minus imports whose prefix is never used for
+// qualified access. C imports are not checked: headers are often included
+// only for macros or types that are used without a prefix.
+func unusedImports(path string, file *parser.File, importMap transform.ImportMap) []Warning {
+	texts := referenceTexts(file)
+
+	var warnings []Warning
+	for _, imp := range file.Imports {
+		prefix := ""
+		for p, full := range importMap {
+			if full == imp.Path {
+				prefix = p
+				break
+			}
+		}
+		used := regexp.MustCompile(`(^|[^A-Za-z0-9_.>])` + regexp.QuoteMeta(prefix) + `\s*\.`)
+
+		found := false
+		for _, text := range texts {
+			if used.MatchString(text) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			warnings = append(warnings, Warning{
+				File: path,
+				Line: imp.Line,
+				Rule: RuleUnusedImport,
+				Msg:  fmt.Sprintf("import %q is not used", imp.Path),
+			})
+		}
+	}
+	return warnings
+}
+
+// referenceTexts collects every piece of the file that may contain a
+// qualified reference to an imported module
+func referenceTexts(file *parser.File) []string {
+	var texts []string
+	for _, decl := range file.Decls {
+		switch {
+		case decl.Function != nil:
+			texts = append(texts, decl.Function.ReturnType, decl.Function.Body)
+			for _, p := range decl.Function.Params {
+				texts = append(texts, p.Type)
+			}
+		case decl.Struct != nil:
+			texts = append(texts, decl.Struct.Body)
+		case decl.Union != nil:
+			texts = append(texts, decl.Union.Body)
+		case decl.Enum != nil:
+			texts = append(texts, decl.Enum.Body)
+		case decl.Typedef != nil:
+			texts = append(texts, decl.Typedef.Body)
+		case decl.Global != nil:
+			texts = append(texts, decl.Global.Type, decl.Global.Value)
+		case decl.Define != nil:
+			texts = append(texts, decl.Define.Value)
+		case decl.Use != nil:
+			texts = append(texts, decl.Use.Module+"."+decl.Use.Name)
+		}
+	}
+	return texts
+}
+
+// shadowedImports reports parameters named like an import prefix. Inside the
+// function the prefix then refers to the parameter, so qualified access to the
+// module is no longer possible.
+func shadowedImports(path string, file *parser.File, importMap transform.ImportMap, cimportMap transform.CImportMap) []Warning {
+	var warnings []Warning
+	for _, decl := range file.Decls {
+		fn := decl.Function
+		if fn == nil {
+			continue
+		}
+		for _, p := range fn.Params {
+			kind := ""
+			if _, ok := importMap[p.Name]; ok {
+				kind = "import"
+			} else if _, ok := cimportMap[p.Name]; ok {
+				kind = "cimport"
+			}
+			if kind == "" {
+				continue
+			}
+			warnings = append(warnings, Warning{
+				File: path,
+				Line: fn.Line,
+				Rule: RuleShadowedImport,
+				Msg:  fmt.Sprintf("parameter %q of %s shadows %s prefix %q", p.Name, fn.Name, kind, p.Name),
+			})
+		}
+	}
+	return warnings
+}
+
+// pubInMain reports pub declarations in the main module. main is the program's
+// entry point and cannot be imported, so pub only adds the symbol to main.h.
+func pubInMain(path string, file *parser.File) []Warning {
+	if file.Module == nil || file.Module.Path != "main" {
+		return nil
+	}
+
+	var warnings []Warning
+	for _, decl := range file.Decls {
+		d, ok := describeDecl(decl)
+		if !ok || !d.public {
+			continue
+		}
+		warnings = append(warnings, Warning{
+			File: path,
+			Line: d.line,
+			Rule: RulePubInMain,
+			Msg:  fmt.Sprintf("pub %s %q in module main cannot be imported", d.kind, d.name),
+		})
+	}
+	return warnings
+}
+
+// duplicateEnumMembers reports enum members declared by more than one enum in
+// a module. A bare member name in a body resolves to the last enum declaring
+// it, so the others must be written with their enum type ("Status.OK").
+func duplicateEnumMembers(paths []string, files []*parser.File) []Warning {
+	first := make(map[string]string) // member -> enum that declared it first
+
+	var warnings []Warning
+	for i, file := range files {
+		for _, decl := range file.Decls {
+			e := decl.Enum
+			if e == nil {
+				continue
+			}
+			for _, member := range enumValues(e.Body) {
+				other, ok := first[member]
+				if !ok {
+					first[member] = e.Name
+					continue
+				}
+				msg := fmt.Sprintf("enum member %q is declared in both %s and %s", member, enumLabel(other), enumLabel(e.Name))
+				if other != "" && e.Name != "" {
+					msg += fmt.Sprintf("; write %s.%s or %s.%s instead of the bare name", other, member, e.Name, member)
+				}
+				warnings = append(warnings, Warning{
+					File: paths[i],
+					Line: e.Line,
+					Rule: RuleDuplicateEnum,
+					Msg:  msg,
+				})
+			}
+		}
+	}
+	return warnings
+}
+
+// enumLabel names an enum in messages
+func enumLabel(name string) string {
+	if name == "" {
+		return "an anonymous enum"
+	}
+	return name
+}
@@ -0,0 +1,589 @@
+package check
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/elijahmorgan/c_minus/internal/diag"
+	"github.com/elijahmorgan/c_minus/internal/parser"
+)
+
+func parse(t *testing.T, source string) *parser.File {
+	t.Helper()
+	file, err := parser.ParseSource(source, "main.cm")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	return file
+}
+
+func TestUnusedImport(t *testing.T) {
+	file := parse(t, `module "main"
+
+import "math/vec"
+import "io"
+import "log"
+
+func area(vec.Vec2 v) int {
+    return v.x * v.y;
+}
+
+func main() int {
+    io.print("hi");
+    return 0;
+}
+`)
+
+	warnings := Files([]string{"main.cm"}, []*parser.File{file}, Options{})
+	if len(warnings) != 1 {
+		t.Fatalf("expected 1 warning, got %v", warnings)
+	}
+	w := warnings[0]
+	if w.Rule != RuleUnusedImport || w.Line != 5 {
+		t.Errorf("unexpected warning %+v", w)
+	}
+	if got := w.String(); got != `main.cm:5: warning: import "log" is not used [unused-import]` {
+		t.Errorf("unexpected warning string %q", got)
+	}
+
+	if warnings := Files([]string{"main.cm"}, []*parser.File{file}, Options{NoImports: true}); len(warnings) != 0 {
+		t.Errorf("expected no warnings with NoImports, got %v", warnings)
+	}
+}
+
+func TestShadowedImport(t *testing.T) {
+	file := parse(t, `module "main"
+
+cimport "stdio.h"
+import "config"
+
+func show(int config, int stdio) int {
+    return config + stdio;
+}
+
+func main() int {
+    return config.get();
+}
+`)
+
+	warnings := Files([]string{"main.cm"}, []*parser.File{file}, Options{})
+	if len(warnings) != 2 {
+		t.Fatalf("expected 2 warnings, got %v", warnings)
+	}
+	for _, w := range warnings {
+		if w.Rule != RuleShadowedImport || w.Line != 6 {
+			t.Errorf("unexpected warning %+v", w)
+		}
+	}
+}
+
+func TestIgnoreComment(t *testing.T) {
+	file := parse(t, `module "main"
+
+// cminus:ignore unused-import
+import "log"
+import "trace"
+
+// cminus:ignore shadowed-import, unused-import
+// show prints a config value
+func show(int trace) int {
+    return trace;
+}
+
+func main() int {
+    return 0;
+}
+`)
+
+	warnings := Files([]string{"main.cm"}, []*parser.File{file}, Options{})
+	if len(warnings) != 1 {
+		t.Fatalf("expected 1 warning, got %v", warnings)
+	}
+	if w := warnings[0]; w.Rule != RuleUnusedImport || w.Line != 5 {
+		t.Errorf("expected unused import on line 5, got %+v", w)
+	}
+}
+
+func TestUndefinedIdentifier(t *testing.T) {
+	file := parse(t, `module "main"
+
+cimport "stdio.h"
+cimport "string.h"
+
+import "util"
+
+#define LIMIT 10
+
+int total = 0;
+
+func helper(int n) int {
+    return n * 2;
+}
+
+func main() int {
+    int count = 0;
+    char buf[16], *p = buf;
+    int (*fn)(int) = helper;
+    size_t len = strlen("abc");
+    for (int i = 0; i < LIMIT; i++) {
+        count += fn(i) + util.scale(i);
+    }
+    /* totl in a comment is fine */
+    stdio.printf("%d %s\n", count, "totl");
+    printf("%zu %p\n", len, p);
+    total = count + totl;
+    return does_not_exist;
+}
+`)
+
+	if got := Files([]string{"main.cm"}, []*parser.File{file}, Options{}); len(got) != 0 {
+		t.Fatalf("heuristic pass must be opt-in, got %v", got)
+	}
+
+	warnings := Files([]string{"main.cm"}, []*parser.File{file}, Options{Heuristics: true})
+	if len(warnings) != 2 {
+		t.Fatalf("expected 2 warnings, got %v", warnings)
+	}
+	if w := warnings[0]; w.Rule != RuleUndefinedIdentifier || w.Line != 27 || w.Msg != `"totl" is not declared in main` {
+		t.Errorf("unexpected warning %+v", w)
+	}
+	if w := warnings[1]; w.Line != 28 || w.Msg != `"does_not_exist" is not declared in main` {
+		t.Errorf("unexpected warning %+v", w)
+	}
+}
+
+func TestUndefinedIdentifierIgnoredOnFunction(t *testing.T) {
+	file := parse(t, `module "main"
+
+// cminus:ignore undefined-identifier
+func main() int {
+    return from_linker_script;
+}
+`)
+
+	if got := Files([]string{"main.cm"}, []*parser.File{file}, Options{Heuristics: true}); len(got) != 0 {
+		t.Fatalf("expected the function-level ignore to apply, got %v", got)
+	}
+}
+
+func TestUnusedPrivate(t *testing.T) {
+	a := parse(t, `module "geo"
+
+#define USED_LIMIT 4
+#define DEAD_LIMIT 8
+
+struct Node { struct Node *next; };
+struct Point { int x; };
+enum Color { RED, GREEN };
+typedef int (*handler)(int);
+typedef int Counter;
+typedef void (*Table[4])(int);
+
+int hits = 0;
+int stale = 0;
+
+pub struct Shared { int v; };
+
+func helper(Point p) int {
+    return p.x + GREEN + USED_LIMIT;
+}
+
+func recurse(int n) int {
+    return n == 0 ? 0 : recurse(n - 1);
+}
+
+func main() int {
+    Counter c = helper((Point){1});
+    hits++;
+    return c + from_b();
+}
+`)
+	b := parse(t, `module "geo"
+
+// cminus:ignore unused-private
+func debug_dump() void {
+}
+
+func from_b() int {
+    return 0;
+}
+`)
+	paths := []string{"a.cm", "b.cm"}
+	files := []*parser.File{a, b}
+
+	if got := Files(paths, files, Options{}); len(got) != 0 {
+		t.Fatalf("unused pass must be opt-in, got %v", got)
+	}
+
+	var got []string
+	for _, w := range Files(paths, files, Options{Unused: true}) {
+		if w.Rule != RuleUnusedPrivate {
+			t.Fatalf("unexpected warning %v", w)
+		}
+		got = append(got, w.String())
+	}
+	want := []string{
+		`a.cm:4: warning: private define "DEAD_LIMIT" is never used [unused-private]`,
+		`a.cm:6: warning: private struct "Node" is never used [unused-private]`,
+		`a.cm:9: warning: private typedef "handler" is never used [unused-private]`,
+		`a.cm:11: warning: private typedef "Table" is never used [unused-private]`,
+		`a.cm:14: warning: private global "stale" is never used [unused-private]`,
+		`a.cm:22: warning: private function "recurse" is never used [unused-private]`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestPubInMain(t *testing.T) {
+	file := parse(t, `module "main"
+
+pub struct Config { int verbose; };
+
+// cminus:ignore pub-in-main
+pub func exported_for_tests() int {
+    return 1;
+}
+
+pub #define VERSION 2
+
+func main() int {
+    return 0;
+}
+`)
+
+	warnings := Files([]string{"main.cm"}, []*parser.File{file}, Options{})
+	if len(warnings) != 2 {
+		t.Fatalf("expected 2 warnings, got %v", warnings)
+	}
+	if got := warnings[0].String(); got != `main.cm:3: warning: pub struct "Config" in module main cannot be imported [pub-in-main]` {
+		t.Errorf("unexpected warning %q", got)
+	}
+	if w := warnings[1]; w.Rule != RulePubInMain || w.Line != 10 {
+		t.Errorf("unexpected warning %+v", w)
+	}
+
+	lib := parse(t, "module \"util\"\n\npub func f() int {\n    return 0;\n}\n")
+	if got := Files([]string{"util.cm"}, []*parser.File{lib}, Options{}); len(got) != 0 {
+		t.Errorf("pub outside main must not warn, got %v", got)
+	}
+}
+
+func TestDuplicateEnumMember(t *testing.T) {
+	a := parse(t, `module "net"
+
+pub enum Status { OK, FAILED };
+`)
+	b := parse(t, `module "net"
+
+enum Result { OK = 1, RETRY };
+
+// cminus:ignore duplicate-enum-member
+enum Legacy { RETRY };
+`)
+
+	warnings := Files([]string{"a.cm", "b.cm"}, []*parser.File{a, b}, Options{})
+	if len(warnings) != 1 {
+		t.Fatalf("expected 1 warning, got %v", warnings)
+	}
+	want := `b.cm:3: warning: enum member "OK" is declared in both Status and Result; write Status.OK or Result.OK instead of the bare name [duplicate-enum-member]`
+	if got := warnings[0].String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRulesHaveDiagnosticCodes(t *testing.T) {
+	rules := []string{RuleUnusedImport, RuleShadowedImport, RulePubInMain, RuleDuplicateEnum, RuleMissingReturn, RuleUndefinedIdentifier, RuleUnusedPrivate, RuleConstParam, RuleIncompleteSwitch}
+	for _, rule := range rules {
+		if _, ok := diag.Lookup(rule); !ok {
+			t.Errorf("rule %s has no diagnostic code", rule)
+		}
+	}
+}
+
+func TestDuplicateAnonymousEnumMember(t *testing.T) {
+	file := parse(t, `module "net"
+
+enum { OK, RETRY };
+enum Status { OK };
+`)
+
+	warnings := Files([]string{"a.cm"}, []*parser.File{file}, Options{Unused: true})
+	if len(warnings) != 1 {
+		t.Fatalf("expected 1 warning, got %v", warnings)
+	}
+	want := `a.cm:4: warning: enum member "OK" is declared in both an anonymous enum and Status [duplicate-enum-member]`
+	if got := warnings[0].String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestMissingReturn(t *testing.T) {
+	file := parse(t, `module "main"
+
+cimport "stdlib.h"
+
+func falls(int x) int {
+    if (x) {
+        return 1;
+    }
+}
+
+func half(int x) int {
+    if (x > 0) return 1;
+    else x = 0;
+}
+
+func returns(int x) int {
+    if (x) {
+        return 1;
+    }
+    return 0;
+}
+
+func branches(int x) int {
+    if (x) {
+        return 1;
+    } else if (x > 1) {
+        return 2;
+    } else {
+        return 3;
+    }
+}
+
+func loops() int {
+    for (;;) {
+        continue;
+    }
+}
+
+func spins() int {
+    while (1) {
+    }
+}
+
+func cleanup(int x) int {
+    int rc = 0;
+    goto out;
+out:
+    return rc;
+}
+
+func dispatch(int x) int {
+    switch (x) {
+    case 1:
+        return 1;
+    default:
+        return 0;
+    }
+}
+
+func fatal() int {
+    abort();
+}
+
+// cminus:attr __attribute__((noreturn))
+func die(int code) void {
+    exit(code);
+}
+
+func checked(int x) int {
+    if (x) {
+        return x;
+    }
+    die(1);
+}
+
+func nothing() void {
+    if (1) {
+        return;
+    }
+}
+
+// cminus:ignore missing-return
+func ignored() int {
+}
+
+func main() int {
+}
+`)
+
+	warnings := Files([]string{"main.cm"}, []*parser.File{file}, Options{})
+	var got []string
+	for _, w := range warnings {
+		if w.Rule != RuleMissingReturn {
+			t.Errorf("unexpected warning %+v", w)
+		}
+		got = append(got, w.String())
+	}
+	want := []string{
+		`main.cm:5: warning: function falls returns int but may reach the end of its body without a return [missing-return]`,
+		`main.cm:11: warning: function half returns int but may reach the end of its body without a return [missing-return]`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestConstParams(t *testing.T) {
+	file := parse(t, `module "shapes"
+
+pub struct Rect { int w; int h; int cells[4]; };
+
+pub func area(Rect* r) int {
+    if (r == NULL || !r) {
+        return 0;
+    }
+    return r->w * r->h + r->cells[0] + sizeof(*r);
+}
+
+pub func sum(int* values, int n) int {
+    int total = 0;
+    for (int i = 0; i < n; i++) {
+        total += values[i];
+    }
+    return total;
+}
+
+pub func grow(Rect* r) void {
+    r->w = r->w * 2;
+}
+
+pub func bump(Rect* r) void {
+    r->cells[1]++;
+}
+
+pub func fill(int* out) void {
+    *out = 1;
+}
+
+pub func clear(Rect* r) void {
+    reset(r);
+}
+
+pub func address(Rect* r) int* {
+    return &r->w;
+}
+
+pub func shift(Rect* r) void {
+    r->h <<= 1;
+}
+
+pub func named(const Rect* r, void* data, Rect** all) int {
+    return r->w;
+}
+
+pub func unused(Rect* r) int {
+    return 0;
+}
+
+pub func copied(Rect* r) Rect* {
+    Rect* other = r;
+    return other;
+}
+`)
+
+	warnings := Files([]string{"shapes.cm"}, []*parser.File{file}, Options{ConstParams: true})
+	var got []string
+	for _, w := range warnings {
+		if w.Rule == RuleConstParam {
+			got = append(got, w.String())
+		}
+	}
+	want := []string{
+		"shapes.cm:5: warning: parameter r of area is only read through; declare it const Rect* [const-param]",
+		"shapes.cm:12: warning: parameter values of sum is only read through; declare it const int* [const-param]",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// The rule is opt-in
+	for _, w := range Files([]string{"shapes.cm"}, []*parser.File{file}, Options{}) {
+		if w.Rule == RuleConstParam {
+			t.Errorf("unexpected warning without ConstParams: %s", w)
+		}
+	}
+}
+
+func TestIncompleteSwitch(t *testing.T) {
+	file := parse(t, `module "job"
+
+enum Status { PENDING, RUNNING, DONE, FAILED };
+
+func missing(Status s) int {
+    switch (s) {
+    case PENDING:
+        return 1;
+    case Status.DONE:
+        return 2;
+    }
+    return 0;
+}
+
+func complete(Status s) int {
+    switch (s) {
+    case PENDING:
+    case RUNNING:
+        return 1;
+    case DONE:
+    case FAILED: {
+        return 2;
+    }
+    }
+    return 0;
+}
+
+func defaulted(Status s) int {
+    switch (s) {
+    case PENDING:
+        return 1;
+    default:
+        return 0;
+    }
+}
+
+func local(int code) int {
+    Status st = (Status)code;
+    switch (st) {
+    case RUNNING:
+        switch (code) {
+        case 1:
+            return 1;
+        default:
+            return 2;
+        }
+    case PENDING:
+    case DONE:
+        return 3;
+    }
+    switch (code) {
+    case 1:
+        return 4;
+    }
+    return 0;
+}
+`)
+
+	warnings := Files([]string{"job.cm"}, []*parser.File{file}, Options{Heuristics: true})
+	var got []string
+	for _, w := range warnings {
+		if w.Rule == RuleIncompleteSwitch {
+			got = append(got, w.String())
+		}
+	}
+	want := []string{
+		"job.cm:6: warning: switch over Status has no default and does not handle RUNNING, FAILED [incomplete-switch]",
+		"job.cm:39: warning: switch over Status has no default and does not handle FAILED [incomplete-switch]",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// The check is heuristic and opt-in
+	for _, w := range Files([]string{"job.cm"}, []*parser.File{file}, Options{}) {
+		if w.Rule == RuleIncompleteSwitch {
+			t.Errorf("unexpected warning without Heuristics: %s", w)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package check
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/elijahmorgan/c_minus/internal/parser"
+)
+
+// nonCallKeywords may precede a parenthesis that is not a function call
+var nonCallKeywords = map[string]bool{
+	"if":       true,
+	"while":    true,
+	"for":      true,
+	"switch":   true,
+	"return":   true,
+	"sizeof":   true,
+	"alignof":  true,
+	"_Alignof": true,
+}
+
+// constParams reports pointer parameters that the function only reads
+// through, which could be declared const. The check is textual and stays
+// quiet whenever a use could write: the parameter (or anything reached
+// through it) must never be assigned, incremented, have its address taken,
+// be passed to a call, or be copied elsewhere. Only single-level pointers to
+// non-void types without any const are considered.
+// paths[i] is the source path of files[i].
+func constParams(paths []string, files []*parser.File) []Warning {
+	var warnings []Warning
+	for i, file := range files {
+		for _, decl := range file.Decls {
+			fn := decl.Function
+			if fn == nil || strings.TrimSpace(fn.Body) == "" {
+				continue
+			}
+			tokens := lexBody(fn.Body)
+			for _, p := range fn.Params {
+				if !constCandidate(p.Type) || !onlyReadThrough(tokens, p.Name) {
+					continue
+				}
+				warnings = append(warnings, Warning{
+					File: paths[i],
+					Line: fn.Line,
+					Rule: RuleConstParam,
+					Msg:  fmt.Sprintf("parameter %s of %s is only read through; declare it const %s", p.Name, fn.Name, strings.TrimSpace(p.Type)),
+				})
+			}
+		}
+	}
+	return warnings
+}
+
+// constCandidate reports whether a parameter type is a single-level pointer
+// to a non-void type with no const qualifier
+func constCandidate(typ string) bool {
+	typ = strings.TrimSpace(typ)
+	if strings.Count(typ, "*") != 1 || !strings.HasSuffix(typ, "*") || strings.ContainsAny(typ, "()[") {
+		return false
+	}
+	for _, word := range strings.Fields(strings.TrimSuffix(typ, "*")) {
+		if word == "const" || word == "void" {
+			return false
+		}
+	}
+	return true
+}
+
+// onlyReadThrough reports whether every use of name in the body reads through
+// the pointer, and there is at least one such read
+func onlyReadThrough(tokens []bodyToken, name string) bool {
+	reads := 0
+	var calls []bool // Whether each open parenthesis is a call's argument list
+	for i, tok := range tokens {
+		switch tok.text {
+		case "(":
+			call := false
+			if i > 0 {
+				prev := tokens[i-1]
+				call = (prev.ident && !nonCallKeywords[prev.text]) || prev.text == ")" || prev.text == "]"
+			}
+			calls = append(calls, call)
+			continue
+		case ")":
+			if len(calls) > 0 {
+				calls = calls[:len(calls)-1]
+			}
+			continue
+		}
+		if !tok.ident || tok.text != name {
+			continue
+		}
+		// A member of the same name ("x.name") is not the parameter
+		if i > 0 && (tokens[i-1].text == "." || tokens[i-1].text == "->") {
+			continue
+		}
+		for _, call := range calls {
+			if call {
+				return false
+			}
+		}
+
+		start, end := i, i+1
+		deref := false
+		if i > 0 && tokens[i-1].text == "*" && isUnaryStar(tokens, i-1) {
+			start, deref = i-1, true
+		}
+		// Follow member accesses and subscripts: p->a.b[i]
+		for end < len(tokens) {
+			if (tokens[end].text == "->" || tokens[end].text == ".") && end+1 < len(tokens) && tokens[end+1].ident {
+				if tokens[end].text == "->" && end == i+1 {
+					deref = true
+				}
+				end += 2
+			} else if tokens[end].text == "[" {
+				if end == i+1 {
+					deref = true
+				}
+				end = skipBrackets(tokens, end)
+			} else {
+				break
+			}
+		}
+		if !deref {
+			// Comparing the pointer itself (p == NULL, !p) is fine too
+			if !isCompared(tokens, i) {
+				return false
+			}
+			continue
+		}
+		// (*p).x and (*p)[i] continue after the parenthesis
+		if start < i && end < len(tokens)-1 && tokens[end].text == ")" {
+			if after := tokens[end+1].text; after == "." || after == "->" || after == "[" {
+				return false
+			}
+		}
+		if isWritten(tokens, start, end) {
+			return false
+		}
+		reads++
+	}
+	return reads > 0
+}
+
+// isCompared reports whether the identifier at i is an operand of == or !=,
+// or of !
+func isCompared(tokens []bodyToken, i int) bool {
+	text := func(j int) string {
+		if j >= 0 && j < len(tokens) {
+			return tokens[j].text
+		}
+		return ""
+	}
+	if (text(i+1) == "=" || text(i+1) == "!") && text(i+2) == "=" {
+		return true
+	}
+	if text(i-1) == "=" && (text(i-2) == "=" || text(i-2) == "!") {
+		return true
+	}
+	return text(i-1) == "!"
+}
+
+// isUnaryStar reports whether the * at index i dereferences rather than
+// multiplies
+func isUnaryStar(tokens []bodyToken, i int) bool {
+	if i == 0 {
+		return true
+	}
+	prev := tokens[i-1]
+	if prev.ident {
+		return nonCallKeywords[prev.text]
+	}
+	return prev.text != ")" && prev.text != "]" && !isNumber(prev.text) && prev.text != "literal"
+}
+
+func isNumber(text string) bool {
+	return text != "" && text[0] >= '0' && text[0] <= '9'
+}
+
+// skipBrackets returns the index after the ] matching the [ at i
+func skipBrackets(tokens []bodyToken, i int) int {
+	depth := 0
+	for ; i < len(tokens); i++ {
+		switch tokens[i].text {
+		case "[":
+			depth++
+		case "]":
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return i
+}
+
+// isWritten reports whether the expression tokens[start:end] is modified or
+// escapes: assigned (=, op=), incremented, decremented, has its address
+// taken, or is called through
+func isWritten(tokens []bodyToken, start, end int) bool {
+	at := func(i int) string {
+		if i >= 0 && i < len(tokens) {
+			return tokens[i].text
+		}
+		return ""
+	}
+
+	// Prefix: &x (not &&x), ++x, --x
+	prev, prev2 := at(start-1), at(start-2)
+	if prev == "&" && prev2 != "&" {
+		return true
+	}
+	if (prev == "+" && prev2 == "+") || (prev == "-" && prev2 == "-") {
+		return true
+	}
+
+	next, next2, next3 := at(end), at(end+1), at(end+2)
+	switch {
+	case next == "(":
+		return true
+	case next == "=" && next2 != "=":
+		return true
+	case (next == "+" && next2 == "+") || (next == "-" && next2 == "-"):
+		return true
+	case strings.Contains("+-*/%&|^", next) && next != "" && next2 == "=":
+		return true
+	case (next == "<" || next == ">") && next2 == next && next3 == "=":
+		return true
+	}
+	return false
+}
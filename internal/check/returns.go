@@ -0,0 +1,269 @@
+package check
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/elijahmorgan/c_minus/internal/parser"
+)
+
+// noreturnCalls are C library functions that never return to their caller
+var noreturnCalls = map[string]bool{
+	"abort":                 true,
+	"exit":                  true,
+	"_Exit":                 true,
+	"quick_exit":            true,
+	"longjmp":               true,
+	"siglongjmp":            true,
+	"unreachable":           true,
+	"__builtin_unreachable": true,
+	"__builtin_trap":        true,
+}
+
+// missingReturns reports non-void functions whose body can reach its closing
+// brace. This is not full control-flow analysis: only the last statement of
+// the body is inspected, and it ends the function if it is a return, a goto,
+// an infinite loop, a call to a noreturn function, an if/else whose branches
+// all end the function, or a switch with a default label. Anything it cannot
+// follow is assumed to return, so the pass errs toward silence.
+// paths[i] is the source path of files[i].
+func missingReturns(paths []string, files []*parser.File) []Warning {
+	noreturn := make(map[string]bool, len(noreturnCalls))
+	for name := range noreturnCalls {
+		noreturn[name] = true
+	}
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			if fn := decl.Function; fn != nil && hasNoreturnAttr(fn.Attrs) {
+				noreturn[fn.Name] = true
+			}
+		}
+	}
+
+	var warnings []Warning
+	for i, file := range files {
+		for _, decl := range file.Decls {
+			fn := decl.Function
+			// main returns 0 when it falls off the end
+			if fn == nil || fn.Name == "main" || fn.ReturnType == "" || fn.ReturnType == "void" ||
+				strings.TrimSpace(fn.Body) == "" || noreturn[fn.Name] {
+				continue
+			}
+			p := &stmtParser{tokens: lexBody(fn.Body), noreturn: noreturn}
+			if p.statement() {
+				continue
+			}
+			warnings = append(warnings, Warning{
+				File: paths[i],
+				Line: fn.Line,
+				Rule: RuleMissingReturn,
+				Msg:  fmt.Sprintf("function %s returns %s but may reach the end of its body without a return", fn.Name, fn.ReturnType),
+			})
+		}
+	}
+	return warnings
+}
+
+func hasNoreturnAttr(attrs []string) bool {
+	for _, attr := range attrs {
+		if strings.Contains(attr, "noreturn") {
+			return true
+		}
+	}
+	return false
+}
+
+// stmtParser walks the statements of a function body
+type stmtParser struct {
+	tokens   []bodyToken
+	pos      int
+	noreturn map[string]bool
+}
+
+func (p *stmtParser) peek(offset int) string {
+	if p.pos+offset < len(p.tokens) {
+		return p.tokens[p.pos+offset].text
+	}
+	return ""
+}
+
+// statement consumes one statement and reports whether control can never
+// continue past it
+func (p *stmtParser) statement() bool {
+	if p.pos >= len(p.tokens) {
+		return false
+	}
+	tok := p.tokens[p.pos]
+
+	switch tok.text {
+	case "}":
+		return false
+	case ";":
+		p.pos++
+		return false
+	case "{":
+		p.pos++
+		ends := false
+		for p.pos < len(p.tokens) && p.peek(0) != "}" {
+			start := p.pos
+			if p.peek(0) == ";" {
+				p.pos++
+				continue
+			}
+			ends = p.statement()
+			if p.pos == start {
+				p.pos++
+			}
+		}
+		p.pos++
+		return ends
+	case "return", "goto":
+		p.skipStatement()
+		return true
+	case "if":
+		p.pos++
+		p.parens()
+		then := p.statement()
+		if p.peek(0) != "else" {
+			return false
+		}
+		p.pos++
+		return p.statement() && then
+	case "while":
+		p.pos++
+		cond := p.parens()
+		p.statement()
+		return isTrueCondition(cond)
+	case "for":
+		p.pos++
+		clauses := splitTopLevel(p.parens(), ";")
+		p.statement()
+		return len(clauses) == 3 && (len(clauses[1]) == 0 || isTrueCondition(clauses[1]))
+	case "do":
+		p.pos++
+		ends := p.statement()
+		var cond []bodyToken
+		if p.peek(0) == "while" {
+			p.pos++
+			cond = p.parens()
+		}
+		if p.peek(0) == ";" {
+			p.pos++
+		}
+		return ends || isTrueCondition(cond)
+	case "switch":
+		p.pos++
+		p.parens()
+		start := p.pos
+		p.statement()
+		for i := start; i+1 < p.pos; i++ {
+			if p.tokens[i].text == "default" && p.tokens[i+1].text == ":" {
+				return true
+			}
+		}
+		return false
+	case "case", "default":
+		// A label belongs to the statement after it
+		for p.pos < len(p.tokens) && p.peek(0) != ":" {
+			p.pos++
+		}
+		p.pos++
+		return p.statement()
+	}
+
+	if tok.ident && p.peek(1) == ":" {
+		p.pos += 2
+		return p.statement()
+	}
+
+	ends := tok.ident && p.noreturn[tok.text] && p.peek(1) == "("
+	p.skipStatement()
+	return ends
+}
+
+// parens consumes a parenthesized group and returns the tokens inside it
+func (p *stmtParser) parens() []bodyToken {
+	if p.peek(0) != "(" {
+		return nil
+	}
+	start := p.pos + 1
+	depth := 0
+	for ; p.pos < len(p.tokens); p.pos++ {
+		switch p.tokens[p.pos].text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth == 0 {
+				p.pos++
+				return p.tokens[start : p.pos-1]
+			}
+		}
+	}
+	return p.tokens[start:]
+}
+
+// skipStatement consumes an expression statement or declaration through its
+// semicolon. A braced group not followed by ; or , ends the statement too, so
+// statement macros ("FOREACH(x) { ... }") do not swallow what follows.
+func (p *stmtParser) skipStatement() {
+	depth := 0
+	for p.pos < len(p.tokens) {
+		switch p.peek(0) {
+		case "(", "[", "{":
+			depth++
+		case ")", "]":
+			depth--
+		case "}":
+			if depth == 0 {
+				return
+			}
+			depth--
+			if depth == 0 && p.peek(1) != ";" && p.peek(1) != "," {
+				p.pos++
+				return
+			}
+		case ";":
+			if depth == 0 {
+				p.pos++
+				return
+			}
+		}
+		p.pos++
+	}
+}
+
+// splitTopLevel splits tokens at each sep outside parentheses
+func splitTopLevel(tokens []bodyToken, sep string) [][]bodyToken {
+	var parts [][]bodyToken
+	depth, start := 0, 0
+	for i, tok := range tokens {
+		switch tok.text {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+		case sep:
+			if depth == 0 {
+				parts = append(parts, tokens[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, tokens[start:])
+}
+
+// isTrueCondition reports whether a loop condition is a constant that is
+// always true ("1", "true")
+func isTrueCondition(cond []bodyToken) bool {
+	if len(cond) != 1 {
+		return false
+	}
+	text := cond[0].text
+	if text == "true" {
+		return true
+	}
+	n, err := strconv.ParseInt(strings.TrimRight(text, "uUlL"), 0, 64)
+	return err == nil && n != 0
+}
@@ -0,0 +1,157 @@
+package check
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/elijahmorgan/c_minus/internal/parser"
+)
+
+// incompleteSwitches reports switches over a variable of one of the module's
+// enum types that have no default label and miss some members. Only a
+// parameter or local declared with the enum type is followed; any other
+// scrutinee, or a case label that is not a plain member name, skips the
+// switch.
+// paths[i] is the source path of files[i].
+func incompleteSwitches(paths []string, files []*parser.File) []Warning {
+	enums := make(map[string][]string) // enum name -> members in order
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			if e := decl.Enum; e != nil && e.Name != "" {
+				enums[e.Name] = enumValues(e.Body)
+			}
+		}
+	}
+	if len(enums) == 0 {
+		return nil
+	}
+
+	var warnings []Warning
+	for i, file := range files {
+		for _, decl := range file.Decls {
+			fn := decl.Function
+			if fn == nil {
+				continue
+			}
+			tokens := lexBody(fn.Body)
+			for pos, tok := range tokens {
+				if tok.text != "switch" {
+					continue
+				}
+				enum, labels, ok := switchOverEnum(tokens, pos, fn.Params, enums)
+				if !ok {
+					continue
+				}
+				var missing []string
+				for _, member := range enums[enum] {
+					if !labels[member] {
+						missing = append(missing, member)
+					}
+				}
+				if len(missing) == 0 {
+					continue
+				}
+				warnings = append(warnings, Warning{
+					File:     paths[i],
+					Line:     fn.Line + tok.line,
+					DeclLine: fn.Line,
+					Rule:     RuleIncompleteSwitch,
+					Msg:      fmt.Sprintf("switch over %s has no default and does not handle %s", enum, strings.Join(missing, ", ")),
+				})
+			}
+		}
+	}
+	return warnings
+}
+
+// switchOverEnum inspects the switch at tokens[pos]. It returns the enum
+// type of the scrutinee and the members named by the switch's own case
+// labels, or false if the scrutinee is not a variable of a known enum type,
+// the switch has a default label, or a label cannot be read.
+func switchOverEnum(tokens []bodyToken, pos int, params []*parser.Param, enums map[string][]string) (string, map[string]bool, bool) {
+	// switch ( name ) {
+	if pos+4 >= len(tokens) || tokens[pos+1].text != "(" || !tokens[pos+2].ident || tokens[pos+3].text != ")" || tokens[pos+4].text != "{" {
+		return "", nil, false
+	}
+	enum := variableEnum(tokens[:pos], tokens[pos+2].text, params, enums)
+	if enum == "" {
+		return "", nil, false
+	}
+
+	labels := make(map[string]bool)
+	depth := 0
+	for i := pos + 4; i < len(tokens); i++ {
+		switch tokens[i].text {
+		case "{":
+			depth++
+		case "}":
+			depth--
+			if depth == 0 {
+				return enum, labels, true
+			}
+		case "switch":
+			// Labels of a nested switch belong to it
+			for i < len(tokens) && tokens[i].text != "{" {
+				i++
+			}
+			i = skipBraces(tokens, i) - 1
+		case "default":
+			if i+1 < len(tokens) && tokens[i+1].text == ":" {
+				return "", nil, false
+			}
+		case "case":
+			// case MEMBER: or case Enum.MEMBER:
+			j := i + 1
+			for j+1 < len(tokens) && tokens[j].ident && tokens[j+1].text == "." {
+				j += 2
+			}
+			if j+1 >= len(tokens) || !tokens[j].ident || tokens[j+1].text != ":" {
+				return "", nil, false
+			}
+			labels[tokens[j].text] = true
+			i = j + 1
+		}
+	}
+	return "", nil, false
+}
+
+// variableEnum returns the module enum a parameter or an earlier local named
+// name is declared with, or "" if there is none
+func variableEnum(before []bodyToken, name string, params []*parser.Param, enums map[string][]string) string {
+	for _, p := range params {
+		if p.Name == name {
+			typ := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(p.Type), "enum "))
+			if _, ok := enums[typ]; ok {
+				return typ
+			}
+			return ""
+		}
+	}
+	// The closest declaration "Enum name" before the switch
+	for k := len(before) - 2; k >= 0; k-- {
+		if before[k+1].text != name {
+			continue
+		}
+		if _, ok := enums[before[k].text]; ok && before[k].ident {
+			return before[k].text
+		}
+	}
+	return ""
+}
+
+// skipBraces returns the index after the } matching the { at i
+func skipBraces(tokens []bodyToken, i int) int {
+	depth := 0
+	for ; i < len(tokens); i++ {
+		switch tokens[i].text {
+		case "{":
+			depth++
+		case "}":
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return i
+}
@@ -0,0 +1,273 @@
+package check
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/elijahmorgan/c_minus/internal/parser"
+	"github.com/elijahmorgan/c_minus/internal/project"
+	"github.com/elijahmorgan/c_minus/internal/transform"
+)
+
+// predefinedNames are the names besides the C11 keywords (parser.IsCKeyword)
+// that are never undefined
+var predefinedNames = map[string]bool{
+	// C23 keywords
+	"bool": true, "true": true, "false": true, "nullptr": true, "alignof": true,
+	"alignas": true, "static_assert": true, "typeof": true,
+	// Common lowercase names provided by the C library as objects or macros
+	"errno": true, "stdin": true, "stdout": true, "stderr": true, "assert": true,
+}
+
+// declKeywords may directly precede an expression, so the identifier after
+// them is a use, not a declaration
+var declKeywords = map[string]bool{
+	"return": true, "case": true, "goto": true, "sizeof": true, "else": true, "do": true,
+}
+
+type bodyToken struct {
+	text  string
+	ident bool
+	line  int // 0-based line offset within the body
+}
+
+// undefinedIdentifiers reports lowercase identifiers used as values in function
+// bodies that are not parameters, locals, module symbols, import prefixes, or C
+// keywords. It is a heuristic: anything that might be declared elsewhere, such as
+// calls when C headers are imported or names in type position, is not flagged.
+func undefinedIdentifiers(path string, file *parser.File, module map[string]bool, importMap transform.ImportMap, cimportMap transform.CImportMap) []Warning {
+	var warnings []Warning
+	for _, decl := range file.Decls {
+		fn := decl.Function
+		if fn == nil {
+			continue
+		}
+
+		known := make(map[string]bool)
+		for _, p := range fn.Params {
+			known[p.Name] = true
+		}
+
+		tokens := lexBody(fn.Body)
+		reported := make(map[string]bool)
+
+		// A declaration list ("int a, *b = f(x, y);") continues after commas at
+		// the nesting depth where it started
+		depth, declDepth := 0, -1
+		for i, tok := range tokens {
+			if !tok.ident {
+				switch tok.text {
+				case "(", "[":
+					depth++
+				case ")", "]":
+					depth--
+				case ";", "{", "}":
+					declDepth = -1
+				}
+				continue
+			}
+
+			prev, next := tokenText(tokens, i-1), tokenText(tokens, i+1)
+			if isDeclaration(tokens, i) || (declDepth == depth && afterComma(tokens, i)) {
+				known[tok.text] = true
+				declDepth = depth
+				continue
+			}
+
+			name := tok.text
+			switch {
+			case known[name], module[name], parser.IsCKeyword(name), predefinedNames[name]:
+				continue
+			case prev == "." || prev == "->" || prev == "goto":
+				// Field access, qualified member, or label
+				continue
+			case next == ":" || next == ".":
+				// Label, or a prefix that is resolved (or rejected) by the transform
+				continue
+			case i+1 < len(tokens) && tokens[i+1].ident:
+				// Type position: "name var"
+				continue
+			case next == "(" && len(cimportMap) > 0:
+				// Possibly a C library function used without its prefix
+				continue
+			case !isPlainLowercase(name) || strings.HasSuffix(name, "_t"):
+				// Macros, reserved names, and typedef'd types
+				continue
+			}
+			if _, ok := importMap[name]; ok {
+				continue
+			}
+			if _, ok := cimportMap[name]; ok {
+				continue
+			}
+
+			if reported[name] {
+				continue
+			}
+			reported[name] = true
+			warnings = append(warnings, Warning{
+				File:     path,
+				Line:     fn.Line + tok.line,
+				DeclLine: fn.Line,
+				Rule:     RuleUndefinedIdentifier,
+				Msg:      fmt.Sprintf("%q is not declared in %s", name, fn.Name),
+			})
+		}
+	}
+	return warnings
+}
+
+// isDeclaration reports whether tokens[i] is being declared: it follows a type
+// name, possibly with pointer stars ("int *p"), or is a function pointer
+// declarator ("(*fp)")
+func isDeclaration(tokens []bodyToken, i int) bool {
+	j := i - 1
+	for j >= 0 && tokens[j].text == "*" {
+		j--
+	}
+	if j < 0 {
+		return false
+	}
+	if tokens[j].text == "(" && j < i-1 {
+		return true
+	}
+	return tokens[j].ident && !declKeywords[tokens[j].text]
+}
+
+// afterComma reports whether tokens[i] follows a comma, skipping pointer stars
+func afterComma(tokens []bodyToken, i int) bool {
+	j := i - 1
+	for j >= 0 && tokens[j].text == "*" {
+		j--
+	}
+	return j >= 0 && tokens[j].text == ","
+}
+
+func tokenText(tokens []bodyToken, i int) string {
+	if i < 0 || i >= len(tokens) {
+		return ""
+	}
+	return tokens[i].text
+}
+
+// isPlainLowercase reports whether name is a lowercase identifier that does
+// not start with an underscore (reserved and compiler-provided names)
+func isPlainLowercase(name string) bool {
+	if name == "" || !unicode.IsLower(rune(name[0])) {
+		return false
+	}
+	for _, ch := range name {
+		if unicode.IsUpper(ch) {
+			return false
+		}
+	}
+	return true
+}
+
+// moduleSymbols collects the names declared at the top level of a module
+func moduleSymbols(files []*parser.File) map[string]bool {
+	symbols := make(map[string]bool)
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			switch {
+			case decl.Function != nil:
+				symbols[decl.Function.Name] = true
+			case decl.Global != nil:
+				symbols[decl.Global.Name] = true
+			case decl.Define != nil:
+				symbols[decl.Define.Name] = true
+			case decl.Struct != nil:
+				symbols[decl.Struct.Name] = true
+			case decl.Union != nil:
+				symbols[decl.Union.Name] = true
+			case decl.Enum != nil:
+				symbols[decl.Enum.Name] = true
+				for _, name := range enumValues(decl.Enum.Body) {
+					symbols[name] = true
+				}
+			case decl.Typedef != nil:
+				if name := project.TypedefName(decl.Typedef.Body); name != "" {
+					symbols[name] = true
+				}
+			}
+		}
+	}
+	return symbols
+}
+
+// lexBody splits a function body into identifiers and punctuation, dropping
+// whitespace, comments, literals, numbers, and preprocessor lines
+func lexBody(body string) []bodyToken {
+	var tokens []bodyToken
+	line := 0
+	lineStart := true
+
+	for i := 0; i < len(body); {
+		ch := body[i]
+		switch {
+		case ch == '\n':
+			line++
+			lineStart = true
+			i++
+			continue
+		case ch == ' ' || ch == '\t' || ch == '\r':
+			i++
+			continue
+		case ch == '#' && lineStart:
+			for i < len(body) && body[i] != '\n' {
+				i++
+			}
+			continue
+		}
+		lineStart = false
+
+		switch {
+		case strings.HasPrefix(body[i:], "//"):
+			for i < len(body) && body[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(body[i:], "/*"):
+			end := strings.Index(body[i+2:], "*/")
+			if end < 0 {
+				end = len(body) - i - 4
+			}
+			line += strings.Count(body[i:i+2+end+2], "\n")
+			i += 2 + end + 2
+		case ch == '"' || ch == '\'':
+			i++
+			for i < len(body) && body[i] != ch {
+				if body[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			i++
+			tokens = append(tokens, bodyToken{text: "literal", line: line})
+		case isIdentByte(ch) && !(ch >= '0' && ch <= '9'):
+			start := i
+			for i < len(body) && isIdentByte(body[i]) {
+				i++
+			}
+			tokens = append(tokens, bodyToken{text: body[start:i], ident: true, line: line})
+		case ch >= '0' && ch <= '9':
+			// Numbers, including suffixes and hex digits
+			start := i
+			for i < len(body) && (isIdentByte(body[i]) || body[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, bodyToken{text: body[start:i], line: line})
+		case strings.HasPrefix(body[i:], "->"):
+			tokens = append(tokens, bodyToken{text: "->", line: line})
+			i += 2
+		default:
+			tokens = append(tokens, bodyToken{text: string(ch), line: line})
+			i++
+		}
+	}
+	return tokens
+}
+
+func isIdentByte(ch byte) bool {
+	return ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9')
+}
@@ -0,0 +1,145 @@
+package check
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/elijahmorgan/c_minus/internal/parser"
+	"github.com/elijahmorgan/c_minus/internal/project"
+)
+
+// privateDecl is a private top-level declaration that may be unused
+type privateDecl struct {
+	file  int // index into the module's files
+	decl  *parser.Decl
+	kind  string
+	name  string
+	alias []string // other names that count as a use (enum values)
+	line  int
+}
+
+// unusedDecls reports private functions, types, globals, and defines that are
+// never referenced by any other declaration in the module. A declaration that
+// only refers to itself (recursion, a self-referential struct) is unused.
+// paths[i] is the source path of files[i].
+func unusedDecls(paths []string, files []*parser.File) []Warning {
+	var candidates []privateDecl
+	uses := make(map[*parser.Decl]map[string]bool)
+
+	for fi, file := range files {
+		for _, decl := range file.Decls {
+			idents := make(map[string]bool)
+			for _, text := range declTexts(decl) {
+				for _, tok := range lexBody(text) {
+					if tok.ident {
+						idents[tok.text] = true
+					}
+				}
+			}
+			uses[decl] = idents
+
+			if c, ok := privateCandidate(decl); ok {
+				c.file = fi
+				candidates = append(candidates, c)
+			}
+		}
+	}
+
+	var warnings []Warning
+	for _, c := range candidates {
+		if c.name == "" || c.line == 0 || isUsed(c, uses) {
+			continue
+		}
+		warnings = append(warnings, Warning{
+			File: paths[c.file],
+			Line: c.line,
+			Rule: RuleUnusedPrivate,
+			Msg:  fmt.Sprintf("private %s %q is never used", c.kind, c.name),
+		})
+	}
+	return warnings
+}
+
+func isUsed(c privateDecl, uses map[*parser.Decl]map[string]bool) bool {
+	for decl, idents := range uses {
+		if decl == c.decl {
+			continue
+		}
+		if idents[c.name] {
+			return true
+		}
+		for _, a := range c.alias {
+			if idents[a] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// privateCandidate describes decl if it is private and could go unused
+func privateCandidate(decl *parser.Decl) (privateDecl, bool) {
+	d, ok := describeDecl(decl)
+	if !ok || d.public || d.name == "" || (d.kind == "function" && d.name == "main") {
+		return privateDecl{}, false
+	}
+	c := privateDecl{decl: decl, kind: d.kind, name: d.name, line: d.line}
+	if decl.Enum != nil {
+		c.alias = enumValues(decl.Enum.Body)
+	}
+	return c, true
+}
+
+// declSummary is the kind, name, and visibility of a top-level declaration
+type declSummary struct {
+	kind   string
+	name   string
+	line   int
+	public bool
+}
+
+// describeDecl summarizes a named declaration; pragmas are not named
+func describeDecl(decl *parser.Decl) (declSummary, bool) {
+	switch {
+	case decl.Function != nil:
+		fn := decl.Function
+		return declSummary{"function", fn.Name, fn.Line, fn.Public}, true
+	case decl.Global != nil:
+		g := decl.Global
+		return declSummary{"global", g.Name, g.Line, g.Public}, true
+	case decl.Define != nil:
+		d := decl.Define
+		return declSummary{"define", d.Name, d.Line, d.Public}, true
+	case decl.Struct != nil:
+		st := decl.Struct
+		return declSummary{"struct", st.Name, st.Line, st.Public}, true
+	case decl.Union != nil:
+		u := decl.Union
+		return declSummary{"union", u.Name, u.Line, u.Public}, true
+	case decl.Enum != nil:
+		e := decl.Enum
+		return declSummary{"enum", e.Name, e.Line, e.Public}, true
+	case decl.Typedef != nil:
+		td := decl.Typedef
+		return declSummary{"typedef", project.TypedefName(td.Body), td.Line, td.Public}, true
+	}
+	return declSummary{}, false
+}
+
+// declTexts returns the parts of a declaration that may reference other
+// module symbols
+func declTexts(decl *parser.Decl) []string {
+	return referenceTexts(&parser.File{Decls: []*parser.Decl{decl}})
+}
+
+// enumValues returns the member names of an enum body
+func enumValues(body string) []string {
+	var names []string
+	for _, v := range strings.Split(strings.Trim(body, "{} \n\t"), ",") {
+		name, _, _ := strings.Cut(v, "=")
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -2,48 +2,133 @@ package codegen
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
+	"github.com/elijahmorgan/c_minus/internal/manifest"
 	"github.com/elijahmorgan/c_minus/internal/parser"
 	"github.com/elijahmorgan/c_minus/internal/paths"
 	"github.com/elijahmorgan/c_minus/internal/project"
+	"github.com/elijahmorgan/c_minus/internal/sourcemap"
 	"github.com/elijahmorgan/c_minus/internal/transform"
 )
 
-// GenerateModule generates .h and .c files for a module
+// Options controls code generation for a module
+type Options struct {
+	// Imported maps import paths to the parsed files of those modules. It is used
+	// to tell enum member access ("state.State.IDLE") apart from field access on
+	// an imported global ("config.settings.width"). Modules missing from the map
+	// are treated as declaring no enum types.
+	Imported map[string][]*parser.File
+
+	// SelfContained emits the module's private declarations at the top of every
+	// .c file instead of writing an _internal.h, so each .c needs only public headers.
+	SelfContained bool
+
+	// C23 treats bool, true, false, and nullptr as keywords: they are never
+	// mangled in signatures or substituted in bodies.
+	C23 bool
+
+	// TraceIncludes, when set, receives the includes of each generated .c
+	// file in order, with the reason for each and the headers they pull in.
+	TraceIncludes io.Writer
+
+	// Manifest, when set, records every file written
+	Manifest *manifest.Manifest
+
+	// Naming selects the mangling scheme and where .c files are written
+	Naming paths.Naming
+}
+
+// GenerateModule generates .h and .c files for a module whose imports are
+// treated as declaring no enum types. Pass Options.Imported to
+// GenerateModuleWithOptions to qualify "mod.Enum.MEMBER".
 func GenerateModule(mod *project.ModuleInfo, files []*parser.File, buildDir string) error {
-	moduleName := paths.SanitizeModuleName(mod.ImportPath)
+	return GenerateModuleWithOptions(mod, files, buildDir, Options{})
+}
+
+// GenerateModuleWithOptions generates .h and .c files for a module
+func GenerateModuleWithOptions(mod *project.ModuleInfo, files []*parser.File, buildDir string, opts Options) error {
+	n := opts.Naming
+	moduleName := n.SanitizeModuleName(mod.ImportPath)
+
+	if err := checkPublicSignatures(mod, files); err != nil {
+		return err
+	}
+	if err := checkPublicInlines(mod, files); err != nil {
+		return err
+	}
+	if err := checkConditionalDecls(mod, files); err != nil {
+		return err
+	}
 
 	// First pass: collect all type names in this module for later qualification
 	typeNames := make(map[string]bool)
 	// Also collect enum values for function body transformation
 	enumValues := make(transform.EnumValueMap)
+	localEnums := make(map[string]transform.EnumValueMap)
 	// Also collect global variable names for function body transformation
 	globalVars := make(transform.GlobalVarMap)
 	// Also collect #define constant names for function body transformation
 	defines := make(transform.DefineMap)
+	// And function names, which re-exports must not clash with
+	funcNames := make(map[string]bool)
+	// Typedef names join typeNames in the body context, so "Score * p;" declares p
+	typedefNames := make(map[string]bool)
 	for _, file := range files {
 		for _, decl := range file.Decls {
-			if decl.Struct != nil {
+			if decl.Function != nil {
+				funcNames[decl.Function.Name] = true
+			} else if decl.Struct != nil {
 				typeNames[decl.Struct.Name] = true
 			} else if decl.Union != nil {
 				typeNames[decl.Union.Name] = true
 			} else if decl.Enum != nil {
-				typeNames[decl.Enum.Name] = true
 				// Extract enum values from the body
-				extractEnumValues(decl.Enum.Body, decl.Enum.Name, moduleName, enumValues)
+				extractEnumValues(decl.Enum.Body, decl.Enum.Name, moduleName, n, enumValues)
+				if decl.Enum.Name != "" {
+					typeNames[decl.Enum.Name] = true
+					// Also by enum type, for qualified access within the module
+					localEnums[decl.Enum.Name] = make(transform.EnumValueMap)
+					extractEnumValues(decl.Enum.Body, decl.Enum.Name, moduleName, n, localEnums[decl.Enum.Name])
+				}
 			} else if decl.Global != nil && !decl.Global.Static {
 				// Map non-static global variable name to mangled name
 				// Static globals are file-local and not mangled
-				globalVars[decl.Global.Name] = moduleName + "_" + decl.Global.Name
+				globalVars[decl.Global.Name] = n.Mangle(moduleName, decl.Global.Name)
 			} else if decl.Define != nil && decl.Define.Public {
 				// Only public defines get mangled; private ones keep their original names
-				defines[decl.Define.Name] = moduleName + "_" + decl.Define.Name
+				defines[decl.Define.Name] = n.Mangle(moduleName, decl.Define.Name)
+			} else if decl.Typedef != nil {
+				if name := project.TypedefName(decl.Typedef.Body); name != "" {
+					typedefNames[name] = true
+				}
 			}
 		}
 	}
+	localTypes := make(map[string]bool, len(typeNames)+len(typedefNames))
+	for _, names := range []map[string]bool{typeNames, typedefNames} {
+		for name := range names {
+			localTypes[name] = true
+		}
+	}
+
+	symbols := transform.BodyContext{
+		EnumValues: enumValues,
+		LocalEnums: localEnums,
+		GlobalVars: globalVars,
+		Defines:    defines,
+		EnumTypes:  collectEnumTypes(opts.Imported),
+		Types:      localTypes,
+		C23:        opts.C23,
+		Naming:     n,
+	}
+
+	// Files of a module usually share their imports; build their maps once
+	maps := newImportMaps()
 
 	// Collect all public and private declarations
 	publicFuncDecls := []*funcDeclInfo{}
@@ -55,42 +140,71 @@ func GenerateModule(mod *project.ModuleInfo, files []*parser.File, buildDir stri
 	publicDefineDecls := []*defineDecl{}
 	privateDefineDecls := []*defineDecl{}
 
-	for _, file := range files {
+	for i, file := range files {
 		for _, decl := range file.Decls {
 			if decl.Function != nil {
-				funcSig := generateFunctionSignature(decl.Function, moduleName)
+				funcSig := generateFunctionSignature(decl.Function, moduleName, n, opts.C23)
 				funcInfo := &funcDeclInfo{
 					signature:  funcSig,
 					docComment: decl.Function.DocComment,
 				}
+				if decl.Function.Inline {
+					// The whole definition goes into the header, with the C headers its body uses
+					fileSymbols, err := maps.bodyContext(file, mod.Files[i], symbols)
+					if err != nil {
+						return err
+					}
+					funcInfo.definition = generateFunctionImplementation(decl.Function, moduleName, &fileSymbols, mod.Files[i])
+					for _, cimp := range file.CImports {
+						funcInfo.cimports = append(funcInfo.cimports, cimp.Path)
+					}
+				}
 				if decl.Function.Public {
 					publicFuncDecls = append(publicFuncDecls, funcInfo)
 				} else {
 					privateFuncDecls = append(privateFuncDecls, funcInfo)
 				}
+			} else if decl.Use != nil {
+				funcInfo, err := reexportFunction(mod, mod.Files[i], file, decl.Use, opts, funcNames)
+				if err != nil {
+					return err
+				}
+				funcNames[decl.Use.Name] = true
+				publicFuncDecls = append(publicFuncDecls, funcInfo)
 			} else if decl.Struct != nil {
 				// Transform the struct body to qualify type references
-				transformedBody := transformTypeBody(decl.Struct.Body, typeNames, moduleName)
+				transformedBody := transformTypeBody(decl.Struct.Body, typeNames, moduleName, n)
 				typeDecl := &typeDecl{
 					kind:       "struct",
 					name:       decl.Struct.Name,
 					body:       transformedBody,
 					public:     decl.Struct.Public,
+					opaque:     decl.Struct.Opaque,
+					packed:     decl.Struct.Packed,
 					docComment: decl.Struct.DocComment,
 				}
-				if decl.Struct.Public {
+				if decl.Struct.Opaque {
+					// Export only the incomplete type; the definition stays internal
+					handle := *typeDecl
+					handle.body = ""
+					publicTypeDecls = append(publicTypeDecls, &handle)
+					typeDecl.public = false
+					typeDecl.docComment = ""
+					privateTypeDecls = append(privateTypeDecls, typeDecl)
+				} else if decl.Struct.Public {
 					publicTypeDecls = append(publicTypeDecls, typeDecl)
 				} else {
 					privateTypeDecls = append(privateTypeDecls, typeDecl)
 				}
 			} else if decl.Union != nil {
 				// Transform the union body to qualify type references
-				transformedBody := transformTypeBody(decl.Union.Body, typeNames, moduleName)
+				transformedBody := transformTypeBody(decl.Union.Body, typeNames, moduleName, n)
 				typeDecl := &typeDecl{
 					kind:       "union",
 					name:       decl.Union.Name,
 					body:       transformedBody,
 					public:     decl.Union.Public,
+					packed:     decl.Union.Packed,
 					docComment: decl.Union.DocComment,
 				}
 				if decl.Union.Public {
@@ -100,7 +214,7 @@ func GenerateModule(mod *project.ModuleInfo, files []*parser.File, buildDir stri
 				}
 			} else if decl.Enum != nil {
 				// Transform enum body to qualify enum values
-				transformedBody := transformEnumBody(decl.Enum.Body, decl.Enum.Name, moduleName)
+				transformedBody := transformEnumBody(decl.Enum.Body, decl.Enum.Name, moduleName, n)
 				typeDecl := &typeDecl{
 					kind:       "enum",
 					name:       decl.Enum.Name,
@@ -126,9 +240,21 @@ func GenerateModule(mod *project.ModuleInfo, files []*parser.File, buildDir stri
 					privateTypeDecls = append(privateTypeDecls, typeDecl)
 				}
 			} else if decl.Global != nil {
+				array := decl.Global.Array
+				if array != "" {
+					// Dimensions name defines and enum values, as initializers do
+					fileSymbols, err := maps.bodyContext(file, mod.Files[i], symbols)
+					if err != nil {
+						return err
+					}
+					array = transform.TransformBody(array, &fileSymbols)
+				}
 				gd := &globalDecl{
+					align:      decl.Global.Align,
+					attrs:      decl.Global.Attrs,
 					typeName:   decl.Global.Type,
 					name:       decl.Global.Name,
+					array:      array,
 					value:      decl.Global.Value,
 					public:     decl.Global.Public,
 					static:     decl.Global.Static,
@@ -142,6 +268,12 @@ func GenerateModule(mod *project.ModuleInfo, files []*parser.File, buildDir stri
 				} else {
 					privateGlobalDecls = append(privateGlobalDecls, gd)
 				}
+			} else if decl.Pragma != nil && strings.HasPrefix(decl.Pragma.Text, "#pragma pack") {
+				// Packing changes struct layout, so it must bracket the type
+				// definitions in both headers, in source order
+				pragma := &typeDecl{kind: "pragma", body: decl.Pragma.Text}
+				publicTypeDecls = append(publicTypeDecls, pragma)
+				privateTypeDecls = append(privateTypeDecls, pragma)
 			} else if decl.Define != nil {
 				dd := &defineDecl{
 					name:       decl.Define.Name,
@@ -158,6 +290,10 @@ func GenerateModule(mod *project.ModuleInfo, files []*parser.File, buildDir stri
 		}
 	}
 
+	// Declarations follow file order; move structs and unions after the types they hold by value
+	publicTypeDecls = orderTypeDecls(publicTypeDecls, moduleName, n)
+	privateTypeDecls = orderTypeDecls(privateTypeDecls, moduleName, n)
+
 	// Collect all imports from all files in the module
 	allImports := make(map[string]bool)
 	for _, file := range files {
@@ -167,20 +303,33 @@ func GenerateModule(mod *project.ModuleInfo, files []*parser.File, buildDir stri
 	}
 
 	// Generate public header
-	if err := generatePublicHeader(mod, publicTypeDecls, publicFuncDecls, publicGlobalDecls, publicDefineDecls, allImports, buildDir); err != nil {
+	if err := generatePublicHeader(mod, n, moduleDocs(files), publicTypeDecls, publicFuncDecls, publicGlobalDecls, publicDefineDecls, allImports, buildDir); err != nil {
 		return err
 	}
-
-	// Generate internal header (always, even if empty - C files include it)
-	if err := generateInternalHeader(mod, privateTypeDecls, privateFuncDecls, privateGlobalDecls, privateDefineDecls, buildDir); err != nil {
+	opts.Manifest.Add(n.ModuleHeaderPath(buildDir, mod.ImportPath))
+
+	// Generate internal header (always, even if empty - C files include it),
+	// or inline its declarations into each .c file
+	privateDecls := ""
+	if opts.SelfContained {
+		privateDecls = generatePrivateDeclarations(moduleName, n, privateTypeDecls, privateFuncDecls, privateGlobalDecls, privateDefineDecls)
+	} else if err := generateInternalHeader(mod, n, privateTypeDecls, privateFuncDecls, privateGlobalDecls, privateDefineDecls, buildDir); err != nil {
 		return err
+	} else {
+		opts.Manifest.Add(n.ModuleInternalHeaderPath(buildDir, mod.ImportPath))
 	}
 
 	// Generate .c files for each source file
 	for i, file := range files {
-		if err := generateCFile(mod, file, mod.Files[i], buildDir, enumValues, globalVars, defines); err != nil {
+		if err := generateCFile(mod, file, mod.Files[i], buildDir, symbols, maps, opts.SelfContained, privateDecls); err != nil {
 			return err
 		}
+		cPath := n.ModuleCFilePath(buildDir, mod.ImportPath, filepath.Base(mod.Files[i]))
+		opts.Manifest.Add(cPath)
+		opts.Manifest.Add(sourcemap.Path(cPath))
+		if opts.TraceIncludes != nil {
+			traceIncludes(opts.TraceIncludes, n, cPath, mod.Files[i], cFileIncludes(mod, n, file, opts.SelfContained), moduleImportsFunc(mod, files, opts.Imported))
+		}
 	}
 
 	return nil
@@ -188,17 +337,22 @@ func GenerateModule(mod *project.ModuleInfo, files []*parser.File, buildDir stri
 
 // typeDecl represents a type declaration for code generation
 type typeDecl struct {
-	kind       string // "struct", "union", "enum", or "typedef"
+	kind       string // "struct", "union", "enum", "typedef", or "pragma"
 	name       string // type name (for struct/union/enum)
 	body       string // opaque body content
 	public     bool
+	opaque     bool   // handle type: public typedef of an incomplete struct, definition in internal header
+	packed     bool   // struct or union laid out without padding
 	docComment string // Go-style doc comment
 }
 
 // globalDecl represents a global variable declaration for code generation
 type globalDecl struct {
-	typeName   string // e.g., "int", "char*", "const char*"
+	align      string   // Alignment specifier (optional), e.g. "_Alignas(64)"
+	attrs      []string // C attributes (optional), e.g. "__attribute__((deprecated))"
+	typeName   string   // e.g., "int", "char*", "const char*"
 	name       string
+	array      string // Array dimensions (optional), e.g. "[]"
 	value      string // Initial value (optional)
 	public     bool
 	static     bool // File-private (static keyword in C)
@@ -215,27 +369,98 @@ type defineDecl struct {
 
 // funcDeclInfo represents a function declaration for code generation
 type funcDeclInfo struct {
-	signature  string // The C function signature
-	docComment string // Go-style doc comment
+	signature  string   // The C function signature
+	docComment string   // Go-style doc comment
+	definition string   // static inline definition emitted in place of the declaration (inline funcs only)
+	cimports   []string // C headers of the defining file, needed by an inline definition
+}
+
+// inlineCImports returns the C headers that the inline definitions among funcs
+// use, in first-use order
+func inlineCImports(funcs []*funcDeclInfo) []string {
+	seen := make(map[string]bool)
+	var headers []string
+	for _, decl := range funcs {
+		for _, h := range decl.cimports {
+			if !seen[h] {
+				seen[h] = true
+				headers = append(headers, h)
+			}
+		}
+	}
+	return headers
+}
+
+// writeFuncDecls writes function declarations, then the inline definitions,
+// so an inline body can call any function of the module
+func writeFuncDecls(sb *strings.Builder, funcs []*funcDeclInfo) {
+	for _, decl := range funcs {
+		if decl.definition != "" {
+			continue
+		}
+		if decl.docComment != "" {
+			sb.WriteString(formatDocComment(decl.docComment))
+		}
+		sb.WriteString(decl.signature)
+		sb.WriteString(";\n\n")
+	}
+	for _, decl := range funcs {
+		if decl.definition == "" {
+			continue
+		}
+		if decl.docComment != "" {
+			sb.WriteString(formatDocComment(decl.docComment))
+		}
+		sb.WriteString(decl.definition)
+		sb.WriteString("\n\n")
+	}
+}
+
+// moduleDocs joins the module doc comments of a module's files, in file order
+func moduleDocs(files []*parser.File) string {
+	var docs []string
+	for _, file := range files {
+		if file.ModuleDoc != "" {
+			docs = append(docs, file.ModuleDoc)
+		}
+	}
+	return strings.Join(docs, "\n\n")
 }
 
 // generatePublicHeader generates the public .h file for a module
-func generatePublicHeader(mod *project.ModuleInfo, publicTypes []*typeDecl, publicFuncs []*funcDeclInfo, publicGlobals []*globalDecl, publicDefines []*defineDecl, imports map[string]bool, buildDir string) error {
-	moduleName := paths.SanitizeModuleName(mod.ImportPath)
+func generatePublicHeader(mod *project.ModuleInfo, n paths.Naming, moduleDoc string, publicTypes []*typeDecl, publicFuncs []*funcDeclInfo, publicGlobals []*globalDecl, publicDefines []*defineDecl, imports map[string]bool, buildDir string) error {
+	moduleName := n.SanitizeModuleName(mod.ImportPath)
 	guardName := strings.ToUpper(moduleName) + "_H"
 
 	var sb strings.Builder
 
+	// Module documentation as a banner
+	if moduleDoc != "" {
+		sb.WriteString(formatDocComment(moduleDoc))
+		sb.WriteString("\n")
+	}
+
 	// Include guard
 	sb.WriteString(fmt.Sprintf("#ifndef %s\n", guardName))
 	sb.WriteString(fmt.Sprintf("#define %s\n\n", guardName))
 
-	// Include headers for imported modules (needed for types used in function signatures)
+	// Include headers for imported modules (needed for types used in function signatures),
+	// sorted so that unchanged sources give a byte-identical header
+	importPaths := make([]string, 0, len(imports))
 	for imp := range imports {
-		importName := paths.SanitizeModuleName(imp)
+		importPaths = append(importPaths, imp)
+	}
+	sort.Strings(importPaths)
+	for _, imp := range importPaths {
+		importName := n.SanitizeModuleName(imp)
 		sb.WriteString(fmt.Sprintf("#include \"%s.h\"\n", importName))
 	}
-	if len(imports) > 0 {
+	// C headers used by inline function bodies
+	cimports := inlineCImports(publicFuncs)
+	for _, h := range cimports {
+		sb.WriteString(fmt.Sprintf("#include <%s>\n", h))
+	}
+	if len(imports) > 0 || len(cimports) > 0 {
 		sb.WriteString("\n")
 	}
 
@@ -244,7 +469,7 @@ func generatePublicHeader(mod *project.ModuleInfo, publicTypes []*typeDecl, publ
 		if dd.docComment != "" {
 			sb.WriteString(formatDocComment(dd.docComment))
 		}
-		sb.WriteString(fmt.Sprintf("#define %s_%s %s\n", moduleName, dd.name, dd.value))
+		sb.WriteString(fmt.Sprintf("#define %s %s\n", n.Mangle(moduleName, dd.name), dd.value))
 	}
 	if len(publicDefines) > 0 {
 		sb.WriteString("\n")
@@ -253,9 +478,9 @@ func generatePublicHeader(mod *project.ModuleInfo, publicTypes []*typeDecl, publ
 	// Forward declarations for all structs and unions (to handle dependencies)
 	for _, td := range publicTypes {
 		if td.kind == "struct" && td.body != "" {
-			sb.WriteString(fmt.Sprintf("struct %s_%s;\n", moduleName, td.name))
+			sb.WriteString(fmt.Sprintf("struct %s;\n", n.Mangle(moduleName, td.name)))
 		} else if td.kind == "union" && td.body != "" {
-			sb.WriteString(fmt.Sprintf("union %s_%s;\n", moduleName, td.name))
+			sb.WriteString(fmt.Sprintf("union %s;\n", n.Mangle(moduleName, td.name)))
 		}
 	}
 	if len(publicTypes) > 0 {
@@ -264,7 +489,7 @@ func generatePublicHeader(mod *project.ModuleInfo, publicTypes []*typeDecl, publ
 
 	// Public type declarations
 	for _, td := range publicTypes {
-		sb.WriteString(generateTypeDeclaration(td, moduleName))
+		sb.WriteString(generateTypeDeclaration(td, moduleName, n))
 		sb.WriteString("\n\n")
 	}
 
@@ -274,22 +499,16 @@ func generatePublicHeader(mod *project.ModuleInfo, publicTypes []*typeDecl, publ
 			sb.WriteString(formatDocComment(gd.docComment))
 		}
 		// In header, emit as extern declaration
-		sb.WriteString(fmt.Sprintf("extern %s %s_%s;\n\n", gd.typeName, moduleName, gd.name))
+		sb.WriteString(fmt.Sprintf("extern %s%s%s %s%s;\n\n", attrsPrefix(gd.attrs), alignPrefix(gd.align), gd.typeName, n.Mangle(moduleName, gd.name), gd.array))
 	}
 
-	// Public function declarations
-	for _, decl := range publicFuncs {
-		if decl.docComment != "" {
-			sb.WriteString(formatDocComment(decl.docComment))
-		}
-		sb.WriteString(decl.signature)
-		sb.WriteString(";\n\n")
-	}
+	// Public function declarations and inline definitions
+	writeFuncDecls(&sb, publicFuncs)
 
 	sb.WriteString("#endif\n")
 
 	// Write to file
-	headerPath := filepath.Join(buildDir, moduleName+".h")
+	headerPath := n.ModuleHeaderPath(buildDir, mod.ImportPath)
 	if err := os.WriteFile(headerPath, []byte(sb.String()), 0644); err != nil {
 		return fmt.Errorf("failed to write %s: %w", headerPath, err)
 	}
@@ -298,8 +517,8 @@ func generatePublicHeader(mod *project.ModuleInfo, publicTypes []*typeDecl, publ
 }
 
 // generateInternalHeader generates the internal _internal.h file for a module
-func generateInternalHeader(mod *project.ModuleInfo, privateTypes []*typeDecl, privateFuncs []*funcDeclInfo, privateGlobals []*globalDecl, privateDefines []*defineDecl, buildDir string) error {
-	moduleName := paths.SanitizeModuleName(mod.ImportPath)
+func generateInternalHeader(mod *project.ModuleInfo, n paths.Naming, privateTypes []*typeDecl, privateFuncs []*funcDeclInfo, privateGlobals []*globalDecl, privateDefines []*defineDecl, buildDir string) error {
+	moduleName := n.SanitizeModuleName(mod.ImportPath)
 	guardName := strings.ToUpper(moduleName) + "_INTERNAL_H"
 
 	var sb strings.Builder
@@ -309,7 +528,34 @@ func generateInternalHeader(mod *project.ModuleInfo, privateTypes []*typeDecl, p
 	sb.WriteString(fmt.Sprintf("#define %s\n\n", guardName))
 
 	// Include public header
-	sb.WriteString(fmt.Sprintf("#include \"%s.h\"\n\n", moduleName))
+	sb.WriteString(fmt.Sprintf("#include \"%s\"\n\n", filepath.Base(n.ModuleHeaderPath("", mod.ImportPath))))
+
+	sb.WriteString(generatePrivateDeclarations(moduleName, n, privateTypes, privateFuncs, privateGlobals, privateDefines))
+
+	sb.WriteString("#endif\n")
+
+	// Write to file
+	headerPath := n.ModuleInternalHeaderPath(buildDir, mod.ImportPath)
+	if err := os.WriteFile(headerPath, []byte(sb.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", headerPath, err)
+	}
+
+	return nil
+}
+
+// generatePrivateDeclarations generates the module-private declarations that
+// normally make up the body of the internal header
+func generatePrivateDeclarations(moduleName string, n paths.Naming, privateTypes []*typeDecl, privateFuncs []*funcDeclInfo, privateGlobals []*globalDecl, privateDefines []*defineDecl) string {
+	var sb strings.Builder
+
+	// C headers used by inline function bodies
+	cimports := inlineCImports(privateFuncs)
+	for _, h := range cimports {
+		sb.WriteString(fmt.Sprintf("#include <%s>\n", h))
+	}
+	if len(cimports) > 0 {
+		sb.WriteString("\n")
+	}
 
 	// Private #define constants (not mangled - module-internal only)
 	for _, dd := range privateDefines {
@@ -325,9 +571,9 @@ func generateInternalHeader(mod *project.ModuleInfo, privateTypes []*typeDecl, p
 	// Forward declarations for private structs and unions
 	for _, td := range privateTypes {
 		if td.kind == "struct" && td.body != "" {
-			sb.WriteString(fmt.Sprintf("struct %s_%s;\n", moduleName, td.name))
+			sb.WriteString(fmt.Sprintf("struct %s;\n", n.Mangle(moduleName, td.name)))
 		} else if td.kind == "union" && td.body != "" {
-			sb.WriteString(fmt.Sprintf("union %s_%s;\n", moduleName, td.name))
+			sb.WriteString(fmt.Sprintf("union %s;\n", n.Mangle(moduleName, td.name)))
 		}
 	}
 	if len(privateTypes) > 0 {
@@ -336,7 +582,7 @@ func generateInternalHeader(mod *project.ModuleInfo, privateTypes []*typeDecl, p
 
 	// Private type declarations
 	for _, td := range privateTypes {
-		sb.WriteString(generateTypeDeclaration(td, moduleName))
+		sb.WriteString(generateTypeDeclaration(td, moduleName, n))
 		sb.WriteString("\n\n")
 	}
 
@@ -345,120 +591,190 @@ func generateInternalHeader(mod *project.ModuleInfo, privateTypes []*typeDecl, p
 		if gd.docComment != "" {
 			sb.WriteString(formatDocComment(gd.docComment))
 		}
-		// In internal header, emit as extern (definition is in .c file)
-		sb.WriteString(fmt.Sprintf("extern %s %s_%s;\n\n", gd.typeName, moduleName, gd.name))
+		// Emit as extern (definition is in the owning .c file)
+		sb.WriteString(fmt.Sprintf("extern %s%s%s %s%s;\n\n", attrsPrefix(gd.attrs), alignPrefix(gd.align), gd.typeName, n.Mangle(moduleName, gd.name), gd.array))
 	}
 
-	// Private function declarations
-	for _, decl := range privateFuncs {
-		if decl.docComment != "" {
-			sb.WriteString(formatDocComment(decl.docComment))
+	// Private function declarations and inline definitions
+	writeFuncDecls(&sb, privateFuncs)
+
+	return sb.String()
+}
+
+// collectEnumTypes maps each imported module path to the enum types it declares
+func collectEnumTypes(imported map[string][]*parser.File) transform.EnumTypeMap {
+	enumTypes := make(transform.EnumTypeMap)
+	for importPath, files := range imported {
+		for _, file := range files {
+			for _, decl := range file.Decls {
+				if decl.Enum == nil || decl.Enum.Name == "" {
+					continue
+				}
+				if enumTypes[importPath] == nil {
+					enumTypes[importPath] = make(map[string]bool)
+				}
+				enumTypes[importPath][decl.Enum.Name] = true
+			}
 		}
-		sb.WriteString(decl.signature)
-		sb.WriteString(";\n\n")
 	}
+	return enumTypes
+}
 
-	sb.WriteString("#endif\n")
+// importMaps caches the import and cimport maps of a module's files, keyed
+// by their import and cimport paths. The maps are only read once built, so
+// files with the same imports share them.
+type importMaps struct {
+	entries map[string]importMapsEntry
+	builds  int // Number of distinct import sets built
+}
 
-	// Write to file
-	headerPath := filepath.Join(buildDir, moduleName+"_internal.h")
-	if err := os.WriteFile(headerPath, []byte(sb.String()), 0644); err != nil {
-		return fmt.Errorf("failed to write %s: %w", headerPath, err)
+type importMapsEntry struct {
+	imports  transform.ImportMap
+	cimports transform.CImportMap
+}
+
+func newImportMaps() *importMaps {
+	return &importMaps{entries: make(map[string]importMapsEntry)}
+}
+
+// bodyContext fills the per-file import maps of the module-wide symbols
+func (m *importMaps) bodyContext(file *parser.File, srcPath string, symbols transform.BodyContext) (transform.BodyContext, error) {
+	var key strings.Builder
+	for _, imp := range file.Imports {
+		key.WriteString(imp.Path + "\x00")
+	}
+	key.WriteString("\x01")
+	for _, cimp := range file.CImports {
+		key.WriteString(cimp.Path + "\x00")
 	}
 
-	return nil
+	entry, ok := m.entries[key.String()]
+	if !ok {
+		// Build import map for qualified access transformation
+		importMap, err := transform.BuildImportMap(file.Imports)
+		if err != nil {
+			return symbols, fmt.Errorf("failed to build import map for %s: %w", srcPath, err)
+		}
+
+		// Build C import map for C header access transformation
+		cimportMap, err := transform.BuildCImportMap(file.CImports)
+		if err != nil {
+			return symbols, fmt.Errorf("failed to build cimport map for %s: %w", srcPath, err)
+		}
+		entry = importMapsEntry{imports: importMap, cimports: cimportMap}
+		m.entries[key.String()] = entry
+		m.builds++
+	}
+
+	symbols.Imports = entry.imports
+	symbols.CImports = entry.cimports
+	return symbols, nil
 }
 
-// generateCFile generates a .c implementation file
-func generateCFile(mod *project.ModuleInfo, file *parser.File, srcPath string, buildDir string, enumValues transform.EnumValueMap, globalVars transform.GlobalVarMap, defines transform.DefineMap) error {
-	moduleName := paths.SanitizeModuleName(mod.ImportPath)
+// generateCFile generates a .c implementation file.
+// symbols holds the module-wide tables; the per-file import maps come from maps.
+// When selfContained is set, privateDecls replaces the internal header include.
+func generateCFile(mod *project.ModuleInfo, file *parser.File, srcPath string, buildDir string, symbols transform.BodyContext, maps *importMaps, selfContained bool, privateDecls string) error {
+	n := symbols.Naming
+	moduleName := n.SanitizeModuleName(mod.ImportPath)
 	baseName := filepath.Base(srcPath)
 	baseName = baseName[:len(baseName)-3] // Remove .cm extension
 
-	// Build import map for qualified access transformation
-	importMap, err := transform.BuildImportMap(file.Imports)
-	if err != nil {
-		return fmt.Errorf("failed to build import map for %s: %w", srcPath, err)
-	}
-
-	// Build C import map for C header access transformation
-	cimportMap, err := transform.BuildCImportMap(file.CImports)
+	symbols, err := maps.bodyContext(file, srcPath, symbols)
 	if err != nil {
-		return fmt.Errorf("failed to build cimport map for %s: %w", srcPath, err)
+		return err
 	}
 
 	var sb strings.Builder
 
-	// Include internal header (which includes public header)
-	sb.WriteString(fmt.Sprintf("#include \"%s_internal.h\"\n", moduleName))
-
-	// Include C standard library headers (cimports)
-	for _, cimp := range file.CImports {
-		sb.WriteString(fmt.Sprintf("#include <%s>\n", cimp.Path))
-	}
-
-	// Include c_minus dependency headers
-	for _, imp := range file.Imports {
-		importName := paths.SanitizeModuleName(imp.Path)
-		sb.WriteString(fmt.Sprintf("#include \"%s.h\"\n", importName))
+	// Own module header, then cimports, then c_minus dependency headers
+	for _, inc := range cFileIncludes(mod, n, file, selfContained) {
+		sb.WriteString(inc.directive)
+		sb.WriteString("\n")
 	}
 
 	sb.WriteString("\n")
 
-	// Emit global variable definitions
+	// Module-private declarations normally found in the internal header
+	if selfContained {
+		sb.WriteString(privateDecls)
+	}
+
+	// Emit definitions, pragmas, and directives once each, in source order,
+	// so #if blocks and pragmas keep their place around what they affect
 	for _, decl := range file.Decls {
-		if decl.Global != nil {
+		if decl.Pragma != nil {
+			sb.WriteString(decl.Pragma.Text)
+			sb.WriteString("\n\n")
+		} else if decl.Directive != nil {
+			// The #line makes the compiler report the directive at its .cm line
+			if !decl.Directive.Conditional() {
+				sb.WriteString(fmt.Sprintf("#line %d \"%s\"\n", decl.Directive.Line, srcPath))
+			}
+			sb.WriteString(decl.Directive.Text)
+			sb.WriteString("\n")
+		} else if decl.Global != nil && !decl.Global.Extern {
+			// Extern globals are defined elsewhere; only the header declares them.
 			// Add #line directive for source mapping
 			if decl.Global.Line > 0 {
 				sb.WriteString(fmt.Sprintf("#line %d \"%s\"\n", decl.Global.Line, srcPath))
 			}
-			globalDef := generateGlobalDefinition(decl.Global, moduleName)
+			globalDef := generateGlobalDefinition(decl.Global, moduleName, &symbols)
 			sb.WriteString(globalDef)
 			sb.WriteString("\n\n")
-		}
-	}
-
-	// Emit function implementations
-	for _, decl := range file.Decls {
-		if decl.Function != nil {
-			funcImpl := generateFunctionImplementation(decl.Function, moduleName, importMap, cimportMap, enumValues, globalVars, defines, srcPath)
+		} else if decl.Function != nil && !decl.Function.Inline {
+			// Inline functions are defined in the module's header instead
+			funcImpl := generateFunctionImplementation(decl.Function, moduleName, &symbols, srcPath)
 			sb.WriteString(funcImpl)
 			sb.WriteString("\n\n")
 		}
 	}
 
-	// Write to file
-	cPath := filepath.Join(buildDir, moduleName+"_"+baseName+".c")
+	// Write to file; a mirrored layout puts it in a per-module directory
+	cPath := n.ModuleCFilePath(buildDir, mod.ImportPath, filepath.Base(srcPath))
+	if err := os.MkdirAll(filepath.Dir(cPath), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(cPath), err)
+	}
 	if err := os.WriteFile(cPath, []byte(sb.String()), 0644); err != nil {
 		return fmt.Errorf("failed to write %s: %w", cPath, err)
 	}
 
-	return nil
+	// The sourcemap beside the .c records the mapping its #line directives give
+	sm, err := sourcemap.FromC(cPath, strings.NewReader(sb.String()))
+	if err != nil {
+		return fmt.Errorf("failed to map %s: %w", cPath, err)
+	}
+	return sm.Write(sourcemap.Path(cPath))
 }
 
-// generateGlobalDefinition generates a global variable definition for a .c file
-func generateGlobalDefinition(g *parser.GlobalDecl, moduleName string) string {
+// generateGlobalDefinition generates a global variable definition for a .c file.
+// The array dimensions and initializer are transformed like a function body,
+// so they may refer to the module's and imported defines and enum values.
+func generateGlobalDefinition(g *parser.GlobalDecl, moduleName string, symbols *transform.BodyContext) string {
 	var sb strings.Builder
 
 	// Static globals: use static keyword, no name mangling
 	if g.Static {
 		sb.WriteString("static ")
+		sb.WriteString(attrsPrefix(g.Attrs))
+		sb.WriteString(alignPrefix(g.Align))
 		sb.WriteString(g.Type)
 		sb.WriteString(" ")
 		sb.WriteString(g.Name)
 	} else {
 		// Type and mangled name
+		sb.WriteString(attrsPrefix(g.Attrs))
+		sb.WriteString(alignPrefix(g.Align))
 		sb.WriteString(g.Type)
 		sb.WriteString(" ")
-		sb.WriteString(moduleName)
-		sb.WriteString("_")
-		sb.WriteString(g.Name)
+		sb.WriteString(symbols.Naming.Mangle(moduleName, g.Name))
 	}
+	sb.WriteString(transform.TransformBody(g.Array, symbols))
 
 	// Optional initializer
 	if g.Value != "" {
 		sb.WriteString(" = ")
-		sb.WriteString(g.Value)
+		sb.WriteString(transform.TransformBody(g.Value, symbols))
 	}
 
 	sb.WriteString(";")
@@ -466,29 +782,56 @@ func generateGlobalDefinition(g *parser.GlobalDecl, moduleName string) string {
 	return sb.String()
 }
 
+// attrsPrefix returns the attributes of a declaration followed by a space, or "" if there are none
+func attrsPrefix(attrs []string) string {
+	if len(attrs) == 0 {
+		return ""
+	}
+	return strings.Join(attrs, " ") + " "
+}
+
+// alignPrefix returns an alignment specifier followed by a space, or "" if there is none
+func alignPrefix(align string) string {
+	if align == "" {
+		return ""
+	}
+	return align + " "
+}
+
 // generateFunctionSignature generates a C function signature with name mangling
-func generateFunctionSignature(fn *parser.FuncDecl, moduleName string) string {
+func generateFunctionSignature(fn *parser.FuncDecl, moduleName string, n paths.Naming, c23 bool) string {
 	var sb strings.Builder
 
+	// Attributes lead, so they apply to both the declaration and the definition
+	sb.WriteString(attrsPrefix(fn.Attrs))
+
 	// Return type (mangle if it's a custom type)
 	returnType := fn.ReturnType
 	if returnType == "" {
 		returnType = "void"
 	}
+	// C requires main to return int; a void main returns 0
+	if isVoidMain(fn) {
+		returnType = "int"
+	}
 	// Transform return type: mangle non-primitive types with module prefix
-	returnType = mangleTypeInSignature(returnType, moduleName)
+	returnType = mangleTypeInSignature(returnType, moduleName, n, c23)
 	sb.WriteString(returnType)
 	sb.WriteString(" ")
 
 	// Function name (mangled with module prefix, except for main)
 	if fn.Name != "main" {
-		sb.WriteString(moduleName)
-		sb.WriteString("_")
+		sb.WriteString(n.Mangle(moduleName, fn.Name))
+	} else {
+		sb.WriteString(fn.Name)
 	}
-	sb.WriteString(fn.Name)
 
-	// Parameters
+	// Parameters; an empty list in C declares a function taking any
+	// arguments, so no parameters is spelled (void)
 	sb.WriteString("(")
+	if len(fn.Params) == 0 {
+		sb.WriteString("void")
+	}
 	for i, param := range fn.Params {
 		if i > 0 {
 			sb.WriteString(", ")
@@ -501,14 +844,18 @@ func generateFunctionSignature(fn *parser.FuncDecl, moduleName string) string {
 		}
 
 		// Transform parameter type: mangle non-primitive types with module prefix
-		paramType := mangleTypeInSignature(param.Type, moduleName)
-
-		// Check if this is a function pointer type (contains "(*)")
-		// For function pointers, the name goes inside: "int (*name)(args)"
-		if strings.Contains(paramType, "(*)") {
-			// Insert the name after (*
-			paramStr := strings.Replace(paramType, "(*)", "(*"+param.Name+")", 1)
-			sb.WriteString(paramStr)
+		paramType := mangleTypeInSignature(param.Type, moduleName, n, c23)
+
+		// Check if this is a function pointer type (contains "(*")
+		// For function pointers, the name goes inside: "int (*name)(args)",
+		// ahead of any array dimensions: "void (*table[4])(int)"
+		if start := strings.Index(paramType, "(*"); start >= 0 {
+			end := start + strings.IndexAny(paramType[start:], ")[")
+			name := param.Name
+			if c := paramType[end-1]; c != '*' && c != ' ' {
+				name = " " + name // after a qualifier: "(*const cb)"
+			}
+			sb.WriteString(paramType[:end] + name + paramType[end:])
 		} else {
 			sb.WriteString(paramType)
 			sb.WriteString(" ")
@@ -521,9 +868,9 @@ func generateFunctionSignature(fn *parser.FuncDecl, moduleName string) string {
 }
 
 // mangleTypeInSignature mangles custom type names in function signatures
-// Primitive C types are left unchanged
+// Primitive C types (and bool under C23) are left unchanged
 // Handles qualified types like "module.Type" -> "module_Type"
-func mangleTypeInSignature(typeName string, moduleName string) string {
+func mangleTypeInSignature(typeName string, moduleName string, n paths.Naming, c23 bool) string {
 	// Common primitive types - don't mangle these
 	primitives := map[string]bool{
 		"void":      true,
@@ -533,6 +880,7 @@ func mangleTypeInSignature(typeName string, moduleName string) string {
 		"long":      true,
 		"float":     true,
 		"double":    true,
+		"_Bool":     true,
 		"unsigned":  true,
 		"signed":    true,
 		"size_t":    true,
@@ -548,7 +896,20 @@ func mangleTypeInSignature(typeName string, moduleName string) string {
 		"intptr_t":  true,
 		"uintptr_t": true,
 		"ptrdiff_t": true,
-		// Also handle pointer types
+		// Extended floating and integer types (gcc)
+		"_Complex":    true,
+		"_Imaginary":  true,
+		"_Float16":    true,
+		"_Float32":    true,
+		"_Float64":    true,
+		"_Float128":   true,
+		"_Float32x":   true,
+		"_Float64x":   true,
+		"__float128":  true,
+		"__int128":    true,
+		"_Decimal32":  true,
+		"_Decimal64":  true,
+		"_Decimal128": true,
 	}
 
 	// Check for pointers
@@ -556,7 +917,7 @@ func mangleTypeInSignature(typeName string, moduleName string) string {
 		// Strip pointer, mangle base type, re-add pointer
 		baseType := strings.TrimRight(typeName, "*")
 		asterisks := typeName[len(baseType):]
-		return mangleTypeInSignature(baseType, moduleName) + asterisks
+		return mangleTypeInSignature(baseType, moduleName, n, c23) + asterisks
 	}
 
 	// Check for struct/union/enum keywords
@@ -570,14 +931,22 @@ func mangleTypeInSignature(typeName string, moduleName string) string {
 		return typeName // Already has enum keyword
 	}
 
+	// Qualifiers apply to the type that follows: "const Point" -> "const module_Point"
+	for _, q := range []string{"const", "volatile", "restrict", "_Atomic"} {
+		if rest, ok := strings.CutPrefix(typeName, q+" "); ok {
+			return q + " " + mangleTypeInSignature(strings.TrimSpace(rest), moduleName, n, c23)
+		}
+	}
+
 	// Split on spaces to handle complex types
 	parts := strings.Fields(typeName)
 	if len(parts) == 0 {
 		return typeName
 	}
 
-	// Check if first word is a primitive
-	if primitives[parts[0]] {
+	// Check if first word is a primitive; this covers multi-word types such
+	// as "long double", "unsigned long long", and "_Complex double"
+	if primitives[parts[0]] || (c23 && transform.IsC23Keyword(parts[0])) {
 		return typeName
 	}
 
@@ -587,56 +956,77 @@ func mangleTypeInSignature(typeName string, moduleName string) string {
 		dotParts := strings.SplitN(typeName, ".", 2)
 		if len(dotParts) == 2 {
 			// Return qualified module_Type format
-			return dotParts[0] + "_" + dotParts[1]
+			return n.Mangle(n.SanitizeModuleName(dotParts[0]), dotParts[1])
 		}
 	}
 
 	// Custom type - mangle it with current module prefix
-	return moduleName + "_" + typeName
+	return n.Mangle(moduleName, typeName)
 }
 
 // generateTypeDeclaration generates a type declaration with name mangling
-func generateTypeDeclaration(td *typeDecl, moduleName string) string {
+func generateTypeDeclaration(td *typeDecl, moduleName string, n paths.Naming) string {
 	var sb strings.Builder
+	name := n.Mangle(moduleName, td.name)
 
 	// Add doc comment if present
 	if td.docComment != "" {
 		sb.WriteString(formatDocComment(td.docComment))
 	}
 
+	// The packed attribute goes between the keyword and the tag, where it
+	// applies to the type in the definition
+	attr := ""
+	if td.packed {
+		attr = "__attribute__((packed)) "
+	}
+
 	switch td.kind {
 	case "struct":
-		if td.body == "" {
+		if td.opaque && td.public {
+			// Handle type: consumers only see the incomplete type
+			sb.WriteString(fmt.Sprintf("typedef struct %s %s;", name, name))
+		} else if td.opaque {
+			// Completes the handle type typedef'd in the public header
+			sb.WriteString(fmt.Sprintf("struct %s%s %s;", attr, name, td.body))
+		} else if td.body == "" {
 			// Forward declaration
-			sb.WriteString(fmt.Sprintf("struct %s_%s;", moduleName, td.name))
+			sb.WriteString(fmt.Sprintf("struct %s;", name))
 		} else {
 			// Full struct definition with typedef
-			sb.WriteString(fmt.Sprintf("typedef struct %s_%s %s", moduleName, td.name, td.body))
-			sb.WriteString(fmt.Sprintf(" %s_%s;", moduleName, td.name))
+			sb.WriteString(fmt.Sprintf("typedef struct %s%s %s", attr, name, td.body))
+			sb.WriteString(fmt.Sprintf(" %s;", name))
 		}
 	case "union":
 		if td.body == "" {
 			// Forward declaration
-			sb.WriteString(fmt.Sprintf("union %s_%s;", moduleName, td.name))
+			sb.WriteString(fmt.Sprintf("union %s;", name))
 		} else {
 			// Full union definition with typedef
-			sb.WriteString(fmt.Sprintf("typedef union %s_%s %s", moduleName, td.name, td.body))
-			sb.WriteString(fmt.Sprintf(" %s_%s;", moduleName, td.name))
+			sb.WriteString(fmt.Sprintf("typedef union %s%s %s", attr, name, td.body))
+			sb.WriteString(fmt.Sprintf(" %s;", name))
 		}
 	case "enum":
+		if td.name == "" {
+			// Anonymous enum: constants only, no type to typedef
+			sb.WriteString(fmt.Sprintf("enum %s;", td.body))
+			break
+		}
 		// Enum definition with typedef
-		sb.WriteString(fmt.Sprintf("typedef enum %s_%s %s", moduleName, td.name, td.body))
-		sb.WriteString(fmt.Sprintf(" %s_%s;", moduleName, td.name))
+		sb.WriteString(fmt.Sprintf("typedef enum %s %s", name, td.body))
+		sb.WriteString(fmt.Sprintf(" %s;", name))
 	case "typedef":
 		// Typedef - we need to parse out the name and mangle it
 		sb.WriteString(fmt.Sprintf("typedef %s;", td.body))
+	case "pragma":
+		sb.WriteString(td.body)
 	}
 
 	return sb.String()
 }
 
 // generateFunctionImplementation generates a complete C function implementation
-func generateFunctionImplementation(fn *parser.FuncDecl, moduleName string, importMap transform.ImportMap, cimportMap transform.CImportMap, enumValues transform.EnumValueMap, globalVars transform.GlobalVarMap, defines transform.DefineMap, srcPath string) string {
+func generateFunctionImplementation(fn *parser.FuncDecl, moduleName string, symbols *transform.BodyContext, srcPath string) string {
 	var sb strings.Builder
 
 	// Add #line directive for source mapping (maps C errors back to .cm file)
@@ -644,22 +1034,103 @@ func generateFunctionImplementation(fn *parser.FuncDecl, moduleName string, impo
 		sb.WriteString(fmt.Sprintf("#line %d \"%s\"\n", fn.Line, srcPath))
 	}
 
-	// Function signature
-	sb.WriteString(generateFunctionSignature(fn, moduleName))
+	// Function signature; inline functions get internal linkage in every includer
+	if fn.Inline {
+		sb.WriteString("static inline ")
+	}
+	sb.WriteString(generateFunctionSignature(fn, moduleName, symbols.Naming, symbols.C23))
 	sb.WriteString(" ")
 
+	// Parameters shadow import prefixes of the same name
+	bodyCtx := *symbols
+	bodyCtx.Locals = make(map[string]bool, len(fn.Params))
+	for _, p := range fn.Params {
+		bodyCtx.Locals[p.Name] = true
+	}
+
 	// Transform function body to replace qualified access with mangled names
 	// Also transform C imports (stdio.printf -> printf), enum values, global variables, and defines
-	transformedBody := transform.TransformFunctionBodyFull(fn.Body, importMap, cimportMap, enumValues, globalVars, defines)
+	transformedBody := transform.TransformBody(fn.Body, &bodyCtx)
+	if isVoidMain(fn) {
+		transformedBody = intMainBody(transformedBody)
+	}
 	sb.WriteString(transformedBody)
 
 	return sb.String()
 }
 
+// isVoidMain reports whether fn is a main declared to return void
+func isVoidMain(fn *parser.FuncDecl) bool {
+	returnType := strings.TrimSpace(fn.ReturnType)
+	return fn.Name == "main" && (returnType == "" || returnType == "void")
+}
+
+// intMainBody adapts the body of a void main to the int main it becomes: a
+// bare "return;" returns 0, and "return 0;" is appended unless the body
+// already ends with a return
+func intMainBody(body string) string {
+	var sb strings.Builder
+	for i := 0; i < len(body); i++ {
+		switch ch := body[i]; {
+		case ch == '"' || ch == '\'':
+			// Copy a string or character literal whole
+			j := i + 1
+			for j < len(body) && body[j] != ch {
+				if body[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			j = min(j+1, len(body))
+			sb.WriteString(body[i:j])
+			i = j - 1
+		case ch == '/' && i+1 < len(body) && (body[i+1] == '/' || body[i+1] == '*'):
+			// Copy a comment whole
+			end := "\n"
+			if body[i+1] == '*' {
+				end = "*/"
+			}
+			j := len(body)
+			if k := strings.Index(body[i+2:], end); k >= 0 {
+				j = i + 2 + k + len(end)
+			}
+			sb.WriteString(body[i:j])
+			i = j - 1
+		case isIdentChar(rune(ch)):
+			j := i
+			for j < len(body) && isIdentChar(rune(body[j])) {
+				j++
+			}
+			word := body[i:j]
+			sb.WriteString(word)
+			if word == "return" && strings.HasPrefix(strings.TrimLeft(body[j:], " \t\r\n"), ";") {
+				sb.WriteString(" 0")
+			}
+			i = j - 1
+		default:
+			sb.WriteByte(ch)
+		}
+	}
+	body = sb.String()
+
+	closing := strings.LastIndex(body, "}")
+	if closing < 0 {
+		return body
+	}
+	before := strings.TrimRight(body[:closing], " \t\r\n")
+	if last, ok := strings.CutSuffix(before, ";"); ok {
+		stmt := strings.TrimSpace(last[strings.LastIndexAny(last, ";{}")+1:])
+		if rest, ok := strings.CutPrefix(stmt, "return"); ok && (rest == "" || !isIdentChar(rune(rest[0]))) {
+			return body
+		}
+	}
+	return before + "\n    return 0;\n" + body[closing:]
+}
+
 // extractEnumValues extracts enum value names from an enum body and adds them to the map
 // For enum body like "{ TODO, IN_PROGRESS, DONE }", it adds entries like:
 // "TODO" -> "module_EnumName_TODO"
-func extractEnumValues(body, enumName, moduleName string, enumValues transform.EnumValueMap) {
+func extractEnumValues(body, enumName, moduleName string, n paths.Naming, enumValues transform.EnumValueMap) {
 	// Find the opening and closing braces
 	startBrace := strings.Index(body, "{")
 	endBrace := strings.LastIndex(body, "}")
@@ -667,7 +1138,6 @@ func extractEnumValues(body, enumName, moduleName string, enumValues transform.E
 		return
 	}
 
-	prefix := moduleName + "_" + enumName + "_"
 	inner := body[startBrace+1 : endBrace]
 
 	// Split on commas and extract each value name
@@ -682,14 +1152,14 @@ func extractEnumValues(body, enumName, moduleName string, enumValues transform.E
 			v = strings.TrimSpace(v[:eqIdx])
 		}
 		if v != "" {
-			enumValues[v] = prefix + v
+			enumValues[v] = enumMember(moduleName, n, enumName, v)
 		}
 	}
 }
 
 // transformTypeBody transforms type references within a struct body
 // Qualifies references to module-local types (enums, structs) with the module prefix
-func transformTypeBody(body string, typeNames map[string]bool, moduleName string) string {
+func transformTypeBody(body string, typeNames map[string]bool, moduleName string, n paths.Naming) string {
 	if len(typeNames) == 0 {
 		return body
 	}
@@ -698,18 +1168,39 @@ func transformTypeBody(body string, typeNames map[string]bool, moduleName string
 	for typeName := range typeNames {
 		// Look for the type name as a standalone identifier (not part of another identifier)
 		// Match patterns like "Type " or "Type;" at field type positions
-		result = replaceTypeInBody(result, typeName, moduleName+"_"+typeName)
+		result = replaceTypeInBody(result, typeName, n.Mangle(moduleName, typeName))
 	}
 	return result
 }
 
 // replaceTypeInBody replaces type references in a struct body with qualified names
-// Handles patterns like "TypeName fieldname;" where TypeName is a type reference
+// Handles patterns like "TypeName fieldname;" where TypeName is a type reference.
+// Preprocessor lines ("#if defined(Handle)") pass through unchanged: their
+// identifiers are macros, not the module's types.
 func replaceTypeInBody(body, typeName, replacement string) string {
 	var result strings.Builder
 	i := 0
 
 	for i < len(body) {
+		// Copy a directive, with its continuation lines, verbatim
+		if lineStart := i == 0 || body[i-1] == '\n'; lineStart && strings.HasPrefix(strings.TrimLeft(body[i:], " \t"), "#") {
+			for i < len(body) {
+				end := strings.IndexByte(body[i:], '\n')
+				if end < 0 {
+					end = len(body) - i
+				} else {
+					end++
+				}
+				line := body[i : i+end]
+				result.WriteString(line)
+				i += end
+				if !strings.HasSuffix(strings.TrimRight(line, "\r\n"), "\\") {
+					break
+				}
+			}
+			continue
+		}
+
 		// Check if we're at the start of the type name
 		if i+len(typeName) <= len(body) && body[i:i+len(typeName)] == typeName {
 			// Check that this is a standalone identifier:
@@ -736,8 +1227,17 @@ func isIdentChar(ch rune) bool {
 	return (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9') || ch == '_'
 }
 
+// enumMember mangles an enum value: module_Enum_VALUE, or module_VALUE for an
+// anonymous enum
+func enumMember(moduleName string, n paths.Naming, enumName, value string) string {
+	if enumName == "" {
+		return n.Mangle(moduleName, value)
+	}
+	return n.Mangle(moduleName, enumName, value)
+}
+
 // transformEnumBody transforms enum values to have the module_EnumName_ prefix
-func transformEnumBody(body, enumName, moduleName string) string {
+func transformEnumBody(body, enumName, moduleName string, n paths.Naming) string {
 	// Parse enum body like "{ TODO, IN_PROGRESS, DONE }"
 	// Transform to "{ module_EnumName_TODO, module_EnumName_IN_PROGRESS, module_EnumName_DONE }"
 
@@ -748,7 +1248,6 @@ func transformEnumBody(body, enumName, moduleName string) string {
 		return body
 	}
 
-	prefix := moduleName + "_" + enumName + "_"
 	inner := body[startBrace+1 : endBrace]
 
 	// Split on commas and transform each value
@@ -763,9 +1262,9 @@ func transformEnumBody(body, enumName, moduleName string) string {
 		if eqIdx := strings.Index(v, "="); eqIdx != -1 {
 			name := strings.TrimSpace(v[:eqIdx])
 			rest := v[eqIdx:]
-			transformed = append(transformed, prefix+name+rest)
+			transformed = append(transformed, enumMember(moduleName, n, enumName, name)+rest)
 		} else {
-			transformed = append(transformed, prefix+v)
+			transformed = append(transformed, enumMember(moduleName, n, enumName, v))
 		}
 	}
 
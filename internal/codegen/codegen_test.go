@@ -1,6 +1,7 @@
 package codegen
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -9,6 +10,7 @@ import (
 	"github.com/elijahmorgan/c_minus/internal/parser"
 	"github.com/elijahmorgan/c_minus/internal/paths"
 	"github.com/elijahmorgan/c_minus/internal/project"
+	"github.com/elijahmorgan/c_minus/internal/sourcemap"
 	"github.com/elijahmorgan/c_minus/internal/transform"
 )
 
@@ -28,7 +30,7 @@ func TestGeneratePublicHeader(t *testing.T) {
 	publicDefines := []*defineDecl{}
 
 	imports := make(map[string]bool)
-	err := generatePublicHeader(mod, publicTypes, publicFuncs, publicGlobals, publicDefines, imports, tmpDir)
+	err := generatePublicHeader(mod, paths.Naming{}, "", publicTypes, publicFuncs, publicGlobals, publicDefines, imports, tmpDir)
 	if err != nil {
 		t.Fatalf("generatePublicHeader failed: %v", err)
 	}
@@ -76,7 +78,7 @@ func TestGenerateInternalHeader(t *testing.T) {
 	privateGlobals := []*globalDecl{}
 	privateDefines := []*defineDecl{}
 
-	err := generateInternalHeader(mod, privateTypes, privateFuncs, privateGlobals, privateDefines, tmpDir)
+	err := generateInternalHeader(mod, paths.Naming{}, privateTypes, privateFuncs, privateGlobals, privateDefines, tmpDir)
 	if err != nil {
 		t.Fatalf("generateInternalHeader failed: %v", err)
 	}
@@ -143,10 +145,7 @@ func TestGenerateCFile(t *testing.T) {
 	buildDir := filepath.Join(tmpDir, "build")
 	os.MkdirAll(buildDir, 0755)
 
-	enumValues := make(transform.EnumValueMap)
-	globalVars := make(transform.GlobalVarMap)
-	defines := make(transform.DefineMap)
-	err := generateCFile(mod, file, srcFile, buildDir, enumValues, globalVars, defines)
+	err := generateCFile(mod, file, srcFile, buildDir, transform.BodyContext{}, newImportMaps(), false, "")
 	if err != nil {
 		t.Fatalf("generateCFile failed: %v", err)
 	}
@@ -180,6 +179,50 @@ func TestGenerateCFile(t *testing.T) {
 	}
 }
 
+func TestGenerateVoidMain(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{
+			name:     "appends return 0",
+			body:     "{\n    puts(\"return;\");\n}",
+			expected: "int main(void) {\n    puts(\"return;\");\n    return 0;\n}",
+		},
+		{
+			name:     "bare returns return 0",
+			body:     "{\n    if (argc > 1) {\n        return;\n    }\n    // return;\n    run();\n    return ;\n}",
+			expected: "int main(void) {\n    if (argc > 1) {\n        return 0;\n    }\n    // return;\n    run();\n    return 0 ;\n}",
+		},
+		{
+			name:     "ends in a nested return",
+			body:     "{\n    if (done) {\n        return;\n    }\n}",
+			expected: "int main(void) {\n    if (done) {\n        return 0;\n    }\n    return 0;\n}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn := &parser.FuncDecl{Name: "main", ReturnType: "void", Body: tt.body}
+			got := generateFunctionImplementation(fn, "main", &transform.BodyContext{}, "")
+			if got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	// An int main and other void functions are left alone
+	fn := &parser.FuncDecl{Name: "main", ReturnType: "int", Body: "{\n    run();\n}"}
+	if got := generateFunctionImplementation(fn, "main", &transform.BodyContext{}, ""); got != "int main(void) {\n    run();\n}" {
+		t.Errorf("int main changed: %q", got)
+	}
+	fn = &parser.FuncDecl{Name: "run", ReturnType: "void", Body: "{\n    return;\n}"}
+	if got := generateFunctionImplementation(fn, "main", &transform.BodyContext{}, ""); got != "void main_run(void) {\n    return;\n}" {
+		t.Errorf("void function changed: %q", got)
+	}
+}
+
 func TestGenerateFunctionSignature(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -216,7 +259,7 @@ func TestGenerateFunctionSignature(t *testing.T) {
 				ReturnType: "int",
 				Params:     []*parser.Param{},
 			},
-			expected: "int math_getNumber()",
+			expected: "int math_getNumber(void)",
 		},
 		{
 			name: "variadic function",
@@ -230,11 +273,59 @@ func TestGenerateFunctionSignature(t *testing.T) {
 			},
 			expected: "void math_log(char* fmt, ...)",
 		},
+		{
+			name: "long double and long long",
+			fn: &parser.FuncDecl{
+				Name:       "scale",
+				ReturnType: "long double",
+				Params: []*parser.Param{
+					{Name: "x", Type: "long double"},
+					{Name: "n", Type: "unsigned long long"},
+				},
+			},
+			expected: "long double math_scale(long double x, unsigned long long n)",
+		},
+		{
+			name: "long long return",
+			fn: &parser.FuncDecl{
+				Name:       "count",
+				ReturnType: "long long",
+				Params: []*parser.Param{
+					{Name: "p", Type: "long long*"},
+				},
+			},
+			expected: "long long math_count(long long* p)",
+		},
+		{
+			name: "complex and extended floats",
+			fn: &parser.FuncDecl{
+				Name:       "mix",
+				ReturnType: "_Complex double",
+				Params: []*parser.Param{
+					{Name: "h", Type: "_Float16"},
+					{Name: "q", Type: "__float128"},
+					{Name: "i", Type: "__int128"},
+				},
+			},
+			expected: "_Complex double math_mix(_Float16 h, __float128 q, __int128 i)",
+		},
+		{
+			name: "qualified types",
+			fn: &parser.FuncDecl{
+				Name:       "read",
+				ReturnType: "const char*",
+				Params: []*parser.Param{
+					{Name: "v", Type: "const Vec*"},
+					{Name: "x", Type: "volatile long double"},
+				},
+			},
+			expected: "const char* math_read(const math_Vec* v, volatile long double x)",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			sig := generateFunctionSignature(tt.fn, "math")
+			sig := generateFunctionSignature(tt.fn, "math", paths.Naming{}, false)
 			if sig != tt.expected {
 				t.Errorf("expected %q, got %q", tt.expected, sig)
 			}
@@ -253,7 +344,7 @@ func TestSanitizeModuleName(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		result := paths.SanitizeModuleName(tt.input)
+		result := paths.Naming{}.SanitizeModuleName(tt.input)
 		if result != tt.expected {
 			t.Errorf("SanitizeModuleName(%q) = %q, expected %q", tt.input, result, tt.expected)
 		}
@@ -323,7 +414,7 @@ func TestGeneratePublicHeaderWithDocComments(t *testing.T) {
 	publicDefines := []*defineDecl{}
 
 	imports := make(map[string]bool)
-	err := generatePublicHeader(mod, publicTypes, publicFuncs, publicGlobals, publicDefines, imports, tmpDir)
+	err := generatePublicHeader(mod, paths.Naming{}, "", publicTypes, publicFuncs, publicGlobals, publicDefines, imports, tmpDir)
 	if err != nil {
 		t.Fatalf("generatePublicHeader failed: %v", err)
 	}
@@ -380,7 +471,7 @@ func TestGenerateGlobalVariables(t *testing.T) {
 	publicDefines := []*defineDecl{}
 
 	imports := make(map[string]bool)
-	err := generatePublicHeader(mod, publicTypes, publicFuncs, publicGlobals, publicDefines, imports, tmpDir)
+	err := generatePublicHeader(mod, paths.Naming{}, "", publicTypes, publicFuncs, publicGlobals, publicDefines, imports, tmpDir)
 	if err != nil {
 		t.Fatalf("generatePublicHeader failed: %v", err)
 	}
@@ -405,3 +496,745 @@ func TestGenerateGlobalVariables(t *testing.T) {
 		t.Error("missing doc comment for global variable")
 	}
 }
+
+func TestGenerateModuleSelfContained(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	mod := &project.ModuleInfo{
+		ImportPath: "cache",
+		Files:      []string{filepath.Join(tmpDir, "cache.cm")},
+	}
+
+	files := []*parser.File{
+		{
+			Module: &parser.ModuleDecl{Path: "cache"},
+			Decls: []*parser.Decl{
+				{Define: &parser.DefineDecl{Name: "SLOTS", Value: "8"}},
+				{Struct: &parser.StructDecl{Name: "Entry", Body: "{\n    int key;\n}", Semi: true}},
+				{Global: &parser.GlobalDecl{Type: "int", Name: "hits", Value: "0"}},
+				{Function: &parser.FuncDecl{Name: "slot", ReturnType: "int", Params: []*parser.Param{{Name: "key", Type: "int"}}, Body: "{\n    return key % SLOTS;\n}"}},
+				{Function: &parser.FuncDecl{Public: true, Name: "lookup", ReturnType: "int", Params: []*parser.Param{{Name: "key", Type: "int"}}, Body: "{\n    hits = hits + 1;\n    return slot(key);\n}"}},
+			},
+		},
+	}
+
+	if err := GenerateModuleWithOptions(mod, files, tmpDir, Options{SelfContained: true}); err != nil {
+		t.Fatalf("GenerateModuleWithOptions failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(tmpDir, "cache_internal.h")); !os.IsNotExist(err) {
+		t.Errorf("expected no cache_internal.h, stat returned %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, "cache_cache.c"))
+	if err != nil {
+		t.Fatalf("failed to read generated C file: %v", err)
+	}
+	c := string(content)
+
+	if strings.Contains(c, "_internal.h") {
+		t.Errorf("self-contained .c must not include the internal header:\n%s", c)
+	}
+	for _, want := range []string{
+		"#include \"cache.h\"",
+		"#define SLOTS 8",
+		"typedef struct cache_Entry",
+		"extern int cache_hits;",
+		"int cache_slot(int key);",
+		"int cache_hits = 0;",
+	} {
+		if !strings.Contains(c, want) {
+			t.Errorf("generated C missing %q:\n%s", want, c)
+		}
+	}
+
+	// Private declarations must precede the definitions that use them
+	if strings.Index(c, "int cache_slot(int key);") > strings.Index(c, "int cache_lookup(int key) {") {
+		t.Errorf("private prototypes must come before function definitions:\n%s", c)
+	}
+}
+
+func TestGenerateModuleInlineFunctions(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	mod := &project.ModuleInfo{
+		ImportPath: "vec",
+		Files:      []string{filepath.Join(tmpDir, "vec.cm")},
+	}
+
+	files := []*parser.File{
+		{
+			Module:   &parser.ModuleDecl{Path: "vec"},
+			CImports: []*parser.CImport{{Path: "math.h", Line: 3}},
+			Decls: []*parser.Decl{
+				{Define: &parser.DefineDecl{Public: true, Name: "SCALE", Value: "2"}},
+				{Function: &parser.FuncDecl{Public: true, Inline: true, Name: "scale", ReturnType: "double", Params: []*parser.Param{{Name: "x", Type: "double"}}, Body: "{\n    return math.fabs(x) * SCALE;\n}", DocComment: "scale scales x.", Line: 5}},
+				{Function: &parser.FuncDecl{Inline: true, Name: "half", ReturnType: "int", Params: []*parser.Param{{Name: "x", Type: "int"}}, Body: "{\n    return x / 2;\n}", Line: 9}},
+				{Function: &parser.FuncDecl{Public: true, Name: "length", ReturnType: "double", Params: []*parser.Param{{Name: "x", Type: "double"}}, Body: "{\n    return x;\n}", Line: 13}},
+			},
+		},
+	}
+
+	if err := GenerateModule(mod, files, tmpDir); err != nil {
+		t.Fatalf("GenerateModule failed: %v", err)
+	}
+
+	header, err := os.ReadFile(filepath.Join(tmpDir, "vec.h"))
+	if err != nil {
+		t.Fatalf("failed to read public header: %v", err)
+	}
+	h := string(header)
+	for _, want := range []string{
+		"#include <math.h>",
+		"// scale scales x.\n#line 5",
+		"static inline double vec_scale(double x) {\n    return fabs(x) * vec_SCALE;\n}",
+		"double vec_length(double x);",
+	} {
+		if !strings.Contains(h, want) {
+			t.Errorf("public header missing %q:\n%s", want, h)
+		}
+	}
+	if strings.Contains(h, "double vec_scale(double x);") {
+		t.Errorf("inline function must be defined, not declared, in the header:\n%s", h)
+	}
+	if strings.Index(h, "double vec_length(double x);") > strings.Index(h, "static inline double vec_scale") {
+		t.Errorf("declarations must precede inline definitions:\n%s", h)
+	}
+
+	internal, err := os.ReadFile(filepath.Join(tmpDir, "vec_internal.h"))
+	if err != nil {
+		t.Fatalf("failed to read internal header: %v", err)
+	}
+	if !strings.Contains(string(internal), "static inline int vec_half(int x) {") {
+		t.Errorf("private inline function must be defined in the internal header:\n%s", internal)
+	}
+
+	cFile, err := os.ReadFile(filepath.Join(tmpDir, "vec_vec.c"))
+	if err != nil {
+		t.Fatalf("failed to read generated C file: %v", err)
+	}
+	c := string(cFile)
+	if strings.Contains(c, "vec_scale") || strings.Contains(c, "vec_half") {
+		t.Errorf("inline functions must not be defined in the .c file:\n%s", c)
+	}
+	if !strings.Contains(c, "double vec_length(double x) {") {
+		t.Errorf("generated C missing the regular function:\n%s", c)
+	}
+}
+
+func TestGenerateModuleErrorDirectives(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	srcPath := filepath.Join(tmpDir, "platform.cm")
+	mod := &project.ModuleInfo{ImportPath: "platform", Files: []string{srcPath}}
+	files := []*parser.File{
+		{
+			Module: &parser.ModuleDecl{Path: "platform"},
+			Decls: []*parser.Decl{
+				{Directive: &parser.DirectiveDecl{Name: "ifndef", Text: "#ifndef __linux__", Line: 3}},
+				{Directive: &parser.DirectiveDecl{Name: "error", Text: `#error "platform requires Linux"`, Line: 4}},
+				{Directive: &parser.DirectiveDecl{Name: "endif", Text: "#endif", Line: 5}},
+				{Function: &parser.FuncDecl{Public: true, Name: "size", ReturnType: "int", Body: "{\n    return 1;\n}", Line: 7}},
+			},
+		},
+	}
+
+	if err := GenerateModule(mod, files, tmpDir); err != nil {
+		t.Fatalf("GenerateModule failed: %v", err)
+	}
+
+	cFile, err := os.ReadFile(filepath.Join(tmpDir, "platform_platform.c"))
+	if err != nil {
+		t.Fatalf("failed to read .c file: %v", err)
+	}
+	c := string(cFile)
+	want := "#ifndef __linux__\n#line 4 \"" + srcPath + "\"\n#error \"platform requires Linux\"\n#endif\n"
+	if !strings.Contains(c, want) {
+		t.Errorf("expected the guarded #error in order:\n%s", c)
+	}
+	if strings.Count(c, "#error") != 1 {
+		t.Errorf("expected #error once:\n%s", c)
+	}
+	if strings.Count(c, "#ifndef __linux__") != 1 || strings.Count(c, "#endif") != 1 {
+		t.Errorf("expected the conditional emitted once:\n%s", c)
+	}
+}
+
+func TestGenerateModuleConditionalDecls(t *testing.T) {
+	parse := func(src string) []*parser.File {
+		file, err := parser.ParseSource("module \"platform\"\n\n"+src, "platform.cm")
+		if err != nil {
+			t.Fatalf("ParseSource failed: %v", err)
+		}
+		return []*parser.File{file}
+	}
+	mod := &project.ModuleInfo{ImportPath: "platform", Files: []string{"platform.cm"}}
+
+	// The header would define S twice
+	files := parse("#ifdef WIDE\nstruct S { long v; };\n#else\nstruct S { int v; };\n#endif\n")
+	err := GenerateModule(mod, files, t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "struct S in module platform is inside an #if block") || !strings.Contains(err.Error(), "platform.cm:3: block opened here") {
+		t.Errorf("expected the conditional struct to be rejected, got %v", err)
+	}
+
+	files = parse("#ifdef WIDE\npub func size() long {\n    return 8;\n}\n#else\npub func size() int {\n    return 4;\n}\n#endif\n")
+	err = GenerateModule(mod, files, t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "func size in module platform has different signatures in #if branches") {
+		t.Errorf("expected mismatched branch signatures to be rejected, got %v", err)
+	}
+
+	// A function in both branches with one signature is declared as usual
+	tmpDir := t.TempDir()
+	files = parse("#ifdef WIDE\nstatic int width = 8;\npub func size() int {\n    return width;\n}\n#else\npub func size() int {\n    return 4;\n}\n#endif\n")
+	if err := GenerateModule(mod, files, tmpDir); err != nil {
+		t.Fatalf("GenerateModule failed: %v", err)
+	}
+	cFile, err := os.ReadFile(filepath.Join(tmpDir, "platform_platform.c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := string(cFile)
+	for _, directive := range []string{"#ifdef WIDE", "#else", "#endif"} {
+		if strings.Count(c, directive) != 1 {
+			t.Errorf("expected %s once:\n%s", directive, c)
+		}
+	}
+	if strings.Index(c, "static int width") > strings.Index(c, "#else") {
+		t.Errorf("expected the static global inside its branch:\n%s", c)
+	}
+}
+
+func TestGenerateModuleAttributes(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	mod := &project.ModuleInfo{
+		ImportPath: "lib",
+		Files:      []string{filepath.Join(tmpDir, "lib.cm")},
+	}
+
+	deprecated := `__attribute__((deprecated("use fresh")))`
+	files := []*parser.File{
+		{
+			Module: &parser.ModuleDecl{Path: "lib"},
+			Decls: []*parser.Decl{
+				{Global: &parser.GlobalDecl{Public: true, Type: "int", Name: "limit", Value: "4", Attrs: []string{deprecated}}},
+				{Function: &parser.FuncDecl{Public: true, Name: "old", ReturnType: "int", Body: "{\n    return 1;\n}", Attrs: []string{deprecated}}},
+				{Function: &parser.FuncDecl{Name: "fast", ReturnType: "int", Body: "{\n    return 2;\n}", Attrs: []string{"__attribute__((always_inline))", "inline"}}},
+			},
+		},
+	}
+
+	if err := GenerateModule(mod, files, tmpDir); err != nil {
+		t.Fatalf("GenerateModule failed: %v", err)
+	}
+
+	header, err := os.ReadFile(filepath.Join(tmpDir, "lib.h"))
+	if err != nil {
+		t.Fatalf("failed to read public header: %v", err)
+	}
+	for _, want := range []string{
+		"extern " + deprecated + " int lib_limit;",
+		deprecated + " int lib_old(void);",
+	} {
+		if !strings.Contains(string(header), want) {
+			t.Errorf("public header missing %q:\n%s", want, header)
+		}
+	}
+
+	internal, err := os.ReadFile(filepath.Join(tmpDir, "lib_internal.h"))
+	if err != nil {
+		t.Fatalf("failed to read internal header: %v", err)
+	}
+	if !strings.Contains(string(internal), "__attribute__((always_inline)) inline int lib_fast(void);") {
+		t.Errorf("internal header missing attributes on fast:\n%s", internal)
+	}
+
+	cFile, err := os.ReadFile(filepath.Join(tmpDir, "lib_lib.c"))
+	if err != nil {
+		t.Fatalf("failed to read generated C file: %v", err)
+	}
+	for _, want := range []string{
+		deprecated + " int lib_limit = 4;",
+		deprecated + " int lib_old(void) {",
+	} {
+		if !strings.Contains(string(cFile), want) {
+			t.Errorf("generated C missing %q:\n%s", want, cFile)
+		}
+	}
+}
+
+func TestGenerateModuleReexport(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	mathFiles := []*parser.File{{
+		Module: &parser.ModuleDecl{Path: "geo/math"},
+		Decls: []*parser.Decl{
+			{Struct: &parser.StructDecl{Public: true, Name: "Vec", Body: "{\n    int x;\n}", Semi: true}},
+			{Function: &parser.FuncDecl{Public: true, Name: "add", ReturnType: "Vec", Params: []*parser.Param{{Name: "a", Type: "Vec"}, {Name: "b", Type: "Vec"}}, Body: "{\n    return a;\n}", DocComment: "add adds two vectors."}},
+			{Function: &parser.FuncDecl{Public: true, Name: "reset", Params: []*parser.Param{{Name: "v", Type: "Vec*"}}, Body: "{\n}"}},
+			{Function: &parser.FuncDecl{Name: "hidden", ReturnType: "int", Body: "{\n    return 0;\n}"}},
+		},
+	}}
+	mod := &project.ModuleInfo{
+		ImportPath: "shapes",
+		Files:      []string{filepath.Join(tmpDir, "shapes.cm")},
+	}
+	file := &parser.File{
+		Module:  &parser.ModuleDecl{Path: "shapes"},
+		Imports: []*parser.Import{{Path: "geo/math", Line: 3}},
+		Decls: []*parser.Decl{
+			{Use: &parser.UseDecl{Module: "math", Name: "add", Line: 5}},
+			{Use: &parser.UseDecl{Module: "math", Name: "reset", Line: 6}},
+		},
+	}
+	opts := Options{Imported: map[string][]*parser.File{"geo/math": mathFiles}}
+
+	if err := GenerateModuleWithOptions(mod, []*parser.File{file}, tmpDir, opts); err != nil {
+		t.Fatalf("GenerateModuleWithOptions failed: %v", err)
+	}
+	header, err := os.ReadFile(filepath.Join(tmpDir, "shapes.h"))
+	if err != nil {
+		t.Fatalf("failed to read public header: %v", err)
+	}
+	for _, want := range []string{
+		"#include \"geo_math.h\"",
+		"// add adds two vectors.\nstatic inline geo_math_Vec shapes_add(geo_math_Vec a, geo_math_Vec b) {\n    return geo_math_add(a, b);\n}",
+		"static inline void shapes_reset(geo_math_Vec* v) {\n    geo_math_reset(v);\n}",
+	} {
+		if !strings.Contains(string(header), want) {
+			t.Errorf("public header missing %q:\n%s", want, header)
+		}
+	}
+
+	for _, tc := range []struct {
+		use  *parser.UseDecl
+		want string
+	}{
+		{&parser.UseDecl{Module: "math", Name: "hidden", Line: 5}, "module geo/math has no pub func hidden"},
+		{&parser.UseDecl{Module: "math", Name: "Vec", Line: 5}, "only functions can be re-exported"},
+		{&parser.UseDecl{Module: "log", Name: "info", Line: 5}, "log is not imported"},
+	} {
+		file.Decls = []*parser.Decl{{Use: tc.use}}
+		err := GenerateModuleWithOptions(mod, []*parser.File{file}, tmpDir, opts)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("pub use %s.%s: expected an error containing %q, got %v", tc.use.Module, tc.use.Name, tc.want, err)
+		}
+	}
+
+	// A re-export must not clash with a function of the module
+	file.Decls = []*parser.Decl{
+		{Use: &parser.UseDecl{Module: "math", Name: "add", Line: 5}},
+		{Function: &parser.FuncDecl{Name: "add", ReturnType: "int", Body: "{\n    return 0;\n}"}},
+	}
+	if err := GenerateModuleWithOptions(mod, []*parser.File{file}, tmpDir, opts); err == nil || !strings.Contains(err.Error(), "module shapes already declares add") {
+		t.Errorf("expected a clash error, got %v", err)
+	}
+}
+
+func TestGenerateArrayGlobals(t *testing.T) {
+	tmpDir := t.TempDir()
+	mod := &project.ModuleInfo{ImportPath: "text", Files: []string{"text.cm"}}
+	files := []*parser.File{
+		{
+			Module: &parser.ModuleDecl{Path: "text"},
+			Decls: []*parser.Decl{
+				{Global: &parser.GlobalDecl{Public: true, Type: "char", Name: "greeting", Array: "[]", Value: `"hello"`}},
+				{Global: &parser.GlobalDecl{Type: "int", Name: "grid", Array: "[4][4]"}},
+				{Function: &parser.FuncDecl{Public: true, Name: "size", ReturnType: "int", Body: "{\n    return sizeof(greeting) + grid[0][0];\n}"}},
+			},
+		},
+	}
+
+	if err := GenerateModule(mod, files, tmpDir); err != nil {
+		t.Fatalf("GenerateModule failed: %v", err)
+	}
+
+	for name, wants := range map[string][]string{
+		"text.h":          {"extern char text_greeting[];"},
+		"text_internal.h": {"extern int text_grid[4][4];"},
+		"text_text.c":     {`char text_greeting[] = "hello";`, "int text_grid[4][4];", "return sizeof(text_greeting) + text_grid[0][0];"},
+	} {
+		content, err := os.ReadFile(filepath.Join(tmpDir, name))
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", name, err)
+		}
+		for _, want := range wants {
+			if !strings.Contains(string(content), want) {
+				t.Errorf("%s missing %q:\n%s", name, want, content)
+			}
+		}
+	}
+}
+
+func TestGenerateArrayGlobalDimensions(t *testing.T) {
+	tmpDir := t.TempDir()
+	configFiles := []*parser.File{{
+		Module: &parser.ModuleDecl{Path: "app/config"},
+		Decls:  []*parser.Decl{{Define: &parser.DefineDecl{Public: true, Name: "MAX", Value: "64"}}},
+	}}
+	mod := &project.ModuleInfo{ImportPath: "util", Files: []string{"util.cm"}}
+	file := &parser.File{
+		Module:  &parser.ModuleDecl{Path: "util"},
+		Imports: []*parser.Import{{Path: "app/config", Line: 3}},
+		Decls: []*parser.Decl{
+			{Define: &parser.DefineDecl{Public: true, Name: "SIZE", Value: "4"}},
+			{Enum: &parser.EnumDecl{Name: "Axis", Body: "{ X, Y, AXES }"}},
+			{Global: &parser.GlobalDecl{Public: true, Type: "int", Name: "grid", Array: "[SIZE][SIZE*2]"}},
+			{Global: &parser.GlobalDecl{Type: "int", Name: "axes", Array: "[AXES]"}},
+			{Global: &parser.GlobalDecl{Static: true, Type: "char", Name: "buf", Array: "[config.MAX]"}},
+		},
+	}
+	opts := Options{Imported: map[string][]*parser.File{"app/config": configFiles}}
+
+	if err := GenerateModuleWithOptions(mod, []*parser.File{file}, tmpDir, opts); err != nil {
+		t.Fatalf("GenerateModuleWithOptions failed: %v", err)
+	}
+	for name, wants := range map[string][]string{
+		"util.h":          {"extern int util_grid[util_SIZE][util_SIZE*2];"},
+		"util_internal.h": {"extern int util_axes[util_Axis_AXES];"},
+		"util_util.c":     {"int util_grid[util_SIZE][util_SIZE*2];", "int util_axes[util_Axis_AXES];", "static char buf[app_config_MAX];"},
+	} {
+		content, err := os.ReadFile(filepath.Join(tmpDir, name))
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", name, err)
+		}
+		for _, want := range wants {
+			if !strings.Contains(string(content), want) {
+				t.Errorf("%s missing %q:\n%s", name, want, content)
+			}
+		}
+	}
+}
+
+func TestGenerateGlobalInitializerImports(t *testing.T) {
+	tmpDir := t.TempDir()
+	configFiles := []*parser.File{{
+		Module: &parser.ModuleDecl{Path: "app/config"},
+		Decls: []*parser.Decl{
+			{Define: &parser.DefineDecl{Public: true, Name: "MAX", Value: "64"}},
+			{Global: &parser.GlobalDecl{Public: true, Type: "int", Name: "base", Value: "1"}},
+		},
+	}}
+	mod := &project.ModuleInfo{ImportPath: "limits", Files: []string{"limits.cm"}}
+	file := &parser.File{
+		Module:  &parser.ModuleDecl{Path: "limits"},
+		Imports: []*parser.Import{{Path: "app/config", Line: 3}},
+		Decls: []*parser.Decl{
+			{Global: &parser.GlobalDecl{Public: true, Type: "int", Name: "limit", Value: "config.MAX * 2"}},
+			{Global: &parser.GlobalDecl{Public: true, Type: "int*", Name: "origin", Value: "&config.base"}},
+			{Global: &parser.GlobalDecl{Static: true, Type: "const char*", Name: "label", Value: `"config.MAX"`}},
+		},
+	}
+	opts := Options{Imported: map[string][]*parser.File{"app/config": configFiles}}
+
+	if err := GenerateModuleWithOptions(mod, []*parser.File{file}, tmpDir, opts); err != nil {
+		t.Fatalf("GenerateModuleWithOptions failed: %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(tmpDir, "limits_limits.c"))
+	if err != nil {
+		t.Fatalf("failed to read generated file: %v", err)
+	}
+	for _, want := range []string{
+		"int limits_limit = app_config_MAX * 2;",
+		"int* limits_origin = &app_config_base;",
+		`static const char* label = "config.MAX";`,
+	} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("limits_limits.c missing %q:\n%s", want, content)
+		}
+	}
+}
+
+func TestGenerateExternGlobals(t *testing.T) {
+	tmpDir := t.TempDir()
+	mod := &project.ModuleInfo{ImportPath: "counter", Files: []string{"counter.cm"}}
+	files := []*parser.File{
+		{
+			Module: &parser.ModuleDecl{Path: "counter"},
+			Decls: []*parser.Decl{
+				{Global: &parser.GlobalDecl{Public: true, Extern: true, Type: "int", Name: "shared_counter"}},
+				{Global: &parser.GlobalDecl{Extern: true, Type: "char", Name: "table", Array: "[]"}},
+				{Function: &parser.FuncDecl{Public: true, Name: "bump", ReturnType: "int", Body: "{\n    return ++shared_counter + table[0];\n}"}},
+			},
+		},
+	}
+
+	if err := GenerateModule(mod, files, tmpDir); err != nil {
+		t.Fatalf("GenerateModule failed: %v", err)
+	}
+
+	for name, wants := range map[string][]string{
+		"counter.h":          {"extern int counter_shared_counter;"},
+		"counter_internal.h": {"extern char counter_table[];"},
+		"counter_counter.c":  {"return ++counter_shared_counter + counter_table[0];"},
+	} {
+		content, err := os.ReadFile(filepath.Join(tmpDir, name))
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", name, err)
+		}
+		for _, want := range wants {
+			if !strings.Contains(string(content), want) {
+				t.Errorf("%s missing %q:\n%s", name, want, content)
+			}
+		}
+	}
+
+	cFile, err := os.ReadFile(filepath.Join(tmpDir, "counter_counter.c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, unwanted := range []string{"int counter_shared_counter;", "char counter_table[];"} {
+		if strings.Contains(string(cFile), unwanted) {
+			t.Errorf("expected no definition %q for an extern global:\n%s", unwanted, cFile)
+		}
+	}
+}
+
+func TestGenerateStructConditionalFields(t *testing.T) {
+	tmpDir := t.TempDir()
+	src := `module "files"
+
+pub enum Mode { READ, WRITE };
+
+pub struct Handle {
+    void* raw;
+};
+
+pub struct File {
+#if defined(_WIN32) && defined(Handle)
+    Handle h;
+#else
+    int fd;
+#endif
+#define MODE_BITS(Mode) \
+    (Mode & 3)
+    Mode mode;
+};
+`
+	file, err := parser.ParseSource(src, "files.cm")
+	if err != nil {
+		t.Fatalf("ParseSource failed: %v", err)
+	}
+	mod := &project.ModuleInfo{ImportPath: "files", Files: []string{"files.cm"}}
+	if err := GenerateModule(mod, []*parser.File{file}, tmpDir); err != nil {
+		t.Fatalf("GenerateModule failed: %v", err)
+	}
+
+	header, err := os.ReadFile(filepath.Join(tmpDir, "files.h"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"#if defined(_WIN32) && defined(Handle)\n    files_Handle h;\n#else\n    int fd;\n#endif",
+		"#define MODE_BITS(Mode) \\\n    (Mode & 3)\n    files_Mode mode;",
+	} {
+		if !strings.Contains(string(header), want) {
+			t.Errorf("files.h missing %q:\n%s", want, header)
+		}
+	}
+}
+
+func TestGenerateCFileSourcemap(t *testing.T) {
+	tmpDir := t.TempDir()
+	src := `module "counter"
+
+int total = 0;
+
+pub func add(int n) int {
+    total += n;
+    return total;
+}
+`
+	file, err := parser.ParseSource(src, "counter.cm")
+	if err != nil {
+		t.Fatalf("ParseSource failed: %v", err)
+	}
+	mod := &project.ModuleInfo{ImportPath: "counter", Files: []string{"counter.cm"}}
+	if err := GenerateModule(mod, []*parser.File{file}, tmpDir); err != nil {
+		t.Fatalf("GenerateModule failed: %v", err)
+	}
+
+	cPath := filepath.Join(tmpDir, "counter_counter.c")
+	sm, err := sourcemap.Load(sourcemap.Path(cPath))
+	if err != nil {
+		t.Fatalf("failed to load sourcemap: %v", err)
+	}
+	if sm.File != cPath {
+		t.Errorf("sourcemap file = %s, want %s", sm.File, cPath)
+	}
+
+	cCode, err := os.ReadFile(cPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(cCode), "\n")
+	for cmLine, want := range map[int]string{3: "int counter_total = 0;", 5: "int counter_add(int n) {", 7: "    return counter_total;"} {
+		out, ok := sm.Generated("counter.cm", cmLine)
+		if !ok {
+			t.Errorf("counter.cm:%d is not mapped", cmLine)
+			continue
+		}
+		if got := lines[out-1]; got != want {
+			t.Errorf("counter.cm:%d maps to generated line %d %q, want %q", cmLine, out, got, want)
+		}
+		if file, line, ok := sm.Source(out); !ok || file != "counter.cm" || line != cmLine {
+			t.Errorf("generated line %d maps back to %s:%d, want counter.cm:%d", out, file, line, cmLine)
+		}
+	}
+}
+
+func TestGeneratePublicHeaderModuleDoc(t *testing.T) {
+	tmpDir := t.TempDir()
+	mod := &project.ModuleInfo{ImportPath: "ring"}
+
+	err := generatePublicHeader(mod, paths.Naming{}, "Package ring implements a ring buffer.\nNot thread safe.", nil, nil, nil, nil, map[string]bool{}, tmpDir)
+	if err != nil {
+		t.Fatalf("generatePublicHeader failed: %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(tmpDir, "ring.h"))
+	if err != nil {
+		t.Fatalf("failed to read generated header: %v", err)
+	}
+	want := "/*\n * Package ring implements a ring buffer.\n * Not thread safe.\n */\n\n#ifndef"
+	if !strings.HasPrefix(string(content), want) {
+		t.Errorf("expected module doc banner at top of header, got:\n%s", content)
+	}
+}
+
+func TestTraceIncludes(t *testing.T) {
+	mod := &project.ModuleInfo{ImportPath: "app", Files: []string{"app/app.cm"}}
+	file, err := parser.ParseSource(`module "app"
+
+cimport "stdio.h"
+import "util"
+import "net/http"
+
+func run() int {
+    return util.one() + http.get();
+}
+`, "app/app.cm")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	imported := map[string][]*parser.File{
+		"net/http": {{Imports: []*parser.Import{{Path: "util"}, {Path: "log"}}}},
+		"log":      {},
+	}
+
+	var out strings.Builder
+	err = GenerateModuleWithOptions(mod, []*parser.File{file}, t.TempDir(), Options{Imported: imported, TraceIncludes: &out})
+	if err != nil {
+		t.Fatalf("GenerateModuleWithOptions failed: %v", err)
+	}
+
+	want := `app_app.c (from app/app.cm):
+  #include "app_internal.h"  (own module's internal header)
+    app.h  (own module's public header)
+      net_http.h  (app imports "net/http")
+        log.h  (net/http imports "log")
+        util.h  (net/http imports "util")
+      util.h  (app imports "util", already included)
+  #include <stdio.h>  (cimport "stdio.h" on line 3)
+  #include "util.h"  (import "util" on line 4, already included)
+  #include "net_http.h"  (import "net/http" on line 5, already included)
+`
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestImportMapsSharedAcrossFiles(t *testing.T) {
+	parse := func(name, source string) *parser.File {
+		f, err := parser.ParseSource(source, name)
+		if err != nil {
+			t.Fatalf("parse %s: %v", name, err)
+		}
+		return f
+	}
+	shared := "module \"shapes\"\n\nimport \"geo/math\"\n\ncimport \"stdio.h\"\n"
+	files := []*parser.File{
+		parse("a.cm", shared),
+		parse("b.cm", shared),
+		parse("c.cm", shared),
+		parse("d.cm", "module \"shapes\"\n\nimport \"geo/math\"\n"),
+	}
+
+	maps := newImportMaps()
+	for i, f := range files {
+		ctx, err := maps.bodyContext(f, f.Module.Path, transform.BodyContext{})
+		if err != nil {
+			t.Fatalf("bodyContext: %v", err)
+		}
+		if ctx.Imports["math"] != "geo/math" {
+			t.Errorf("file %d: imports = %v", i, ctx.Imports)
+		}
+		if _, ok := ctx.CImports["stdio"]; ok != (i < 3) {
+			t.Errorf("file %d: cimports = %v", i, ctx.CImports)
+		}
+	}
+	if maps.builds != 2 {
+		t.Errorf("expected the maps built once per distinct import set (2), got %d", maps.builds)
+	}
+}
+
+func BenchmarkGenerateMultiFileModule(b *testing.B) {
+	tmpDir := b.TempDir()
+	mod := &project.ModuleInfo{ImportPath: "shapes"}
+	var files []*parser.File
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("f%d.cm", i)
+		source := fmt.Sprintf("module \"shapes\"\n\nimport \"geo/math\"\nimport \"util\"\n\ncimport \"stdio.h\"\n\nfunc f%d() int {\n    return math.add(%d, 1);\n}\n", i, i)
+		f, err := parser.ParseSource(source, name)
+		if err != nil {
+			b.Fatal(err)
+		}
+		mod.Files = append(mod.Files, filepath.Join(tmpDir, name))
+		files = append(files, f)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := GenerateModule(mod, files, tmpDir); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestGenerateModuleIsDeterministic(t *testing.T) {
+	src := "module \"app\"\n\nimport \"alpha\"\nimport \"beta\"\nimport \"gamma\"\nimport \"delta\"\n\npub func run() int {\n    return alpha.a() + beta.b() + gamma.c() + delta.d();\n}\n"
+	file, err := parser.ParseSource(src, "app.cm")
+	if err != nil {
+		t.Fatalf("ParseSource failed: %v", err)
+	}
+	mod := &project.ModuleInfo{ImportPath: "app", Files: []string{"app.cm"}}
+
+	dir := t.TempDir()
+	generate := func() map[string]string {
+		if err := GenerateModule(mod, []*parser.File{file}, dir); err != nil {
+			t.Fatalf("GenerateModule failed: %v", err)
+		}
+		out := make(map[string]string)
+		entries, _ := os.ReadDir(dir)
+		for _, e := range entries {
+			data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			out[e.Name()] = string(data)
+		}
+		return out
+	}
+
+	first := generate()
+	if !strings.Contains(first["app.h"], "#include \"alpha.h\"\n#include \"beta.h\"\n#include \"delta.h\"\n#include \"gamma.h\"\n") {
+		t.Errorf("expected sorted imports in the public header:\n%s", first["app.h"])
+	}
+	// Map order differs between runs; repeat to catch any that leaks out
+	for range 5 {
+		for name, content := range generate() {
+			if content != first[name] {
+				t.Fatalf("%s differs between runs:\n%s\n---\n%s", name, first[name], content)
+			}
+		}
+	}
+}
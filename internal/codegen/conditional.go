@@ -0,0 +1,100 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/elijahmorgan/c_minus/internal/parser"
+	"github.com/elijahmorgan/c_minus/internal/project"
+)
+
+// checkConditionalDecls reports declarations inside a top-level #if block
+// that the module's headers would declare unconditionally: types, defines,
+// non-static globals, re-exports, #pragma pack, and inline functions. The
+// .c file keeps the block, but a header copy of "#if X struct S {..} #else
+// struct S {..} #endif" would define S twice. Functions and static globals
+// may be conditional; a function in several branches must keep one
+// signature, since its prototype is declared once per branch.
+func checkConditionalDecls(mod *project.ModuleInfo, files []*parser.File) error {
+	type funcSig struct {
+		sig  string
+		path string
+		line int
+	}
+	sigs := make(map[string]funcSig)
+
+	for i, file := range files {
+		path := mod.Files[i]
+		var open []int // Lines of the #if directives enclosing the current decl
+		for _, decl := range file.Decls {
+			if d := decl.Directive; d != nil {
+				switch d.Name {
+				case "if", "ifdef", "ifndef":
+					open = append(open, d.Line)
+				case "endif":
+					if len(open) > 0 {
+						open = open[:len(open)-1]
+					}
+				}
+				continue
+			}
+			if len(open) == 0 {
+				continue
+			}
+
+			kind, name, line := conditionalHeaderDecl(decl)
+			if fn := decl.Function; fn != nil && !fn.Inline {
+				sig := functionSigKey(fn)
+				if prev, ok := sigs[fn.Name]; ok && prev.sig != sig {
+					return fmt.Errorf("func %s in module %s has different signatures in #if branches:\n  %s:%d: declared here\n  %s:%d: declared again here; the header declares one prototype per branch, so they must match",
+						fn.Name, mod.ImportPath, prev.path, prev.line, path, fn.Line)
+				}
+				sigs[fn.Name] = funcSig{sig: sig, path: path, line: fn.Line}
+				continue
+			}
+			if kind == "" {
+				continue
+			}
+			return fmt.Errorf("%s %s in module %s is inside an #if block:\n  %s:%d: declared here\n  %s:%d: block opened here; the module's headers declare it unconditionally, so move it out of the block",
+				kind, name, mod.ImportPath, path, line, path, open[len(open)-1])
+		}
+	}
+	return nil
+}
+
+// conditionalHeaderDecl returns the kind, name, and line of a declaration
+// that goes into a header whatever the #if blocks around it, or "" for one
+// that may be conditional
+func conditionalHeaderDecl(decl *parser.Decl) (kind, name string, line int) {
+	switch {
+	case decl.Struct != nil:
+		return "struct", decl.Struct.Name, decl.Struct.Line
+	case decl.Union != nil:
+		return "union", decl.Union.Name, decl.Union.Line
+	case decl.Enum != nil:
+		return "enum", decl.Enum.Name, decl.Enum.Line
+	case decl.Typedef != nil:
+		return "typedef", project.TypedefName(decl.Typedef.Body), decl.Typedef.Line
+	case decl.Define != nil:
+		return "#define", decl.Define.Name, decl.Define.Line
+	case decl.Global != nil && !decl.Global.Static:
+		return "global", decl.Global.Name, decl.Global.Line
+	case decl.Use != nil:
+		return "use", decl.Use.Module + "." + decl.Use.Name, decl.Use.Line
+	case decl.Pragma != nil && strings.HasPrefix(decl.Pragma.Text, "#pragma pack"):
+		return "#pragma", "pack", decl.Pragma.Line
+	case decl.Function != nil && decl.Function.Inline:
+		return "inline func", decl.Function.Name, decl.Function.Line
+	}
+	return "", "", 0
+}
+
+// functionSigKey returns a function's return and parameter types, which
+// must agree between the branches that define it
+func functionSigKey(fn *parser.FuncDecl) string {
+	parts := []string{fn.ReturnType}
+	for _, p := range fn.Params {
+		parts = append(parts, p.Type)
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,133 @@
+package codegen
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/elijahmorgan/c_minus/internal/parser"
+	"github.com/elijahmorgan/c_minus/internal/paths"
+	"github.com/elijahmorgan/c_minus/internal/project"
+)
+
+// include is one #include line of a generated .c file
+type include struct {
+	directive string // e.g. `#include "math.h"` or "#include <stdio.h>"
+	module    string // Import path whose public header this is (empty for C headers)
+	internal  bool   // The module's internal header, which includes its public header
+	reason    string // Why the file includes it
+}
+
+// cFileIncludes returns the includes of the .c file generated for file, in order
+func cFileIncludes(mod *project.ModuleInfo, n paths.Naming, file *parser.File, selfContained bool) []include {
+	moduleName := n.SanitizeModuleName(mod.ImportPath)
+	var includes []include
+
+	if selfContained {
+		// Include only the public header; private declarations follow the includes
+		includes = append(includes, include{
+			directive: fmt.Sprintf("#include \"%s.h\"", moduleName),
+			module:    mod.ImportPath,
+			reason:    "own module's public header (--self-contained)",
+		})
+	} else {
+		// Include internal header (which includes public header)
+		includes = append(includes, include{
+			directive: fmt.Sprintf("#include \"%s\"", filepath.Base(n.ModuleInternalHeaderPath("", mod.ImportPath))),
+			module:    mod.ImportPath,
+			internal:  true,
+			reason:    "own module's internal header",
+		})
+	}
+
+	// Include C standard library headers (cimports)
+	for _, cimp := range file.CImports {
+		includes = append(includes, include{
+			directive: fmt.Sprintf("#include <%s>", cimp.Path),
+			reason:    fmt.Sprintf("cimport %q on line %d", cimp.Path, cimp.Line),
+		})
+	}
+
+	// Include c_minus dependency headers
+	for _, imp := range file.Imports {
+		includes = append(includes, include{
+			directive: fmt.Sprintf("#include \"%s.h\"", n.SanitizeModuleName(imp.Path)),
+			module:    imp.Path,
+			reason:    fmt.Sprintf("import %q on line %d", imp.Path, imp.Line),
+		})
+	}
+
+	return includes
+}
+
+// traceIncludes writes the includes of one generated .c file as a tree: each
+// direct include with its reason, and indented below it the module headers it
+// pulls in. A public header includes the headers of every module its module
+// imports, from any of its files. Repeats are marked, since include guards
+// make them no-ops.
+func traceIncludes(w io.Writer, n paths.Naming, cPath, srcPath string, includes []include, moduleImports func(string) []string) {
+	fmt.Fprintf(w, "%s (from %s):\n", filepath.Base(cPath), srcPath)
+
+	seen := make(map[string]bool)
+	line := func(depth int, text, reason, header string) bool {
+		repeat := seen[header]
+		if repeat {
+			reason += ", already included"
+		}
+		seen[header] = true
+		fmt.Fprintf(w, "%s%s  (%s)\n", strings.Repeat("  ", depth+1), text, reason)
+		return !repeat
+	}
+
+	var expand func(module string, depth int)
+	expand = func(module string, depth int) {
+		imports := append([]string(nil), moduleImports(module)...)
+		sort.Strings(imports)
+		for _, imp := range imports {
+			header := n.SanitizeModuleName(imp) + ".h"
+			if line(depth, header, fmt.Sprintf("%s imports %q", module, imp), header) {
+				expand(imp, depth+1)
+			}
+		}
+	}
+
+	for _, inc := range includes {
+		header := strings.Trim(strings.TrimPrefix(inc.directive, "#include "), "\"<>")
+		if !line(0, inc.directive, inc.reason, header) || inc.module == "" {
+			continue
+		}
+		depth := 1
+		if inc.internal {
+			public := n.SanitizeModuleName(inc.module) + ".h"
+			if !line(1, public, "own module's public header", public) {
+				continue
+			}
+			depth = 2
+		}
+		expand(inc.module, depth)
+	}
+}
+
+// moduleImportsFunc returns the imports of a module across all of its files,
+// from files for the module being generated and from imported for the rest
+func moduleImportsFunc(mod *project.ModuleInfo, files []*parser.File, imported map[string][]*parser.File) func(string) []string {
+	return func(importPath string) []string {
+		modFiles := imported[importPath]
+		if importPath == mod.ImportPath {
+			modFiles = files
+		}
+		set := make(map[string]bool)
+		var out []string
+		for _, f := range modFiles {
+			for _, imp := range f.Imports {
+				if !set[imp.Path] {
+					set[imp.Path] = true
+					out = append(out, imp.Path)
+				}
+			}
+		}
+		return out
+	}
+}
@@ -0,0 +1,84 @@
+package codegen
+
+import (
+	"strings"
+
+	"github.com/elijahmorgan/c_minus/internal/paths"
+)
+
+// orderTypeDecls reorders type declarations so that a struct or union is
+// defined before any struct or union that holds it by value. Declarations
+// from different files of a module otherwise follow file order, which need
+// not match their dependencies. Pointer members only need the forward
+// declaration and impose no order. Source order is kept wherever it already
+// works, and pragmas stay where they are since they bracket the types between them.
+func orderTypeDecls(types []*typeDecl, moduleName string, n paths.Naming) []*typeDecl {
+	ordered := make([]*typeDecl, 0, len(types))
+	start := 0
+	for i := 0; i <= len(types); i++ {
+		if i < len(types) && types[i].kind != "pragma" {
+			continue
+		}
+		ordered = append(ordered, orderSegment(types[start:i], moduleName, n)...)
+		if i < len(types) {
+			ordered = append(ordered, types[i])
+		}
+		start = i + 1
+	}
+	return ordered
+}
+
+// orderSegment orders one run of declarations without pragmas
+func orderSegment(types []*typeDecl, moduleName string, n paths.Naming) []*typeDecl {
+	// Complete struct and union definitions, by mangled name
+	defined := make(map[string]int)
+	for i, td := range types {
+		if (td.kind == "struct" || td.kind == "union") && td.body != "" && !(td.opaque && td.public) {
+			defined[n.Mangle(moduleName, td.name)] = i
+		}
+	}
+
+	ordered := make([]*typeDecl, 0, len(types))
+	state := make([]int, len(types)) // 0 = pending, 1 = visiting, 2 = emitted
+	var visit func(i int)
+	visit = func(i int) {
+		if state[i] != 0 {
+			// Emitted, or a cycle of by-value members that C rejects anyway
+			return
+		}
+		state[i] = 1
+		if td := types[i]; td.kind == "struct" || td.kind == "union" {
+			for _, name := range valueMemberTypes(td.body) {
+				if dep, ok := defined[name]; ok && dep != i {
+					visit(dep)
+				}
+			}
+		}
+		state[i] = 2
+		ordered = append(ordered, types[i])
+	}
+	for i := range types {
+		visit(i)
+	}
+	return ordered
+}
+
+// valueMemberTypes returns the identifiers in a struct or union body that are
+// not followed by '*', i.e. candidate types of members held by value
+func valueMemberTypes(body string) []string {
+	var names []string
+	for i := 0; i < len(body); {
+		if !isIdentChar(rune(body[i])) {
+			i++
+			continue
+		}
+		start := i
+		for i < len(body) && isIdentChar(rune(body[i])) {
+			i++
+		}
+		if rest := strings.TrimLeft(body[i:], " \t\r\n"); !strings.HasPrefix(rest, "*") {
+			names = append(names, body[start:i])
+		}
+	}
+	return names
+}
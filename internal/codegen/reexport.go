@@ -0,0 +1,68 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/elijahmorgan/c_minus/internal/parser"
+	"github.com/elijahmorgan/c_minus/internal/project"
+	"github.com/elijahmorgan/c_minus/internal/transform"
+)
+
+// reexportFunction returns the public header entry for "pub use prefix.name":
+// a static inline wrapper, named as if the module declared the function,
+// that forwards to the imported module's function. Importers then call it
+// through this module without importing the original.
+func reexportFunction(mod *project.ModuleInfo, srcPath string, file *parser.File, use *parser.UseDecl, opts Options, local map[string]bool) (*funcDeclInfo, error) {
+	where := fmt.Sprintf("%s:%d: pub use %s.%s", srcPath, use.Line, use.Module, use.Name)
+
+	importMap, err := transform.BuildImportMap(file.Imports)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build import map for %s: %w", srcPath, err)
+	}
+	importPath, ok := importMap[use.Module]
+	if !ok {
+		return nil, fmt.Errorf("%s: %s is not imported", where, use.Module)
+	}
+	if local[use.Name] {
+		return nil, fmt.Errorf("%s: module %s already declares %s", where, mod.ImportPath, use.Name)
+	}
+
+	var fn *parser.FuncDecl
+	for _, f := range opts.Imported[importPath] {
+		for _, decl := range f.Decls {
+			if decl.Function != nil && decl.Function.Public && decl.Function.Name == use.Name {
+				fn = decl.Function
+			}
+		}
+	}
+	if fn == nil {
+		return nil, fmt.Errorf("%s: module %s has no pub func %s (only functions can be re-exported)", where, importPath, use.Name)
+	}
+
+	args := make([]string, len(fn.Params))
+	for i, p := range fn.Params {
+		if p.Type == "..." {
+			return nil, fmt.Errorf("%s: variadic functions cannot be re-exported", where)
+		}
+		args[i] = p.Name
+	}
+
+	// The signature keeps the original module's type names; only the function is renamed
+	n := opts.Naming
+	from := n.SanitizeModuleName(importPath)
+	target := n.Mangle(from, use.Name)
+	signature := generateFunctionSignature(fn, from, n, opts.C23)
+	signature = strings.Replace(signature, target+"(", n.Mangle(n.SanitizeModuleName(mod.ImportPath), use.Name)+"(", 1)
+
+	call := fmt.Sprintf("%s(%s);", target, strings.Join(args, ", "))
+	if returnType := strings.TrimSpace(fn.ReturnType); returnType != "" && returnType != "void" {
+		call = "return " + call
+	}
+
+	return &funcDeclInfo{
+		signature:  signature,
+		docComment: fn.DocComment,
+		definition: fmt.Sprintf("static inline %s {\n    %s\n}", signature, call),
+	}, nil
+}
@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/elijahmorgan/c_minus/internal/parser"
+	"github.com/elijahmorgan/c_minus/internal/paths"
 	"github.com/elijahmorgan/c_minus/internal/project"
 )
 
@@ -86,6 +87,59 @@ func TestGenerateModuleWithTypes(t *testing.T) {
 	}
 }
 
+func TestGenerateModuleWithOpaqueStruct(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	mod := &project.ModuleInfo{
+		ImportPath: "db",
+		Files:      []string{"conn.cm"},
+	}
+
+	files := []*parser.File{
+		{
+			Module: &parser.ModuleDecl{Path: "db"},
+			Decls: []*parser.Decl{
+				{
+					Struct: &parser.StructDecl{
+						Public:     true,
+						Opaque:     true,
+						Name:       "Conn",
+						Body:       "{\n    int fd;\n}",
+						Semi:       true,
+						DocComment: "// Conn is a database connection",
+					},
+				},
+			},
+		},
+	}
+
+	if err := GenerateModule(mod, files, tmpDir); err != nil {
+		t.Fatalf("GenerateModule failed: %v", err)
+	}
+
+	public, err := os.ReadFile(filepath.Join(tmpDir, "db.h"))
+	if err != nil {
+		t.Fatalf("failed to read db.h: %v", err)
+	}
+	if !strings.Contains(string(public), "// Conn is a database connection\ntypedef struct db_Conn db_Conn;") {
+		t.Errorf("db.h missing handle typedef, got:\n%s", public)
+	}
+	if strings.Contains(string(public), "int fd;") {
+		t.Errorf("db.h must not contain the struct definition, got:\n%s", public)
+	}
+
+	internal, err := os.ReadFile(filepath.Join(tmpDir, "db_internal.h"))
+	if err != nil {
+		t.Fatalf("failed to read db_internal.h: %v", err)
+	}
+	if !strings.Contains(string(internal), "struct db_Conn {\n    int fd;\n};") {
+		t.Errorf("db_internal.h missing struct definition, got:\n%s", internal)
+	}
+	if strings.Contains(string(internal), "typedef struct db_Conn") {
+		t.Errorf("db_internal.h must not repeat the typedef, got:\n%s", internal)
+	}
+}
+
 func TestGenerateWithQualifiedAccess(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -322,3 +376,437 @@ func TestGenerateFunctionWithFunctionPointerParam(t *testing.T) {
 		t.Errorf("header missing correctly formatted function pointer parameter, got:\n%s", headerContent)
 	}
 }
+
+func TestGenerateFunctionSignatureFunctionPointerArray(t *testing.T) {
+	tests := []struct {
+		param parser.Param
+		want  string
+	}{
+		{parser.Param{Name: "table", Type: "void (*[4])(int)"}, "void (*table[4])(int)"},
+		{parser.Param{Name: "pp", Type: "int (**)(void)"}, "int (**pp)(void)"},
+		{parser.Param{Name: "rows", Type: "int (*)[3]"}, "int (*rows)[3]"},
+		{parser.Param{Name: "cb", Type: "int (*const)(void)"}, "int (*const cb)(void)"},
+	}
+
+	for _, tt := range tests {
+		param := tt.param
+		fn := &parser.FuncDecl{Name: "run", ReturnType: "void", Params: []*parser.Param{&param}}
+		sig := generateFunctionSignature(fn, "events", paths.Naming{}, false)
+		if want := "void events_run(" + tt.want + ")"; sig != want {
+			t.Errorf("expected %q, got %q", want, sig)
+		}
+	}
+}
+
+func TestGenerateModuleWithPragmas(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	mod := &project.ModuleInfo{
+		ImportPath: "wire",
+		Files:      []string{filepath.Join(tmpDir, "wire.cm")},
+	}
+
+	files := []*parser.File{
+		{
+			Module: &parser.ModuleDecl{Path: "wire"},
+			Decls: []*parser.Decl{
+				{Pragma: &parser.PragmaDecl{Text: "#pragma pack(push, 1)"}},
+				{Struct: &parser.StructDecl{Public: true, Name: "Header", Body: "{\n    char tag;\n    int length;\n}", Semi: true}},
+				{Pragma: &parser.PragmaDecl{Text: "#pragma pack(pop)"}},
+				{Pragma: &parser.PragmaDecl{Text: "#pragma GCC diagnostic ignored \"-Wunused-parameter\""}},
+				{Function: &parser.FuncDecl{Public: true, Name: "size", ReturnType: "int", Params: []*parser.Param{{Name: "h", Type: "Header*"}}, Body: "{\n    return sizeof(Header);\n}"}},
+			},
+		},
+	}
+
+	if err := GenerateModule(mod, files, tmpDir); err != nil {
+		t.Fatalf("GenerateModule failed: %v", err)
+	}
+
+	header, err := os.ReadFile(filepath.Join(tmpDir, "wire.h"))
+	if err != nil {
+		t.Fatalf("failed to read wire.h: %v", err)
+	}
+	h := string(header)
+	push := strings.Index(h, "#pragma pack(push, 1)")
+	def := strings.Index(h, "typedef struct wire_Header")
+	pop := strings.Index(h, "#pragma pack(pop)")
+	if push < 0 || def < 0 || pop < 0 || !(push < def && def < pop) {
+		t.Errorf("expected pack pragmas around the struct in wire.h:\n%s", h)
+	}
+	if strings.Contains(h, "diagnostic") {
+		t.Errorf("only pack pragmas belong in headers:\n%s", h)
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, "wire_wire.c"))
+	if err != nil {
+		t.Fatalf("failed to read wire_wire.c: %v", err)
+	}
+	c := string(content)
+	diag := strings.Index(c, "#pragma GCC diagnostic")
+	fn := strings.Index(c, "int wire_size(")
+	if diag < 0 || fn < 0 || diag > fn {
+		t.Errorf("expected diagnostic pragma before the function in the .c:\n%s", c)
+	}
+	// A repeated push or pop would change what the pragmas apply to
+	for _, pragma := range []string{"#pragma pack(push, 1)", "#pragma pack(pop)", "#pragma GCC diagnostic"} {
+		if n := strings.Count(c, pragma); n != 1 {
+			t.Errorf("expected %q once in the .c, got %d:\n%s", pragma, n, c)
+		}
+	}
+}
+
+func TestGenerateModuleC23Keywords(t *testing.T) {
+	mod := &project.ModuleInfo{ImportPath: "flags", Files: []string{"flags.cm"}}
+	// Before C23 these are ordinary identifiers, so a module may declare them
+	files := []*parser.File{
+		{
+			Module: &parser.ModuleDecl{Path: "flags"},
+			Decls: []*parser.Decl{
+				{Global: &parser.GlobalDecl{Type: "int", Name: "nullptr"}},
+				{Function: &parser.FuncDecl{Public: true, Name: "check", ReturnType: "bool", Params: []*parser.Param{{Name: "ok", Type: "bool"}, {Name: "p", Type: "int*"}}, Body: "{\n    return ok && p != nullptr ? true : false;\n}"}},
+			},
+		},
+	}
+
+	tests := []struct {
+		c23      bool
+		wantSig  string
+		wantBody string
+	}{
+		{true, "bool flags_check(bool ok, int* p)", "return ok && p != nullptr ? true : false;"},
+		{false, "flags_bool flags_check(flags_bool ok, int* p)", "return ok && p != flags_nullptr ? true : false;"},
+	}
+
+	for _, tt := range tests {
+		tmpDir := t.TempDir()
+		if err := GenerateModuleWithOptions(mod, files, tmpDir, Options{C23: tt.c23}); err != nil {
+			t.Fatalf("GenerateModuleWithOptions failed: %v", err)
+		}
+
+		header, err := os.ReadFile(filepath.Join(tmpDir, "flags.h"))
+		if err != nil {
+			t.Fatalf("failed to read flags.h: %v", err)
+		}
+		if !strings.Contains(string(header), tt.wantSig+";") {
+			t.Errorf("C23=%v: expected %q in header:\n%s", tt.c23, tt.wantSig, header)
+		}
+
+		content, err := os.ReadFile(filepath.Join(tmpDir, "flags_flags.c"))
+		if err != nil {
+			t.Fatalf("failed to read flags_flags.c: %v", err)
+		}
+		if !strings.Contains(string(content), tt.wantBody) {
+			t.Errorf("C23=%v: expected %q in body:\n%s", tt.c23, tt.wantBody, content)
+		}
+	}
+}
+
+func TestGenerateModuleAlignment(t *testing.T) {
+	tmpDir := t.TempDir()
+	mod := &project.ModuleInfo{ImportPath: "ring", Files: []string{"ring.cm"}}
+	files := []*parser.File{
+		{
+			Module: &parser.ModuleDecl{Path: "ring"},
+			Decls: []*parser.Decl{
+				{Struct: &parser.StructDecl{Public: true, Name: "Slot", Body: "{\n    _Alignas(64) int head;\n    int tail;\n}", Semi: true}},
+				{Global: &parser.GlobalDecl{Public: true, Align: "_Alignas(64)", Type: "int", Name: "count", Value: "0"}},
+				{Global: &parser.GlobalDecl{Align: "_Alignas(16)", Type: "char", Name: "scratch"}},
+			},
+		},
+	}
+
+	if err := GenerateModule(mod, files, tmpDir); err != nil {
+		t.Fatalf("GenerateModule failed: %v", err)
+	}
+
+	for name, wants := range map[string][]string{
+		"ring.h":          {"_Alignas(64) int head;", "extern _Alignas(64) int ring_count;"},
+		"ring_internal.h": {"extern _Alignas(16) char ring_scratch;"},
+		"ring_ring.c":     {"_Alignas(64) int ring_count = 0;", "_Alignas(16) char ring_scratch;"},
+	} {
+		content, err := os.ReadFile(filepath.Join(tmpDir, name))
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", name, err)
+		}
+		for _, want := range wants {
+			if !strings.Contains(string(content), want) {
+				t.Errorf("%s missing %q:\n%s", name, want, content)
+			}
+		}
+	}
+}
+
+func TestGenerateModulePackedTypes(t *testing.T) {
+	tmpDir := t.TempDir()
+	mod := &project.ModuleInfo{ImportPath: "wire", Files: []string{"wire.cm"}}
+	files := []*parser.File{
+		{
+			Module: &parser.ModuleDecl{Path: "wire"},
+			Decls: []*parser.Decl{
+				{Struct: &parser.StructDecl{Public: true, Packed: true, Name: "Header", Body: "{\n    char tag;\n    int length;\n}", Semi: true}},
+				{Struct: &parser.StructDecl{Public: true, Opaque: true, Packed: true, Name: "Conn", Body: "{\n    int fd;\n}", Semi: true}},
+				{Union: &parser.UnionDecl{Packed: true, Name: "Word", Body: "{\n    char bytes[3];\n    short half;\n}", Semi: true}},
+			},
+		},
+	}
+
+	if err := GenerateModule(mod, files, tmpDir); err != nil {
+		t.Fatalf("GenerateModule failed: %v", err)
+	}
+
+	for name, wants := range map[string][]string{
+		"wire.h":          {"typedef struct __attribute__((packed)) wire_Header {\n    char tag;", "} wire_Header;", "typedef struct wire_Conn wire_Conn;"},
+		"wire_internal.h": {"struct __attribute__((packed)) wire_Conn {\n    int fd;\n};", "typedef union __attribute__((packed)) wire_Word {"},
+	} {
+		content, err := os.ReadFile(filepath.Join(tmpDir, name))
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", name, err)
+		}
+		for _, want := range wants {
+			if !strings.Contains(string(content), want) {
+				t.Errorf("%s missing %q:\n%s", name, want, content)
+			}
+		}
+	}
+}
+
+func TestGenerateModuleAnonymousEnum(t *testing.T) {
+	tmpDir := t.TempDir()
+	mod := &project.ModuleInfo{ImportPath: "limits", Files: []string{"limits.cm"}}
+	files := []*parser.File{
+		{
+			Module: &parser.ModuleDecl{Path: "limits"},
+			Decls: []*parser.Decl{
+				{Enum: &parser.EnumDecl{Public: true, Body: "{ MAX_USERS = 64, MAX_GROUPS }", Semi: true}},
+				{Enum: &parser.EnumDecl{Body: "{ RETRIES = 3 }", Semi: true}},
+				{Function: &parser.FuncDecl{Public: true, Name: "budget", ReturnType: "int", Body: "{\n    return MAX_USERS * RETRIES;\n}"}},
+			},
+		},
+	}
+
+	if err := GenerateModule(mod, files, tmpDir); err != nil {
+		t.Fatalf("GenerateModule failed: %v", err)
+	}
+
+	for name, wants := range map[string][]string{
+		"limits.h":          {"enum {\n    limits_MAX_USERS= 64,\n    limits_MAX_GROUPS\n};"},
+		"limits_internal.h": {"enum {\n    limits_RETRIES= 3\n};"},
+		"limits_limits.c":   {"return limits_MAX_USERS * limits_RETRIES;"},
+	} {
+		content, err := os.ReadFile(filepath.Join(tmpDir, name))
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", name, err)
+		}
+		for _, want := range wants {
+			if !strings.Contains(string(content), want) {
+				t.Errorf("%s missing %q:\n%s", name, want, content)
+			}
+		}
+		if strings.Contains(string(content), "typedef enum  ") || strings.Contains(string(content), "limits_ ") {
+			t.Errorf("%s declares a type for an anonymous enum:\n%s", name, content)
+		}
+	}
+}
+
+func TestGenerateModulePrivateTypeInPublicSignature(t *testing.T) {
+	mod := &project.ModuleInfo{
+		ImportPath: "geo",
+		Files:      []string{"types.cm", "api.cm"},
+	}
+	types, err := parser.ParseSource("module \"geo\"\n\nstruct Node { int value; };\npub struct Point { int x; };\n", "types.cm")
+	if err != nil {
+		t.Fatalf("parse types.cm: %v", err)
+	}
+	api, err := parser.ParseSource(`module "geo"
+
+pub func origin() Point {
+    return (Point){0};
+}
+
+func first(Node* n) int {
+    return n->value;
+}
+
+pub func make_node(const struct Node* tmpl, int value) Node* {
+    return 0;
+}
+`, "api.cm")
+	if err != nil {
+		t.Fatalf("parse api.cm: %v", err)
+	}
+
+	err = GenerateModule(mod, []*parser.File{types, api}, t.TempDir())
+	if err == nil {
+		t.Fatal("expected an error for a private type in a pub signature")
+	}
+	want := "pub func make_node in module geo uses private struct Node [CM0014]:\n  api.cm:11: function declared here\n  types.cm:3: Node declared here; mark it pub or make make_node private"
+	if err.Error() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", err, want)
+	}
+
+	// Private functions and explicit struct tags are fine
+	ok, err := parser.ParseSource(`module "geo"
+
+struct Node { int value; };
+
+func first(Node* n) int {
+    return n->value;
+}
+
+pub func count(struct Node* n) int {
+    return 1;
+}
+`, "api.cm")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	mod.Files = []string{"api.cm"}
+	if err := GenerateModule(mod, []*parser.File{ok}, t.TempDir()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestGenerateModulePrivateSymbolInPublicInline(t *testing.T) {
+	mod := &project.ModuleInfo{ImportPath: "util", Files: []string{"util.cm"}}
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"func", "return helper();", "uses private func helper [CM0015]:\n  util.cm:19: function declared here\n  util.cm:11: helper declared here; mark it pub or drop inline from get"},
+		{"global", "return counter;", "uses private global counter [CM0015]"},
+		{"static global", "return hits;", "uses private global hits [CM0015]"},
+		{"define", "return LIMIT;", "uses private #define LIMIT [CM0015]"},
+		{"enum value", "return RED;", "uses private enum value RED [CM0015]"},
+		{"type", "return sizeof(Cell);", "uses private typedef Cell [CM0015]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := `module "util"
+
+int counter = 0;
+static int hits = 0;
+pub int total = 0;
+
+#define LIMIT 3
+enum Color { RED, GREEN };
+typedef int Cell;
+
+func helper() int {
+    return 1;
+}
+
+pub func shared() int {
+    return 2;
+}
+
+pub inline func get(int n) int {
+    ` + tt.body + `
+}
+`
+			file, err := parser.ParseSource(src, "util.cm")
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			err = GenerateModule(mod, []*parser.File{file}, t.TempDir())
+			if err == nil {
+				t.Fatal("expected an error for a private symbol in a pub inline body")
+			}
+			if !strings.Contains(err.Error(), "pub inline func get in module util "+tt.want) {
+				t.Errorf("got:\n%s\nwant it to contain:\n%s", err, tt.want)
+			}
+		})
+	}
+
+	// Pub symbols, parameters shadowing private names, and private inline
+	// functions are fine
+	ok, err := parser.ParseSource(`module "util"
+
+int counter = 0;
+pub int total = 0;
+
+func helper() int {
+    return 1;
+}
+
+pub func shared() int {
+    return 2;
+}
+
+pub inline func get(int counter) int {
+    return shared() + total + counter;
+}
+
+inline func peek() int {
+    return helper() + counter;
+}
+`, "util.cm")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if err := GenerateModule(mod, []*parser.File{ok}, t.TempDir()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestGenerateModuleOrdersValueMembers(t *testing.T) {
+	tmpDir := t.TempDir()
+	mod := &project.ModuleInfo{
+		ImportPath: "geo",
+		Files:      []string{"a.cm", "b.cm"},
+	}
+	a, err := parser.ParseSource(`module "geo"
+
+pub struct Shape {
+    int kind;
+    Value v;
+};
+
+pub union Value {
+    Vec2 point;
+    float scalar;
+};
+`, "a.cm")
+	if err != nil {
+		t.Fatalf("parse a.cm: %v", err)
+	}
+	b, err := parser.ParseSource(`module "geo"
+
+pub struct Link {
+    Shape *owner;
+};
+
+pub struct Vec2 {
+    float x;
+    float y;
+};
+`, "b.cm")
+	if err != nil {
+		t.Fatalf("parse b.cm: %v", err)
+	}
+
+	if err := GenerateModule(mod, []*parser.File{a, b}, tmpDir); err != nil {
+		t.Fatalf("GenerateModule failed: %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(tmpDir, "geo.h"))
+	if err != nil {
+		t.Fatalf("failed to read geo.h: %v", err)
+	}
+	header := string(content)
+
+	var positions []int
+	for _, def := range []string{"typedef struct geo_Vec2 {", "typedef union geo_Value {", "typedef struct geo_Shape {", "typedef struct geo_Link {"} {
+		pos := strings.Index(header, def)
+		if pos < 0 {
+			t.Fatalf("missing %q in:\n%s", def, header)
+		}
+		positions = append(positions, pos)
+	}
+	for i := 1; i < len(positions); i++ {
+		if positions[i-1] > positions[i] {
+			t.Errorf("expected Vec2, Value, Shape, Link in that order, got:\n%s", header)
+			break
+		}
+	}
+}
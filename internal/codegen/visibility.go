@@ -0,0 +1,167 @@
+package codegen
+
+import (
+	"fmt"
+
+	"github.com/elijahmorgan/c_minus/internal/diag"
+	"github.com/elijahmorgan/c_minus/internal/parser"
+	"github.com/elijahmorgan/c_minus/internal/paths"
+	"github.com/elijahmorgan/c_minus/internal/project"
+	"github.com/elijahmorgan/c_minus/internal/transform"
+)
+
+// privateType is a struct, union, or enum declared without pub
+type privateType struct {
+	kind string
+	path string
+	line int
+}
+
+// checkPublicSignatures reports a pub function whose return or parameter type
+// names a private struct, union, or enum of the module. The public header
+// would refer to module_Type, which only the internal header declares, so
+// every importer would fail to compile.
+func checkPublicSignatures(mod *project.ModuleInfo, files []*parser.File) error {
+	private := make(map[string]privateType)
+	for i, file := range files {
+		for _, decl := range file.Decls {
+			var kind, name string
+			var line int
+			switch {
+			case decl.Struct != nil && !decl.Struct.Public:
+				kind, name, line = "struct", decl.Struct.Name, decl.Struct.Line
+			case decl.Union != nil && !decl.Union.Public:
+				kind, name, line = "union", decl.Union.Name, decl.Union.Line
+			case decl.Enum != nil && !decl.Enum.Public && decl.Enum.Name != "":
+				kind, name, line = "enum", decl.Enum.Name, decl.Enum.Line
+			default:
+				continue
+			}
+			private[name] = privateType{kind: kind, path: mod.Files[i], line: line}
+		}
+	}
+	if len(private) == 0 {
+		return nil
+	}
+
+	for i, file := range files {
+		for _, decl := range file.Decls {
+			fn := decl.Function
+			if fn == nil || !fn.Public {
+				continue
+			}
+			types := []string{fn.ReturnType}
+			for _, p := range fn.Params {
+				types = append(types, p.Type)
+			}
+			for _, typ := range types {
+				for _, name := range localTypeNames(typ) {
+					pt, ok := private[name]
+					if !ok {
+						continue
+					}
+					return fmt.Errorf("pub func %s in module %s uses private %s %s [%s]:\n  %s:%d: function declared here\n  %s:%d: %s declared here; mark it pub or make %s private",
+						fn.Name, mod.ImportPath, pt.kind, name, diag.PrivateTypeInPublicAPI, mod.Files[i], fn.Line, pt.path, pt.line, name, fn.Name)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkPublicInlines reports a pub inline function whose body uses a private
+// function, global, define, type, or enum value of the module. Its definition
+// goes into the public header, where only pub declarations precede it.
+func checkPublicInlines(mod *project.ModuleInfo, files []*parser.File) error {
+	type privateSymbol struct {
+		kind string
+		path string
+		line int
+	}
+	private := make(map[string]privateSymbol)
+	for i, file := range files {
+		add := func(kind, name string, line int) {
+			if name != "" {
+				private[name] = privateSymbol{kind: kind, path: mod.Files[i], line: line}
+			}
+		}
+		for _, decl := range file.Decls {
+			switch {
+			case decl.Function != nil && !decl.Function.Public:
+				add("func", decl.Function.Name, decl.Function.Line)
+			case decl.Global != nil && !decl.Global.Public:
+				add("global", decl.Global.Name, decl.Global.Line)
+			case decl.Define != nil && !decl.Define.Public:
+				add("#define", decl.Define.Name, decl.Define.Line)
+			case decl.Struct != nil && !decl.Struct.Public:
+				add("struct", decl.Struct.Name, decl.Struct.Line)
+			case decl.Union != nil && !decl.Union.Public:
+				add("union", decl.Union.Name, decl.Union.Line)
+			case decl.Typedef != nil && !decl.Typedef.Public:
+				add("typedef", project.TypedefName(decl.Typedef.Body), decl.Typedef.Line)
+			case decl.Enum != nil && !decl.Enum.Public:
+				add("enum", decl.Enum.Name, decl.Enum.Line)
+				values := make(transform.EnumValueMap)
+				extractEnumValues(decl.Enum.Body, decl.Enum.Name, "", paths.Naming{}, values)
+				for value := range values {
+					add("enum value", value, decl.Enum.Line)
+				}
+			}
+		}
+	}
+	if len(private) == 0 {
+		return nil
+	}
+
+	// The body transform finds the names it would rewrite as module symbols,
+	// skipping fields, string literals, and names its parameters shadow
+	names := make(transform.GlobalVarMap, len(private))
+	for name := range private {
+		names[name] = name
+	}
+	for i, file := range files {
+		for _, decl := range file.Decls {
+			fn := decl.Function
+			if fn == nil || !fn.Public || !fn.Inline {
+				continue
+			}
+			ctx := &transform.BodyContext{GlobalVars: names, Locals: make(map[string]bool, len(fn.Params))}
+			for _, p := range fn.Params {
+				ctx.Locals[p.Name] = true
+			}
+			_, subs := transform.TransformBodyWithSubstitutions(fn.Body, ctx)
+			for _, sub := range subs {
+				ps := private[sub.From]
+				return fmt.Errorf("pub inline func %s in module %s uses private %s %s [%s]:\n  %s:%d: function declared here\n  %s:%d: %s declared here; mark it pub or drop inline from %s",
+					fn.Name, mod.ImportPath, ps.kind, sub.From, diag.PrivateInPublicInline, mod.Files[i], fn.Line, ps.path, ps.line, sub.From, fn.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// localTypeNames returns the identifiers in a signature type that refer to the
+// current module: not qualified by an import ("geo.Point") and not written
+// with an explicit struct, union, or enum keyword, which is left unmangled
+func localTypeNames(typ string) []string {
+	var names []string
+	prev := ""
+	for i := 0; i < len(typ); {
+		if !isIdentChar(rune(typ[i])) {
+			i++
+			continue
+		}
+		start := i
+		for i < len(typ) && isIdentChar(rune(typ[i])) {
+			i++
+		}
+		word := typ[start:i]
+		qualified := (start > 0 && typ[start-1] == '.') || (i < len(typ) && typ[i] == '.')
+		if !qualified && prev != "struct" && prev != "union" && prev != "enum" {
+			names = append(names, word)
+		}
+		prev = word
+	}
+	return names
+}
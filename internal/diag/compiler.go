@@ -0,0 +1,99 @@
+package diag
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// CompilerDiag is one diagnostic reported by the C compiler. Thanks to the
+// #line directives in generated code, File is usually the .cm source.
+type CompilerDiag struct {
+	File     string
+	Line     int // 1-based
+	Col      int // 1-based for gcc output; 0 if unknown
+	EndCol   int // End of the range, when the reporter gives one (the LSP); 0 otherwise
+	Severity string
+	Message  string
+	Notes    []string // "note:" lines that follow the diagnostic, as printed
+	More     int      // Follow-on diagnostics on the same line collapsed into this one
+}
+
+// compilerLineRE matches "file:line[:col]: severity: message"
+var compilerLineRE = regexp.MustCompile(`^(.+?):(\d+):(?:(\d+):)? (fatal error|error|warning|note): (.*)$`)
+
+// ParseCompilerOutput extracts the diagnostics from gcc's stderr. Notes attach
+// to the diagnostic before them; source excerpts, carets, and "In function"
+// context lines are dropped.
+func ParseCompilerOutput(output string) []CompilerDiag {
+	var diags []CompilerDiag
+	for _, line := range strings.Split(output, "\n") {
+		m := compilerLineRE.FindStringSubmatch(strings.TrimRight(line, "\r"))
+		if m == nil {
+			continue
+		}
+		if m[4] == "note" {
+			if len(diags) > 0 {
+				last := &diags[len(diags)-1]
+				last.Notes = append(last.Notes, m[0])
+			}
+			continue
+		}
+		lineNum, _ := strconv.Atoi(m[2])
+		col, _ := strconv.Atoi(m[3])
+		diags = append(diags, CompilerDiag{File: m[1], Line: lineNum, Col: col, Severity: m[4], Message: m[5]})
+	}
+	return diags
+}
+
+// GroupCompilerDiags keeps the first diagnostic of each source line and
+// severity, in order, and counts the rest in its More field. One mistake
+// usually produces a cascade of errors on the same line; the first is the one
+// to fix.
+func GroupCompilerDiags(diags []CompilerDiag) []CompilerDiag {
+	type key struct {
+		file     string
+		line     int
+		severity string
+	}
+	index := make(map[key]int)
+	var grouped []CompilerDiag
+	for _, d := range diags {
+		k := key{d.File, d.Line, d.Severity}
+		if i, ok := index[k]; ok {
+			grouped[i].More += 1 + d.More
+			continue
+		}
+		index[k] = len(grouped)
+		grouped = append(grouped, d)
+	}
+	return grouped
+}
+
+// String formats the diagnostic as gcc does, followed by its notes and a
+// count of the collapsed follow-on diagnostics
+func (d CompilerDiag) String() string {
+	var sb strings.Builder
+	if d.Col > 0 {
+		fmt.Fprintf(&sb, "%s:%d:%d: %s: %s\n", d.File, d.Line, d.Col, d.Severity, d.Message)
+	} else {
+		fmt.Fprintf(&sb, "%s:%d: %s: %s\n", d.File, d.Line, d.Severity, d.Message)
+	}
+	for _, note := range d.Notes {
+		fmt.Fprintf(&sb, "  %s\n", note)
+	}
+	if d.More > 0 {
+		fmt.Fprintf(&sb, "  (%d more %s on this line)\n", d.More, plural(d.More, d.Severity))
+	}
+	return sb.String()
+}
+
+// plural returns "error" or "errors" (and so on) for n diagnostics of severity
+func plural(n int, severity string) string {
+	severity = strings.TrimPrefix(severity, "fatal ")
+	if n == 1 {
+		return severity
+	}
+	return severity + "s"
+}
@@ -0,0 +1,55 @@
+package diag
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGroupCompilerDiags(t *testing.T) {
+	output := `/p/main.cm: In function 'main':
+/p/main.cm:5:5: error: unknown type name 'Pointt'; did you mean 'Point'?
+    5 |     Pointt p = {1, 2};
+      |     ^~~~~~
+      |     Point
+/p/main.cm:5:17: warning: excess elements in scalar initializer
+/p/main.cm:5:20: error: expected ';' before '}' token
+/p/main.cm:5:22: error: expected statement before '}' token
+/p/main.cm:6:12: error: request for member 'x' in something not a structure or union
+/p/main.cm:5:17: note: (near initialization for 'p')
+/p/geo.cm:3:8: note: declared here
+In file included from /p/.c_minus/main_main.c:1:
+/p/main.cm:9: error: 'missing' undeclared (first use in this function)
+cc1: all warnings being treated as errors
+`
+
+	diags := ParseCompilerOutput(output)
+	if len(diags) != 6 {
+		t.Fatalf("expected 6 diagnostics, got %d: %+v", len(diags), diags)
+	}
+	if d := diags[4]; d.Line != 6 || len(d.Notes) != 2 || !strings.HasSuffix(d.Notes[1], "note: declared here") {
+		t.Errorf("expected notes to attach to the preceding diagnostic, got %+v", d)
+	}
+	if d := diags[5]; d.Line != 9 || d.Col != 0 || d.Message != "'missing' undeclared (first use in this function)" {
+		t.Errorf("expected a diagnostic without a column, got %+v", d)
+	}
+
+	grouped := GroupCompilerDiags(diags)
+	if len(grouped) != 4 {
+		t.Fatalf("expected 4 groups, got %d: %+v", len(grouped), grouped)
+	}
+	first := grouped[0]
+	if first.Line != 5 || first.Col != 5 || first.Severity != "error" || first.More != 2 {
+		t.Errorf("expected the first error on line 5 to absorb the two after it, got %+v", first)
+	}
+	if w := grouped[1]; w.Severity != "warning" || w.Line != 5 || w.More != 0 {
+		t.Errorf("expected the warning on line 5 to stay separate, got %+v", w)
+	}
+
+	want := "/p/main.cm:5:5: error: unknown type name 'Pointt'; did you mean 'Point'?\n  (2 more errors on this line)\n"
+	if got := first.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got := grouped[3].String(); got != "/p/main.cm:9: error: 'missing' undeclared (first use in this function)\n" {
+		t.Errorf("unexpected String() without a column: %q", got)
+	}
+}
@@ -0,0 +1,259 @@
+// Package diag assigns stable codes to C-minus diagnostics and holds the
+// longer explanations printed by "c_minus explain".
+package diag
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Codes for diagnostics. Codes are stable: never renumber or reuse one.
+const (
+	UnusedImport        = "CM0001"
+	ShadowedImport      = "CM0002"
+	UndefinedIdentifier = "CM0003"
+	UnusedPrivate       = "CM0004"
+	PubInMain           = "CM0005"
+	DuplicateEnumMember = "CM0006"
+	MissingReturn       = "CM0007"
+	ConstParam          = "CM0008"
+	IncompleteSwitch    = "CM0009"
+
+	ModuleMismatch         = "CM0010"
+	ModulePathMismatch     = "CM0011"
+	CircularDependency     = "CM0012"
+	DuplicateGlobal        = "CM0013"
+	PrivateTypeInPublicAPI = "CM0014"
+	PrivateInPublicInline  = "CM0015"
+)
+
+// Entry describes one diagnostic code
+type Entry struct {
+	Code    string // Stable code, e.g. "CM0012"
+	Name    string // Short name; for warnings this is the rule used in cminus:ignore
+	Summary string // One-line description
+	Details string // Longer explanation of why the diagnostic fires
+	Example string // Minimal example of the fix
+}
+
+// entries is ordered by code
+var entries = []Entry{
+	{
+		Code:    UnusedImport,
+		Name:    "unused-import",
+		Summary: "an imported module is never used",
+		Details: `A file imports a module but never refers to anything through its prefix.
+Imports are per file, so every file must only import what it uses.`,
+		Example: `// Remove the import, or use it:
+import "log"
+
+func main() int {
+    log.info("started");
+    return 0;
+}`,
+	},
+	{
+		Code:    ShadowedImport,
+		Name:    "shadowed-import",
+		Summary: "a local name hides an import prefix",
+		Details: `A parameter or local variable has the same name as an import prefix, so
+prefix.name accesses in its scope are treated as field access instead.`,
+		Example: `import "log"
+
+// Rename the parameter so log.info still refers to the module:
+func report(char* msg) void {
+    log.info(msg);
+}`,
+	},
+	{
+		Code:    UndefinedIdentifier,
+		Name:    "undefined-identifier",
+		Summary: "a name is not declared in the module or its imports (--checks)",
+		Details: `The heuristic checker found a call or reference to a name that no file of
+the module declares and no import provides. It usually means a missing
+import or a misspelled name.`,
+		Example: `// Import the module that declares the function and call it qualified:
+import "math"
+
+func main() int {
+    return math.add(1, 2);
+}`,
+	},
+	{
+		Code:    UnusedPrivate,
+		Name:    "unused-private",
+		Summary: "a private declaration is never used in its module (--unused)",
+		Details: `A declaration without pub is only visible inside its module, and no file of
+the module refers to it. It is dead code.`,
+		Example: `// Delete the declaration, or make it pub if other modules should use it:
+pub func helper() int {
+    return 1;
+}`,
+	},
+	{
+		Code:    PubInMain,
+		Name:    "pub-in-main",
+		Summary: "pub has no effect in the main module",
+		Details: `Nothing can import the main module, so marking its declarations pub only
+generates a header no one includes.`,
+		Example: `module "main"
+
+// Drop pub:
+func helper() int {
+    return 1;
+}`,
+	},
+	{
+		Code:    DuplicateEnumMember,
+		Name:    "duplicate-enum-member",
+		Summary: "two enums in a module share a member name",
+		Details: `Enum members are used unqualified inside their module, so a member name
+defined by two enums is ambiguous and the generated C will not compile.`,
+		Example: `// Give each member a distinct name:
+enum Color { COLOR_RED, COLOR_GREEN };
+enum Light { LIGHT_RED, LIGHT_AMBER };`,
+	},
+	{
+		Code:    MissingReturn,
+		Name:    "missing-return",
+		Summary: "a non-void function may end without returning a value",
+		Details: `The last statement of the function body is not a return, a goto, an
+infinite loop, or a call that never returns, so control can reach the
+closing brace. The caller then reads an undefined return value. The check
+only looks at the end of the body; branches that all return are accepted
+when the last statement is an if/else or a switch with a default label.`,
+		Example: `// Return on every path:
+pub func sign(int x) int {
+    if (x < 0) {
+        return -1;
+    }
+    return x > 0;
+}`,
+	},
+	{
+		Code:    ConstParam,
+		Name:    "const-param",
+		Summary: "a pointer parameter is only read through and could be const",
+		Details: `The function never assigns through the pointer, increments what it points
+to, takes an address through it, or passes it on, so the parameter could
+point to const. Callers can then pass const data, and the signature says
+the function leaves it alone. The check is opt-in (c_minus vet
+--const-params) and stays quiet whenever a use might write, such as
+passing the pointer to another function.`,
+		Example: `// Declare the pointed-to type const:
+pub func area(const Rect* r) int {
+    return r->w * r->h;
+}`,
+	},
+	{
+		Code:    IncompleteSwitch,
+		Name:    "incomplete-switch",
+		Summary: "a switch over an enum misses members and has no default",
+		Details: `The switched variable is declared with one of the module's enum types, but
+some members have no case label and there is no default label, so those
+values silently fall through the switch. The check runs with --checks and
+only follows switches on a parameter or local declared with the enum type.`,
+		Example: `// Handle every member, or add a default label:
+switch (s) {
+case PENDING:
+    return 1;
+case DONE:
+    return 2;
+}`,
+	},
+	{
+		Code:    ModuleMismatch,
+		Name:    "module-mismatch",
+		Summary: "files in one directory declare different modules",
+		Details: `Every .cm file in a directory belongs to the same module, so all of them
+must start with the same module declaration.`,
+		Example: `// math/add.cm and math/sub.cm both declare:
+module "math"`,
+	},
+	{
+		Code:    ModulePathMismatch,
+		Name:    "module-path-mismatch",
+		Summary: "a module declaration does not match its directory",
+		Details: `A module's import path is its directory relative to cm.mod, and the module
+declaration must say the same path.`,
+		Example: `// In utils/strings/trim.cm:
+module "utils/strings"`,
+	},
+	{
+		Code:    CircularDependency,
+		Name:    "circular-dependency",
+		Summary: "modules import each other in a cycle",
+		Details: `Modules must form an acyclic import graph so they can be built in
+dependency order. Break the cycle by moving the shared declarations
+into a module that both sides import.`,
+		Example: `// Before: a imports b and b imports a.
+// After: both import a new module "shared" holding what they share.
+module "a"
+import "shared"`,
+	},
+	{
+		Code:    DuplicateGlobal,
+		Name:    "duplicate-global",
+		Summary: "a global variable is declared twice in a module",
+		Details: `All files of a module share one namespace, so a global declared in two
+files would be defined twice at link time.`,
+		Example: `// Keep one declaration and use it from every file of the module:
+int counter = 0;`,
+	},
+	{
+		Code:    PrivateTypeInPublicAPI,
+		Name:    "private-type-in-public-api",
+		Summary: "a pub function's signature uses a private type",
+		Details: `The public header declares every pub function, but private structs, unions,
+and enums are only declared in the internal header. Importers would see a
+type they cannot name, so the module could not be used.`,
+		Example: `// Make the type pub as well (or "pub opaque struct" to hide its fields):
+pub struct Node { int value; };
+
+pub func make_node(int value) Node* {
+    ...
+}`,
+	},
+	{
+		Code:    PrivateInPublicInline,
+		Name:    "private-in-public-inline",
+		Summary: "a pub inline function's body uses a private symbol",
+		Details: `A pub inline function is defined in the public header, which importers and
+the module's own files include before the internal header. Private
+functions, globals, defines, types, and enum values are only declared in the
+internal header, so the body could not compile.`,
+		Example: `// Make the symbol pub, or drop inline so the body stays in the .c file:
+pub int counter = 0;
+
+pub inline func get() int {
+    return counter;
+}`,
+	},
+}
+
+// All returns every known entry, ordered by code
+func All() []Entry {
+	return append([]Entry(nil), entries...)
+}
+
+// Lookup finds an entry by code (case-insensitive) or by name
+func Lookup(key string) (Entry, bool) {
+	for _, e := range entries {
+		if strings.EqualFold(e.Code, key) || e.Name == key {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+// String formats the entry as printed by "c_minus explain"
+func (e Entry) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s: %s\n\n", e.Code, e.Name, e.Summary)
+	b.WriteString(e.Details)
+	b.WriteString("\n\nExample fix:\n\n")
+	for _, line := range strings.Split(e.Example, "\n") {
+		b.WriteString("    " + line + "\n")
+	}
+	return b.String()
+}
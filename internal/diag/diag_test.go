@@ -0,0 +1,41 @@
+package diag
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLookupByCodeAndName(t *testing.T) {
+	for _, key := range []string{"CM0012", "cm0012", "circular-dependency"} {
+		e, ok := Lookup(key)
+		if !ok || e.Code != CircularDependency {
+			t.Errorf("Lookup(%q) = %v, %v; want %s", key, e.Code, ok, CircularDependency)
+		}
+	}
+	if _, ok := Lookup("CM9999"); ok {
+		t.Error("expected unknown code to fail lookup")
+	}
+}
+
+func TestEntriesAreUniqueAndComplete(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, e := range All() {
+		if seen[e.Code] || seen[e.Name] {
+			t.Errorf("duplicate code or name: %s %s", e.Code, e.Name)
+		}
+		seen[e.Code], seen[e.Name] = true, true
+		if e.Summary == "" || e.Details == "" || e.Example == "" {
+			t.Errorf("%s is missing a summary, details or example", e.Code)
+		}
+	}
+}
+
+func TestEntryString(t *testing.T) {
+	e, _ := Lookup(UnusedImport)
+	out := e.String()
+	for _, want := range []string{"CM0001 unused-import:", "Example fix:", "    import \"log\""} {
+		if !strings.Contains(out, want) {
+			t.Errorf("explanation missing %q:\n%s", want, out)
+		}
+	}
+}
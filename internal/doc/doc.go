@@ -0,0 +1,145 @@
+// Package doc renders the API of a module from its declarations and doc
+// comments, in the manner of go doc
+package doc
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/elijahmorgan/c_minus/internal/parser"
+	"github.com/elijahmorgan/c_minus/internal/project"
+)
+
+// sections orders the kinds of declarations in a module's documentation
+var sections = [][]project.SymbolKind{
+	{project.SymbolDefine},
+	{project.SymbolGlobal},
+	{project.SymbolStruct, project.SymbolUnion, project.SymbolEnum, project.SymbolTypedef},
+	{project.SymbolFunc},
+}
+
+// Module writes the documentation of module importPath: its doc comment,
+// then its defines, globals, types, and functions, each followed by its doc
+// comment. Only public declarations are listed unless all is set.
+func Module(w io.Writer, p *project.LoadedProject, importPath string, all bool) error {
+	if _, ok := p.Modules[importPath]; !ok {
+		return fmt.Errorf("no module %q in project %s", importPath, p.RootModule)
+	}
+	decls := declsByName(p.Files[importPath])
+
+	fmt.Fprintf(w, "module %q\n", importPath)
+	if text := p.Symbols.Docs[importPath]; text != "" {
+		fmt.Fprintf(w, "\n%s\n", text)
+	}
+	for _, kinds := range sections {
+		for _, sym := range p.Symbols.Modules[importPath] {
+			if !containsKind(kinds, sym.Kind) || (!sym.Public && !all) {
+				continue
+			}
+			fmt.Fprintf(w, "\n%s\n", declaration(sym, decls[sym.Name], all))
+			if sym.Doc != "" {
+				fmt.Fprintf(w, "    %s\n", strings.ReplaceAll(sym.Doc, "\n", "\n    "))
+			}
+		}
+	}
+	return nil
+}
+
+// Index writes one line per module of the project: its import path and the
+// first line of its doc comment
+func Index(w io.Writer, p *project.LoadedProject) {
+	importPaths := make([]string, 0, len(p.Modules))
+	width := 0
+	for importPath := range p.Modules {
+		importPaths = append(importPaths, importPath)
+		width = max(width, len(importPath))
+	}
+	sort.Strings(importPaths)
+	for _, importPath := range importPaths {
+		synopsis, _, _ := strings.Cut(p.Symbols.Docs[importPath], "\n")
+		fmt.Fprintln(w, strings.TrimRight(fmt.Sprintf("%-*s  %s", width, importPath, synopsis), " "))
+	}
+}
+
+// declaration renders a symbol as it is declared in C-minus. The fields of
+// an opaque struct are shown only with all.
+func declaration(sym project.Symbol, d *parser.Decl, all bool) string {
+	var b strings.Builder
+	if sym.Public {
+		b.WriteString("pub ")
+	}
+	switch {
+	case d == nil:
+		b.WriteString(sym.Signature)
+	case d.Function != nil:
+		fn := d.Function
+		if fn.Inline {
+			b.WriteString("inline ")
+		}
+		params := make([]string, len(fn.Params))
+		for i, p := range fn.Params {
+			params[i] = strings.TrimSpace(p.Type + " " + p.Name)
+		}
+		fmt.Fprintf(&b, "func %s(%s) %s", fn.Name, strings.Join(params, ", "), fn.ReturnType)
+	case d.Struct != nil:
+		b.WriteString(sym.Signature)
+		if !d.Struct.Opaque || all {
+			b.WriteString(" " + d.Struct.Body)
+		}
+	case d.Union != nil:
+		b.WriteString(sym.Signature + " " + d.Union.Body)
+	case d.Enum != nil:
+		b.WriteString(sym.Signature + " " + d.Enum.Body)
+	case d.Typedef != nil:
+		b.WriteString("typedef " + d.Typedef.Body)
+	case d.Global != nil:
+		if d.Global.Static {
+			b.WriteString("static ")
+		}
+		if d.Global.Extern {
+			b.WriteString("extern ")
+		}
+		b.WriteString(sym.Signature)
+	case d.Define != nil:
+		b.WriteString(strings.TrimSpace(sym.Signature + " " + d.Define.Value))
+	}
+	return b.String()
+}
+
+// declsByName maps the names of a module's declarations to them, as the
+// symbol table names them
+func declsByName(files []*parser.File) map[string]*parser.Decl {
+	decls := make(map[string]*parser.Decl)
+	for _, file := range files {
+		for _, d := range file.Decls {
+			switch {
+			case d.Function != nil:
+				decls[d.Function.Name] = d
+			case d.Struct != nil:
+				decls[d.Struct.Name] = d
+			case d.Union != nil:
+				decls[d.Union.Name] = d
+			case d.Enum != nil && d.Enum.Name != "":
+				decls[d.Enum.Name] = d
+			case d.Global != nil:
+				decls[d.Global.Name] = d
+			case d.Define != nil:
+				decls[d.Define.Name] = d
+			case d.Typedef != nil:
+				decls[project.TypedefName(d.Typedef.Body)] = d
+			}
+		}
+	}
+	return decls
+}
+
+func containsKind(kinds []project.SymbolKind, kind project.SymbolKind) bool {
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package doc
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elijahmorgan/c_minus/internal/project"
+)
+
+func loadProject(t *testing.T, files map[string]string) *project.LoadedProject {
+	t.Helper()
+	root := t.TempDir()
+	for rel, content := range files {
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	loaded, err := project.Load(root, nil)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	return loaded
+}
+
+var geoFiles = map[string]string{
+	"cm.mod": `module "demo"`,
+	"main.cm": `module "main"
+
+func main() int {
+    return 0;
+}
+`,
+	"geo/geo.cm": `// Package geo does geometry
+module "geo"
+
+// MAX_POINTS bounds a path
+pub #define MAX_POINTS 64
+
+// Point is a position
+pub struct Point {
+    int x, y;
+};
+
+// Handle hides its fields
+pub opaque struct Handle {
+    int fd;
+};
+
+pub typedef void (*Visit)(Point p);
+
+// origins counts origin calls
+pub int origins = 0;
+
+struct Cache {
+    int hits;
+};
+
+// origin returns the point at 0, 0
+pub func origin() Point {
+    Point p = {0, 0};
+    origins++;
+    return p;
+}
+
+func helper(int n) int {
+    return n;
+}
+`,
+}
+
+func TestModule(t *testing.T) {
+	loaded := loadProject(t, geoFiles)
+
+	var out strings.Builder
+	if err := Module(&out, loaded, "geo", false); err != nil {
+		t.Fatalf("Module failed: %v", err)
+	}
+	want := `module "geo"
+
+Package geo does geometry
+
+pub #define MAX_POINTS 64
+    MAX_POINTS bounds a path
+
+pub int origins
+    origins counts origin calls
+
+pub struct Point {
+    int x, y;
+}
+    Point is a position
+
+pub opaque struct Handle
+    Handle hides its fields
+
+pub typedef void (*Visit)(Point p)
+
+pub func origin() Point
+    origin returns the point at 0, 0
+`
+	if out.String() != want {
+		t.Errorf("Module output:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	if err := Module(&out, loaded, "geo", true); err != nil {
+		t.Fatalf("Module failed: %v", err)
+	}
+	for _, want := range []string{"struct Cache {\n    int hits;\n}", "func helper(int n) int", "pub opaque struct Handle {\n    int fd;\n}"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q with all, got:\n%s", want, out.String())
+		}
+	}
+
+	if err := Module(&out, loaded, "nope", false); err == nil {
+		t.Error("expected an error for an unknown module")
+	}
+}
+
+func TestIndex(t *testing.T) {
+	loaded := loadProject(t, geoFiles)
+
+	var out strings.Builder
+	Index(&out, loaded)
+	want := "geo   Package geo does geometry\nmain\n"
+	if out.String() != want {
+		t.Errorf("Index = %q, want %q", out.String(), want)
+	}
+}
@@ -39,6 +39,9 @@ func (p *clangdProxy) start(ctx context.Context) error {
 	if p.cmd != nil {
 		return nil
 	}
+	if _, err := exec.LookPath("clangd"); err != nil {
+		return fmt.Errorf("not found on PATH: install clangd (from LLVM, e.g. the clangd or clang-tools package) so the language server can analyze the generated C")
+	}
 
 	p.cmd = exec.CommandContext(ctx, "clangd",
 		"--compile-commands-dir="+p.buildDir,
@@ -0,0 +1,218 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/elijahmorgan/c_minus/internal/build"
+	"github.com/elijahmorgan/c_minus/internal/diag"
+	"github.com/elijahmorgan/c_minus/internal/project"
+)
+
+// saveCompileDelay is how long compile on save waits for further saves
+// before compiling
+const saveCompileDelay = 300 * time.Millisecond
+
+// defaultSaveWarnings are the warning flags used when the client gives none
+var defaultSaveWarnings = []string{"-Wall", "-Wextra"}
+
+// saveCompiler compiles the generated C of saved files' modules in the
+// background and publishes the compiler's warnings, which clangd does not
+// report without the same -W flags. Saves within the delay of each other
+// share one run, and starting a run cancels the one in progress.
+type saveCompiler struct {
+	s     *server
+	flags []string
+	delay time.Duration
+
+	mu      sync.Mutex
+	pending map[string]bool // Saved .cm paths waiting for the next run
+	timer   *time.Timer
+	cancel  context.CancelFunc // Cancels the run in progress
+}
+
+func newSaveCompiler(s *server, flags []string) *saveCompiler {
+	if len(flags) == 0 {
+		flags = defaultSaveWarnings
+	}
+	return &saveCompiler{s: s, flags: flags, delay: saveCompileDelay, pending: make(map[string]bool)}
+}
+
+// saved schedules a compile of the module containing cmPath
+func (c *saveCompiler) saved(cmPath string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending[cmPath] = true
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	c.timer = time.AfterFunc(c.delay, c.start)
+}
+
+// start cancels the run in progress and compiles everything saved since
+func (c *saveCompiler) start() {
+	c.mu.Lock()
+	saved := sortedKeys(c.pending)
+	c.pending = make(map[string]bool)
+	if c.cancel != nil {
+		c.cancel()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	c.mu.Unlock()
+
+	byURI := c.compile(ctx, saved)
+
+	// Holding the lock while publishing keeps a superseded run, cancelled
+	// under the same lock, from overwriting the newer results
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ctx.Err() != nil {
+		return
+	}
+	for _, uri := range sortedDiagKeys(byURI) {
+		_ = c.s.publishSourceDiagnostics(uri, "compile", byURI[uri])
+	}
+}
+
+// compile runs the compiler over every generated .c file of the saved files'
+// modules and returns the warnings for each of the modules' .cm files, with
+// an empty list for files that have none
+func (c *saveCompiler) compile(ctx context.Context, saved []string) map[string][]any {
+	byURI := make(map[string][]any)
+	compiled := make(map[string]bool)
+	for _, cmPath := range saved {
+		proj, err := project.Discover(filepath.Dir(cmPath))
+		if err != nil {
+			continue
+		}
+		importPath, err := projectModuleImportPath(proj, cmPath)
+		if err != nil {
+			continue
+		}
+		mod, ok := proj.Modules[importPath]
+		if !ok || compiled[importPath] {
+			continue
+		}
+		compiled[importPath] = true
+
+		cfg, err := build.LoadConfig(proj.RootPath)
+		if err != nil {
+			cfg = &build.Config{}
+		}
+		var warnings []diag.CompilerDiag
+		for _, file := range mod.Files {
+			if uri, err := fileURIFromPath(file); err == nil {
+				byURI[uri] = []any{}
+			}
+			cPath := generatedCPath(proj, importPath, filepath.Base(file))
+			args := saveCompileArgs(cPath, filepath.Join(proj.RootPath, ".c_minus"), cfg.Options, c.flags)
+			command := cfg.Options.CompilerCommand(args...)
+			out, _ := exec.CommandContext(ctx, command[0], command[1:]...).CombinedOutput()
+			if ctx.Err() != nil {
+				return nil
+			}
+			for _, d := range diag.ParseCompilerOutput(string(out)) {
+				if d.Severity == "warning" && filepath.Ext(d.File) == ".cm" {
+					warnings = append(warnings, d)
+				}
+			}
+		}
+
+		for _, d := range diag.GroupCompilerDiags(warnings) {
+			uri, err := fileURIFromPath(d.File)
+			if err != nil {
+				continue
+			}
+			byURI[uri] = append(byURI[uri], compilerDiagnostic(d))
+		}
+	}
+	return byURI
+}
+
+// saveCompileArgs checks one generated .c file as the build compiles it,
+// with the compile-on-save warning flags and without writing an object
+func saveCompileArgs(cPath, buildDir string, opts build.Options, flags []string) []string {
+	std := opts.CStandard
+	if std == "" {
+		std = build.DefaultCStandard
+	}
+	args := []string{"-fsyntax-only", cPath, "-I", buildDir, "-std=" + std}
+	for _, def := range opts.Defines {
+		args = append(args, "-D"+def)
+	}
+	return append(args, flags...)
+}
+
+// compilerDiagnostic converts a compiler diagnostic to an LSP diagnostic
+func compilerDiagnostic(d diag.CompilerDiag) map[string]any {
+	message := d.Message
+	if d.More > 0 {
+		message += fmt.Sprintf(" (+%d more on this line)", d.More)
+	}
+	char := max(d.Col-1, 0)
+	return map[string]any{
+		"range": map[string]any{
+			"start": map[string]any{"line": d.Line - 1, "character": char},
+			"end":   map[string]any{"line": d.Line - 1, "character": char + 1},
+		},
+		"severity": 2,
+		"source":   "cc",
+		"message":  message,
+	}
+}
+
+// diagnosticSets holds the latest diagnostics of each source (clangd,
+// compile on save) per .cm URI. Publishing replaces everything shown for a
+// file, so each source's update is published together with the others'.
+type diagnosticSets struct {
+	mu    sync.Mutex
+	byURI map[string]map[string][]any
+}
+
+// set replaces the diagnostics of one source and returns all of the file's
+func (d *diagnosticSets) set(uri, source string, diags []any) []any {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.byURI == nil {
+		d.byURI = make(map[string]map[string][]any)
+	}
+	if d.byURI[uri] == nil {
+		d.byURI[uri] = make(map[string][]any)
+	}
+	d.byURI[uri][source] = diags
+
+	all := []any{}
+	for _, src := range sortedDiagKeys(d.byURI[uri]) {
+		all = append(all, d.byURI[uri][src]...)
+	}
+	return all
+}
+
+// reset forgets every source's diagnostics for a file
+func (d *diagnosticSets) reset(uri string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.byURI, uri)
+}
+
+// publishSourceDiagnostics publishes one source's diagnostics for a .cm URI
+// together with the latest ones of the other sources
+func (s *server) publishSourceDiagnostics(uri, source string, diags []any) error {
+	all := s.diags.set(uri, source, diags)
+	return s.conn.writeMessage(jsonrpcMessage{JSONRPC: "2.0", Method: "textDocument/publishDiagnostics", Params: mustJSON(map[string]any{"uri": uri, "diagnostics": all})})
+}
+
+func sortedDiagKeys(m map[string][]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,124 @@
+package lsp
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elijahmorgan/c_minus/internal/build"
+	"github.com/elijahmorgan/c_minus/internal/project"
+)
+
+func TestSaveCompileReportsWarnings(t *testing.T) {
+	if _, err := exec.LookPath("gcc"); err != nil {
+		t.Skip("gcc not installed")
+	}
+	// The compiler is resolved as for a build, launcher included
+	t.Setenv("CC", "env gcc")
+
+	root := t.TempDir()
+	files := map[string]string{
+		"cm.mod": `module "warn"`,
+		"main.cm": `module "main"
+
+import "util"
+
+func main() int {
+    return util.half(4) - 2;
+}
+`,
+		"util/util.cm": `module "util"
+
+pub func half(int n) int {
+    int unused = 0;
+    return n / 2;
+}
+`,
+		"util/extra.cm": `module "util"
+
+pub func twice(int n) int {
+    return n * 2;
+}
+`,
+	}
+	for rel, content := range files {
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	proj, err := project.Discover(root)
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	if _, _, err := transpileWorkspace(proj, nil, nil); err != nil {
+		t.Fatalf("transpile: %v", err)
+	}
+
+	c := newSaveCompiler(nil, nil)
+	byURI := c.compile(context.Background(), []string{filepath.Join(root, "util", "util.cm")})
+
+	utilURI, _ := fileURIFromPath(filepath.Join(root, "util", "util.cm"))
+	extraURI, _ := fileURIFromPath(filepath.Join(root, "util", "extra.cm"))
+	mainURI, _ := fileURIFromPath(filepath.Join(root, "main.cm"))
+	if len(byURI) != 2 {
+		t.Fatalf("expected results for both util files, got %v", byURI)
+	}
+	if diags := byURI[extraURI]; diags == nil || len(diags) != 0 {
+		t.Errorf("expected an empty list clearing extra.cm, got %v", diags)
+	}
+	if _, ok := byURI[mainURI]; ok {
+		t.Errorf("main.cm is in another module and was not saved")
+	}
+
+	diags := byURI[utilURI]
+	if len(diags) != 1 {
+		t.Fatalf("expected one warning in util.cm, got %v", diags)
+	}
+	d := diags[0].(map[string]any)
+	start := d["range"].(map[string]any)["start"].(map[string]any)
+	if !strings.Contains(d["message"].(string), "unused variable") || start["line"] != 3 || d["severity"] != 2 {
+		t.Errorf("unexpected diagnostic %v", d)
+	}
+}
+
+func TestSaveCompileArgs(t *testing.T) {
+	opts := build.Options{CStandard: "c17", Defines: []string{"DEBUG"}}
+	got := strings.Join(saveCompileArgs("/b/main_main.c", "/b", opts, []string{"-Wshadow"}), " ")
+	want := "-fsyntax-only /b/main_main.c -I /b -std=c17 -DDEBUG -Wshadow"
+	if got != want {
+		t.Errorf("saveCompileArgs = %q, want %q", got, want)
+	}
+
+	got = strings.Join(saveCompileArgs("/b/main_main.c", "/b", build.Options{}, defaultSaveWarnings), " ")
+	want = "-fsyntax-only /b/main_main.c -I /b -std=" + build.DefaultCStandard + " -Wall -Wextra"
+	if got != want {
+		t.Errorf("saveCompileArgs = %q, want %q", got, want)
+	}
+}
+
+func TestDiagnosticSetsMergeSources(t *testing.T) {
+	var d diagnosticSets
+	uri := "file:///p/main.cm"
+
+	if all := d.set(uri, "clangd", []any{"c1"}); len(all) != 1 {
+		t.Errorf("expected clangd's diagnostic, got %v", all)
+	}
+	if all := d.set(uri, "compile", []any{"w1", "w2"}); len(all) != 3 || all[0] != "c1" {
+		t.Errorf("expected both sources, clangd first, got %v", all)
+	}
+	if all := d.set(uri, "clangd", nil); len(all) != 2 || all[0] != "w1" {
+		t.Errorf("expected clangd's diagnostics replaced, got %v", all)
+	}
+
+	d.reset(uri)
+	if all := d.set(uri, "clangd", nil); len(all) != 0 {
+		t.Errorf("expected reset to drop the compile warnings, got %v", all)
+	}
+}
@@ -1,12 +1,16 @@
 package lsp
 
 import (
+	"strings"
+
 	"github.com/elijahmorgan/c_minus/internal/project"
 )
 
 type cmCompletionContext struct {
 	InImportString bool
 	MemberModule   string // if completing after `mod.`
+	TypeName       bool   // if a type is expected: after `sizeof(` or a cast's `(`
+	PointerMember  string // if completing after `var->`
 }
 
 func completionContext(cmText string, line0, char0 int) cmCompletionContext {
@@ -32,15 +36,76 @@ func completionContext(cmText string, line0, char0 int) cmCompletionContext {
 		}
 	}
 
+	// field completion: <ident>->
+	if strings.HasSuffix(trimPartialIdentifier(prefix), "->") {
+		before := strings.TrimSuffix(trimPartialIdentifier(prefix), "->")
+		name, start := lastIdentifier(before)
+		if name != "" && start+len(name) == len(before) {
+			return cmCompletionContext{PointerMember: name}
+		}
+	}
+
 	// member completion: <ident>.
 	if len(prefix) > 0 && prefix[len(prefix)-1] == '.' {
-		name, _ := lastIdentifier(prefix[:len(prefix)-1])
-		if name != "" {
-			return cmCompletionContext{MemberModule: name}
+		name, start := lastIdentifier(prefix[:len(prefix)-1])
+		if name != "" && start+len(name) == len(prefix)-1 {
+			return cmCompletionContext{MemberModule: name, TypeName: typePosition(prefix[:start])}
 		}
 	}
 
-	return cmCompletionContext{}
+	return cmCompletionContext{TypeName: typePosition(trimPartialIdentifier(prefix))}
+}
+
+// typePosition reports whether prefix ends where a type name is expected:
+// right after "sizeof(" (or alignof) or after a "(" that does not call anything
+func typePosition(prefix string) bool {
+	prefix = strings.TrimRight(prefix, " \t")
+	if !strings.HasSuffix(prefix, "(") {
+		return false
+	}
+	before := strings.TrimRight(prefix[:len(prefix)-1], " \t")
+	if before == "" {
+		return true
+	}
+	if name, start := lastIdentifier(before); name != "" && start+len(name) == len(before) {
+		return name == "sizeof" || name == "_Alignof" || name == "alignof"
+	}
+	// A call or index result can be called again: f(x)(, a[0](
+	last := before[len(before)-1]
+	return last != ')' && last != ']'
+}
+
+// trimPartialIdentifier drops the identifier being typed at the end of prefix
+func trimPartialIdentifier(prefix string) string {
+	end := len(prefix)
+	for end > 0 && isIdentChar(prefix[end-1]) {
+		end--
+	}
+	return prefix[:end]
+}
+
+// isTypeSymbol reports whether a symbol names a type
+func isTypeSymbol(s cmSymbol) bool {
+	switch s.Kind {
+	case symbolKindStruct, symbolKindUnion, symbolKindEnum, symbolKindTypedef:
+		return true
+	}
+	return false
+}
+
+// completionItemKind maps a symbol kind to an LSP CompletionItemKind
+func completionItemKind(kind symbolKind) int {
+	switch kind {
+	case symbolKindFunc:
+		return 3 // Function
+	case symbolKindStruct, symbolKindUnion, symbolKindTypedef:
+		return 22 // Struct
+	case symbolKindEnum:
+		return 13 // Enum
+	case symbolKindDefine:
+		return 21 // Constant
+	}
+	return 6 // Variable
 }
 
 func cmCompletions(proj *project.Project, idx *moduleIndex, cmPath, cmText string, line0, char0 int) []any {
@@ -66,34 +131,43 @@ func cmCompletions(proj *project.Project, idx *moduleIndex, cmPath, cmText strin
 		imports := importedModulePrefixes(cmPath, cmText)
 		targetImportPath, ok := imports[modPrefix]
 		if !ok {
-			// Not imported in this file; don't suggest module members.
-			return nil
+			// Not an import prefix: complete the fields of a struct variable
+			return fieldCompletions(proj, idx, cmPath, cmText, line0, char0, modPrefix)
 		}
 
 		syms := idx.Modules[targetImportPath]
 		items := make([]any, 0, len(syms))
 		for _, s := range syms {
-			if !s.Public {
+			if !s.Public || (ctx.TypeName && !isTypeSymbol(s)) {
 				continue
 			}
-			kind := 6 // Variable
-			switch s.Kind {
-			case symbolKindFunc:
-				kind = 3
-			case symbolKindStruct, symbolKindUnion:
-				kind = 22
-			case symbolKindEnum:
-				kind = 13
-			case symbolKindTypedef:
-				kind = 22
-			case symbolKindDefine:
-				kind = 21
-			case symbolKindGlobal:
-				kind = 6
+			items = append(items, map[string]any{
+				"label":      s.Name,
+				"kind":       completionItemKind(s.Kind),
+				"insertText": s.Name,
+			})
+		}
+		return items
+	}
+
+	if ctx.PointerMember != "" {
+		return fieldCompletions(proj, idx, cmPath, cmText, line0, char0, ctx.PointerMember)
+	}
+
+	if ctx.TypeName {
+		// The module's own types, public or not; imported ones come after `mod.`
+		importPath, err := projectModuleImportPath(proj, cmPath)
+		if err != nil {
+			return nil
+		}
+		var items []any
+		for _, s := range idx.Modules[importPath] {
+			if !isTypeSymbol(s) {
+				continue
 			}
 			items = append(items, map[string]any{
 				"label":      s.Name,
-				"kind":       kind,
+				"kind":       completionItemKind(s.Kind),
 				"insertText": s.Name,
 			})
 		}
@@ -0,0 +1,138 @@
+package lsp
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/elijahmorgan/c_minus/internal/project"
+)
+
+func TestCompletionContextTypePositions(t *testing.T) {
+	tests := []struct {
+		line   string
+		want   bool
+		member string
+	}{
+		{"    n = sizeof(", true, ""},
+		{"    n = sizeof (Ve", true, ""},
+		{"    p = (", true, ""},
+		{"    p = (geo.", true, "geo"},
+		{"    n = sizeof(geo.", true, "geo"},
+		{"    x = geo.", false, "geo"},
+		{"    run(", false, ""},
+		{"    if (", false, ""},
+		{"    f(x)(", false, ""},
+	}
+
+	for _, tt := range tests {
+		ctx := completionContext(tt.line, 0, len(tt.line))
+		if ctx.TypeName != tt.want || ctx.MemberModule != tt.member {
+			t.Errorf("%q: got TypeName=%v MemberModule=%q, want %v %q", tt.line, ctx.TypeName, ctx.MemberModule, tt.want, tt.member)
+		}
+	}
+}
+
+func TestCMCompletionsOfferTypeNames(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"cm.mod":     `module "types"`,
+		"geo/geo.cm": "module \"geo\"\n\npub struct Point { int x; int y; };\n\nstruct Cache { int n; };\n\npub func origin() int {\n    return 0;\n}\n",
+		"main.cm":    "module \"main\"\n\nimport \"geo\"\n\nstruct Local { int a; };\n\nfunc main() int {\n    return sizeof(\n",
+	}
+	for rel, content := range files {
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	proj, err := project.Discover(root)
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	idx, err := buildModuleIndex(proj, nil)
+	if err != nil {
+		t.Fatalf("index: %v", err)
+	}
+
+	labels := func(items []any) []string {
+		var out []string
+		for _, item := range items {
+			out = append(out, item.(map[string]any)["label"].(string))
+		}
+		sort.Strings(out)
+		return out
+	}
+
+	mainPath := filepath.Join(root, "main.cm")
+	text := files["main.cm"]
+	got := labels(cmCompletions(proj, idx, mainPath, text, 7, len("    return sizeof(")))
+	if len(got) != 1 || got[0] != "Local" {
+		t.Errorf("local type completions = %v, want [Local]", got)
+	}
+
+	text = "module \"main\"\n\nimport \"geo\"\n\nfunc main() int {\n    return sizeof(geo.\n"
+	got = labels(cmCompletions(proj, idx, mainPath, text, 5, len("    return sizeof(geo.")))
+	if len(got) != 1 || got[0] != "Point" {
+		t.Errorf("imported type completions = %v, want [Point]", got)
+	}
+}
+
+func TestCMCompletionsOfferStructFields(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"cm.mod":     `module "fields"`,
+		"geo/geo.cm": "module \"geo\"\n\npub struct Point { int x; int y; };\n\npub opaque struct Handle { int fd; };\n",
+		"main.cm":    "module \"main\"\n\nimport \"geo\"\n\nstruct Tree { int size; Tree* left; };\n",
+	}
+	for rel, content := range files {
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	proj, err := project.Discover(root)
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	idx, err := buildModuleIndex(proj, nil)
+	if err != nil {
+		t.Fatalf("index: %v", err)
+	}
+
+	mainPath := filepath.Join(root, "main.cm")
+	tests := []struct {
+		body string
+		want string
+	}{
+		{"func count(Tree* t) int {\n    return t->", "left,size"},
+		{"func count(Tree* t) int {\n    return t->si", "left,size"},
+		{"func f() int {\n    geo.Point p = {1, 2};\n    return p.", "x,y"},
+		{"func f(geo.Point *p) int {\n    int n = 2 * p;\n    return p->", "x,y"},
+		{"func f(geo.Handle* h) int {\n    return h->", ""},
+		{"func f(int n) int {\n    return n->", ""},
+	}
+	for _, tt := range tests {
+		text := files["main.cm"] + tt.body
+		lines := strings.Split(text, "\n")
+		line0 := len(lines) - 1
+		var got []string
+		for _, item := range cmCompletions(proj, idx, mainPath, text, line0, len(lines[line0])) {
+			got = append(got, item.(map[string]any)["label"].(string))
+		}
+		sort.Strings(got)
+		if strings.Join(got, ",") != tt.want {
+			t.Errorf("%q: fields = %v, want %s", lines[line0], got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package lsp
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/elijahmorgan/c_minus/internal/project"
+)
+
+// notTypes are words that can precede a variable name without declaring it
+var notTypes = map[string]bool{
+	"return": true, "sizeof": true, "case": true, "goto": true, "else": true,
+	"if": true, "while": true, "for": true, "switch": true, "do": true,
+}
+
+// variableType finds the declared type of variable name, as written in the
+// source ("Point", "geo.Point"), by scanning back from the cursor for the
+// nearest parameter or local declaration of it. This is a textual
+// heuristic, not scope analysis.
+func variableType(lines []string, line0, char0 int, name string) string {
+	decl := regexp.MustCompile(`(?:^|[;{(,])\s*(?:(?:const|static|volatile|register|struct|union)\s+)*((?:[A-Za-z_]\w*\.)?[A-Za-z_]\w*)(?:\s*\*+\s*|\s+)` + regexp.QuoteMeta(name) + `\s*(?:[;=,)\[]|$)`)
+	for i := line0; i >= 0 && i < len(lines); i-- {
+		text := lines[i]
+		if i == line0 && char0 <= len(text) {
+			text = text[:char0]
+		}
+		matches := decl.FindAllStringSubmatch(text, -1)
+		for j := len(matches) - 1; j >= 0; j-- {
+			if typ := matches[j][1]; !notTypes[typ] {
+				return typ
+			}
+		}
+	}
+	return ""
+}
+
+// fieldCompletions offers the members of the struct or union that variable
+// name has, as found by variableType. Fields of an opaque struct are only
+// offered inside its own module.
+func fieldCompletions(proj *project.Project, idx *moduleIndex, cmPath, cmText string, line0, char0 int, name string) []any {
+	typ := variableType(splitLinesPreserve(cmText), line0, char0, name)
+	if typ == "" {
+		return nil
+	}
+
+	modPath, err := projectModuleImportPath(proj, cmPath)
+	if err != nil {
+		return nil
+	}
+	foreign := false
+	if prefix, typeName, ok := strings.Cut(typ, "."); ok {
+		importPath, ok := importedModulePrefixes(cmPath, cmText)[prefix]
+		if !ok {
+			return nil
+		}
+		modPath, typ, foreign = importPath, typeName, true
+	}
+
+	for _, s := range idx.Modules[modPath] {
+		if s.Name != typ || (s.Kind != symbolKindStruct && s.Kind != symbolKindUnion) {
+			continue
+		}
+		if foreign && (!s.Public || s.Opaque) {
+			return nil
+		}
+		items := make([]any, 0, len(s.Fields))
+		for _, field := range s.Fields {
+			items = append(items, map[string]any{
+				"label":      field,
+				"kind":       5, // Field
+				"insertText": field,
+				"detail":     s.Signature,
+			})
+		}
+		return items
+	}
+	return nil
+}
@@ -43,16 +43,22 @@ func (s *server) forwardHover(ctx context.Context, msg jsonrpcMessage) error {
 	cmText, hasText := s.openDocs[cmPath]
 	s.mu.Unlock()
 	if hasText {
+		if cimportHover, ok := tryCMCImportHover(cmPath, cmText, params.Position.Line, params.Position.Character); ok {
+			return s.conn.writeMessage(jsonrpcMessage{JSONRPC: "2.0", ID: msg.ID, Result: cimportHover})
+		}
 		if cmHover, ok := s.tryCMHover(proj, cmPath, cmText, params.Position.Line, params.Position.Character); ok {
 			return s.conn.writeMessage(jsonrpcMessage{JSONRPC: "2.0", ID: msg.ID, Result: cmHover})
 		}
 	}
+	if s.clangd == nil {
+		return s.conn.writeMessage(jsonrpcMessage{JSONRPC: "2.0", ID: msg.ID, Result: json.RawMessage("null")})
+	}
 
 	modPath, err := projectModuleImportPath(proj, cmPath)
 	if err != nil {
 		return s.writeError(msg.ID, -32002, err.Error())
 	}
-	cPath := generatedCPath(proj.RootPath, modPath, filepath.Base(cmPath))
+	cPath := generatedCPath(proj, modPath, filepath.Base(cmPath))
 	cURI, err := fileURIFromPath(cPath)
 	if err != nil {
 		return s.writeError(msg.ID, -32002, err.Error())
@@ -141,12 +147,15 @@ func (s *server) forwardDefinition(ctx context.Context, msg jsonrpcMessage) erro
 			return s.conn.writeMessage(jsonrpcMessage{JSONRPC: "2.0", ID: msg.ID, Result: cmDef})
 		}
 	}
+	if s.clangd == nil {
+		return s.conn.writeMessage(jsonrpcMessage{JSONRPC: "2.0", ID: msg.ID, Result: json.RawMessage("null")})
+	}
 
 	modPath, err := projectModuleImportPath(proj, cmPath)
 	if err != nil {
 		return s.writeError(msg.ID, -32002, err.Error())
 	}
-	cPath := generatedCPath(proj.RootPath, modPath, filepath.Base(cmPath))
+	cPath := generatedCPath(proj, modPath, filepath.Base(cmPath))
 	cURI, err := fileURIFromPath(cPath)
 	if err != nil {
 		return s.writeError(msg.ID, -32002, err.Error())
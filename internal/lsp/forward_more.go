@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"os"
 	"path/filepath"
 
 	"github.com/elijahmorgan/c_minus/internal/project"
@@ -40,11 +41,30 @@ func (s *server) forwardReferences(ctx context.Context, msg jsonrpcMessage) erro
 		return s.writeError(msg.ID, -32002, err.Error())
 	}
 
+	// Module symbols are found natively in every .cm file of the project,
+	// then merged with what clangd sees in the generated C
+	s.mu.Lock()
+	cmText, hasText := s.openDocs[cmPath]
+	s.mu.Unlock()
+	if !hasText {
+		if b, err := os.ReadFile(cmPath); err == nil {
+			cmText = string(b)
+		}
+	}
+	native, isSymbol := s.cmReferences(proj, cmPath, cmText, params.Position.Line, params.Position.Character, params.Context.IncludeDeclaration)
+
+	if s.clangd == nil {
+		if !isSymbol {
+			return s.conn.writeMessage(jsonrpcMessage{JSONRPC: "2.0", ID: msg.ID, Result: json.RawMessage("null")})
+		}
+		return s.conn.writeMessage(jsonrpcMessage{JSONRPC: "2.0", ID: msg.ID, Result: mergeLocations(native, nil)})
+	}
+
 	modPath, err := projectModuleImportPath(proj, cmPath)
 	if err != nil {
 		return s.writeError(msg.ID, -32002, err.Error())
 	}
-	cPath := generatedCPath(proj.RootPath, modPath, filepath.Base(cmPath))
+	cPath := generatedCPath(proj, modPath, filepath.Base(cmPath))
 	cURI, err := fileURIFromPath(cPath)
 	if err != nil {
 		return s.writeError(msg.ID, -32002, err.Error())
@@ -78,6 +98,9 @@ func (s *server) forwardReferences(ctx context.Context, msg jsonrpcMessage) erro
 	if err != nil {
 		mapped = raw
 	}
+	if isSymbol {
+		mapped = mergeLocations(native, mapped)
+	}
 	return s.conn.writeMessage(jsonrpcMessage{JSONRPC: "2.0", ID: msg.ID, Result: mapped})
 }
 
@@ -113,7 +136,7 @@ func (s *server) forwardCompletion(ctx context.Context, msg jsonrpcMessage) erro
 	if err != nil {
 		return s.writeError(msg.ID, -32002, err.Error())
 	}
-	cPath := generatedCPath(proj.RootPath, modPath, filepath.Base(cmPath))
+	cPath := generatedCPath(proj, modPath, filepath.Base(cmPath))
 	cURI, err := fileURIFromPath(cPath)
 	if err != nil {
 		return s.writeError(msg.ID, -32002, err.Error())
@@ -138,9 +161,12 @@ func (s *server) forwardCompletion(ctx context.Context, msg jsonrpcMessage) erro
 	}
 
 	// We decode into an interface{} so we can rewrite the edit ranges to .cm coordinates.
+	// Without clangd only the C-minus completions are offered.
 	var result any
-	if err := s.clangd.request(ctx, "textDocument/completion", forwardParams, &result); err != nil {
-		return s.writeError(msg.ID, -32002, err.Error())
+	if s.clangd != nil {
+		if err := s.clangd.request(ctx, "textDocument/completion", forwardParams, &result); err != nil {
+			return s.writeError(msg.ID, -32002, err.Error())
+		}
 	}
 
 	// Merge in C-minus specific completions.
@@ -0,0 +1,157 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/elijahmorgan/c_minus/internal/parser"
+	"github.com/elijahmorgan/c_minus/internal/transform"
+)
+
+// cimportSearchDirs are the system include directories searched when resolving
+// a cimport header for hover. Directories from #cgo -I flags are searched first.
+var cimportSearchDirs = []string{
+	"/usr/local/include",
+	"/usr/include",
+}
+
+// cimportHeaderPreviewLines is the number of header lines shown in the hover.
+const cimportHeaderPreviewLines = 8
+
+// cimportPathAt returns the header path when char0 falls inside the string
+// literal of a `cimport "..."` directive, along with the literal's bounds.
+func cimportPathAt(line string, char0 int) (path string, start int, end int, ok bool) {
+	trimmed := trimSpaces(line)
+	if !hasPrefix(trimmed, "cimport") {
+		return "", 0, 0, false
+	}
+	open := indexOfSubstring(line, "\"")
+	if open < 0 {
+		return "", 0, 0, false
+	}
+	closeIdx := indexOfSubstring(line[open+1:], "\"")
+	if closeIdx < 0 {
+		return "", 0, 0, false
+	}
+	closeIdx += open + 1
+	if char0 < open || char0 > closeIdx {
+		return "", 0, 0, false
+	}
+	return line[open+1 : closeIdx], open + 1, closeIdx, true
+}
+
+func tryCMCImportHover(cmPath, cmText string, line0, char0 int) (json.RawMessage, bool) {
+	lines := splitLinesPreserve(cmText)
+	if line0 < 0 || line0 >= len(lines) {
+		return nil, false
+	}
+	header, start, end, ok := cimportPathAt(lines[line0], char0)
+	if !ok || header == "" {
+		return nil, false
+	}
+
+	var includeDirs []string
+	cimports := []*parser.CImport{{Path: header}}
+	if pf, err := parser.ParseSource(cmText, cmPath); err == nil {
+		includeDirs = cgoIncludeDirs(pf.CGoFlags, filepath.Dir(cmPath))
+		cimports = pf.CImports
+	}
+
+	value := "```c\n#include <" + header + ">\n```"
+
+	// Reuse the transform's prefix logic so the hover matches what bodies accept.
+	if cimportMap, err := transform.BuildCImportMap(cimports); err == nil {
+		for prefix, path := range cimportMap {
+			if path == header {
+				value += "\n\nAccess symbols as `" + prefix + ".<name>`."
+				break
+			}
+		}
+	}
+
+	if resolved := resolveCImportHeader(header, includeDirs); resolved != "" {
+		value += "\n\nResolved to `" + resolved + "`"
+		if preview := headerPreview(resolved, cimportHeaderPreviewLines); preview != "" {
+			value += "\n\n```c\n" + preview + "\n```"
+		}
+	}
+
+	hover := map[string]any{
+		"contents": map[string]any{
+			"kind":  "markdown",
+			"value": value,
+		},
+		"range": map[string]any{
+			"start": map[string]any{"line": line0, "character": start},
+			"end":   map[string]any{"line": line0, "character": end},
+		},
+	}
+
+	b, _ := json.Marshal(hover)
+	return b, true
+}
+
+// cgoIncludeDirs extracts -I directories from #cgo CFLAGS directives.
+// Relative directories are resolved against baseDir.
+func cgoIncludeDirs(flags []*parser.CGoFlag, baseDir string) []string {
+	var dirs []string
+	for _, f := range flags {
+		if f.Type != "CFLAGS" {
+			continue
+		}
+		fields := strings.Fields(f.Flags)
+		for i := 0; i < len(fields); i++ {
+			dir := ""
+			if fields[i] == "-I" && i+1 < len(fields) {
+				dir = fields[i+1]
+				i++
+			} else if strings.HasPrefix(fields[i], "-I") {
+				dir = strings.TrimPrefix(fields[i], "-I")
+			}
+			if dir == "" {
+				continue
+			}
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(baseDir, dir)
+			}
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// resolveCImportHeader returns the first existing path for header on the
+// include path, or "" if it cannot be found.
+func resolveCImportHeader(header string, extraDirs []string) string {
+	dirs := append(append([]string{}, extraDirs...), cimportSearchDirs...)
+	for _, dir := range dirs {
+		candidate := filepath.Join(dir, filepath.FromSlash(header))
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// headerPreview returns up to n leading non-blank lines of a header file.
+func headerPreview(path string, n int) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	var out []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() && len(out) < n {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" {
+			continue
+		}
+		out = append(out, line)
+	}
+	return strings.Join(out, "\n")
+}
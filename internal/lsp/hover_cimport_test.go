@@ -0,0 +1,68 @@
+package lsp
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCImportPathAt(t *testing.T) {
+	line := `cimport "stdio.h"`
+
+	path, start, end, ok := cimportPathAt(line, 11)
+	if !ok || path != "stdio.h" {
+		t.Fatalf("expected stdio.h, got %q (ok=%v)", path, ok)
+	}
+	if start != 9 || end != 16 {
+		t.Fatalf("expected range 9-16, got %d-%d", start, end)
+	}
+
+	if _, _, _, ok := cimportPathAt(line, 2); ok {
+		t.Fatalf("expected no match on the cimport keyword")
+	}
+	if _, _, _, ok := cimportPathAt(`import "stdio.h"`, 10); ok {
+		t.Fatalf("expected no match on a c_minus import")
+	}
+}
+
+func TestCMCImportHoverResolvesCGoIncludeDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	incDir := filepath.Join(tmpDir, "include")
+	if err := os.MkdirAll(incDir, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	header := "// mylib.h - tiny test library\nint mylib_add(int a, int b);\n"
+	if err := os.WriteFile(filepath.Join(incDir, "mylib.h"), []byte(header), 0644); err != nil {
+		t.Fatalf("write header: %v", err)
+	}
+
+	cmText := strings.Join([]string{
+		`module "main"`,
+		"",
+		"#cgo CFLAGS: -Iinclude",
+		`cimport "mylib.h"`,
+		"",
+	}, "\n")
+	cmPath := filepath.Join(tmpDir, "main.cm")
+
+	raw, ok := tryCMCImportHover(cmPath, cmText, 3, 11)
+	if !ok {
+		t.Fatalf("expected a cimport hover")
+	}
+
+	var h struct {
+		Contents struct {
+			Value string `json:"value"`
+		} `json:"contents"`
+	}
+	if err := json.Unmarshal(raw, &h); err != nil {
+		t.Fatalf("unmarshal hover: %v", err)
+	}
+	for _, want := range []string{"#include <mylib.h>", "`mylib.<name>`", "tiny test library"} {
+		if !strings.Contains(h.Contents.Value, want) {
+			t.Errorf("hover missing %q:\n%s", want, h.Contents.Value)
+		}
+	}
+}
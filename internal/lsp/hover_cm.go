@@ -34,7 +34,11 @@ func (s *server) tryCMHover(proj *project.Project, cmPath, cmText string, line0,
 	if qualifier == "" {
 		// If identifierAt didn't detect a qualifier (it only looks for "." immediately
 		// before the identifier), check for qualified access where the dot is AFTER the identifier.
-		if char0+len(ident) < len(line) && line[char0+len(ident)] == '.' {
+		end := char0
+		for end < len(line) && isIdentChar(line[end]) {
+			end++
+		}
+		if end < len(line) && line[end] == '.' {
 			qualifier = ident
 			ident = ""
 		}
@@ -49,6 +53,9 @@ func (s *server) tryCMHover(proj *project.Project, cmPath, cmText string, line0,
 			name, _ := lastIdentifier(line[:char0+1])
 			qualifier = name
 			ident = ""
+		} else if hover, ok := s.trySameModuleHover(proj, cmPath, cmText, line0, char0, ident); ok {
+			// A bare identifier declared by the module itself
+			return hover, true
 		} else {
 			// Also support hovering on the member name in "mod.member".
 			for i := char0; i >= 0 && i < len(line); i-- {
@@ -114,6 +121,9 @@ func (s *server) tryCMHover(proj *project.Project, cmPath, cmText string, line0,
 		}
 		end = start + len(qualifier)
 		value = "```c\nmodule \"" + importPath + "\"\n```"
+		if doc := idx.Docs[importPath]; doc != "" {
+			value += "\n\n" + doc
+		}
 	} else {
 		start = indexOfIdentifier(line, ident)
 		if start < 0 {
@@ -121,12 +131,76 @@ func (s *server) tryCMHover(proj *project.Project, cmPath, cmText string, line0,
 		}
 		end = start + len(ident)
 
-		value = "```c\n" + sym.Signature + "\n```"
+		sig := sym.Signature
+		if sym.Kind == symbolKindDefine && sym.Value != "" {
+			// Show the macro as generated, with its value
+			n := projectNaming(proj)
+			sig = "#define " + n.Mangle(n.SanitizeModuleName(importPath), sym.Name) + " " + sym.Value
+		}
+		value = "```c\n" + sig + "\n```"
 		if sym.Doc != "" {
 			value += "\n\n" + sym.Doc
 		}
 	}
 
+	_ = filepath.Clean(cmPath)
+	return hoverResult(value, line0, start, end), true
+}
+
+// trySameModuleHover hovers a bare identifier naming a function, type,
+// global, or define of the module cmPath belongs to. It shows the
+// source-level declaration rather than the mangled C that clangd would.
+func (s *server) trySameModuleHover(proj *project.Project, cmPath, cmText string, line0, char0 int, ident string) (json.RawMessage, bool) {
+	if ident == "" || isInStringOrComment(cmText, line0, char0) {
+		return nil, false
+	}
+	importPath, err := projectModuleImportPath(proj, cmPath)
+	if err != nil {
+		return nil, false
+	}
+
+	s.mu.Lock()
+	openDocsCopy := make(map[string]string, len(s.openDocs))
+	for k, v := range s.openDocs {
+		openDocsCopy[k] = v
+	}
+	s.mu.Unlock()
+
+	idx, err := buildModuleIndex(proj, openDocsCopy)
+	if err != nil {
+		return nil, false
+	}
+
+	var sym *cmSymbol
+	for i := range idx.Modules[importPath] {
+		if idx.Modules[importPath][i].Name == ident {
+			sym = &idx.Modules[importPath][i]
+			break
+		}
+	}
+	if sym == nil {
+		return nil, false
+	}
+
+	sig := sym.Signature
+	if sym.Kind == symbolKindDefine && sym.Value != "" {
+		sig += " " + sym.Value
+	}
+	value := "```c\n" + sig + "\n```"
+	if sym.Doc != "" {
+		value += "\n\n" + sym.Doc
+	}
+
+	line := splitLinesPreserve(cmText)[line0]
+	start := char0
+	for start > 0 && isIdentChar(line[start-1]) {
+		start--
+	}
+	return hoverResult(value, line0, start, start+len(ident)), true
+}
+
+// hoverResult builds a markdown hover over [start, end) of line0
+func hoverResult(value string, line0, start, end int) json.RawMessage {
 	hover := map[string]any{
 		"contents": map[string]any{
 			"kind":  "markdown",
@@ -139,6 +213,5 @@ func (s *server) tryCMHover(proj *project.Project, cmPath, cmText string, line0,
 	}
 
 	b, _ := json.Marshal(hover)
-	_ = filepath.Clean(cmPath)
-	return b, true
+	return b
 }
@@ -0,0 +1,147 @@
+package lsp
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elijahmorgan/c_minus/internal/project"
+)
+
+func TestCMHoverShowsDefineValue(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"cm.mod":           `module "hover"`,
+		"config/config.cm": "module \"config\"\n\n// Size of every read buffer\npub #define MAX_BUFFER (4 * 256)\n",
+		"main.cm":          "module \"main\"\n\nimport \"config\"\n\nfunc main() int {\n    return config.MAX_BUFFER;\n}\n",
+	}
+	for rel, content := range files {
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	proj, err := project.Discover(root)
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+
+	s := &server{}
+	mainPath := filepath.Join(root, "main.cm")
+	raw, ok := s.tryCMHover(proj, mainPath, files["main.cm"], 5, strings.Index("    return config.MAX_BUFFER;", "MAX"))
+	if !ok {
+		t.Fatal("expected a hover for config.MAX_BUFFER")
+	}
+
+	var hover struct {
+		Contents struct {
+			Value string `json:"value"`
+		} `json:"contents"`
+	}
+	if err := json.Unmarshal(raw, &hover); err != nil {
+		t.Fatalf("unmarshal hover: %v", err)
+	}
+	want := "```c\n#define config_MAX_BUFFER (4 * 256)\n```\n\nSize of every read buffer"
+	if hover.Contents.Value != want {
+		t.Errorf("hover = %q, want %q", hover.Contents.Value, want)
+	}
+}
+
+func TestCMHoverShowsModuleDoc(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"cm.mod":           `module "hover"`,
+		"config/config.cm": "// Package config holds build-time settings.\nmodule \"config\"\n\npub #define MAX_BUFFER 64\n",
+		"main.cm":          "module \"main\"\n\nimport \"config\"\n\nfunc main() int {\n    return config.MAX_BUFFER;\n}\n",
+	}
+	for rel, content := range files {
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	proj, err := project.Discover(root)
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+
+	s := &server{}
+	mainPath := filepath.Join(root, "main.cm")
+	raw, ok := s.tryCMHover(proj, mainPath, files["main.cm"], 5, strings.Index("    return config.MAX_BUFFER;", "config")+1)
+	if !ok {
+		t.Fatal("expected a hover for the config prefix")
+	}
+
+	var hover struct {
+		Contents struct {
+			Value string `json:"value"`
+		} `json:"contents"`
+	}
+	if err := json.Unmarshal(raw, &hover); err != nil {
+		t.Fatalf("unmarshal hover: %v", err)
+	}
+	want := "```c\nmodule \"config\"\n```\n\nPackage config holds build-time settings."
+	if hover.Contents.Value != want {
+		t.Errorf("hover = %q, want %q", hover.Contents.Value, want)
+	}
+}
+
+func TestCMHoverSameModuleFunction(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"cm.mod":  `module "hover"`,
+		"main.cm": "module \"main\"\n\n// scale multiplies v by factor.\nfunc scale(int v, int factor) int {\n    return v * factor;\n}\n\n#define LIMIT 8\n\nfunc main() int {\n    return scale(LIMIT, 2); // scale\n}\n",
+	}
+	for rel, content := range files {
+		if err := os.WriteFile(filepath.Join(root, rel), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	proj, err := project.Discover(root)
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+
+	s := &server{}
+	mainPath := filepath.Join(root, "main.cm")
+	callLine := "    return scale(LIMIT, 2); // scale"
+	hoverValue := func(char0 int) (string, bool) {
+		raw, ok := s.tryCMHover(proj, mainPath, files["main.cm"], 10, char0)
+		if !ok {
+			return "", false
+		}
+		var hover struct {
+			Contents struct {
+				Value string `json:"value"`
+			} `json:"contents"`
+		}
+		if err := json.Unmarshal(raw, &hover); err != nil {
+			t.Fatalf("unmarshal hover: %v", err)
+		}
+		return hover.Contents.Value, true
+	}
+
+	got, ok := hoverValue(strings.Index(callLine, "scale") + 2)
+	want := "```c\nint scale(int v, int factor)\n```\n\nscale multiplies v by factor."
+	if !ok || got != want {
+		t.Errorf("hover on scale = %q, want %q", got, want)
+	}
+	got, ok = hoverValue(strings.Index(callLine, "LIMIT"))
+	if !ok || got != "```c\n#define LIMIT 8\n```" {
+		t.Errorf("hover on LIMIT = %q", got)
+	}
+	if got, ok := hoverValue(strings.LastIndex(callLine, "scale")); ok {
+		t.Errorf("expected no hover inside a comment, got %q", got)
+	}
+}
@@ -0,0 +1,179 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/elijahmorgan/c_minus/internal/project"
+)
+
+func (s *server) inlayHints(ctx context.Context, msg jsonrpcMessage) error {
+	var params struct {
+		TextDocument struct {
+			URI string `json:"uri"`
+		} `json:"textDocument"`
+		Range lspRange `json:"range"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return s.writeError(msg.ID, -32602, fmt.Sprintf("invalid params: %v", err))
+	}
+
+	cmPath, err := filePathFromURI(params.TextDocument.URI)
+	if err != nil {
+		return s.writeError(msg.ID, -32602, fmt.Sprintf("invalid uri: %v", err))
+	}
+	cmPath, err = filepath.Abs(cmPath)
+	if err != nil {
+		return s.writeError(msg.ID, -32602, fmt.Sprintf("invalid path: %v", err))
+	}
+
+	s.mu.Lock()
+	cmText, ok := s.openDocs[cmPath]
+	s.mu.Unlock()
+	if !ok {
+		return s.writeError(msg.ID, -32002, "document not open")
+	}
+
+	proj, err := project.Discover(filepath.Dir(cmPath))
+	if err != nil {
+		return s.writeError(msg.ID, -32002, err.Error())
+	}
+	idx, err := buildModuleIndex(proj, map[string]string{cmPath: cmText})
+	if err != nil {
+		return s.writeError(msg.ID, -32002, err.Error())
+	}
+
+	hints := cmInlayHints(proj, idx, cmPath, cmText, params.Range)
+	if hints == nil {
+		hints = []any{}
+	}
+	return s.conn.writeMessage(jsonrpcMessage{JSONRPC: "2.0", ID: msg.ID, Result: mustJSON(hints)})
+}
+
+// cmInlayHints returns parameter-name hints for the arguments of calls to
+// C-minus functions that start within r
+func cmInlayHints(proj *project.Project, idx *moduleIndex, cmPath, cmText string, r lspRange) []any {
+	modPath, err := projectModuleImportPath(proj, cmPath)
+	if err != nil {
+		return nil
+	}
+	imports := importedModulePrefixes(cmPath, cmText)
+
+	// Functions callable from this file: bare for the module's own, "prefix.name" for imports
+	params := make(map[string][]string)
+	for _, sym := range idx.Modules[modPath] {
+		if sym.Kind == symbolKindFunc {
+			params[sym.Name] = sym.Params
+		}
+	}
+	for prefix, importPath := range imports {
+		for _, sym := range idx.Modules[importPath] {
+			if sym.Kind == symbolKindFunc && sym.Public {
+				params[prefix+"."+sym.Name] = sym.Params
+			}
+		}
+	}
+
+	lines := splitLinesPreserve(cmText)
+	lineStart := make([]int, len(lines))
+	off := 0
+	for i, line := range lines {
+		lineStart[i] = off
+		off += len(line) + 1
+	}
+	position := func(offset int) map[string]any {
+		line := 0
+		for line+1 < len(lineStart) && lineStart[line+1] <= offset {
+			line++
+		}
+		return map[string]any{"line": line, "character": offset - lineStart[line]}
+	}
+
+	first := max(r.Start.Line, 0)
+	last := min(r.End.Line, len(lines)-1)
+	if first > last {
+		return nil
+	}
+	mask := codeMask(cmText)
+
+	var hints []any
+	for i := lineStart[first]; i < lineStart[last]+len(lines[last]); i++ {
+		if !mask[i] || !isIdentChar(cmText[i]) || (i > 0 && (isIdentChar(cmText[i-1]) || cmText[i-1] == '.')) {
+			continue
+		}
+
+		// Read a name, qualified by one "prefix." if present
+		end := i
+		for end < len(cmText) && (isIdentChar(cmText[end]) || cmText[end] == '.') {
+			end++
+		}
+		name := cmText[i:end]
+		open := end
+		for open < len(cmText) && (cmText[open] == ' ' || cmText[open] == '\t') {
+			open++
+		}
+		names, ok := params[name]
+		if !ok || open >= len(cmText) || cmText[open] != '(' || strings.HasSuffix(strings.TrimRight(cmText[:i], " \t"), "func") {
+			i = end - 1
+			continue
+		}
+
+		for n, arg := range callArguments(cmText, mask, open) {
+			if n >= len(names) || names[n] == "" || cmText[arg[0]:arg[1]] == names[n] {
+				continue
+			}
+			hints = append(hints, map[string]any{
+				"position":     position(arg[0]),
+				"label":        names[n] + ":",
+				"kind":         2, // Parameter
+				"paddingRight": true,
+			})
+		}
+		i = end - 1
+	}
+	return hints
+}
+
+// callArguments returns the [start, end) offsets of each top-level argument of
+// the call whose '(' is at open, trimmed of surrounding whitespace
+func callArguments(src string, mask []bool, open int) [][2]int {
+	var args [][2]int
+	start := open + 1
+	depth := 0
+	add := func(end int) {
+		s, e := start, end
+		for s < e && strings.ContainsRune(" \t\r\n", rune(src[s])) {
+			s++
+		}
+		for e > s && strings.ContainsRune(" \t\r\n", rune(src[e-1])) {
+			e--
+		}
+		if s < e {
+			args = append(args, [2]int{s, e})
+		}
+	}
+	for i := open + 1; i < len(src); i++ {
+		if !mask[i] {
+			continue
+		}
+		switch src[i] {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			if depth == 0 {
+				add(i)
+				return args
+			}
+			depth--
+		case ',':
+			if depth == 0 {
+				add(i)
+				start = i + 1
+			}
+		}
+	}
+	return args
+}
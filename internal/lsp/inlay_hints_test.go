@@ -0,0 +1,63 @@
+package lsp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/elijahmorgan/c_minus/internal/project"
+)
+
+func TestCMInlayHintsNameCallArguments(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"cm.mod":       `module "hints"`,
+		"math/math.cm": "module \"math\"\n\npub func clamp(int value, int lo, int hi) int {\n    return value < lo ? lo : value > hi ? hi : value;\n}\n",
+		"main.cm": "module \"main\"\n\nimport \"math\"\n\nfunc twice(int n) int {\n    return n * 2;\n}\n\n" +
+			"func main() int {\n    int hi = 9;\n    // math.clamp(1, 2, 3)\n    return math.clamp(twice(4), (1, 0), hi) + twice(\"(\"[0]);\n}\n",
+	}
+	for rel, content := range files {
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	proj, err := project.Discover(root)
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	idx, err := buildModuleIndex(proj, nil)
+	if err != nil {
+		t.Fatalf("index: %v", err)
+	}
+
+	mainPath := filepath.Join(root, "main.cm")
+	hints := cmInlayHints(proj, idx, mainPath, files["main.cm"], lspRange{Start: lspPosition{Line: 0}, End: lspPosition{Line: 20}})
+
+	// The comment and the declaration of twice get no hints, and hi needs none
+	want := []struct {
+		label string
+		char  int
+	}{
+		{"value:", 22}, {"lo:", 32}, {"n:", 28}, {"n:", 52},
+	}
+	if len(hints) != len(want) {
+		t.Fatalf("got %d hints, want %d: %v", len(hints), len(want), hints)
+	}
+	for i, w := range want {
+		h := hints[i].(map[string]any)
+		pos := h["position"].(map[string]any)
+		if h["label"] != w.label || pos["line"] != 11 || pos["character"] != w.char {
+			t.Errorf("hint %d = %v at %v, want %s at 11:%d", i, h["label"], pos, w.label, w.char)
+		}
+	}
+
+	// Calls outside the requested range are skipped
+	if hints := cmInlayHints(proj, idx, mainPath, files["main.cm"], lspRange{Start: lspPosition{Line: 0}, End: lspPosition{Line: 10}}); len(hints) != 0 {
+		t.Errorf("expected no hints before line 11, got %v", hints)
+	}
+}
@@ -104,3 +104,33 @@ func isInStringOrComment(src string, line0, char0 int) bool {
 func isInStringOrCommentAt(line string, char0 int) bool {
 	return isInStringOrComment(line, 0, char0)
 }
+
+// codeMask marks which bytes of src are code, as opposed to part of a
+// comment, string, or character literal
+func codeMask(src string) []bool {
+	mask := make([]bool, len(src))
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == '/' && i+1 < len(src) && src[i+1] == '/':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			i += 2
+			for i+1 < len(src) && !(src[i] == '*' && src[i+1] == '/') {
+				i++
+			}
+			i++
+		case c == '"' || c == '\'':
+			for i++; i < len(src) && src[i] != c && src[i] != '\n'; i++ {
+				if src[i] == '\\' {
+					i++
+				}
+			}
+		default:
+			mask[i] = true
+		}
+	}
+	return mask
+}
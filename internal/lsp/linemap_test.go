@@ -31,3 +31,63 @@ func TestLineMapper_MapsLineDirectives(t *testing.T) {
 		t.Fatalf("expected /tmp/main.cm:11, got %s:%d", file, line)
 	}
 }
+
+func TestLineMapper_InterleavedFiles(t *testing.T) {
+	c := strings.Join([]string{
+		"#include \"shapes.h\"",         // 1
+		"#line 3 \"/src/a.cm\"",         // 2
+		"int shapes_count = 0;",         // 3 -> a:3
+		"",                              // 4 -> a:4 (generated blank)
+		"#line 2 \"/src/b.cm\"",         // 5
+		"static int b_total = 0;",       // 6 -> b:2
+		"",                              // 7
+		"#line 5 \"/src/a.cm\"",         // 8
+		"int shapes_area(int s) {",      // 9 -> a:5
+		"    return s * s;",             // 10 -> a:6
+		"}",                             // 11 -> a:7
+		"",                              // 12
+		"#line 9 \"/src/b.cm\"",         // 13
+		"int shapes_perimeter(int s) {", // 14 -> b:9
+		"    return 4 * s;",             // 15 -> b:10
+		"}",                             // 16 -> b:11
+	}, "\n") + "\n"
+
+	lm, err := newLineMapperFromC(strings.NewReader(c))
+	if err != nil {
+		t.Fatalf("newLineMapperFromC: %v", err)
+	}
+
+	for _, tt := range []struct {
+		out  int
+		file string
+		line int
+	}{
+		{3, "/src/a.cm", 3},
+		{6, "/src/b.cm", 2},
+		{9, "/src/a.cm", 5},
+		{10, "/src/a.cm", 6},
+		{14, "/src/b.cm", 9},
+		{16, "/src/b.cm", 11},
+	} {
+		file, line := lm.mapLine(tt.out)
+		if file != tt.file || line != tt.line {
+			t.Errorf("mapLine(%d) = %s:%d, want %s:%d", tt.out, file, line, tt.file, tt.line)
+		}
+		out, ok := lm.mapToGeneratedLine(tt.file, tt.line)
+		if !ok || out != tt.out {
+			t.Errorf("mapToGeneratedLine(%s, %d) = %d, %v, want %d", tt.file, tt.line, out, ok, tt.out)
+		}
+	}
+
+	// a:5 would also fall in the first a segment if it ran over the blank
+	// line and the #line directive; the segment that starts at a:5 wins
+	if out, _ := lm.mapToGeneratedLine("/src/a.cm", 5); out != 9 {
+		t.Errorf("expected a:5 at generated line 9, got %d", out)
+	}
+	if _, ok := lm.mapToGeneratedLine("/src/b.cm", 5); ok {
+		t.Error("expected b:5, which no segment covers, to be unmapped")
+	}
+	if _, ok := lm.mapToGeneratedLine("/src/c.cm", 3); ok {
+		t.Error("expected a file with no #line directives to be unmapped")
+	}
+}
@@ -0,0 +1,213 @@
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/elijahmorgan/c_minus/internal/project"
+)
+
+// cmReferences finds references to a module-level symbol in every .cm file of
+// the project, including files that were never opened or transpiled: bare
+// uses in the defining module and, for public symbols, "prefix.name" uses in
+// the files that import it. It reports false when the position is not on a
+// symbol declared at the top level of a module.
+func (s *server) cmReferences(proj *project.Project, cmPath, cmText string, line0, char0 int, includeDecl bool) ([]map[string]any, bool) {
+	lines := splitLinesPreserve(cmText)
+	if line0 < 0 || line0 >= len(lines) || isInStringOrComment(cmText, line0, char0) {
+		return nil, false
+	}
+	line := lines[line0]
+	if snapped, ok := snapCharToIdentifier(line, char0); ok {
+		char0 = snapped
+	}
+	ident, qualifier := identifierAt(line, char0)
+	if ident == "" {
+		return nil, false
+	}
+
+	target, err := projectModuleImportPath(proj, cmPath)
+	if err != nil {
+		return nil, false
+	}
+	if qualifier != "" {
+		importPath, ok := importedModulePrefixes(cmPath, cmText)[qualifier]
+		if !ok {
+			return nil, false
+		}
+		target = importPath
+	}
+	mod, ok := proj.Modules[target]
+	if !ok {
+		return nil, false
+	}
+
+	s.mu.Lock()
+	openDocsCopy := make(map[string]string, len(s.openDocs))
+	for k, v := range s.openDocs {
+		openDocsCopy[k] = v
+	}
+	s.mu.Unlock()
+
+	idx, err := buildModuleIndex(proj, openDocsCopy)
+	if err != nil {
+		return nil, false
+	}
+	var sym *cmSymbol
+	for i := range idx.Modules[target] {
+		if idx.Modules[target][i].Name == ident {
+			sym = &idx.Modules[target][i]
+			break
+		}
+	}
+	if sym == nil || (qualifier != "" && !sym.Public) {
+		return nil, false
+	}
+
+	readText := func(path string) (string, bool) {
+		if text, ok := openDocsCopy[path]; ok {
+			return text, true
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return "", false
+		}
+		return string(b), true
+	}
+
+	var locations []map[string]any
+	addEdits := func(path string, edits []any, skip int) {
+		uri, err := fileURIFromPath(path)
+		if err != nil {
+			return
+		}
+		for _, e := range edits {
+			r := e.(map[string]any)["range"].(map[string]any)
+			start := r["start"].(map[string]any)
+			end := r["end"].(map[string]any)
+			l, c := start["line"].(int), start["character"].(int)+skip
+			if !includeDecl && path == sym.File && l == sym.Line1-1 && c == sym.Char0 {
+				continue
+			}
+			locations = append(locations, map[string]any{
+				"uri": uri,
+				"range": map[string]any{
+					"start": map[string]any{"line": l, "character": c},
+					"end":   map[string]any{"line": l, "character": end["character"].(int)},
+				},
+			})
+		}
+	}
+
+	// The rename edit finder locates the uses; only the name part of a
+	// qualified use is the reference
+	for _, path := range mod.Files {
+		text, ok := readText(path)
+		if !ok {
+			continue
+		}
+		textLines := splitLinesPreserve(text)
+		var edits []any
+		for _, e := range findRenameEdits(text, ident, ident, false, "") {
+			start := e.(map[string]any)["range"].(map[string]any)["start"].(map[string]any)
+			if !isMemberAccess(textLines[start["line"].(int)], start["character"].(int)) {
+				edits = append(edits, e)
+			}
+		}
+		addEdits(path, edits, 0)
+	}
+	if sym.Public {
+		for importPath, other := range proj.Modules {
+			if importPath == target {
+				continue
+			}
+			for _, path := range other.Files {
+				text, ok := readText(path)
+				if !ok {
+					continue
+				}
+				for prefix, imported := range importedModulePrefixes(path, text) {
+					if imported == target {
+						addEdits(path, findRenameEdits(text, ident, ident, true, prefix), len(prefix)+1)
+					}
+				}
+			}
+		}
+	}
+	return locations, true
+}
+
+// isMemberAccess reports whether the identifier at col follows "." or "->",
+// making it a struct member rather than the module symbol
+func isMemberAccess(line string, col int) bool {
+	i := col - 1
+	for i >= 0 && (line[i] == ' ' || line[i] == '\t') {
+		i--
+	}
+	return i >= 0 && (line[i] == '.' || (line[i] == '>' && i > 0 && line[i-1] == '-'))
+}
+
+// mergeLocations appends the locations of a references result to native
+// ones, dropping any that start at a position already present
+func mergeLocations(native []map[string]any, raw json.RawMessage) json.RawMessage {
+	seen := make(map[string]bool)
+	key := func(uri any, r any) string {
+		start, _ := r.(map[string]any)["start"].(map[string]any)
+		return fmt.Sprintf("%v:%v:%v", uri, start["line"], start["character"])
+	}
+
+	var merged []any
+	for _, loc := range native {
+		k := key(loc["uri"], loc["range"])
+		if !seen[k] {
+			seen[k] = true
+			merged = append(merged, loc)
+		}
+	}
+
+	var forwarded []map[string]any
+	if len(raw) > 0 && json.Unmarshal(raw, &forwarded) == nil {
+		for _, loc := range forwarded {
+			r, ok := loc["range"].(map[string]any)
+			if !ok {
+				continue
+			}
+			// JSON numbers decode as float64; normalize them for the key
+			if start, ok := r["start"].(map[string]any); ok {
+				for _, f := range []string{"line", "character"} {
+					if n, ok := start[f].(float64); ok {
+						start[f] = int(n)
+					}
+				}
+			}
+			k := key(loc["uri"], r)
+			if !seen[k] {
+				seen[k] = true
+				merged = append(merged, loc)
+			}
+		}
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		a, b := merged[i].(map[string]any), merged[j].(map[string]any)
+		if a["uri"] != b["uri"] {
+			return fmt.Sprint(a["uri"]) < fmt.Sprint(b["uri"])
+		}
+		return locationLine(a) < locationLine(b)
+	})
+	out, _ := json.Marshal(merged)
+	if merged == nil {
+		out = json.RawMessage("[]")
+	}
+	return out
+}
+
+// locationLine returns the start line of a location map
+func locationLine(loc map[string]any) int {
+	r, _ := loc["range"].(map[string]any)
+	start, _ := r["start"].(map[string]any)
+	n, _ := start["line"].(int)
+	return n
+}
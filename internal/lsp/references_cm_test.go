@@ -0,0 +1,135 @@
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/elijahmorgan/c_minus/internal/project"
+)
+
+func TestCMReferencesAcrossProject(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"cm.mod": `module "refs"`,
+		"shapes/shapes.cm": `module "shapes"
+
+pub struct Box { int bump; };
+`,
+		"utils/counter/counter.cm": `module "utils/counter"
+
+import "shapes"
+
+pub func bump(int n) int {
+    return n + 1;
+}
+
+func twice(shapes.Box* b, int n) int {
+    b->bump = 0;
+    return bump(bump(n));
+}
+`,
+		"main.cm": `module "main"
+
+import "utils/counter"
+
+func main() int {
+    return counter.bump(1) - counter.bump(0) - 1;
+}
+`,
+		"report/report.cm": `module "report"
+
+import "utils/counter"
+
+pub func next(int n) int {
+    // counter.bump in a comment is not a use
+    return counter.bump(n);
+}
+`,
+	}
+	for rel, content := range files {
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	proj, err := project.Discover(root)
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+
+	s := &server{openDocs: make(map[string]string)}
+	mainPath := filepath.Join(root, "main.cm")
+	line := "    return counter.bump(1) - counter.bump(0) - 1;"
+	locate := func(includeDecl bool) []string {
+		t.Helper()
+		locs, ok := s.cmReferences(proj, mainPath, files["main.cm"], 5, strings.Index(line, "bump"), includeDecl)
+		if !ok {
+			t.Fatal("expected counter.bump to be a module symbol")
+		}
+		var got []string
+		for _, loc := range locs {
+			path, err := filePathFromURI(loc["uri"].(string))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rel, _ := filepath.Rel(root, path)
+			start := loc["range"].(map[string]any)["start"].(map[string]any)
+			got = append(got, fmt.Sprintf("%s:%d:%d", rel, start["line"], start["character"]))
+		}
+		sort.Strings(got)
+		return got
+	}
+
+	want := []string{
+		"main.cm:5:19",
+		"main.cm:5:37",
+		"report/report.cm:6:19",
+		"utils/counter/counter.cm:10:11",
+		"utils/counter/counter.cm:10:16",
+		"utils/counter/counter.cm:4:9",
+	}
+	if got := locate(true); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("references = %v, want %v", got, want)
+	}
+	if got := locate(false); strings.Join(got, " ") != strings.Join(want[:5], " ") {
+		t.Errorf("references without the declaration = %v, want %v", got, want[:5])
+	}
+
+	// Anything but a module symbol is left to clangd
+	if _, ok := s.cmReferences(proj, mainPath, files["main.cm"], 5, 4, true); ok {
+		t.Error("expected no native references for a keyword")
+	}
+}
+
+func TestMergeLocationsDeduplicates(t *testing.T) {
+	native := []map[string]any{{
+		"uri":   "file:///p/main.cm",
+		"range": map[string]any{"start": map[string]any{"line": 5, "character": 19}, "end": map[string]any{"line": 5, "character": 23}},
+	}}
+	clangd := json.RawMessage(`[
+		{"uri": "file:///p/main.cm", "range": {"start": {"line": 5, "character": 19}, "end": {"line": 5, "character": 23}}},
+		{"uri": "file:///p/main.cm", "range": {"start": {"line": 2, "character": 4}, "end": {"line": 2, "character": 8}}}
+	]`)
+
+	var merged []map[string]any
+	if err := json.Unmarshal(mergeLocations(native, clangd), &merged); err != nil {
+		t.Fatal(err)
+	}
+	if len(merged) != 2 {
+		t.Fatalf("expected 2 locations, got %v", merged)
+	}
+	if line := merged[0]["range"].(map[string]any)["start"].(map[string]any)["line"]; line != float64(2) {
+		t.Errorf("expected locations sorted by line, got %v", merged)
+	}
+	if got := string(mergeLocations(nil, nil)); got != "[]" {
+		t.Errorf("expected an empty list, got %s", got)
+	}
+}
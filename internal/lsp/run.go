@@ -0,0 +1,175 @@
+package lsp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"sync"
+
+	"github.com/elijahmorgan/c_minus/internal/build"
+	"github.com/elijahmorgan/c_minus/internal/project"
+)
+
+// runCommand builds the project and runs its executable
+const runCommand = "c_minus.run"
+
+// LSP MessageType values for window/logMessage
+const (
+	messageError = 1
+	messageInfo  = 3
+)
+
+func (s *server) executeCommand(ctx context.Context, msg jsonrpcMessage) error {
+	var params struct {
+		Command string `json:"command"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return s.writeError(msg.ID, -32602, fmt.Sprintf("invalid params: %v", err))
+	}
+
+	switch params.Command {
+	case runCommand:
+		return s.runProject(ctx, msg)
+	}
+	return s.writeError(msg.ID, -32602, fmt.Sprintf("unknown command %q", params.Command))
+}
+
+// runProject builds the project on disk and runs the binary in the background,
+// streaming its output as window/logMessage notifications. The reply carries
+// the exit code once the program finishes. Only one run may be active.
+func (s *server) runProject(ctx context.Context, msg jsonrpcMessage) error {
+	if !s.running.CompareAndSwap(false, true) {
+		return s.writeError(msg.ID, -32002, runCommand+": a run is already in progress")
+	}
+
+	binPath, err := s.buildForRun(ctx)
+	if err != nil {
+		s.running.Store(false)
+		_ = s.logMessage(messageError, err.Error())
+		return s.writeError(msg.ID, -32603, err.Error())
+	}
+
+	go func() {
+		defer s.running.Store(false)
+
+		stdout := &logWriter{s: s, typ: messageInfo}
+		stderr := &logWriter{s: s, typ: messageError}
+		cmd := exec.CommandContext(ctx, binPath)
+		cmd.Dir = s.rootPath
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		err := cmd.Run()
+		stdout.flush()
+		stderr.flush()
+
+		exitCode := 0
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			exitCode = exitErr.ExitCode()
+		} else if err != nil {
+			_ = s.logMessage(messageError, fmt.Sprintf("%s: %v", runCommand, err))
+			_ = s.writeError(msg.ID, -32603, err.Error())
+			return
+		}
+
+		_ = s.logMessage(messageInfo, fmt.Sprintf("%s: exited with code %d", runCommand, exitCode))
+		_ = s.conn.writeMessage(jsonrpcMessage{JSONRPC: "2.0", ID: msg.ID, Result: mustJSON(map[string]any{"exitCode": exitCode})})
+	}()
+	return nil
+}
+
+// buildForRun builds the project from the files on disk and returns the
+// executable's path. Compiler output is forwarded to the client log.
+func (s *server) buildForRun(ctx context.Context) (string, error) {
+	// Build as c_minus build would, with the project's cm.build
+	cfg := &build.Config{}
+	if root, _, err := project.FindRoot(s.rootPath); err == nil {
+		if cfg, err = build.LoadConfig(root); err != nil {
+			return "", err
+		}
+	}
+	proj, err := project.DiscoverWithContext(s.rootPath, project.NewBuildContext(cfg.Tags, cfg.Release))
+	if err != nil {
+		return "", fmt.Errorf("project discovery failed: %w", err)
+	}
+
+	out := &logWriter{s: s, typ: messageError}
+	opts := cfg.Options
+	opts.Output = out
+	if opts.Jobs == 0 {
+		opts.Jobs = runtime.GOMAXPROCS(0)
+	}
+	binPath, err := build.ExecutablePath(proj, opts)
+	if err != nil {
+		return "", err
+	}
+	err = build.Build(proj, opts)
+	out.flush()
+
+	// The build regenerated .c_minus from disk; put back the generated C for
+	// unsaved editor contents so positions keep mapping correctly.
+	s.transpiled.reset()
+	s.lineMapsMu.Lock()
+	s.lineMaps = make(map[string]*lineMapper)
+	s.lineMapsMu.Unlock()
+	s.mu.Lock()
+	var open []string
+	for p := range s.openDocs {
+		open = append(open, p)
+	}
+	s.mu.Unlock()
+	for _, p := range open {
+		_ = s.refreshFile(ctx, p)
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("build failed: %w", err)
+	}
+	return binPath, nil
+}
+
+func (s *server) logMessage(typ int, text string) error {
+	return s.conn.writeMessage(jsonrpcMessage{JSONRPC: "2.0", Method: "window/logMessage", Params: mustJSON(map[string]any{"type": typ, "message": text})})
+}
+
+// logWriter sends each complete line written to it as a window/logMessage
+type logWriter struct {
+	s   *server
+	typ int
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf.Write(p)
+	for {
+		line, err := w.buf.ReadString('\n')
+		if err != nil {
+			// Keep the partial line for the next write
+			w.buf.Reset()
+			w.buf.WriteString(line)
+			break
+		}
+		_ = w.s.logMessage(w.typ, line[:len(line)-1])
+	}
+	return len(p), nil
+}
+
+// flush sends any trailing text that did not end in a newline
+func (w *logWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.buf.Len() > 0 {
+		_ = w.s.logMessage(w.typ, w.buf.String())
+		w.buf.Reset()
+	}
+}
@@ -0,0 +1,41 @@
+package lsp
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestLogWriterSendsLines(t *testing.T) {
+	var out bytes.Buffer
+	s := &server{conn: newJSONRPCConn(&bytes.Buffer{}, &out)}
+	w := &logWriter{s: s, typ: messageInfo}
+
+	w.Write([]byte("first\nsec"))
+	w.Write([]byte("ond\nlast"))
+	w.flush()
+
+	reader := newJSONRPCConn(&out, nil)
+	var got []string
+	for {
+		msg, err := reader.readMessage()
+		if err != nil {
+			break
+		}
+		var params struct {
+			Type    int    `json:"type"`
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		if msg.Method != "window/logMessage" || params.Type != messageInfo {
+			t.Errorf("unexpected message %s %s", msg.Method, msg.Params)
+		}
+		got = append(got, params.Message)
+	}
+
+	if len(got) != 3 || got[0] != "first" || got[1] != "second" || got[2] != "last" {
+		t.Errorf("expected [first second last], got %q", got)
+	}
+}
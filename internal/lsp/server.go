@@ -3,14 +3,19 @@ package lsp
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 
+	"github.com/elijahmorgan/c_minus/internal/diag"
+	"github.com/elijahmorgan/c_minus/internal/parser"
 	"github.com/elijahmorgan/c_minus/internal/paths"
 	"github.com/elijahmorgan/c_minus/internal/project"
+	"github.com/elijahmorgan/c_minus/internal/sourcemap"
 )
 
 type server struct {
@@ -20,14 +25,30 @@ type server struct {
 	rootPath string
 	buildDir string
 
+	// clangd is nil when the client disabled it with the disableClangd
+	// initialization option; requests are then answered natively or with null
 	clangd *clangdProxy
 
+	// watchFiles is set when the client can register file watchers for us
+	watchFiles bool
+
+	// running guards against concurrent c_minus.run commands
+	running atomic.Bool
+
 	mu          sync.Mutex
 	openDocs    map[string]string // absolute path -> full text
 	openedCDocs map[string]int    // c file absolute path -> version
 
 	lineMapsMu sync.Mutex
 	lineMaps   map[string]*lineMapper // c file absolute path -> mapper
+
+	// transpiled lets refreshFile regenerate only modules that changed
+	transpiled transpileCache
+
+	// saveCompiler is set when the client enabled the compileOnSave
+	// initialization option
+	saveCompiler *saveCompiler
+	diags        diagnosticSets
 }
 
 func Serve(ctx context.Context, in io.Reader, out io.Writer) error {
@@ -72,7 +93,19 @@ func (s *server) handleRequest(ctx context.Context, msg jsonrpcMessage) error {
 	switch msg.Method {
 	case "initialize":
 		var params struct {
-			RootURI string `json:"rootUri"`
+			RootURI      string `json:"rootUri"`
+			Capabilities struct {
+				Workspace struct {
+					DidChangeWatchedFiles struct {
+						DynamicRegistration bool `json:"dynamicRegistration"`
+					} `json:"didChangeWatchedFiles"`
+				} `json:"workspace"`
+			} `json:"capabilities"`
+			InitializationOptions struct {
+				DisableClangd      bool     `json:"disableClangd"`
+				CompileOnSave      bool     `json:"compileOnSave"`
+				CompileOnSaveFlags []string `json:"compileOnSaveFlags"`
+			} `json:"initializationOptions"`
 		}
 		_ = json.Unmarshal(msg.Params, &params)
 		if params.RootURI == "" {
@@ -85,6 +118,7 @@ func (s *server) handleRequest(ctx context.Context, msg jsonrpcMessage) error {
 
 		s.rootURI = params.RootURI
 		s.rootPath = rootPath
+		s.watchFiles = params.Capabilities.Workspace.DidChangeWatchedFiles.DynamicRegistration
 
 		buildDir := filepath.Join(rootPath, ".c_minus")
 		if err := os.MkdirAll(buildDir, 0755); err != nil {
@@ -92,27 +126,39 @@ func (s *server) handleRequest(ctx context.Context, msg jsonrpcMessage) error {
 		}
 		s.buildDir = buildDir
 
-		s.clangd = newClangdProxy(rootPath, buildDir)
-		s.clangd.onNotification = s.onClangdNotification
-		if err := s.clangd.start(ctx); err != nil {
-			return s.writeError(msg.ID, -32002, fmt.Sprintf("failed to start clangd: %v", err))
+		if !params.InitializationOptions.DisableClangd {
+			s.clangd = newClangdProxy(rootPath, buildDir)
+			s.clangd.onNotification = s.onClangdNotification
+			if err := s.clangd.start(ctx); err != nil {
+				return s.writeError(msg.ID, -32002, fmt.Sprintf("failed to start clangd: %v", err))
+			}
+			if err := s.clangd.initialize(ctx, s.rootURI); err != nil {
+				return s.writeError(msg.ID, -32002, fmt.Sprintf("failed to initialize clangd: %v", err))
+			}
+		}
+
+		textSync := map[string]any{
+			"openClose": true,
+			"change":    1, // Full
 		}
-		if err := s.clangd.initialize(ctx, s.rootURI); err != nil {
-			return s.writeError(msg.ID, -32002, fmt.Sprintf("failed to initialize clangd: %v", err))
+		if params.InitializationOptions.CompileOnSave {
+			s.saveCompiler = newSaveCompiler(s, params.InitializationOptions.CompileOnSaveFlags)
+			textSync["save"] = map[string]any{"includeText": false}
 		}
 
 		result := map[string]any{
 			"capabilities": map[string]any{
-				"textDocumentSync": map[string]any{
-					"openClose": true,
-					"change":    1, // Full
-				},
+				"textDocumentSync":        textSync,
 				"hoverProvider":           true,
 				"definitionProvider":      true,
 				"referencesProvider":      true,
 				"renameProvider":          map[string]any{"prepareProvider": true},
 				"documentSymbolProvider":  true,
 				"workspaceSymbolProvider": true,
+				"inlayHintProvider":       true,
+				"executeCommandProvider": map[string]any{
+					"commands": []string{runCommand},
+				},
 				"completionProvider": map[string]any{
 					"resolveProvider":   false,
 					"triggerCharacters": []string{".", ">", ":", "\""},
@@ -128,6 +174,9 @@ func (s *server) handleRequest(ctx context.Context, msg jsonrpcMessage) error {
 		}
 		return s.conn.writeMessage(jsonrpcMessage{JSONRPC: "2.0", ID: msg.ID, Result: json.RawMessage("null")})
 
+	case "workspace/executeCommand":
+		return s.executeCommand(ctx, msg)
+
 	case "textDocument/hover":
 		return s.forwardHover(ctx, msg)
 	case "textDocument/definition":
@@ -138,6 +187,8 @@ func (s *server) handleRequest(ctx context.Context, msg jsonrpcMessage) error {
 		return s.forwardCompletion(ctx, msg)
 	case "textDocument/documentSymbol":
 		return s.documentSymbols(ctx, msg)
+	case "textDocument/inlayHint":
+		return s.inlayHints(ctx, msg)
 	case "workspace/symbol":
 		return s.workspaceSymbols(ctx, msg)
 	case "textDocument/prepareRename":
@@ -156,7 +207,26 @@ func (s *server) handleNotification(ctx context.Context, msg jsonrpcMessage) err
 		return io.EOF
 
 	case "initialized":
-		return nil
+		if !s.watchFiles {
+			return nil
+		}
+		// Ask the client to tell us about sources changing on disk. The
+		// response carries nothing we need and is dropped by Serve.
+		return s.conn.writeMessage(jsonrpcMessage{JSONRPC: "2.0", ID: mustJSON("c_minus-watch"), Method: "client/registerCapability", Params: mustJSON(map[string]any{
+			"registrations": []any{map[string]any{
+				"id":     "c_minus-watched-files",
+				"method": "workspace/didChangeWatchedFiles",
+				"registerOptions": map[string]any{
+					"watchers": []any{
+						map[string]any{"globPattern": "**/*.cm"},
+						map[string]any{"globPattern": "**/cm.mod"},
+					},
+				},
+			}},
+		})})
+
+	case "workspace/didChangeWatchedFiles":
+		return s.didChangeWatchedFiles(ctx, msg)
 
 	case "textDocument/didOpen":
 		var params struct {
@@ -215,6 +285,29 @@ func (s *server) handleNotification(ctx context.Context, msg jsonrpcMessage) err
 
 		return s.refreshFile(ctx, cmPath)
 
+	case "textDocument/didSave":
+		if s.saveCompiler == nil {
+			return nil
+		}
+		var params struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+		}
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return err
+		}
+		cmPath, err := filePathFromURI(params.TextDocument.URI)
+		if err != nil {
+			return err
+		}
+		cmPath, err = filepath.Abs(cmPath)
+		if err != nil {
+			return err
+		}
+		s.saveCompiler.saved(cmPath)
+		return nil
+
 	case "textDocument/didClose":
 		var params struct {
 			TextDocument struct {
@@ -258,7 +351,7 @@ func (s *server) refreshFile(ctx context.Context, cmPath string) error {
 	}
 	s.mu.Unlock()
 
-	buildDir, err := transpileWorkspace(proj, openDocsCopy)
+	buildDir, regenerated, err := transpileWorkspace(proj, openDocsCopy, &s.transpiled)
 	if err != nil {
 		return s.publishParserError(cmPath, err)
 	}
@@ -269,7 +362,8 @@ func (s *server) refreshFile(ctx context.Context, cmPath string) error {
 	if err != nil {
 		return s.publishParserError(cmPath, err)
 	}
-	cPath := generatedCPath(proj.RootPath, modPath, filepath.Base(cmPath))
+	cPath := generatedCPath(proj, modPath, filepath.Base(cmPath))
+	s.syncRegenerated(proj, regenerated, cPath)
 
 	// Invalidate any cached line map for this generated file.
 	s.lineMapsMu.Lock()
@@ -293,6 +387,11 @@ func (s *server) refreshFile(ctx context.Context, cmPath string) error {
 	}
 	s.mu.Unlock()
 
+	if s.clangd == nil {
+		// Without clangd, parse errors are the only diagnostics
+		return s.publishDiagnostics(cmPath, nil)
+	}
+
 	if !alreadyOpen {
 		s.mu.Lock()
 		s.openedCDocs[cPath] = 1
@@ -324,6 +423,55 @@ func (s *server) refreshFile(ctx context.Context, cmPath string) error {
 	})
 }
 
+// syncRegenerated drops the line maps of the other C files that the last
+// transpile rewrote (importers of a module whose header changed) and sends
+// clangd the new text of those it has open, so they are not analyzed stale.
+// skip is the C file refreshFile itself sends.
+func (s *server) syncRegenerated(proj *project.Project, regenerated []string, skip string) {
+	for _, importPath := range regenerated {
+		mod, ok := proj.Modules[importPath]
+		if !ok {
+			continue
+		}
+		for _, file := range mod.Files {
+			cPath := generatedCPath(proj, importPath, filepath.Base(file))
+			if cPath == skip {
+				continue
+			}
+			s.lineMapsMu.Lock()
+			delete(s.lineMaps, cPath)
+			s.lineMapsMu.Unlock()
+
+			s.mu.Lock()
+			ver, open := s.openedCDocs[cPath]
+			if open {
+				ver++
+				s.openedCDocs[cPath] = ver
+			}
+			s.mu.Unlock()
+			if !open || s.clangd == nil {
+				continue
+			}
+
+			cURI, err := fileURIFromPath(cPath)
+			if err != nil {
+				continue
+			}
+			cText, err := os.ReadFile(cPath)
+			if err != nil {
+				continue
+			}
+			_ = s.clangd.notify("textDocument/didChange", map[string]any{
+				"textDocument": map[string]any{
+					"uri":     cURI,
+					"version": ver,
+				},
+				"contentChanges": []any{map[string]any{"text": string(cText)}},
+			})
+		}
+	}
+}
+
 func projectModuleImportPath(proj *project.Project, cmPath string) (string, error) {
 	rel, err := filepath.Rel(proj.RootPath, filepath.Dir(cmPath))
 	if err != nil {
@@ -336,9 +484,17 @@ func projectModuleImportPath(proj *project.Project, cmPath string) (string, erro
 	return rel, nil
 }
 
-func generatedCPath(rootPath, importPath, cmBase string) string {
-	buildDir := filepath.Join(rootPath, ".c_minus")
-	return paths.ModuleCFilePath(buildDir, importPath, cmBase)
+// projectNaming returns how the project's generated files are named: the
+// mangling scheme selected in its cm.mod, with flat files
+func projectNaming(proj *project.Project) paths.Naming {
+	return paths.Naming{Mangling: proj.Mangling}
+}
+
+// generatedCPath returns the C file generated for a .cm file, named with the
+// mangling scheme selected in the project's cm.mod
+func generatedCPath(proj *project.Project, importPath, cmBase string) string {
+	buildDir := filepath.Join(proj.RootPath, ".c_minus")
+	return projectNaming(proj).ModuleCFilePath(buildDir, importPath, cmBase)
 }
 
 func (s *server) publishDiagnostics(cmPath string, diags []any) error {
@@ -349,20 +505,46 @@ func (s *server) publishDiagnostics(cmPath string, diags []any) error {
 	if diags == nil {
 		diags = []any{}
 	}
+	// This replaces what every source reported for the file
+	s.diags.reset(uri)
 	return s.conn.writeMessage(jsonrpcMessage{JSONRPC: "2.0", Method: "textDocument/publishDiagnostics", Params: mustJSON(map[string]any{"uri": uri, "diagnostics": diags})})
 }
 
 func (s *server) publishParserError(cmPath string, err error) error {
-	diag := map[string]any{
+	return s.publishDiagnostics(cmPath, []any{parserErrorDiagnostic(cmPath, err)})
+}
+
+// parserErrorDiagnostic builds a diagnostic for err. Parse errors in cmPath are
+// placed at their line and column; anything else lands at the top of the file.
+func parserErrorDiagnostic(cmPath string, err error) map[string]any {
+	line, char := 0, 0
+	var pe *parser.ParseError
+	if errors.As(err, &pe) && pe.Line > 0 && sameFile(pe.File, cmPath) {
+		line = pe.Line - 1
+		if pe.Col > 0 {
+			char = pe.Col - 1
+		}
+	}
+
+	return map[string]any{
 		"range": map[string]any{
-			"start": map[string]any{"line": 0, "character": 0},
-			"end":   map[string]any{"line": 0, "character": 1},
+			"start": map[string]any{"line": line, "character": char},
+			"end":   map[string]any{"line": line, "character": char + 1},
 		},
 		"severity": 1,
 		"source":   "c_minus",
 		"message":  err.Error(),
 	}
-	return s.publishDiagnostics(cmPath, []any{diag})
+}
+
+// sameFile reports whether two paths refer to the same file after cleaning
+func sameFile(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		return filepath.Clean(a) == filepath.Clean(b)
+	}
+	return absA == absB
 }
 
 func (s *server) writeError(id json.RawMessage, code int, msg string) error {
@@ -374,6 +556,9 @@ func mustJSON(v any) json.RawMessage {
 	return b
 }
 
+// lspSeverities names the LSP DiagnosticSeverity values
+var lspSeverities = map[int]string{1: "error", 2: "warning", 3: "information", 4: "hint"}
+
 func (s *server) onClangdNotification(msg jsonrpcMessage) {
 	if msg.Method != "textDocument/publishDiagnostics" {
 		return
@@ -413,7 +598,7 @@ func (s *server) onClangdNotification(msg jsonrpcMessage) {
 		return
 	}
 
-	byURI := make(map[string][]any)
+	var mapped []diag.CompilerDiag
 	for _, d := range params.Diagnostics {
 		origFile, origLine1 := lm.mapLine(d.Range.Start.Line + 1)
 		if origFile == "" {
@@ -422,25 +607,47 @@ func (s *server) onClangdNotification(msg jsonrpcMessage) {
 		if filepath.Ext(origFile) != ".cm" {
 			continue
 		}
-		cmURI, err := fileURIFromPath(origFile)
+		mapped = append(mapped, diag.CompilerDiag{
+			File:     origFile,
+			Line:     origLine1,
+			Col:      d.Range.Start.Character,
+			EndCol:   d.Range.End.Character,
+			Severity: lspSeverities[d.Severity],
+			Message:  d.Message,
+		})
+	}
+
+	// Several generated lines map to one .cm line, and one mistake cascades;
+	// show the first diagnostic per line and severity
+	byURI := make(map[string][]any)
+	for _, d := range diag.GroupCompilerDiags(mapped) {
+		cmURI, err := fileURIFromPath(d.File)
 		if err != nil {
 			continue
 		}
-
-		mapped := map[string]any{
+		message := d.Message
+		if d.More > 0 {
+			message += fmt.Sprintf(" (+%d more on this line)", d.More)
+		}
+		severity := 0
+		for code, name := range lspSeverities {
+			if name == d.Severity {
+				severity = code
+			}
+		}
+		byURI[cmURI] = append(byURI[cmURI], map[string]any{
 			"range": map[string]any{
-				"start": map[string]any{"line": origLine1 - 1, "character": d.Range.Start.Character},
-				"end":   map[string]any{"line": origLine1 - 1, "character": d.Range.End.Character},
+				"start": map[string]any{"line": d.Line - 1, "character": d.Col},
+				"end":   map[string]any{"line": d.Line - 1, "character": d.EndCol},
 			},
-			"severity": d.Severity,
+			"severity": severity,
 			"source":   "clangd",
-			"message":  d.Message,
-		}
-		byURI[cmURI] = append(byURI[cmURI], mapped)
+			"message":  message,
+		})
 	}
 
 	for uri, diags := range byURI {
-		_ = s.conn.writeMessage(jsonrpcMessage{JSONRPC: "2.0", Method: "textDocument/publishDiagnostics", Params: mustJSON(map[string]any{"uri": uri, "diagnostics": diags})})
+		_ = s.publishSourceDiagnostics(uri, "clangd", diags)
 	}
 }
 
@@ -452,6 +659,14 @@ func (s *server) getLineMapperForCFile(cPath string) (*lineMapper, error) {
 		return lm, nil
 	}
 
+	// Code generation writes a sourcemap beside each .c file; one written by
+	// an older version falls back to reading the #line directives
+	if sm, err := sourcemap.Load(sourcemap.Path(cPath)); err == nil {
+		lm := &lineMapper{sm: sm}
+		s.lineMaps[cPath] = lm
+		return lm, nil
+	}
+
 	f, err := os.Open(cPath)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,177 @@
+package lsp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/elijahmorgan/c_minus/internal/build"
+	"github.com/elijahmorgan/c_minus/internal/parser"
+	"github.com/elijahmorgan/c_minus/internal/paths"
+	"github.com/elijahmorgan/c_minus/internal/project"
+)
+
+func TestParserErrorDiagnosticUsesPosition(t *testing.T) {
+	cmPath := filepath.Join(t.TempDir(), "main.cm")
+	source := "module \"main\"\n\n  func (int a) int {\n    return a;\n}\n"
+
+	_, parseErr := parser.ParseSource(source, cmPath)
+	if parseErr == nil {
+		t.Fatal("expected a parse error")
+	}
+	// transpileWorkspace wraps parse errors; the position must survive wrapping
+	err := fmt.Errorf("failed to parse %s: %w", cmPath, parseErr)
+
+	diag := parserErrorDiagnostic(cmPath, err)
+	start := diag["range"].(map[string]any)["start"].(map[string]any)
+	if start["line"] != 2 || start["character"] != 2 {
+		t.Errorf("expected diagnostic at 2:2, got %v:%v", start["line"], start["character"])
+	}
+
+	// Errors from another file stay at the top of this one
+	diag = parserErrorDiagnostic(filepath.Join(filepath.Dir(cmPath), "other.cm"), err)
+	start = diag["range"].(map[string]any)["start"].(map[string]any)
+	if start["line"] != 0 || start["character"] != 0 {
+		t.Errorf("expected diagnostic at 0:0 for another file, got %v:%v", start["line"], start["character"])
+	}
+}
+
+func TestGeneratedCPathFollowsProjectMangling(t *testing.T) {
+	root := t.TempDir()
+
+	proj := &project.Project{RootPath: root}
+	if got, want := generatedCPath(proj, "a/b", "c.cm"), filepath.Join(root, ".c_minus", "a_b_c.c"); got != want {
+		t.Errorf("default scheme: got %q, want %q", got, want)
+	}
+
+	proj.Mangling = paths.ManglingLength
+	if got, want := generatedCPath(proj, "a/b", "c.cm"), filepath.Join(root, ".c_minus", "N1a1bE1c.c"); got != want {
+		t.Errorf("length scheme: got %q, want %q", got, want)
+	}
+}
+
+func TestGeneratedCPathIgnoresBuildLayout(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "cm.mod"), []byte(`module "layout"`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "main.cm"), []byte("module \"main\"\n\nfunc main() int {\n    return 0;\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	proj, err := project.Discover(root)
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+
+	// A build with mirrored objects, as c_minus.run starts, leaves the
+	// server's generated files flat
+	if err := build.Transpile(proj, filepath.Join(root, "out"), build.Options{MirrorObjects: true}); err != nil {
+		t.Fatalf("transpile: %v", err)
+	}
+	if got, want := generatedCPath(proj, "main", "main.cm"), filepath.Join(root, ".c_minus", "main_main.c"); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestGeneratedCPathConcurrentProjects(t *testing.T) {
+	// Compile-on-save computes paths off the server goroutine, while the
+	// server handles requests for projects with other schemes
+	under := &project.Project{RootPath: t.TempDir()}
+	length := &project.Project{RootPath: t.TempDir(), Mangling: paths.ManglingLength}
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				proj, want := under, "a_b_c.c"
+				if i%2 == 1 {
+					proj, want = length, "N1a1bE1c.c"
+				}
+				if got := filepath.Base(generatedCPath(proj, "a/b", "c.cm")); got != want {
+					t.Errorf("got %q, want %q", got, want)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestClangdStartReportsMissingClangd(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	p := newClangdProxy(t.TempDir(), t.TempDir())
+	err := p.start(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "install clangd") {
+		t.Errorf("expected an actionable missing clangd error, got %v", err)
+	}
+}
+
+func TestClangdDiagnosticsGroupedPerLine(t *testing.T) {
+	dir := t.TempDir()
+	cmPath := filepath.Join(dir, "main.cm")
+	cPath := filepath.Join(dir, "main_main.c")
+	cSource := "#include \"main_internal.h\"\n\n#line 3 \"" + cmPath + "\"\nint main() {\n    Pointt p = {1, 2};\n    return p.x;\n}\n"
+	if err := os.WriteFile(cPath, []byte(cSource), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	s := &server{conn: newJSONRPCConn(&bytes.Buffer{}, &out), lineMaps: make(map[string]*lineMapper)}
+	diag := func(line, char, severity int, message string) map[string]any {
+		pos := map[string]any{"line": line, "character": char}
+		return map[string]any{"range": map[string]any{"start": pos, "end": pos}, "severity": severity, "message": message}
+	}
+	s.onClangdNotification(jsonrpcMessage{Method: "textDocument/publishDiagnostics", Params: mustJSON(map[string]any{
+		"uri": "file://" + cPath,
+		"diagnostics": []any{
+			diag(4, 4, 1, "unknown type name 'Pointt'"),
+			diag(4, 16, 1, "expected ';'"),
+			diag(4, 18, 1, "expected statement"),
+			diag(4, 14, 2, "excess elements"),
+			diag(5, 11, 1, "member reference base type is not a structure"),
+		},
+	})})
+
+	msg, err := newJSONRPCConn(&out, nil).readMessage()
+	if err != nil {
+		t.Fatalf("expected a publishDiagnostics message: %v", err)
+	}
+	var params struct {
+		URI         string `json:"uri"`
+		Diagnostics []struct {
+			Range struct {
+				Start struct {
+					Line int `json:"line"`
+				} `json:"start"`
+			} `json:"range"`
+			Severity int    `json:"severity"`
+			Message  string `json:"message"`
+		} `json:"diagnostics"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if !strings.HasSuffix(params.URI, "/main.cm") {
+		t.Errorf("expected diagnostics for main.cm, got %s", params.URI)
+	}
+
+	var got []string
+	for _, d := range params.Diagnostics {
+		got = append(got, fmt.Sprintf("%d/%d %s", d.Range.Start.Line, d.Severity, d.Message))
+	}
+	want := []string{
+		"3/1 unknown type name 'Pointt' (+2 more on this line)",
+		"3/2 excess elements",
+		"4/1 member reference base type is not a structure",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected diagnostics:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
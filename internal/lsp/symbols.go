@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/elijahmorgan/c_minus/internal/project"
 )
@@ -55,12 +57,16 @@ func (s *server) documentSymbols(ctx context.Context, msg jsonrpcMessage) error
 		return s.writeError(msg.ID, -32002, err.Error())
 	}
 
-	var out []any
+	var fileSyms []cmSymbol
 	for _, sym := range syms {
-		if filepath.Clean(sym.File) != filepath.Clean(cmPath) {
-			continue
+		if filepath.Clean(sym.File) == filepath.Clean(cmPath) {
+			fileSyms = append(fileSyms, sym)
 		}
+	}
+	sortDocumentSymbols(fileSyms)
 
+	var out []any
+	for _, sym := range fileSyms {
 		kind := 13 // Enum
 		switch sym.Kind {
 		case symbolKindFunc:
@@ -132,57 +138,108 @@ func (s *server) workspaceSymbols(ctx context.Context, msg jsonrpcMessage) error
 		return s.writeError(msg.ID, -32002, err.Error())
 	}
 
-	var out []any
+	// idx.Modules is a map; collect the matches and sort them so results are stable
+	var matches []cmSymbol
 	for _, syms := range idx.Modules {
 		for _, sym := range syms {
 			if params.Query != "" && indexOfSubstring(sym.Name, params.Query) < 0 {
 				continue
 			}
+			matches = append(matches, sym)
+		}
+	}
+	sortWorkspaceSymbols(matches, params.Query)
 
-			uri, err := fileURIFromPath(sym.File)
-			if err != nil {
-				continue
-			}
+	var out []any
+	for _, sym := range matches {
+		uri, err := fileURIFromPath(sym.File)
+		if err != nil {
+			continue
+		}
 
-			startLine0 := sym.Line1 - 1
-			if startLine0 < 0 {
-				startLine0 = 0
-			}
-			startChar0 := sym.Char0
-			if startChar0 < 0 {
-				startChar0 = 0
-			}
+		startLine0 := sym.Line1 - 1
+		if startLine0 < 0 {
+			startLine0 = 0
+		}
+		startChar0 := sym.Char0
+		if startChar0 < 0 {
+			startChar0 = 0
+		}
 
-			kind := 12 // Function
-			switch sym.Kind {
-			case symbolKindFunc:
-				kind = 12
-			case symbolKindStruct, symbolKindUnion:
-				kind = 23
-			case symbolKindEnum:
-				kind = 10
-			case symbolKindTypedef:
-				kind = 23
-			case symbolKindGlobal:
-				kind = 13
-			case symbolKindDefine:
-				kind = 14
-			}
+		kind := 12 // Function
+		switch sym.Kind {
+		case symbolKindFunc:
+			kind = 12
+		case symbolKindStruct, symbolKindUnion:
+			kind = 23
+		case symbolKindEnum:
+			kind = 10
+		case symbolKindTypedef:
+			kind = 23
+		case symbolKindGlobal:
+			kind = 13
+		case symbolKindDefine:
+			kind = 14
+		}
 
-			out = append(out, map[string]any{
-				"name": sym.Name,
-				"kind": kind,
-				"location": map[string]any{
-					"uri": uri,
-					"range": map[string]any{
-						"start": map[string]any{"line": startLine0, "character": startChar0},
-						"end":   map[string]any{"line": startLine0, "character": startChar0 + len(sym.Name)},
-					},
+		out = append(out, map[string]any{
+			"name": sym.Name,
+			"kind": kind,
+			"location": map[string]any{
+				"uri": uri,
+				"range": map[string]any{
+					"start": map[string]any{"line": startLine0, "character": startChar0},
+					"end":   map[string]any{"line": startLine0, "character": startChar0 + len(sym.Name)},
 				},
-			})
-		}
+			},
+		})
 	}
 
 	b, _ := json.Marshal(out)
 	return s.conn.writeMessage(jsonrpcMessage{JSONRPC: "2.0", ID: msg.ID, Result: b})
 }
+
+// sortDocumentSymbols orders symbols by file, line, and name
+func sortDocumentSymbols(syms []cmSymbol) {
+	sort.Slice(syms, func(i, j int) bool {
+		a, b := syms[i], syms[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line1 != b.Line1 {
+			return a.Line1 < b.Line1
+		}
+		return a.Name < b.Name
+	})
+}
+
+// workspaceSymbolRank ranks how well name matches query: an exact match
+// first, then a prefix, then any other substring
+func workspaceSymbolRank(name, query string) int {
+	switch {
+	case name == query:
+		return 0
+	case strings.HasPrefix(name, query):
+		return 1
+	default:
+		return 2
+	}
+}
+
+// sortWorkspaceSymbols orders matches by rank, then name; file and line
+// break ties between symbols of the same name in different modules
+func sortWorkspaceSymbols(syms []cmSymbol, query string) {
+	sort.Slice(syms, func(i, j int) bool {
+		a, b := syms[i], syms[j]
+		if ra, rb := workspaceSymbolRank(a.Name, query), workspaceSymbolRank(b.Name, query); ra != rb {
+			return ra < rb
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line1 < b.Line1
+	})
+}
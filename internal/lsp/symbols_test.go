@@ -0,0 +1,83 @@
+package lsp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// symbolNames sends one request to handler and returns the names in its result
+func symbolNames(t *testing.T, s *server, handler func(context.Context, jsonrpcMessage) error, params any) []string {
+	t.Helper()
+	var out bytes.Buffer
+	s.conn = newJSONRPCConn(&bytes.Buffer{}, &out)
+	if err := handler(context.Background(), jsonrpcMessage{ID: json.RawMessage("1"), Params: mustJSON(params)}); err != nil {
+		t.Fatalf("handler: %v", err)
+	}
+	msg, err := newJSONRPCConn(&out, nil).readMessage()
+	if err != nil {
+		t.Fatalf("read response: %v", err)
+	}
+	if msg.Error != nil {
+		t.Fatalf("error response: %s", msg.Error.Message)
+	}
+	var syms []struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(msg.Result, &syms); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	var names []string
+	for _, sym := range syms {
+		names = append(names, sym.Name)
+	}
+	return names
+}
+
+func TestSymbolOrderIsStable(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"cm.mod":         `module "symbols"`,
+		"geo/geo.cm":     "module \"geo\"\n\npub func point_count() int { return 0; }\n\npub struct point { int x; };\n",
+		"draw/draw.cm":   "module \"draw\"\n\npub func draw_point() void {}\n\npub func point() void {}\n",
+		"alpha/alpha.cm": "module \"alpha\"\n\npub func point() void {}\n",
+		"main.cm":        "module \"main\"\n\npub #define ZED 1\n\nfunc main() int {\n    return 0;\n}\n\nint count = 0;\n",
+	}
+	for rel, content := range files {
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mainPath := filepath.Join(root, "main.cm")
+	s := &server{rootPath: root, openDocs: map[string]string{mainPath: files["main.cm"]}}
+
+	// Exact matches first, then prefixes, then substrings; ties by name, then file
+	want := "point point point point_count draw_point"
+	for i := 0; i < 10; i++ {
+		got := strings.Join(symbolNames(t, s, s.workspaceSymbols, map[string]any{"query": "point"}), " ")
+		if got != want {
+			t.Fatalf("workspace symbols (run %d) = %q, want %q", i, got, want)
+		}
+	}
+
+	mainURI, err := fileURIFromPath(mainPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "ZED main count"
+	for i := 0; i < 10; i++ {
+		got := strings.Join(symbolNames(t, s, s.documentSymbols, map[string]any{"textDocument": map[string]any{"uri": mainURI}}), " ")
+		if got != want {
+			t.Fatalf("document symbols (run %d) = %q, want %q", i, got, want)
+		}
+	}
+}
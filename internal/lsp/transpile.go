@@ -1,12 +1,19 @@
 package lsp
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"sync"
 
+	"github.com/elijahmorgan/c_minus/internal/build"
 	"github.com/elijahmorgan/c_minus/internal/codegen"
+	"github.com/elijahmorgan/c_minus/internal/manifest"
 	"github.com/elijahmorgan/c_minus/internal/parser"
 	"github.com/elijahmorgan/c_minus/internal/paths"
 	"github.com/elijahmorgan/c_minus/internal/project"
@@ -18,49 +25,213 @@ type compileCommand struct {
 	Arguments []string `json:"arguments"`
 }
 
-func transpileWorkspace(proj *project.Project, openDocs map[string]string) (string, error) {
+// transpileCache remembers what was generated for each module so an edit only
+// regenerates the edited module instead of the whole workspace
+type transpileCache struct {
+	mu      sync.Mutex
+	modules map[string]*cachedModule // import path -> last transpile
+}
+
+type cachedModule struct {
+	fingerprint string         // Hash of the module's file paths and contents
+	files       []*parser.File // Parsed files, reused for imported declarations
+	header      []byte         // Public header as last generated
+}
+
+// reset forgets every module, forcing the next transpile to regenerate all of
+// them (e.g. after a build rewrote .c_minus from the files on disk)
+func (c *transpileCache) reset() {
+	c.mu.Lock()
+	c.modules = nil
+	c.mu.Unlock()
+}
+
+// transpileWorkspace generates C for the project into .c_minus, using the text
+// of open documents over the files on disk. With a cache, only modules whose
+// sources changed are regenerated, plus the direct importers of any module
+// whose public header changed. It returns the build directory and the import
+// paths of the regenerated modules.
+func transpileWorkspace(proj *project.Project, openDocs map[string]string, cache *transpileCache) (string, []string, error) {
 	buildDir := filepath.Join(proj.RootPath, ".c_minus")
 	if err := os.MkdirAll(buildDir, 0755); err != nil {
-		return "", err
+		return "", nil, err
+	}
+
+	// Generated names follow the scheme chosen in cm.mod
+	if err := paths.CheckMangling(proj.Mangling); err != nil {
+		return "", nil, err
+	}
+	n := projectNaming(proj)
+
+	if cache == nil {
+		cache = &transpileCache{}
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.modules == nil {
+		cache.modules = make(map[string]*cachedModule)
+	}
+	for importPath := range cache.modules {
+		if _, ok := proj.Modules[importPath]; !ok {
+			delete(cache.modules, importPath)
+		}
 	}
 
 	var cmds []compileCommand
+	dirty := make(map[string]bool)
+	// New cache entries are only stored once everything generated, so a
+	// failure part way leaves the modules it touched to be regenerated
+	fresh := make(map[string]*cachedModule)
 
+	parsed := make(map[string][]*parser.File, len(proj.Modules))
 	for _, mod := range proj.Modules {
-		parsedFiles := make([]*parser.File, 0, len(mod.Files))
-		for _, filePath := range mod.Files {
-			var f *parser.File
-			var err error
+		sources := make([]string, len(mod.Files))
+		for i, filePath := range mod.Files {
 			if content, ok := openDocs[filePath]; ok {
-				f, err = parser.ParseSource(content, filePath)
+				sources[i] = content
 			} else {
-				f, err = parser.ParseFile(filePath)
+				b, err := os.ReadFile(filePath)
+				if err != nil {
+					return "", nil, fmt.Errorf("failed to parse %s: failed to read file: %w", filePath, err)
+				}
+				sources[i] = string(b)
 			}
-			if err != nil {
-				return "", fmt.Errorf("failed to parse %s: %w", filePath, err)
-			}
-			parsedFiles = append(parsedFiles, f)
 
-			cFilePath := paths.ModuleCFilePath(buildDir, mod.ImportPath, filepath.Base(filePath))
+			cFilePath := n.ModuleCFilePath(buildDir, mod.ImportPath, filepath.Base(filePath))
 			cmds = append(cmds, compileCommand{
 				Directory: buildDir,
 				File:      cFilePath,
-				Arguments: []string{"cc", "-c", cFilePath, "-I", buildDir},
+				Arguments: []string{"cc", "-c", cFilePath, "-I", buildDir, "-std=" + build.DefaultCStandard},
 			})
 		}
 
-		if err := codegen.GenerateModule(mod, parsedFiles, buildDir); err != nil {
-			return "", fmt.Errorf("failed to generate code for module %s: %w", mod.ImportPath, err)
+		fp := moduleFingerprint(proj.Mangling, mod.Files, sources)
+		if cached, ok := cache.modules[mod.ImportPath]; ok && cached.fingerprint == fp && generatedOutputsExist(buildDir, n, mod) {
+			parsed[mod.ImportPath] = cached.files
+			continue
+		}
+
+		parsedFiles := make([]*parser.File, 0, len(mod.Files))
+		for i, filePath := range mod.Files {
+			f, err := parser.ParseSource(sources[i], filePath)
+			if err != nil {
+				return "", nil, fmt.Errorf("failed to parse %s: %w", filePath, err)
+			}
+			parsedFiles = append(parsedFiles, f)
+		}
+		parsed[mod.ImportPath] = parsedFiles
+		dirty[mod.ImportPath] = true
+
+		var header []byte
+		if old, ok := cache.modules[mod.ImportPath]; ok {
+			header = old.header
+		}
+		fresh[mod.ImportPath] = &cachedModule{fingerprint: fp, files: parsedFiles, header: header}
+	}
+
+	// Generated files are recorded for c_minus clean
+	m, err := manifest.Load(proj.RootPath, buildDir)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Generate changed modules first, then importers of any whose public
+	// header changed: enum types from the header affect how they transpile.
+	var regenerated []string
+	generate := func(mod *project.ModuleInfo) (bool, error) {
+		if err := codegen.GenerateModuleWithOptions(mod, parsed[mod.ImportPath], buildDir, codegen.Options{Imported: parsed, Naming: n, Manifest: m}); err != nil {
+			delete(cache.modules, mod.ImportPath)
+			return false, fmt.Errorf("failed to generate code for module %s: %w", mod.ImportPath, err)
+		}
+		regenerated = append(regenerated, mod.ImportPath)
+
+		header, _ := os.ReadFile(n.ModuleHeaderPath(buildDir, mod.ImportPath))
+		entry, ok := fresh[mod.ImportPath]
+		if !ok {
+			entry = new(cachedModule)
+			*entry = *cache.modules[mod.ImportPath]
+			fresh[mod.ImportPath] = entry
+		}
+		changed := !bytes.Equal(entry.header, header)
+		entry.header = header
+		return changed, nil
+	}
+
+	headerChanged := make(map[string]bool)
+	for _, importPath := range sortedKeys(dirty) {
+		changed, err := generate(proj.Modules[importPath])
+		if err != nil {
+			return "", nil, err
+		}
+		headerChanged[importPath] = changed
+	}
+	for _, mod := range proj.Modules {
+		if dirty[mod.ImportPath] {
+			continue
 		}
+		for _, imp := range mod.Imports {
+			if headerChanged[imp] {
+				if _, err := generate(mod); err != nil {
+					return "", nil, err
+				}
+				break
+			}
+		}
+	}
+
+	for importPath, entry := range fresh {
+		cache.modules[importPath] = entry
 	}
 
+	sort.Slice(cmds, func(i, j int) bool { return cmds[i].File < cmds[j].File })
 	b, err := json.MarshalIndent(cmds, "", "  ")
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 	if err := os.WriteFile(filepath.Join(buildDir, "compile_commands.json"), b, 0644); err != nil {
-		return "", err
+		return "", nil, err
+	}
+	if len(regenerated) > 0 {
+		m.Add(filepath.Join(buildDir, "compile_commands.json"))
+		if err := m.Save(); err != nil {
+			return "", nil, err
+		}
+	}
+
+	sort.Strings(regenerated)
+	return buildDir, regenerated, nil
+}
+
+// moduleFingerprint hashes everything a module's generated output depends on
+// apart from its imports: the mangling scheme and its files' paths and text
+func moduleFingerprint(mangling string, files, sources []string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00", mangling)
+	for i, f := range files {
+		fmt.Fprintf(h, "%s\x00%d\x00%s", f, len(sources[i]), sources[i])
 	}
+	return hex.EncodeToString(h.Sum(nil))
+}
 
-	return buildDir, nil
+// generatedOutputsExist reports whether the module's header and C files are
+// still in the build directory (a clean may have removed them)
+func generatedOutputsExist(buildDir string, n paths.Naming, mod *project.ModuleInfo) bool {
+	if _, err := os.Stat(n.ModuleHeaderPath(buildDir, mod.ImportPath)); err != nil {
+		return false
+	}
+	for _, f := range mod.Files {
+		if _, err := os.Stat(n.ModuleCFilePath(buildDir, mod.ImportPath, filepath.Base(f))); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
@@ -0,0 +1,238 @@
+package lsp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/elijahmorgan/c_minus/internal/project"
+)
+
+func TestTranspileWorkspaceRegeneratesChangedModules(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"cm.mod":  `module "incremental"`,
+		"a/a.cm":  "module \"a\"\n\npub func one() int {\n    return 1;\n}\n",
+		"b/b.cm":  "module \"b\"\n\npub func two() int {\n    return 2;\n}\n",
+		"main.cm": "module \"main\"\n\nimport \"a\"\nimport \"b\"\n\nfunc main() int {\n    return a.one() + b.two();\n}\n",
+	}
+	for rel, content := range files {
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	proj, err := project.Discover(root)
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+
+	cache := &transpileCache{}
+	open := map[string]string{}
+	step := func(name string, want ...string) {
+		t.Helper()
+		_, got, err := transpileWorkspace(proj, open, cache)
+		if err != nil {
+			t.Fatalf("%s: transpileWorkspace: %v", name, err)
+		}
+		if len(got) == 0 {
+			got = nil
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: regenerated %v, want %v", name, got, want)
+		}
+	}
+
+	step("first transpile", "a", "b", "main")
+	step("no changes")
+
+	// A body edit leaves b's header alone, so importers are untouched
+	open[filepath.Join(root, "b", "b.cm")] = "module \"b\"\n\npub func two() int {\n    return 1 + 1;\n}\n"
+	step("body edit", "b")
+
+	// A new public declaration changes a's header, so main is regenerated too
+	open[filepath.Join(root, "a", "a.cm")] = files["a/a.cm"] + "\npub enum Mode { FAST, SLOW };\n"
+	step("header change", "a", "main")
+
+	if err := os.Remove(filepath.Join(root, ".c_minus", "b_b.c")); err != nil {
+		t.Fatal(err)
+	}
+	step("missing output", "b")
+
+	cache.reset()
+	step("after reset", "a", "b", "main")
+}
+
+func TestTranspileWorkspaceKeepsImportersOfMultiImportModule(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"cm.mod":     `module "incremental"`,
+		"app/app.cm": "module \"app\"\n\nimport \"a\"\nimport \"b\"\nimport \"c\"\nimport \"d\"\n\npub func run() int {\n    return a.one() + b.one() + c.one() + d.one();\n}\n",
+		"main.cm":    "module \"main\"\n\nimport \"app\"\n\nfunc main() int {\n    return app.run();\n}\n",
+	}
+	for _, name := range []string{"a", "b", "c", "d"} {
+		files[name+"/"+name+".cm"] = "module \"" + name + "\"\n\npub func one() int {\n    return 1;\n}\n"
+	}
+	for rel, content := range files {
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	proj, err := project.Discover(root)
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+
+	cache := &transpileCache{}
+	open := map[string]string{}
+	if _, _, err := transpileWorkspace(proj, open, cache); err != nil {
+		t.Fatalf("first transpile: %v", err)
+	}
+
+	// Each body edit leaves app's header as it was, so main is not regenerated
+	appPath := filepath.Join(root, "app", "app.cm")
+	for i := range 5 {
+		open[appPath] = strings.Replace(files["app/app.cm"], "d.one();", fmt.Sprintf("d.one() + %d;", i), 1)
+		_, got, err := transpileWorkspace(proj, open, cache)
+		if err != nil {
+			t.Fatalf("edit %d: transpileWorkspace: %v", i, err)
+		}
+		if !reflect.DeepEqual(got, []string{"app"}) {
+			t.Fatalf("edit %d: regenerated %v, want [app]", i, got)
+		}
+	}
+}
+
+func TestTranspileWorkspaceRetriesAfterParseError(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"cm.mod":  `module "incremental"`,
+		"a/a.cm":  "module \"a\"\n\npub func one() int {\n    return 1;\n}\n",
+		"b/b.cm":  "module \"b\"\n\npub func two() int {\n    return 2;\n}\n",
+		"main.cm": "module \"main\"\n\nimport \"a\"\nimport \"b\"\n\nfunc main() int {\n    return a.one() + b.two();\n}\n",
+	}
+	for rel, content := range files {
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	proj, err := project.Discover(root)
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+
+	cache := &transpileCache{}
+	open := map[string]string{}
+	if _, _, err := transpileWorkspace(proj, open, cache); err != nil {
+		t.Fatalf("transpileWorkspace: %v", err)
+	}
+
+	// Edit a while b does not parse. Modules are visited in map order, so
+	// fail a few times to also cover a being parsed before b.
+	open[filepath.Join(root, "a", "a.cm")] = strings.Replace(files["a/a.cm"], "return 1;", "return 11;", 1)
+	open[filepath.Join(root, "b", "b.cm")] = "module \"b\"\n\npub func two( int {\n"
+	for range 8 {
+		if _, _, err := transpileWorkspace(proj, open, cache); err == nil {
+			t.Fatalf("expected b's parse error")
+		}
+	}
+
+	delete(open, filepath.Join(root, "b", "b.cm"))
+	if _, _, err := transpileWorkspace(proj, open, cache); err != nil {
+		t.Fatalf("transpileWorkspace: %v", err)
+	}
+	c, err := os.ReadFile(filepath.Join(root, ".c_minus", "a_a.c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(c), "return 11;") {
+		t.Errorf("expected a's edit to be generated once b parses, got:\n%s", c)
+	}
+}
+
+func TestRefreshFileSyncsRegeneratedImporters(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"cm.mod":  `module "incremental"`,
+		"a/a.cm":  "module \"a\"\n\npub func one() int {\n    return 1;\n}\n",
+		"b/b.cm":  "module \"b\"\n\npub func two() int {\n    return 2;\n}\n",
+		"main.cm": "module \"main\"\n\nimport \"a\"\n\nfunc main() int {\n    return a.one();\n}\n",
+	}
+	for rel, content := range files {
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	aPath, bPath, mainPath := filepath.Join(root, "a", "a.cm"), filepath.Join(root, "b", "b.cm"), filepath.Join(root, "main.cm")
+
+	var clangdOut bytes.Buffer
+	s := &server{
+		conn:        newJSONRPCConn(&bytes.Buffer{}, &bytes.Buffer{}),
+		clangd:      &clangdProxy{conn: newJSONRPCConn(&bytes.Buffer{}, &clangdOut)},
+		openDocs:    map[string]string{},
+		openedCDocs: make(map[string]int),
+		lineMaps:    make(map[string]*lineMapper),
+	}
+	for _, p := range []string{mainPath, bPath} {
+		if err := s.refreshFile(context.Background(), p); err != nil {
+			t.Fatalf("refresh %s: %v", p, err)
+		}
+	}
+	mainC := filepath.Join(root, ".c_minus", "main_main.c")
+	s.lineMaps[mainC] = &lineMapper{}
+	clangdOut.Reset()
+
+	// A new public declaration changes a's header, so main is regenerated and
+	// clangd gets its new text; b is untouched
+	s.openDocs[aPath] = files["a/a.cm"] + "\npub enum Mode { FAST, SLOW };\n"
+	if err := s.refreshFile(context.Background(), aPath); err != nil {
+		t.Fatalf("refresh a: %v", err)
+	}
+
+	r := newJSONRPCConn(&clangdOut, nil)
+	var sent []string
+	for {
+		msg, err := r.readMessage()
+		if err != nil {
+			break
+		}
+		var params struct {
+			TextDocument struct {
+				URI     string `json:"uri"`
+				Version int    `json:"version"`
+			} `json:"textDocument"`
+		}
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		sent = append(sent, fmt.Sprintf("%s %s %d", msg.Method, filepath.Base(params.TextDocument.URI), params.TextDocument.Version))
+	}
+	want := []string{"textDocument/didChange main_main.c 2", "textDocument/didOpen a_a.c 1"}
+	if !reflect.DeepEqual(sent, want) {
+		t.Errorf("clangd got %v, want %v", sent, want)
+	}
+	if _, ok := s.lineMaps[mainC]; ok {
+		t.Errorf("expected main_main.c's line map to be dropped")
+	}
+}
@@ -0,0 +1,159 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/elijahmorgan/c_minus/internal/project"
+)
+
+// LSP FileChangeType values
+const (
+	fileCreated = 1
+	fileChanged = 2
+	fileDeleted = 3
+)
+
+// didChangeWatchedFiles handles files changing on disk outside the editor
+// (git checkouts, edits to files that are not open). Generated C and line
+// maps are invalidated, the project is re-discovered, and every open document
+// in an impacted module is re-transpiled so its diagnostics are current.
+func (s *server) didChangeWatchedFiles(ctx context.Context, msg jsonrpcMessage) error {
+	var params struct {
+		Changes []struct {
+			URI  string `json:"uri"`
+			Type int    `json:"type"`
+		} `json:"changes"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return err
+	}
+
+	var changed, deleted []string
+	for _, c := range params.Changes {
+		p, err := filePathFromURI(c.URI)
+		if err != nil {
+			continue
+		}
+		p, err = filepath.Abs(p)
+		if err != nil {
+			continue
+		}
+		if filepath.Ext(p) != ".cm" && filepath.Base(p) != "cm.mod" {
+			continue
+		}
+		changed = append(changed, p)
+		if c.Type == fileDeleted {
+			deleted = append(deleted, p)
+		}
+	}
+	if len(changed) == 0 || s.clangd == nil {
+		return nil
+	}
+
+	// Line maps are rebuilt lazily, so dropping all of them is cheap and
+	// avoids tracking which generated files a change touched.
+	s.lineMapsMu.Lock()
+	s.lineMaps = make(map[string]*lineMapper)
+	s.lineMapsMu.Unlock()
+
+	s.mu.Lock()
+	open := make([]string, 0, len(s.openDocs))
+	for p := range s.openDocs {
+		open = append(open, p)
+	}
+	s.mu.Unlock()
+
+	startDir := s.rootPath
+	if startDir == "" {
+		startDir = filepath.Dir(changed[0])
+	}
+	proj, err := project.Discover(startDir)
+	if err != nil {
+		for _, p := range open {
+			_ = s.publishParserError(p, err)
+		}
+		return nil
+	}
+
+	for _, p := range deleted {
+		s.forgetGeneratedFile(proj, p)
+	}
+
+	for _, p := range impactedOpenDocs(proj, changed, open) {
+		if err := s.refreshFile(ctx, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// forgetGeneratedFile removes the generated C for a deleted .cm file and
+// closes it in clangd so stale diagnostics and symbols go away.
+func (s *server) forgetGeneratedFile(proj *project.Project, cmPath string) {
+	modPath, err := projectModuleImportPath(proj, cmPath)
+	if err != nil {
+		return
+	}
+	cPath := generatedCPath(proj, modPath, filepath.Base(cmPath))
+
+	s.mu.Lock()
+	_, wasOpen := s.openedCDocs[cPath]
+	delete(s.openedCDocs, cPath)
+	s.mu.Unlock()
+
+	if wasOpen {
+		if cURI, err := fileURIFromPath(cPath); err == nil {
+			_ = s.clangd.notify("textDocument/didClose", map[string]any{
+				"textDocument": map[string]any{"uri": cURI},
+			})
+		}
+	}
+	_ = os.Remove(cPath)
+}
+
+// impactedOpenDocs returns the open documents affected by changes to the
+// given paths: documents in a changed module or in any module that imports
+// one, directly or transitively. A change to cm.mod affects every document.
+func impactedOpenDocs(proj *project.Project, changed []string, open []string) []string {
+	all := false
+	dirty := make(map[string]bool) // module directories
+	for _, p := range changed {
+		if filepath.Base(p) == "cm.mod" {
+			all = true
+			break
+		}
+		dirty[filepath.Dir(p)] = true
+	}
+
+	if !all {
+		// Propagate to importers until nothing new is marked.
+		for grew := true; grew; {
+			grew = false
+			for _, mod := range proj.Modules {
+				if dirty[mod.DirPath] {
+					continue
+				}
+				for _, imp := range mod.Imports {
+					if dep, ok := proj.Modules[imp]; ok && dirty[dep.DirPath] {
+						dirty[mod.DirPath] = true
+						grew = true
+						break
+					}
+				}
+			}
+		}
+	}
+
+	var out []string
+	for _, p := range open {
+		if all || dirty[filepath.Dir(p)] {
+			out = append(out, p)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,43 @@
+package lsp
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/elijahmorgan/c_minus/internal/project"
+)
+
+func TestImpactedOpenDocs(t *testing.T) {
+	root := t.TempDir()
+	proj := &project.Project{
+		RootPath: root,
+		Modules: map[string]*project.ModuleInfo{
+			"main":  {ImportPath: "main", DirPath: root, Imports: []string{"app"}},
+			"app":   {ImportPath: "app", DirPath: filepath.Join(root, "app"), Imports: []string{"math"}},
+			"math":  {ImportPath: "math", DirPath: filepath.Join(root, "math")},
+			"other": {ImportPath: "other", DirPath: filepath.Join(root, "other")},
+		},
+	}
+	mainCm := filepath.Join(root, "main.cm")
+	appCm := filepath.Join(root, "app", "app.cm")
+	mathCm := filepath.Join(root, "math", "vec.cm")
+	otherCm := filepath.Join(root, "other", "other.cm")
+	open := []string{otherCm, mathCm, appCm, mainCm}
+
+	got := impactedOpenDocs(proj, []string{filepath.Join(root, "math", "new.cm")}, open)
+	want := []string{appCm, mainCm, mathCm}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("math change: got %v, want %v", got, want)
+	}
+
+	got = impactedOpenDocs(proj, []string{filepath.Join(root, "other", "x.cm")}, open)
+	if !reflect.DeepEqual(got, []string{otherCm}) {
+		t.Errorf("other change: got %v", got)
+	}
+
+	got = impactedOpenDocs(proj, []string{filepath.Join(root, "cm.mod")}, open)
+	if len(got) != len(open) {
+		t.Errorf("cm.mod change should affect all open docs, got %v", got)
+	}
+}
@@ -0,0 +1,153 @@
+// Package manifest records the files c_minus generates, so that clean can
+// remove exactly those and leave anything else in the build directory alone.
+package manifest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// FileName is the manifest's name inside the build directory
+const FileName = ".manifest"
+
+// Manifest is the set of generated files of a project. Paths are stored
+// relative to the project root when they are inside it. It is safe for
+// concurrent use, and a nil *Manifest ignores Add.
+type Manifest struct {
+	mu    sync.Mutex
+	root  string
+	path  string
+	files map[string]bool
+}
+
+// Load reads the manifest in buildDir, or starts an empty one if there is
+// none. Entries from earlier builds are kept, so files written by a build
+// with other options are still cleaned.
+func Load(root, buildDir string) (*Manifest, error) {
+	m := &Manifest{root: root, path: filepath.Join(buildDir, FileName), files: make(map[string]bool)}
+
+	f, err := os.Open(m.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			m.files[line] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	return m, nil
+}
+
+// Add records a generated file
+func (m *Manifest) Add(path string) {
+	if m == nil {
+		return
+	}
+	if rel, err := filepath.Rel(m.root, path); err == nil && !strings.HasPrefix(rel, "..") {
+		path = filepath.ToSlash(rel)
+	}
+	m.mu.Lock()
+	m.files[path] = true
+	m.mu.Unlock()
+}
+
+// Files returns the recorded files as absolute paths, sorted
+func (m *Manifest) Files() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	files := make([]string, 0, len(m.files))
+	for f := range m.files {
+		files = append(files, m.abs(f))
+	}
+	sort.Strings(files)
+	return files
+}
+
+func (m *Manifest) abs(entry string) string {
+	if filepath.IsAbs(entry) {
+		return entry
+	}
+	return filepath.Join(m.root, filepath.FromSlash(entry))
+}
+
+// Save writes the manifest, dropping entries whose files no longer exist
+func (m *Manifest) Save() error {
+	m.mu.Lock()
+	entries := make([]string, 0, len(m.files))
+	for f := range m.files {
+		if _, err := os.Stat(m.abs(f)); err == nil {
+			entries = append(entries, f)
+		}
+	}
+	m.mu.Unlock()
+	sort.Strings(entries)
+
+	var sb strings.Builder
+	sb.WriteString("# Files generated by c_minus; c_minus clean removes these. Do not edit.\n")
+	for _, e := range entries {
+		sb.WriteString(e + "\n")
+	}
+	if err := os.WriteFile(m.path, []byte(sb.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// Clean removes the files listed in buildDir's manifest and the manifest
+// itself, then any directories under buildDir (and buildDir) left empty.
+// Files the manifest does not list are never removed. It returns the
+// removed files.
+func Clean(root, buildDir string) ([]string, error) {
+	m, err := Load(root, buildDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for _, f := range m.Files() {
+		err := os.Remove(f)
+		if err == nil {
+			removed = append(removed, f)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return removed, fmt.Errorf("failed to remove %s: %w", f, err)
+		}
+	}
+	if err := os.Remove(m.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return removed, fmt.Errorf("failed to remove manifest: %w", err)
+	}
+
+	removeEmptyDirs(buildDir)
+	return removed, nil
+}
+
+// removeEmptyDirs removes dir and its subdirectories, deepest first, when
+// they are empty
+func removeEmptyDirs(dir string) {
+	var dirs []string
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.IsDir() {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	for i := len(dirs) - 1; i >= 0; i-- {
+		_ = os.Remove(dirs[i]) // Fails, and is kept, unless empty
+	}
+}
@@ -0,0 +1,65 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCleanRemovesOnlyRecordedFiles(t *testing.T) {
+	root := t.TempDir()
+	buildDir := filepath.Join(root, ".c_minus")
+	write := func(rel string) string {
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	m, err := Load(root, buildDir)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	for _, rel := range []string{".c_minus/main.h", ".c_minus/obj/math/vec.o", "app"} {
+		m.Add(write(rel))
+	}
+	m.Add(filepath.Join(buildDir, "never_written.c"))
+	notes := write(".c_minus/notes.txt")
+	if err := m.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	// A later build adds to the manifest instead of replacing it
+	m, err = Load(root, buildDir)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	m.Add(write(".c_minus/util.h"))
+	if err := m.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	// Entries for files that were never written are dropped on save
+	if got := len(m.Files()); got != 4 {
+		t.Errorf("expected 4 entries, got %v", m.Files())
+	}
+
+	removed, err := Clean(root, buildDir)
+	if err != nil {
+		t.Fatalf("Clean: %v", err)
+	}
+	if len(removed) != 4 {
+		t.Errorf("expected 4 files removed, got %v", removed)
+	}
+	for _, rel := range []string{".c_minus/main.h", ".c_minus/obj", ".c_minus/util.h", ".c_minus/.manifest", "app"} {
+		if _, err := os.Stat(filepath.Join(root, rel)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed, stat returned %v", rel, err)
+		}
+	}
+	if _, err := os.Stat(notes); err != nil {
+		t.Errorf("expected an unrecorded file to survive clean: %v", err)
+	}
+}
@@ -4,23 +4,68 @@ import (
 	"fmt"
 	"os"
 	"strings"
+
+	"github.com/elijahmorgan/c_minus/internal/paths"
 )
 
 // File represents a parsed .cm file
 type File struct {
 	Module    *ModuleDecl
+	ModuleDoc string // Doc comment directly above the module declaration
 	Imports   []*Import
 	CImports  []*CImport
 	Decls     []*Decl
-	BuildTags [][]string // Each inner slice is an OR group, outer slice is AND
-	CGoFlags  []*CGoFlag // #cgo directives for compiler/linker flags
+	BuildTags [][]string       // Each inner slice is an OR group, outer slice is AND
+	CGoFlags  []*CGoFlag       // #cgo directives for compiler/linker flags
+	Ignores   map[int][]string // Line of a declaration or import -> rules silenced by "// cminus:ignore"
+}
+
+// ignorePrefix starts a comment that silences warnings for the item on the next line
+const ignorePrefix = "// cminus:ignore"
+
+// attrPrefix starts a comment giving a C attribute for the function or global
+// on the next line, e.g. "// cminus:attr __attribute__((deprecated))"
+const attrPrefix = "// cminus:attr"
+
+// Ignored reports whether warnings for rule are silenced for the item at line
+func (f *File) Ignored(line int, rule string) bool {
+	for _, r := range f.Ignores[line] {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// extractIgnores maps each "// cminus:ignore rule..." comment to the line of the
+// next item below it; doc comments may sit between the two. Rules may be
+// separated by spaces or commas.
+func extractIgnores(lines []string) map[int][]string {
+	ignores := make(map[int][]string)
+	var pending []string
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, ignorePrefix) {
+			rules := strings.FieldsFunc(strings.TrimPrefix(line, ignorePrefix), func(r rune) bool {
+				return r == ',' || r == ' ' || r == '\t'
+			})
+			pending = append(pending, rules...)
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "//") || len(pending) == 0 {
+			continue
+		}
+		ignores[i+1] = append(ignores[i+1], pending...)
+		pending = nil
+	}
+	return ignores
 }
 
 // CGoFlag represents a #cgo directive for compiler or linker flags
 type CGoFlag struct {
 	Platform string // Optional platform constraint (e.g., "linux", "darwin", "windows", or empty for all)
-	Type     string // "CFLAGS" or "LDFLAGS"
-	Flags    string // The actual flags (e.g., "-I/usr/local/include" or "-lcurl")
+	Type     string // "CFLAGS", "LDFLAGS", or "pkg-config"
+	Flags    string // The actual flags (e.g., "-I/usr/local/include" or "-lcurl"), or package names for pkg-config
 }
 
 // ModuleDecl represents a module declaration
@@ -31,31 +76,68 @@ type ModuleDecl struct {
 // Import represents an import statement for c_minus modules
 type Import struct {
 	Path string
+	Line int // Line number in source file (1-based)
 }
 
 // CImport represents a C header import statement
 type CImport struct {
 	Path string // e.g., "stdio.h"
+	Line int    // Line number in source file (1-based)
 }
 
 // Decl represents a top-level declaration (function, type, etc.)
 type Decl struct {
-	Function *FuncDecl
-	Struct   *StructDecl
-	Union    *UnionDecl
-	Enum     *EnumDecl
-	Typedef  *TypedefDecl
-	Global   *GlobalDecl
-	Define   *DefineDecl
+	Function  *FuncDecl
+	Struct    *StructDecl
+	Union     *UnionDecl
+	Enum      *EnumDecl
+	Typedef   *TypedefDecl
+	Global    *GlobalDecl
+	Define    *DefineDecl
+	Pragma    *PragmaDecl
+	Directive *DirectiveDecl
+	Use       *UseDecl
+}
+
+// DirectiveDecl represents a top-level preprocessor directive passed through
+// to the generated .c file: #error or #warning, or a conditional (#if,
+// #ifdef, #ifndef, #elif, #else, #endif) that can guard them
+type DirectiveDecl struct {
+	Name string // Directive name without '#', e.g. "error" or "ifdef"
+	Text string // Full directive, e.g. "#error \"needs a 64-bit target\""
+	Line int    // Line number in source file (1-based)
+}
+
+// Conditional reports whether the directive is part of an #if block
+func (d *DirectiveDecl) Conditional() bool {
+	return d.Name != "error" && d.Name != "warning"
+}
+
+// UseDecl re-exports a function of an imported module: "pub use math.add;"
+// makes add callable through this module
+type UseDecl struct {
+	Module string // Import prefix, e.g. "math"
+	Name   string // Re-exported function, e.g. "add"
+	Line   int    // Line number in source file (1-based)
+}
+
+// PragmaDecl represents a top-level #pragma directive, passed through verbatim
+type PragmaDecl struct {
+	Text string // Full directive, e.g. "#pragma pack(push, 1)"
+	Line int    // Line number in source file (1-based)
 }
 
 // GlobalDecl represents a global variable declaration
 type GlobalDecl struct {
 	Public     bool
 	Static     bool   // File-private (not visible to other files in module)
+	Extern     bool   // Declared only: defined elsewhere (e.g. in C linked with #cgo), so no definition is emitted
+	Align      string // Alignment specifier (optional), e.g. "_Alignas(64)"
 	Type       string // e.g., "int", "char*", "const char*"
 	Name       string
-	Value      string // Initial value (optional, empty if uninitialized)
+	Array      string   // Array dimensions after the name (optional), e.g. "[]" or "[4][4]"
+	Value      string   // Initial value (optional, empty if uninitialized)
+	Attrs      []string // C attributes from "// cminus:attr" comments, emitted before the declaration
 	DocComment string
 	Line       int // Line number in source file (1-based)
 }
@@ -66,17 +148,20 @@ type DefineDecl struct {
 	Name       string
 	Value      string // The constant value (e.g., "4096", `"1.0.0"`)
 	DocComment string
+	Line       int // Line number in source file (1-based)
 }
 
 // FuncDecl represents a function declaration
 type FuncDecl struct {
 	Public     bool
+	Inline     bool // static inline definition emitted into the module's header
 	ReturnType string
 	Name       string
 	Params     []*Param
 	Body       string
-	DocComment string // Go-style doc comment (comments immediately preceding the declaration)
-	Line       int    // Line number in source file (1-based)
+	Attrs      []string // C attributes from "// cminus:attr" comments, emitted before the declaration
+	DocComment string   // Go-style doc comment (comments immediately preceding the declaration)
+	Line       int      // Line number in source file (1-based)
 }
 
 // Param represents a function parameter
@@ -88,28 +173,34 @@ type Param struct {
 // StructDecl represents a struct type declaration
 type StructDecl struct {
 	Public     bool
+	Opaque     bool // pub opaque struct: only an incomplete type is exported
+	Packed     bool // packed struct: fields are laid out without padding
 	Name       string
 	Body       string // Opaque body: everything between { and }
 	Semi       bool
 	DocComment string // Go-style doc comment (comments immediately preceding the declaration)
+	Line       int    // Line number in source file (1-based)
 }
 
 // UnionDecl represents a union type declaration
 type UnionDecl struct {
 	Public     bool
+	Packed     bool // packed union
 	Name       string
 	Body       string // Opaque body: everything between { and }
 	Semi       bool
 	DocComment string // Go-style doc comment (comments immediately preceding the declaration)
+	Line       int    // Line number in source file (1-based)
 }
 
 // EnumDecl represents an enum type declaration
 type EnumDecl struct {
 	Public     bool
-	Name       string
+	Name       string // Empty for an anonymous enum, which only declares constants
 	Body       string // Opaque body: everything between { and }
 	Semi       bool
 	DocComment string // Go-style doc comment (comments immediately preceding the declaration)
+	Line       int    // Line number in source file (1-based)
 }
 
 // TypedefDecl represents a typedef declaration
@@ -118,6 +209,35 @@ type TypedefDecl struct {
 	Body       string // Everything from typedef to ;
 	Semi       bool
 	DocComment string // Go-style doc comment (comments immediately preceding the declaration)
+	Line       int    // Line number in source file (1-based)
+}
+
+// ParseError is a parse failure with the source position it applies to
+type ParseError struct {
+	File string
+	Line int // 1-based line number (0 if not tied to a line)
+	Col  int // 1-based column (0 if unknown)
+	Msg  string
+}
+
+// Error formats the error as "file:line:col: msg", omitting unknown positions
+func (e *ParseError) Error() string {
+	switch {
+	case e.Line > 0 && e.Col > 0:
+		return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Col, e.Msg)
+	case e.Line > 0:
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+	default:
+		return fmt.Sprintf("%s: %s", e.File, e.Msg)
+	}
+}
+
+// newLineError creates a ParseError for the declaration starting at lines[i],
+// positioned at the line's first non-blank character
+func newLineError(path string, lines []string, i int, err error) *ParseError {
+	line := lines[i]
+	col := len(line) - len(strings.TrimLeft(line, " \t")) + 1
+	return &ParseError{File: path, Line: i + 1, Col: col, Msg: err.Error()}
 }
 
 // Manual parser implementation - no Participle code generation needed
@@ -133,9 +253,12 @@ func ParseFile(path string) (*File, error) {
 }
 
 // ParseSource parses C-minus source code provided as a string.
+// A leading UTF-8 byte order mark, written by some Windows editors, is ignored.
 //
 // This is primarily used by the LSP server for in-memory documents.
 func ParseSource(source string, path string) (*File, error) {
+	source = strings.TrimPrefix(source, "\ufeff")
+
 	// For now, use a simpler manual parser until we refine Participle grammar.
 	return manualParse(source, path)
 }
@@ -151,6 +274,7 @@ func manualParse(source string, path string) (*File, error) {
 	}
 
 	lines := strings.Split(source, "\n")
+	file.Ignores = extractIgnores(lines)
 
 	// Phase 0: Extract build tags (must be before module declaration)
 	for _, line := range lines {
@@ -185,8 +309,11 @@ func manualParse(source string, path string) (*File, error) {
 	}
 
 	// Phase 1: Extract module, imports, and cimports
-	for _, line := range lines {
+	for i, line := range lines {
 		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "module") || strings.HasPrefix(line, "import") || strings.HasPrefix(line, "cimport") {
+			line = StripLineComment(line)
+		}
 
 		if strings.HasPrefix(line, "module") {
 			parts := strings.Fields(line)
@@ -194,6 +321,13 @@ func manualParse(source string, path string) (*File, error) {
 				file.Module = &ModuleDecl{
 					Path: strings.Trim(parts[1], `"`),
 				}
+				if len(parts) > 2 {
+					return nil, newLineError(path, lines, i, fmt.Errorf("module path %s contains whitespace", strings.Join(parts[1:], " ")))
+				}
+				if err := paths.CheckModulePath(file.Module.Path); err != nil {
+					return nil, newLineError(path, lines, i, err)
+				}
+				file.ModuleDoc = moduleDocComment(lines[:i])
 			}
 		}
 
@@ -203,6 +337,7 @@ func manualParse(source string, path string) (*File, error) {
 			if len(parts) >= 2 {
 				file.CImports = append(file.CImports, &CImport{
 					Path: strings.Trim(parts[1], `"`),
+					Line: i + 1,
 				})
 			}
 		} else if strings.HasPrefix(line, "import") {
@@ -210,27 +345,49 @@ func manualParse(source string, path string) (*File, error) {
 			if len(parts) >= 2 {
 				file.Imports = append(file.Imports, &Import{
 					Path: strings.Trim(parts[1], `"`),
+					Line: i + 1,
 				})
 			}
 		}
 	}
 
 	if file.Module == nil {
-		return nil, fmt.Errorf("%s: no module declaration found", path)
+		return nil, &ParseError{File: path, Msg: "no module declaration found"}
 	}
 
 	// Phase 2: Extract declarations (functions and types)
 	i := 0
 	var pendingDocComment []string // Collects consecutive comment lines
+	var pendingAttrs []string      // Attributes for the next declaration
 	for i < len(lines) {
 		line := strings.TrimSpace(lines[i])
 
-		// Handle empty lines - they break doc comment association
+		// Handle empty lines - they break doc comment and attribute association
 		if line == "" {
 			pendingDocComment = nil // Reset pending doc comments on blank line
+			pendingAttrs = nil
+			i++
+			continue
+		}
+
+		// Suppression comments are directives, not documentation
+		if strings.HasPrefix(line, ignorePrefix) {
+			i++
+			continue
+		}
+
+		// So are attributes; they attach to the declaration below
+		if strings.HasPrefix(line, attrPrefix) {
+			attr := strings.TrimSpace(strings.TrimPrefix(line, attrPrefix))
+			if attr == "" {
+				return nil, newLineError(path, lines, i, fmt.Errorf("cminus:attr requires an attribute"))
+			}
+			pendingAttrs = append(pendingAttrs, attr)
 			i++
 			continue
 		}
+		attrLine := i
+		declCount := len(file.Decls)
 
 		// Handle comments - collect them as potential doc comments
 		if strings.HasPrefix(line, "//") {
@@ -243,11 +400,35 @@ func manualParse(source string, path string) (*File, error) {
 		docComment := buildDocComment(pendingDocComment)
 		pendingDocComment = nil // Reset after use
 
-		// Check for function declaration
-		if strings.Contains(line, "func") {
+		// Pragmas first: their text may contain any keyword
+		if strings.HasPrefix(line, "#pragma") {
+			file.Decls = append(file.Decls, &Decl{Pragma: &PragmaDecl{Text: line, Line: i + 1}})
+			i++
+		} else if name := directiveName(line); name != "" {
+			file.Decls = append(file.Decls, &Decl{Directive: &DirectiveDecl{Name: name, Text: line, Line: i + 1}})
+			i++
+		} else if strings.HasPrefix(line, "pub use ") {
+			useDecl, err := parseUse(line)
+			if err != nil {
+				return nil, newLineError(path, lines, i, err)
+			}
+			useDecl.Line = i + 1
+			file.Decls = append(file.Decls, &Decl{Use: useDecl})
+			i++
+		} else if strings.HasPrefix(strings.TrimPrefix(line, "pub "), "typedef ") {
+			// Typedef before the keyword checks: its body may name struct/enum/func types
+			typedefDecl, consumed, err := parseTypedef(lines, i)
+			if err != nil {
+				return nil, newLineError(path, lines, i, err)
+			}
+			typedefDecl.DocComment = docComment
+			typedefDecl.Line = i + 1
+			file.Decls = append(file.Decls, &Decl{Typedef: typedefDecl})
+			i += consumed
+		} else if isFuncDecl(line) {
 			funcDecl, consumed, err := parseFunction(lines, i, source)
 			if err != nil {
-				return nil, fmt.Errorf("%s:%d: %w", path, i+1, err)
+				return nil, newLineError(path, lines, i, err)
 			}
 			funcDecl.DocComment = docComment
 			funcDecl.Line = i + 1 // 1-based line number
@@ -256,47 +437,54 @@ func manualParse(source string, path string) (*File, error) {
 		} else if strings.Contains(line, "struct") {
 			structDecl, consumed, err := parseStruct(lines, i)
 			if err != nil {
-				return nil, fmt.Errorf("%s:%d: %w", path, i+1, err)
+				return nil, newLineError(path, lines, i, err)
 			}
 			structDecl.DocComment = docComment
+			structDecl.Line = i + 1
 			file.Decls = append(file.Decls, &Decl{Struct: structDecl})
 			i += consumed
 		} else if strings.Contains(line, "union") {
 			unionDecl, consumed, err := parseUnion(lines, i)
 			if err != nil {
-				return nil, fmt.Errorf("%s:%d: %w", path, i+1, err)
+				return nil, newLineError(path, lines, i, err)
 			}
 			unionDecl.DocComment = docComment
+			unionDecl.Line = i + 1
 			file.Decls = append(file.Decls, &Decl{Union: unionDecl})
 			i += consumed
 		} else if strings.Contains(line, "enum") {
 			enumDecl, consumed, err := parseEnum(lines, i)
 			if err != nil {
-				return nil, fmt.Errorf("%s:%d: %w", path, i+1, err)
+				return nil, newLineError(path, lines, i, err)
 			}
 			enumDecl.DocComment = docComment
+			enumDecl.Line = i + 1
 			file.Decls = append(file.Decls, &Decl{Enum: enumDecl})
 			i += consumed
 		} else if strings.Contains(line, "typedef") {
 			typedefDecl, consumed, err := parseTypedef(lines, i)
 			if err != nil {
-				return nil, fmt.Errorf("%s:%d: %w", path, i+1, err)
+				return nil, newLineError(path, lines, i, err)
 			}
 			typedefDecl.DocComment = docComment
+			typedefDecl.Line = i + 1
 			file.Decls = append(file.Decls, &Decl{Typedef: typedefDecl})
 			i += consumed
 		} else if isDefineDecl(line) {
 			defineDecl, consumed, err := parseDefine(lines, i)
 			if err != nil {
-				return nil, fmt.Errorf("%s:%d: %w", path, i+1, err)
+				return nil, newLineError(path, lines, i, err)
 			}
 			defineDecl.DocComment = docComment
+			defineDecl.Line = i + 1
 			file.Decls = append(file.Decls, &Decl{Define: defineDecl})
 			i += consumed
+		} else if name, ok := funcPointerGlobalName(line); ok {
+			return nil, newLineError(path, lines, i, fmt.Errorf("global %s declares a function pointer in C syntax; name its type with a typedef (typedef void (*Handler)();) and declare Handler %s", name, name))
 		} else if isGlobalVariableDecl(line) {
 			globalDecl, consumed, err := parseGlobal(lines, i)
 			if err != nil {
-				return nil, fmt.Errorf("%s:%d: %w", path, i+1, err)
+				return nil, newLineError(path, lines, i, err)
 			}
 			globalDecl.DocComment = docComment
 			globalDecl.Line = i + 1 // 1-based line number
@@ -305,22 +493,164 @@ func manualParse(source string, path string) (*File, error) {
 		} else {
 			i++
 		}
+
+		if len(file.Decls) > declCount {
+			decl := file.Decls[len(file.Decls)-1]
+			if err := checkDeclNames(decl); err != nil {
+				return nil, newLineError(path, lines, declLine(decl)-1, err)
+			}
+		}
+
+		if len(pendingAttrs) > 0 && len(file.Decls) > declCount {
+			switch decl := file.Decls[len(file.Decls)-1]; {
+			case decl.Function != nil:
+				decl.Function.Attrs = pendingAttrs
+			case decl.Global != nil:
+				decl.Global.Attrs = pendingAttrs
+			default:
+				return nil, newLineError(path, lines, attrLine, fmt.Errorf("cminus:attr applies only to functions and global variables"))
+			}
+			pendingAttrs = nil
+		}
 	}
 
 	return file, nil
 }
 
+// cKeywords are the C11 keywords, which no declaration may be named
+var cKeywords = map[string]bool{
+	"auto": true, "break": true, "case": true, "char": true, "const": true,
+	"continue": true, "default": true, "do": true, "double": true, "else": true,
+	"enum": true, "extern": true, "float": true, "for": true, "goto": true,
+	"if": true, "inline": true, "int": true, "long": true, "register": true,
+	"restrict": true, "return": true, "short": true, "signed": true, "sizeof": true,
+	"static": true, "struct": true, "switch": true, "typedef": true, "union": true,
+	"unsigned": true, "void": true, "volatile": true, "while": true,
+	"_Alignas": true, "_Alignof": true, "_Atomic": true, "_Bool": true, "_Complex": true,
+	"_Generic": true, "_Imaginary": true, "_Noreturn": true, "_Static_assert": true,
+	"_Thread_local": true,
+}
+
+// IsCKeyword reports whether name is a C keyword
+func IsCKeyword(name string) bool {
+	return cKeywords[name]
+}
+
+// checkDeclNames returns an error if a declaration, or one of a function's
+// parameters, is named by a C keyword or by something that is not a C
+// identifier ("int 2x")
+func checkDeclNames(decl *Decl) error {
+	kind, name := declName(decl)
+	if IsCKeyword(name) {
+		return fmt.Errorf("%s name %q is a reserved C keyword", kind, name)
+	}
+	if (decl.Function != nil || decl.Global != nil) && !isIdentifier(declaratorName(name)) {
+		return fmt.Errorf("%s name %q is not a valid C identifier", kind, name)
+	}
+	if fn := decl.Function; fn != nil {
+		for _, p := range fn.Params {
+			if p.Type == "..." || p.Name == "" {
+				continue
+			}
+			ident := declaratorName(p.Name)
+			if IsCKeyword(ident) {
+				return fmt.Errorf("parameter name %q of %s is a reserved C keyword", ident, fn.Name)
+			}
+			if !isIdentifier(ident) {
+				return fmt.Errorf("parameter name %q of %s is not a valid C identifier", p.Name, fn.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// declaratorName strips the pointer stars and array dimensions that C
+// lets a name carry: "*argv[]" is named argv
+func declaratorName(name string) string {
+	name, _, _ = strings.Cut(strings.TrimLeft(name, "*"), "[")
+	return strings.TrimSpace(name)
+}
+
+// declName returns the kind and name of a named declaration, or empty strings
+func declName(decl *Decl) (kind, name string) {
+	switch {
+	case decl.Function != nil:
+		return "function", decl.Function.Name
+	case decl.Global != nil:
+		return "global", decl.Global.Name
+	case decl.Struct != nil:
+		return "struct", decl.Struct.Name
+	case decl.Union != nil:
+		return "union", decl.Union.Name
+	case decl.Enum != nil:
+		return "enum", decl.Enum.Name
+	case decl.Define != nil:
+		return "#define", decl.Define.Name
+	}
+	return "", ""
+}
+
+// declLine returns the 1-based line a declaration starts on
+func declLine(decl *Decl) int {
+	switch {
+	case decl.Function != nil:
+		return decl.Function.Line
+	case decl.Global != nil:
+		return decl.Global.Line
+	case decl.Struct != nil:
+		return decl.Struct.Line
+	case decl.Union != nil:
+		return decl.Union.Line
+	case decl.Enum != nil:
+		return decl.Enum.Line
+	case decl.Define != nil:
+		return decl.Define.Line
+	}
+	return 1
+}
+
+// StripLineComment removes a trailing "//" comment from a directive line,
+// ignoring any "//" inside a quoted path
+func StripLineComment(line string) string {
+	inQuote := false
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '"':
+			inQuote = !inQuote
+		case !inQuote && line[i] == '/' && i+1 < len(line) && line[i+1] == '/':
+			return strings.TrimSpace(line[:i])
+		}
+	}
+	return line
+}
+
+// parseUse parses a re-export line: "pub use prefix.name;"
+func parseUse(line string) (*UseDecl, error) {
+	target := strings.TrimSpace(strings.TrimSuffix(StripLineComment(strings.TrimPrefix(line, "pub use ")), ";"))
+	module, name, ok := strings.Cut(target, ".")
+	if !ok || !isIdentifier(module) || !isIdentifier(name) {
+		return nil, fmt.Errorf("expected 'pub use module.name;', got %q", line)
+	}
+	return &UseDecl{Module: module, Name: name}, nil
+}
+
 // parseFunction parses a function declaration starting at the given line
 func parseFunction(lines []string, startIdx int, fullSource string) (*FuncDecl, int, error) {
 	line := strings.TrimSpace(lines[startIdx])
 
 	funcDecl := &FuncDecl{}
 
-	// Check for pub modifier
-	if strings.HasPrefix(line, "pub ") {
-		funcDecl.Public = true
-		line = strings.TrimPrefix(line, "pub ")
-		line = strings.TrimSpace(line)
+	// Check for pub and inline modifiers, in either order
+	for {
+		if !funcDecl.Public && strings.HasPrefix(line, "pub ") {
+			funcDecl.Public = true
+			line = strings.TrimSpace(strings.TrimPrefix(line, "pub "))
+		} else if !funcDecl.Inline && strings.HasPrefix(line, "inline ") {
+			funcDecl.Inline = true
+			line = strings.TrimSpace(strings.TrimPrefix(line, "inline "))
+		} else {
+			break
+		}
 	}
 
 	// Parse "func name(params) returnType"
@@ -342,6 +672,9 @@ func parseFunction(lines []string, startIdx int, fullSource string) (*FuncDecl,
 	}
 
 	funcDecl.Name = nameParts[0]
+	if funcDecl.Inline && funcDecl.Name == "main" {
+		return nil, 0, fmt.Errorf("main cannot be inline")
+	}
 
 	// Find matching closing parenthesis (respecting nested parens for function pointers)
 	closeParenIdx := findMatchingParen(line, parenIdx)
@@ -475,11 +808,13 @@ func splitParamsRespectingParens(paramStr string) []string {
 }
 
 // parseFunctionPointerParam parses a function pointer parameter.
-// Input format: "returnType (*name)(paramTypes)" or "returnType (*name)(paramTypes)"
-// Returns a Param with the name extracted and the type as the full signature minus the name.
+// Input format: "returnType (*name)(paramTypes)", where the declarator may
+// also carry array dimensions or extra indirection: "void (*table[4])(int)",
+// "int (**pp)(void)", "int (*rows)[3]".
+// Returns a Param with the name extracted and the type as the full signature
+// minus the name, e.g. "void (*[4])(int)".
 func parseFunctionPointerParam(part string) *Param {
 	// Find the (*name) part
-	// Pattern: returnType (*name)(paramTypes)
 	startParen := strings.Index(part, "(*")
 	if startParen == -1 {
 		return nil
@@ -492,12 +827,22 @@ func parseFunctionPointerParam(part string) *Param {
 	}
 	endParen += startParen // Adjust to absolute position
 
-	// Extract the name (between "(* and )")
-	name := strings.TrimSpace(part[startParen+2 : endParen])
+	// The name is the identifier ending the declarator, before any "[N]"
+	declarator := part[startParen+1 : endParen]
+	head, dims := declarator, ""
+	if idx := strings.Index(declarator, "["); idx >= 0 {
+		head, dims = declarator[:idx], declarator[idx:]
+	}
+	head = strings.TrimRight(head, " \t")
+	nameStart := len(head)
+	for nameStart > 0 && isIdentByte(head[nameStart-1]) {
+		nameStart--
+	}
+	name := head[nameStart:]
 
-	// Build the type by replacing the name with empty
+	// Build the type by removing the name
 	// E.g., "int (*cmp)(void*, void*)" -> "int (*)(void*, void*)"
-	typeStr := part[:startParen+2] + part[endParen:]
+	typeStr := part[:startParen+1] + strings.TrimRight(head[:nameStart], " \t") + dims + part[endParen:]
 
 	return &Param{
 		Name: name,
@@ -505,48 +850,95 @@ func parseFunctionPointerParam(part string) *Param {
 	}
 }
 
+// isIdentByte reports whether b can appear in a C identifier
+func isIdentByte(b byte) bool {
+	return b == '_' || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9')
+}
+
+// isIdentifier reports whether s is a C identifier
+func isIdentifier(s string) bool {
+	if s == "" || (s[0] >= '0' && s[0] <= '9') {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isIdentByte(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
 // extractBraceBlock extracts a brace-balanced block starting from a line
 func extractBraceBlock(lines []string, startIdx int) (string, int) {
 	var result strings.Builder
 	braceCount := 0
 	foundStart := false
 	consumed := 0
-	inBody := false
+
+	// Braces inside literals and comments do not count: { putchar('}'); }
+	var quote byte
+	inBlockComment := false
 
 	for i := startIdx; i < len(lines); i++ {
 		line := lines[i]
 		consumed++
 
-		// Process character by character to extract only from { to }
-		for j, ch := range line {
-			if ch == '{' {
+		// Copy only from the opening { to its matching }
+		for j := 0; j < len(line); j++ {
+			ch := line[j]
+			if foundStart {
+				result.WriteByte(ch)
+			}
+			switch {
+			case inBlockComment:
+				if ch == '*' && j+1 < len(line) && line[j+1] == '/' {
+					inBlockComment = false
+					if foundStart {
+						result.WriteByte('/')
+					}
+					j++
+				}
+			case quote != 0:
+				if ch == '\\' && j+1 < len(line) {
+					if foundStart {
+						result.WriteByte(line[j+1])
+					}
+					j++
+				} else if ch == quote {
+					quote = 0
+				}
+			case ch == '"' || ch == '\'':
+				quote = ch
+			case ch == '/' && j+1 < len(line) && line[j+1] == '/':
+				if foundStart {
+					result.WriteString(line[j+1:])
+				}
+				j = len(line)
+			case ch == '/' && j+1 < len(line) && line[j+1] == '*':
+				inBlockComment = true
+				if foundStart {
+					result.WriteByte('*')
+				}
+				j++
+			case ch == '{':
 				if !foundStart {
 					foundStart = true
-					inBody = true
-					result.WriteRune('{')
-				} else {
-					result.WriteRune(ch)
+					result.WriteByte('{')
 				}
 				braceCount++
-			} else if ch == '}' {
+			case ch == '}':
 				braceCount--
-				result.WriteRune(ch)
 				if braceCount == 0 && foundStart {
 					return result.String(), consumed
 				}
-			} else if inBody {
-				result.WriteRune(ch)
-			}
-
-			// Preserve everything after the opening brace on the same line
-			if foundStart && braceCount > 0 && j < len(line)-1 {
-				// Already handled by rune iteration
 			}
 		}
+		// A quote never spans lines
+		quote = 0
 
 		// Add newline if we're in the body and not at the end
-		if inBody && braceCount > 0 {
-			result.WriteRune('\n')
+		if foundStart && braceCount > 0 {
+			result.WriteByte('\n')
 		}
 	}
 
@@ -566,6 +958,22 @@ func parseStruct(lines []string, startIdx int) (*StructDecl, int, error) {
 		line = strings.TrimSpace(line)
 	}
 
+	// Check for the opaque (handle type) and packed modifiers, in either order
+	for {
+		if strings.HasPrefix(line, "opaque ") && !structDecl.Opaque {
+			if !structDecl.Public {
+				return nil, 0, fmt.Errorf("opaque struct must be public")
+			}
+			structDecl.Opaque = true
+			line = strings.TrimSpace(strings.TrimPrefix(line, "opaque "))
+		} else if strings.HasPrefix(line, "packed ") && !structDecl.Packed {
+			structDecl.Packed = true
+			line = strings.TrimSpace(strings.TrimPrefix(line, "packed "))
+		} else {
+			break
+		}
+	}
+
 	// Parse "struct Name"
 	if !strings.HasPrefix(line, "struct ") {
 		return nil, 0, fmt.Errorf("expected 'struct' keyword")
@@ -586,6 +994,12 @@ func parseStruct(lines []string, startIdx int) (*StructDecl, int, error) {
 
 	// Check if this is a forward declaration (ends with ;)
 	if strings.Contains(line, ";") && !strings.Contains(line, "{") {
+		if structDecl.Opaque {
+			return nil, 0, fmt.Errorf("opaque struct %s needs a body", structDecl.Name)
+		}
+		if structDecl.Packed {
+			return nil, 0, fmt.Errorf("packed struct %s needs a body", structDecl.Name)
+		}
 		structDecl.Body = ""
 		structDecl.Semi = true
 		return structDecl, 1, nil
@@ -596,7 +1010,7 @@ func parseStruct(lines []string, startIdx int) (*StructDecl, int, error) {
 	structDecl.Body = body
 
 	// Check for semicolon after body
-	lastLine := strings.TrimSpace(lines[startIdx+consumed-1])
+	lastLine := strings.TrimSpace(StripLineComment(lines[startIdx+consumed-1]))
 	if strings.HasSuffix(lastLine, ";") || (startIdx+consumed < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[startIdx+consumed]), ";")) {
 		structDecl.Semi = true
 		if startIdx+consumed < len(lines) && strings.TrimSpace(lines[startIdx+consumed]) == ";" {
@@ -620,6 +1034,11 @@ func parseUnion(lines []string, startIdx int) (*UnionDecl, int, error) {
 		line = strings.TrimSpace(line)
 	}
 
+	if strings.HasPrefix(line, "packed ") {
+		unionDecl.Packed = true
+		line = strings.TrimSpace(strings.TrimPrefix(line, "packed "))
+	}
+
 	// Parse "union Name"
 	if !strings.HasPrefix(line, "union ") {
 		return nil, 0, fmt.Errorf("expected 'union' keyword")
@@ -640,6 +1059,9 @@ func parseUnion(lines []string, startIdx int) (*UnionDecl, int, error) {
 
 	// Check if this is a forward declaration (ends with ;)
 	if strings.Contains(line, ";") && !strings.Contains(line, "{") {
+		if unionDecl.Packed {
+			return nil, 0, fmt.Errorf("packed union %s needs a body", unionDecl.Name)
+		}
 		unionDecl.Body = ""
 		unionDecl.Semi = true
 		return unionDecl, 1, nil
@@ -650,7 +1072,7 @@ func parseUnion(lines []string, startIdx int) (*UnionDecl, int, error) {
 	unionDecl.Body = body
 
 	// Check for semicolon after body
-	lastLine := strings.TrimSpace(lines[startIdx+consumed-1])
+	lastLine := strings.TrimSpace(StripLineComment(lines[startIdx+consumed-1]))
 	if strings.HasSuffix(lastLine, ";") || (startIdx+consumed < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[startIdx+consumed]), ";")) {
 		unionDecl.Semi = true
 		if startIdx+consumed < len(lines) && strings.TrimSpace(lines[startIdx+consumed]) == ";" {
@@ -674,30 +1096,31 @@ func parseEnum(lines []string, startIdx int) (*EnumDecl, int, error) {
 		line = strings.TrimSpace(line)
 	}
 
-	// Parse "enum Name"
-	if !strings.HasPrefix(line, "enum ") {
+	// Parse "enum Name" or "enum {"
+	if !strings.HasPrefix(line, "enum ") && !strings.HasPrefix(line, "enum{") {
 		return nil, 0, fmt.Errorf("expected 'enum' keyword")
 	}
 
-	line = strings.TrimPrefix(line, "enum ")
+	line = strings.TrimPrefix(line, "enum")
 	line = strings.TrimSpace(line)
 
-	// Extract enum name (word before '{')
-	parts := strings.FieldsFunc(line, func(r rune) bool {
-		return r == '{'
-	})
-	if len(parts) < 1 {
-		return nil, 0, fmt.Errorf("missing enum name")
+	// Extract enum name (word before '{'); an enum without one only declares constants
+	if !strings.HasPrefix(line, "{") {
+		parts := strings.FieldsFunc(line, func(r rune) bool {
+			return r == '{'
+		})
+		if len(parts) < 1 {
+			return nil, 0, fmt.Errorf("missing enum name")
+		}
+		enumDecl.Name = strings.TrimSpace(parts[0])
 	}
 
-	enumDecl.Name = strings.TrimSpace(parts[0])
-
 	// Extract enum body (brace-balanced)
 	body, consumed := extractBraceBlock(lines, startIdx)
 	enumDecl.Body = body
 
 	// Check for semicolon after body
-	lastLine := strings.TrimSpace(lines[startIdx+consumed-1])
+	lastLine := strings.TrimSpace(StripLineComment(lines[startIdx+consumed-1]))
 	if strings.HasSuffix(lastLine, ";") || (startIdx+consumed < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[startIdx+consumed]), ";")) {
 		enumDecl.Semi = true
 		if startIdx+consumed < len(lines) && strings.TrimSpace(lines[startIdx+consumed]) == ";" {
@@ -726,27 +1149,75 @@ func parseTypedef(lines []string, startIdx int) (*TypedefDecl, int, error) {
 		return nil, 0, fmt.Errorf("expected 'typedef' keyword")
 	}
 
-	// Extract full typedef body (everything after "typedef" up to ";")
-	consumed := 1
+	// The body runs to the first ';' outside brackets and literals, which may
+	// sit mid-line: "typedef int X; pub func f() ..." leaves the function on
+	// the line for the next declaration.
+	rest := strings.TrimPrefix(line, "typedef ")
 	var bodyBuilder strings.Builder
+	depth := 0
+	var quote byte
+	for idx := startIdx; ; {
+		end := -1
+		for j := 0; j < len(rest) && end < 0; j++ {
+			ch := rest[j]
+			switch {
+			case quote != 0:
+				if ch == '\\' {
+					j++
+				} else if ch == quote {
+					quote = 0
+				}
+			case ch == '"' || ch == '\'':
+				quote = ch
+			case ch == '(' || ch == '{' || ch == '[':
+				depth++
+			case ch == ')' || ch == '}' || ch == ']':
+				depth--
+			case ch == ';' && depth == 0:
+				end = j
+			}
+		}
 
-	// Start from the current line after "typedef"
-	bodyBuilder.WriteString(strings.TrimPrefix(line, "typedef "))
+		if end >= 0 {
+			bodyBuilder.WriteString(rest[:end])
+			typedefDecl.Body = strings.TrimSpace(bodyBuilder.String())
+			typedefDecl.Semi = true
 
-	// If the line doesn't end with semicolon, continue reading
-	for !strings.HasSuffix(strings.TrimSpace(lines[startIdx+consumed-1]), ";") {
-		if startIdx+consumed >= len(lines) {
+			remainder := strings.TrimSpace(rest[end+1:])
+			if remainder == "" || strings.HasPrefix(remainder, "//") {
+				return typedefDecl, idx - startIdx + 1, nil
+			}
+			// Hand the rest of the line back to the caller
+			lines[idx] = remainder
+			return typedefDecl, idx - startIdx, nil
+		}
+
+		bodyBuilder.WriteString(rest)
+		idx++
+		if idx >= len(lines) {
 			return nil, 0, fmt.Errorf("typedef missing semicolon")
 		}
 		bodyBuilder.WriteString("\n")
-		bodyBuilder.WriteString(lines[startIdx+consumed])
-		consumed++
+		rest = lines[idx]
 	}
+}
 
-	typedefDecl.Body = strings.TrimSpace(strings.TrimSuffix(bodyBuilder.String(), ";"))
-	typedefDecl.Semi = true
-
-	return typedefDecl, consumed, nil
+// moduleDocComment returns the doc comment ending on the last of lines, which
+// precede the module declaration. Build tags, suppression comments, and
+// attributes are not part of it.
+func moduleDocComment(lines []string) string {
+	start := len(lines)
+	for start > 0 && strings.HasPrefix(strings.TrimSpace(lines[start-1]), "//") {
+		start--
+	}
+	var comment []string
+	for _, line := range lines[start:] {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "// +build ") && !strings.HasPrefix(line, ignorePrefix) && !strings.HasPrefix(line, attrPrefix) {
+			comment = append(comment, line)
+		}
+	}
+	return buildDocComment(comment)
 }
 
 // buildDocComment joins collected comment lines into a single doc comment string.
@@ -814,12 +1285,54 @@ func parseDefine(lines []string, startIdx int) (*DefineDecl, int, error) {
 	return defineDecl, 1, nil
 }
 
+// isFuncDecl reports whether a line starts a function declaration: the func
+// keyword as a word of its own after any pub and inline modifiers. An
+// identifier that merely contains "func" (func_table, my_func) does not count.
+func isFuncDecl(line string) bool {
+	for _, word := range strings.Fields(line) {
+		switch word {
+		case "pub", "inline":
+			continue
+		case "func":
+			return true
+		}
+		return false
+	}
+	return false
+}
+
+// funcPointerGlobalName returns the name of a global declared with a C
+// function pointer declarator, as in "void (*table[10])();", which a global
+// cannot spell: its type must be a typedef
+func funcPointerGlobalName(line string) (string, bool) {
+	for _, prefix := range []string{"pub ", "static ", "extern "} {
+		line = strings.TrimSpace(strings.TrimPrefix(line, prefix))
+	}
+	open := strings.Index(line, "(")
+	if open <= 0 || strings.ContainsAny(line[:open], "=#") || strings.TrimSpace(line[:open]) == "" {
+		return "", false
+	}
+	rest := strings.TrimSpace(line[open+1:])
+	if !strings.HasPrefix(rest, "*") {
+		return "", false
+	}
+	rest = strings.TrimSpace(rest[1:])
+	end := 0
+	for end < len(rest) && isIdentByte(rest[end]) {
+		end++
+	}
+	if end == 0 {
+		return "", false
+	}
+	return rest[:end], true
+}
+
 // isGlobalVariableDecl checks if a line looks like a global variable declaration
 // It must:
 // - Optionally start with "pub" or "static"
 // - Followed by type(s) and a variable name
 // - End with ";" or "= value;"
-// - Not be a function (no "func" keyword, no "(" in declaration)
+// - Not be a function (no leading "func" keyword, no "(" in declaration)
 // - Not be a type definition (no "struct", "union", "enum", "typedef")
 func isGlobalVariableDecl(line string) bool {
 	// Skip if empty or doesn't contain potential declaration
@@ -835,7 +1348,7 @@ func isGlobalVariableDecl(line string) bool {
 	}
 
 	// Skip if it's a function, struct, union, enum, typedef
-	if strings.Contains(line, "func ") ||
+	if isFuncDecl(line) ||
 		strings.Contains(line, "struct ") ||
 		strings.Contains(line, "union ") ||
 		strings.Contains(line, "enum ") ||
@@ -843,12 +1356,8 @@ func isGlobalVariableDecl(line string) bool {
 		return false
 	}
 
-	// Skip if it has parentheses (function declaration or call)
-	if strings.Contains(line, "(") {
-		return false
-	}
-
-	// Check if line starts with "pub " or "static " and strip it
+	// Check if line starts with "pub " or "static " and strip it,
+	// along with an alignment specifier
 	workLine := line
 	if strings.HasPrefix(workLine, "pub ") {
 		workLine = strings.TrimPrefix(workLine, "pub ")
@@ -858,6 +1367,18 @@ func isGlobalVariableDecl(line string) bool {
 		workLine = strings.TrimPrefix(workLine, "static ")
 		workLine = strings.TrimSpace(workLine)
 	}
+	if strings.HasPrefix(workLine, "extern ") {
+		workLine = strings.TrimPrefix(workLine, "extern ")
+		workLine = strings.TrimSpace(workLine)
+	}
+	if _, rest, ok := cutAlignment(workLine); ok {
+		workLine = rest
+	}
+
+	// Skip if it has parentheses (function declaration or call)
+	if strings.Contains(workLine, "(") {
+		return false
+	}
 
 	// Must end with ";" to be a declaration (may span multiple lines)
 	// Simple heuristic: looks like "type name" or "type name = value"
@@ -871,6 +1392,31 @@ func isGlobalVariableDecl(line string) bool {
 	return strings.Contains(line, ";") || strings.Contains(line, "=")
 }
 
+// cutAlignment splits a leading _Alignas(...) or alignas(...) specifier off s,
+// returning the specifier and the trimmed remainder
+func cutAlignment(s string) (spec, rest string, ok bool) {
+	if !strings.HasPrefix(s, "_Alignas") && !strings.HasPrefix(s, "alignas") {
+		return "", s, false
+	}
+	open := strings.Index(s, "(")
+	if open == -1 || strings.TrimSpace(s[:open]) != "_Alignas" && strings.TrimSpace(s[:open]) != "alignas" {
+		return "", s, false
+	}
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return s[:i+1], strings.TrimSpace(s[i+1:]), true
+			}
+		}
+	}
+	return "", s, false
+}
+
 // parseGlobal parses a global variable declaration
 func parseGlobal(lines []string, startIdx int) (*GlobalDecl, int, error) {
 	line := strings.TrimSpace(lines[startIdx])
@@ -891,6 +1437,22 @@ func parseGlobal(lines []string, startIdx int) (*GlobalDecl, int, error) {
 		line = strings.TrimSpace(line)
 	}
 
+	// Check for extern modifier
+	if strings.HasPrefix(line, "extern ") {
+		if globalDecl.Static {
+			return nil, 0, fmt.Errorf("a global cannot be both static and extern")
+		}
+		globalDecl.Extern = true
+		line = strings.TrimPrefix(line, "extern ")
+		line = strings.TrimSpace(line)
+	}
+
+	// Check for an alignment specifier
+	if spec, rest, ok := cutAlignment(line); ok {
+		globalDecl.Align = spec
+		line = rest
+	}
+
 	// Find the complete declaration (may span multiple lines until ;)
 	fullDecl := line
 	consumed := 1
@@ -911,6 +1473,12 @@ func parseGlobal(lines []string, startIdx int) (*GlobalDecl, int, error) {
 		declPart = fullDecl
 	}
 
+	// Array dimensions follow the name: "char greeting[]", "int grid[4][4]"
+	if bracket := strings.Index(declPart, "["); bracket != -1 {
+		globalDecl.Array = strings.ReplaceAll(declPart[bracket:], " ", "")
+		declPart = strings.TrimSpace(declPart[:bracket])
+	}
+
 	// Parse the type and name from declPart
 	// Format: "type name" or "type1 type2 name" (e.g., "const char* version")
 	fields := strings.Fields(declPart)
@@ -922,10 +1490,36 @@ func parseGlobal(lines []string, startIdx int) (*GlobalDecl, int, error) {
 	globalDecl.Name = fields[len(fields)-1]
 	globalDecl.Type = strings.Join(fields[:len(fields)-1], " ")
 	globalDecl.Value = valuePart
+	if globalDecl.Extern && valuePart != "" {
+		return nil, 0, fmt.Errorf("extern global %s cannot have an initializer: it is defined elsewhere", globalDecl.Name)
+	}
 
 	return globalDecl, consumed, nil
 }
 
+// passthroughDirectives are the top-level directives kept as DirectiveDecls
+var passthroughDirectives = map[string]bool{
+	"error": true, "warning": true,
+	"if": true, "ifdef": true, "ifndef": true, "elif": true, "else": true, "endif": true,
+}
+
+// directiveName returns the name of a pass-through directive on line
+// ("error" for "#error ..."), or "" if line is not one
+func directiveName(line string) string {
+	if !strings.HasPrefix(line, "#") {
+		return ""
+	}
+	rest := strings.TrimSpace(line[1:])
+	end := 0
+	for end < len(rest) && rest[end] >= 'a' && rest[end] <= 'z' {
+		end++
+	}
+	if passthroughDirectives[rest[:end]] {
+		return rest[:end]
+	}
+	return ""
+}
+
 // parseCGoDirective parses a #cgo directive line
 // Formats:
 //
@@ -933,6 +1527,7 @@ func parseGlobal(lines []string, startIdx int) (*GlobalDecl, int, error) {
 //	#cgo LDFLAGS: -lcurl -lssl
 //	#cgo linux CFLAGS: -I/usr/include
 //	#cgo darwin LDFLAGS: -framework Security
+//	#cgo pkg-config: libcurl openssl
 func parseCGoDirective(line string) (*CGoFlag, error) {
 	// Remove the #cgo prefix
 	line = strings.TrimPrefix(line, "#cgo ")
@@ -971,9 +1566,12 @@ func parseCGoDirective(line string) (*CGoFlag, error) {
 	}
 
 	// Validate the type
-	if cgoFlag.Type != "CFLAGS" && cgoFlag.Type != "LDFLAGS" {
+	if cgoFlag.Type != "CFLAGS" && cgoFlag.Type != "LDFLAGS" && cgoFlag.Type != "pkg-config" {
 		return nil, fmt.Errorf("invalid #cgo directive: unknown type '%s'", cgoFlag.Type)
 	}
+	if cgoFlag.Type == "pkg-config" && flags == "" {
+		return nil, fmt.Errorf("invalid #cgo directive: pkg-config requires a package name")
+	}
 
 	return cgoFlag, nil
 }
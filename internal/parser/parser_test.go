@@ -1,8 +1,11 @@
 package parser
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -206,6 +209,44 @@ pub func multiply(int a, int b) int {
 	}
 }
 
+func TestParseSingleLineBodies(t *testing.T) {
+	source := `module "oneline"
+
+pub func id(int x) int { return x; }
+func close_brace() void { putchar('}'); puts("{ }"); } // prints braces
+pub struct Pair { int a; int b; }; // two ints
+union Word { int i; float f; };
+enum Mode { ON, OFF }; /* switch */
+func last() int { return 0; }
+`
+	file, err := ParseSource(source, "oneline.cm")
+	if err != nil {
+		t.Fatalf("ParseSource failed: %v", err)
+	}
+	if len(file.Decls) != 6 {
+		t.Fatalf("expected 6 declarations, got %d", len(file.Decls))
+	}
+
+	if fn := file.Decls[0].Function; fn == nil || fn.Name != "id" || fn.Body != "{ return x; }" {
+		t.Errorf("unexpected id: %+v", fn)
+	}
+	if fn := file.Decls[1].Function; fn == nil || fn.Body != `{ putchar('}'); puts("{ }"); }` {
+		t.Errorf("unexpected close_brace: %+v", fn)
+	}
+	if st := file.Decls[2].Struct; st == nil || st.Name != "Pair" || st.Body != "{ int a; int b; }" || !st.Semi {
+		t.Errorf("unexpected Pair: %+v", st)
+	}
+	if u := file.Decls[3].Union; u == nil || u.Body != "{ int i; float f; }" || !u.Semi {
+		t.Errorf("unexpected Word: %+v", u)
+	}
+	if e := file.Decls[4].Enum; e == nil || e.Name != "Mode" || e.Body != "{ ON, OFF }" {
+		t.Errorf("unexpected Mode: %+v", e)
+	}
+	if fn := file.Decls[5].Function; fn == nil || fn.Name != "last" || fn.Line != 8 {
+		t.Errorf("unexpected last: %+v", fn)
+	}
+}
+
 func TestParseCImports(t *testing.T) {
 	source := `module "main"
 
@@ -766,6 +807,31 @@ static const char* internal_name = "secret";
 	}
 }
 
+func TestParseExternGlobal(t *testing.T) {
+	file, err := ParseSource("module \"counter\"\n\npub extern int shared_counter;\nextern const char* names[];\n", "counter.cm")
+	if err != nil {
+		t.Fatalf("ParseSource failed: %v", err)
+	}
+	if len(file.Decls) != 2 {
+		t.Fatalf("expected 2 globals, got %d", len(file.Decls))
+	}
+	if g := file.Decls[0].Global; g == nil || !g.Extern || !g.Public || g.Type != "int" || g.Name != "shared_counter" {
+		t.Errorf("unexpected first global: %+v", g)
+	}
+	if g := file.Decls[1].Global; g == nil || !g.Extern || g.Public || g.Type != "const char*" || g.Name != "names" || g.Array != "[]" {
+		t.Errorf("unexpected second global: %+v", g)
+	}
+
+	for _, source := range []string{
+		"module \"counter\"\n\npub extern int shared_counter = 1;\n",
+		"module \"counter\"\n\nstatic extern int shared_counter;\n",
+	} {
+		if _, err := ParseSource(source, "counter.cm"); err == nil {
+			t.Errorf("expected an error for %q", source)
+		}
+	}
+}
+
 func TestParseGlobalVariable(t *testing.T) {
 	source := `module "state"
 
@@ -936,3 +1002,501 @@ pub func fetch(char* url) int {
 		t.Errorf("expected flags '-framework Security', got '%s'", f4.Flags)
 	}
 }
+
+func TestParseCGoPkgConfig(t *testing.T) {
+	file, err := ParseSource("module \"http\"\n\n#cgo pkg-config: libcurl openssl\n#cgo linux pkg-config: libsystemd\n", "http.cm")
+	if err != nil {
+		t.Fatalf("ParseSource failed: %v", err)
+	}
+	if len(file.CGoFlags) != 2 {
+		t.Fatalf("expected 2 #cgo directives, got %d", len(file.CGoFlags))
+	}
+	if f := file.CGoFlags[0]; f.Type != "pkg-config" || f.Platform != "" || f.Flags != "libcurl openssl" {
+		t.Errorf("unexpected first directive: %+v", f)
+	}
+	if f := file.CGoFlags[1]; f.Type != "pkg-config" || f.Platform != "linux" || f.Flags != "libsystemd" {
+		t.Errorf("unexpected second directive: %+v", f)
+	}
+
+	if _, err := parseCGoDirective("#cgo pkg-config:"); err == nil || !strings.Contains(err.Error(), "requires a package name") {
+		t.Errorf("expected an error for an empty pkg-config directive, got %v", err)
+	}
+}
+
+func TestParseErrorPosition(t *testing.T) {
+	source := `module "math"
+
+// add is missing its parameter list
+    pub func add int {
+    return 0;
+}
+`
+	_, err := ParseSource(source, "math.cm")
+	if err == nil {
+		t.Fatal("expected a parse error")
+	}
+
+	var pe *ParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("expected *ParseError, got %T: %v", err, err)
+	}
+	if pe.File != "math.cm" || pe.Line != 4 || pe.Col != 5 {
+		t.Errorf("expected math.cm:4:5, got %s:%d:%d", pe.File, pe.Line, pe.Col)
+	}
+	if pe.Msg != "expected '(' after function name" {
+		t.Errorf("unexpected message %q", pe.Msg)
+	}
+	if err.Error() != "math.cm:4:5: expected '(' after function name" {
+		t.Errorf("unexpected error string %q", err.Error())
+	}
+}
+
+func TestParseErrorMissingModule(t *testing.T) {
+	_, err := ParseSource("func main() int {\n    return 0;\n}\n", "main.cm")
+
+	var pe *ParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("expected *ParseError, got %T: %v", err, err)
+	}
+	if pe.Line != 0 || pe.Msg != "no module declaration found" {
+		t.Errorf("unexpected error %+v", pe)
+	}
+	if err.Error() != "main.cm: no module declaration found" {
+		t.Errorf("unexpected error string %q", err.Error())
+	}
+}
+
+func TestParseIgnoreComments(t *testing.T) {
+	source := `module "main"
+
+// cminus:ignore unused-import
+import "log"
+
+// cminus:ignore shadowed-import,unused-import
+// run does the work
+func run(int log) int {
+    return log;
+}
+`
+	file, err := ParseSource(source, "main.cm")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	if file.Imports[0].Line != 4 || !file.Ignored(4, "unused-import") {
+		t.Errorf("expected unused-import ignored on import line 4, got %v", file.Ignores)
+	}
+	if !file.Ignored(8, "shadowed-import") || !file.Ignored(8, "unused-import") {
+		t.Errorf("expected both rules ignored on line 8, got %v", file.Ignores)
+	}
+	if file.Ignored(8, "other") || file.Ignored(5, "unused-import") {
+		t.Errorf("unexpected ignores %v", file.Ignores)
+	}
+
+	fn := file.Decls[0].Function
+	if fn.DocComment != "run does the work" {
+		t.Errorf("ignore comment leaked into doc comment: %q", fn.DocComment)
+	}
+}
+
+func TestParseDirectiveTrailingComments(t *testing.T) {
+	source := `module "x" // note
+import "y"//note
+cimport "stdio.h" // printf
+`
+	file, err := ParseSource(source, "x.cm")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	if file.Module.Path != "x" {
+		t.Errorf("expected module x, got %q", file.Module.Path)
+	}
+	if len(file.Imports) != 1 || file.Imports[0].Path != "y" {
+		t.Errorf("expected import y, got %v", file.Imports)
+	}
+	if len(file.CImports) != 1 || file.CImports[0].Path != "stdio.h" {
+		t.Errorf("expected cimport stdio.h, got %v", file.CImports)
+	}
+}
+
+func TestParseAlignedGlobal(t *testing.T) {
+	source := `module "ring"
+
+pub _Alignas(64) int head = 0;
+static alignas(sizeof(long)) char scratch;
+`
+	file, err := ParseSource(source, "ring.cm")
+	if err != nil {
+		t.Fatalf("ParseSource failed: %v", err)
+	}
+	if len(file.Decls) != 2 {
+		t.Fatalf("expected 2 declarations, got %d", len(file.Decls))
+	}
+
+	g1 := file.Decls[0].Global
+	if g1 == nil || !g1.Public || g1.Align != "_Alignas(64)" || g1.Type != "int" || g1.Name != "head" || g1.Value != "0" {
+		t.Errorf("unexpected first global: %+v", g1)
+	}
+	g2 := file.Decls[1].Global
+	if g2 == nil || !g2.Static || g2.Align != "alignas(sizeof(long))" || g2.Type != "char" || g2.Name != "scratch" {
+		t.Errorf("unexpected second global: %+v", g2)
+	}
+}
+
+func TestParseArrayGlobal(t *testing.T) {
+	source := `module "text"
+
+pub char greeting[] = "hello";
+int grid [4][4];
+`
+	file, err := ParseSource(source, "text.cm")
+	if err != nil {
+		t.Fatalf("ParseSource failed: %v", err)
+	}
+	if len(file.Decls) != 2 {
+		t.Fatalf("expected 2 declarations, got %d", len(file.Decls))
+	}
+
+	g1 := file.Decls[0].Global
+	if g1 == nil || g1.Type != "char" || g1.Name != "greeting" || g1.Array != "[]" || g1.Value != `"hello"` {
+		t.Errorf("unexpected first global: %+v", g1)
+	}
+	g2 := file.Decls[1].Global
+	if g2 == nil || g2.Type != "int" || g2.Name != "grid" || g2.Array != "[4][4]" {
+		t.Errorf("unexpected second global: %+v", g2)
+	}
+}
+
+func TestParseIdentifiersContainingFunc(t *testing.T) {
+	source := `module "dispatch"
+
+pub int func_count = 0;
+static char* my_func = "name";
+int funcs[4];
+
+func run() int {
+    return func_count;
+}
+`
+	file, err := ParseSource(source, "dispatch.cm")
+	if err != nil {
+		t.Fatalf("ParseSource failed: %v", err)
+	}
+	if len(file.Decls) != 4 {
+		t.Fatalf("expected 3 globals and 1 function, got %d declarations", len(file.Decls))
+	}
+	for i, name := range []string{"func_count", "my_func", "funcs"} {
+		if g := file.Decls[i].Global; g == nil || g.Name != name {
+			t.Errorf("declaration %d: expected global %s, got %+v", i, name, file.Decls[i])
+		}
+	}
+	if fn := file.Decls[3].Function; fn == nil || fn.Name != "run" {
+		t.Errorf("expected function run, got %+v", file.Decls[3])
+	}
+
+	// A function pointer declarator is reported rather than dropped
+	for _, decl := range []string{"void (*func_table[10])();", "pub static int (* handler)(int);"} {
+		_, err := ParseSource("module \"dispatch\"\n\n"+decl+"\n", "dispatch.cm")
+		if err == nil || !strings.Contains(err.Error(), "dispatch.cm:3") || !strings.Contains(err.Error(), "declares a function pointer") {
+			t.Errorf("ParseSource(%q): expected a function pointer error, got %v", decl, err)
+		}
+	}
+
+	for line, want := range map[string]bool{
+		"func main() int {":          true,
+		"pub inline func f() void {": true,
+		"inline pub func f() void;":  true,
+		"int func_count = 0;":        false,
+		"void (*func_table[10])();":  false,
+		"pub functor f;":             false,
+	} {
+		if got := isFuncDecl(line); got != want {
+			t.Errorf("isFuncDecl(%q) = %v, want %v", line, got, want)
+		}
+	}
+}
+
+func TestParseInlineFunction(t *testing.T) {
+	source := `module "vec"
+
+pub inline func add(int a, int b) int {
+    return a + b;
+}
+
+inline func twice(int a) int { return a * 2; }
+
+inline pub func sub(int a, int b) int {
+    return a - b;
+}
+`
+	file, err := ParseSource(source, "vec.cm")
+	if err != nil {
+		t.Fatalf("ParseSource failed: %v", err)
+	}
+	if len(file.Decls) != 3 {
+		t.Fatalf("expected 3 declarations, got %d", len(file.Decls))
+	}
+
+	add := file.Decls[0].Function
+	if add == nil || !add.Public || !add.Inline || add.Name != "add" || add.ReturnType != "int" {
+		t.Errorf("unexpected first function: %+v", add)
+	}
+	twice := file.Decls[1].Function
+	if twice == nil || twice.Public || !twice.Inline || twice.Name != "twice" {
+		t.Errorf("unexpected second function: %+v", twice)
+	}
+	sub := file.Decls[2].Function
+	if sub == nil || !sub.Public || !sub.Inline || sub.Name != "sub" {
+		t.Errorf("expected 'inline pub func' to parse like 'pub inline func': %+v", sub)
+	}
+
+	if _, err := ParseSource("module \"main\"\n\ninline func main() int { return 0; }\n", "main.cm"); err == nil || !strings.Contains(err.Error(), "main cannot be inline") {
+		t.Errorf("expected inline main to be rejected, got %v", err)
+	}
+}
+
+func TestParseErrorDirectives(t *testing.T) {
+	source := `module "platform"
+
+#if !defined(__linux__)
+#error "platform requires Linux"
+#else
+#warning "experimental"
+#endif
+
+#ifdef HAVE_STRUCT_STAT
+pub func size() int {
+    return 1;
+}
+#endif
+`
+	file, err := ParseSource(source, "platform.cm")
+	if err != nil {
+		t.Fatalf("ParseSource failed: %v", err)
+	}
+
+	var got []string
+	for _, decl := range file.Decls {
+		switch {
+		case decl.Directive != nil:
+			got = append(got, fmt.Sprintf("%d:%s", decl.Directive.Line, decl.Directive.Text))
+		case decl.Function != nil:
+			got = append(got, "func "+decl.Function.Name)
+		default:
+			t.Errorf("unexpected decl %+v", decl)
+		}
+	}
+	want := []string{
+		"3:#if !defined(__linux__)",
+		`4:#error "platform requires Linux"`,
+		"5:#else",
+		`6:#warning "experimental"`,
+		"7:#endif",
+		"9:#ifdef HAVE_STRUCT_STAT",
+		"func size",
+		"13:#endif",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("decls:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if file.Decls[1].Directive.Conditional() || !file.Decls[0].Directive.Conditional() {
+		t.Error("expected #error to be unconditional and #if conditional")
+	}
+}
+
+func TestParseAttributes(t *testing.T) {
+	source := `module "lib"
+
+// old is superseded.
+// cminus:attr __attribute__((deprecated("use fresh")))
+// cminus:attr __attribute__((cold))
+pub func old() int {
+    return 1;
+}
+
+// cminus:attr __attribute__((unused))
+
+pub func fresh() int {
+    return 2;
+}
+
+// cminus:attr __attribute__((aligned(64)))
+pub int counter = 0;
+`
+	file, err := ParseSource(source, "lib.cm")
+	if err != nil {
+		t.Fatalf("ParseSource failed: %v", err)
+	}
+	if len(file.Decls) != 3 {
+		t.Fatalf("expected 3 declarations, got %d", len(file.Decls))
+	}
+
+	old := file.Decls[0].Function
+	if old == nil || len(old.Attrs) != 2 || old.Attrs[0] != `__attribute__((deprecated("use fresh")))` || old.Attrs[1] != "__attribute__((cold))" {
+		t.Errorf("unexpected attributes on old: %+v", old)
+	}
+	if old.DocComment != "old is superseded." {
+		t.Errorf("attributes must not be part of the doc comment, got %q", old.DocComment)
+	}
+	// A blank line detaches an attribute, like a doc comment
+	if fresh := file.Decls[1].Function; fresh == nil || len(fresh.Attrs) != 0 {
+		t.Errorf("expected no attributes on fresh: %+v", fresh)
+	}
+	if g := file.Decls[2].Global; g == nil || len(g.Attrs) != 1 || g.Attrs[0] != "__attribute__((aligned(64)))" {
+		t.Errorf("unexpected attributes on counter: %+v", g)
+	}
+
+	_, err = ParseSource("module \"lib\"\n\n// cminus:attr __attribute__((packed))\nstruct S { int a; };\n", "lib.cm")
+	if err == nil || !strings.Contains(err.Error(), "cminus:attr applies only to functions and global variables") {
+		t.Errorf("expected an error for an attribute on a struct, got %v", err)
+	}
+}
+
+func TestParseUse(t *testing.T) {
+	source := `module "shapes"
+
+import "geo/math"
+
+pub use math.add;
+pub use math.scale; // forwarded for callers
+`
+	file, err := ParseSource(source, "shapes.cm")
+	if err != nil {
+		t.Fatalf("ParseSource failed: %v", err)
+	}
+	if len(file.Decls) != 2 {
+		t.Fatalf("expected 2 declarations, got %d", len(file.Decls))
+	}
+	if u := file.Decls[0].Use; u == nil || u.Module != "math" || u.Name != "add" || u.Line != 5 {
+		t.Errorf("unexpected first use: %+v", u)
+	}
+	if u := file.Decls[1].Use; u == nil || u.Module != "math" || u.Name != "scale" {
+		t.Errorf("unexpected second use: %+v", u)
+	}
+
+	for _, bad := range []string{"pub use math;", "pub use math.add.more;", "pub use .add;"} {
+		if _, err := ParseSource("module \"shapes\"\n\n"+bad+"\n", "shapes.cm"); err == nil || !strings.Contains(err.Error(), "expected 'pub use module.name;'") {
+			t.Errorf("%s: expected a syntax error, got %v", bad, err)
+		}
+	}
+}
+
+func TestParseModuleDoc(t *testing.T) {
+	source := `// +build linux
+
+// Package ring implements a fixed-size ring buffer.
+// It is not safe for concurrent use.
+module "ring"
+
+// capacity is the number of slots
+pub #define CAPACITY 64
+`
+	file, err := ParseSource(source, "ring.cm")
+	if err != nil {
+		t.Fatalf("ParseSource failed: %v", err)
+	}
+	want := "Package ring implements a fixed-size ring buffer.\nIt is not safe for concurrent use."
+	if file.ModuleDoc != want {
+		t.Errorf("ModuleDoc = %q, want %q", file.ModuleDoc, want)
+	}
+
+	// A blank line separates the comment from the module declaration
+	file, err = ParseSource("// scratch notes\n\nmodule \"ring\"\n", "ring.cm")
+	if err != nil {
+		t.Fatalf("ParseSource failed: %v", err)
+	}
+	if file.ModuleDoc != "" {
+		t.Errorf("expected no module doc, got %q", file.ModuleDoc)
+	}
+}
+
+func TestParseRejectsCKeywordNames(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"function", "module \"m\"\n\nfunc switch(int x) int {\n    return x;\n}\n", "m.cm:3:1: function name \"switch\" is a reserved C keyword"},
+		{"global", "module \"m\"\n\nint count = 0;\nint default = 0;\n", "m.cm:4:1: global name \"default\" is a reserved C keyword"},
+		{"struct", "module \"m\"\n\npub struct register {\n    int x;\n};\n", "m.cm:3:1: struct name \"register\" is a reserved C keyword"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSource(tt.source, "m.cm")
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("expected %q, got %v", tt.want, err)
+			}
+		})
+	}
+
+	if _, err := ParseSource("module \"m\"\n\nint switches = 0;\n\nfunc defaults() int {\n    return switches;\n}\n", "m.cm"); err != nil {
+		t.Errorf("expected names containing keywords to parse, got %v", err)
+	}
+}
+
+func TestParseRejectsInvalidIdentifiers(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"parameter", "module \"m\"\n\nfunc scale(int 2x) int {\n    return 2;\n}\n", "m.cm:3:1: parameter name \"2x\" of scale is not a valid C identifier"},
+		{"pointer parameter", "module \"m\"\n\nfunc first(char* 1st[]) char* {\n    return 0;\n}\n", "m.cm:3:1: parameter name \"1st[]\" of first is not a valid C identifier"},
+		{"keyword parameter", "module \"m\"\n\nfunc pick(int case) int {\n    return 0;\n}\n", "m.cm:3:1: parameter name \"case\" of pick is a reserved C keyword"},
+		{"function", "module \"m\"\n\nfunc 3d() int {\n    return 3;\n}\n", "m.cm:3:1: function name \"3d\" is not a valid C identifier"},
+		{"global", "module \"m\"\n\nint count = 0;\nint max-count = 4;\n", "m.cm:4:1: global name \"max-count\" is not a valid C identifier"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSource(tt.source, "m.cm")
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("expected %q, got %v", tt.want, err)
+			}
+		})
+	}
+
+	valid := "module \"m\"\n\nint *cursor = 0;\nint grid[4];\n\nfunc scale(int x2, char *argv[], void (*cb)(int), ...) int {\n    return x2;\n}\n"
+	if _, err := ParseSource(valid, "m.cm"); err != nil {
+		t.Errorf("expected valid names to parse, got %v", err)
+	}
+}
+
+func TestParseByteOrderMark(t *testing.T) {
+	source := "\ufeffmodule \"util\"\n\nimport \"log\"\n\npub func one() int {\n    return 1;\n}\n"
+	file, err := ParseSource(source, "util.cm")
+	if err != nil {
+		t.Fatalf("ParseSource failed: %v", err)
+	}
+	if file.Module == nil || file.Module.Path != "util" {
+		t.Fatalf("expected module util, got %+v", file.Module)
+	}
+	if len(file.Imports) != 1 || len(file.Decls) != 1 || file.Decls[0].Function.Line != 5 {
+		t.Errorf("unexpected parse result: imports %v, decls %v", file.Imports, file.Decls)
+	}
+
+	if _, err := ParseSource("\ufeff// +build linux\n\nmodule \"util\"\n", "util.cm"); err != nil {
+		t.Errorf("expected a BOM before build tags to parse, got %v", err)
+	}
+}
+
+func TestParseRejectsInvalidModulePath(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"module \"\"\n", "m.cm:1:1: module path is empty"},
+		{"module \"my util\"\n", "m.cm:1:1: module path \"my util\" contains whitespace"},
+		{"// util helpers\nmodule \"util-v2\"\n", "m.cm:2:1: module path \"util-v2\" contains '-', which is not allowed in a C identifier"},
+	}
+	for _, tt := range tests {
+		_, err := ParseSource(tt.source, "m.cm")
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("ParseSource(%q): expected %q, got %v", tt.source, tt.want, err)
+		}
+	}
+
+	if _, err := ParseSource("module \"util/strings\"\n", "m.cm"); err != nil {
+		t.Errorf("expected a nested module path to parse, got %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -55,6 +56,87 @@ struct PrivateData {
 	}
 }
 
+func TestParseOpaqueStruct(t *testing.T) {
+	source := `module "db"
+
+pub opaque struct Conn {
+    int fd;
+};
+`
+
+	file, err := manualParse(source, "test.cm")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if len(file.Decls) != 1 || file.Decls[0].Struct == nil {
+		t.Fatalf("expected 1 struct declaration, got %+v", file.Decls)
+	}
+	st := file.Decls[0].Struct
+	if !st.Public || !st.Opaque || st.Name != "Conn" || st.Body == "" {
+		t.Errorf("unexpected struct %+v", st)
+	}
+
+	// opaque needs pub and a body
+	if _, err := manualParse("module \"db\"\n\nopaque struct Conn {\n    int fd;\n};\n", "test.cm"); err == nil {
+		t.Error("expected error for private opaque struct")
+	}
+	if _, err := manualParse("module \"db\"\n\npub opaque struct Conn;\n", "test.cm"); err == nil {
+		t.Error("expected error for opaque struct without a body")
+	}
+}
+
+func TestParsePackedTypes(t *testing.T) {
+	source := `module "wire"
+
+pub packed struct Header {
+    char tag;
+    int length;
+};
+
+pub packed opaque struct Frame {
+    char kind;
+};
+
+pub opaque packed struct Conn {
+    int fd;
+};
+
+packed union Word {
+    char bytes[3];
+    short half;
+};
+`
+
+	file, err := manualParse(source, "test.cm")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if len(file.Decls) != 4 {
+		t.Fatalf("expected 4 declarations, got %+v", file.Decls)
+	}
+	for i, name := range []string{"Header", "Frame", "Conn"} {
+		st := file.Decls[i].Struct
+		if st == nil || st.Name != name || !st.Packed || !st.Public || st.Body == "" {
+			t.Errorf("expected packed struct %s, got %+v", name, st)
+			continue
+		}
+		if st.Opaque != (name != "Header") {
+			t.Errorf("struct %s: unexpected opaque %v", name, st.Opaque)
+		}
+	}
+	if u := file.Decls[3].Union; u == nil || u.Name != "Word" || !u.Packed || u.Public {
+		t.Errorf("expected private packed union Word, got %+v", u)
+	}
+
+	// packed types need a body
+	if _, err := manualParse("module \"wire\"\n\npub packed struct Header;\n", "test.cm"); err == nil {
+		t.Error("expected error for packed struct without a body")
+	}
+	if _, err := manualParse("module \"wire\"\n\npacked union Word;\n", "test.cm"); err == nil {
+		t.Error("expected error for packed union without a body")
+	}
+}
+
 func TestParseEnum(t *testing.T) {
 	source := `module "state"
 
@@ -90,6 +172,36 @@ pub enum State {
 	}
 }
 
+func TestParseAnonymousEnum(t *testing.T) {
+	source := `module "limits"
+
+pub enum { MAX_USERS = 64, MAX_GROUPS };
+
+enum{ RETRIES = 3 };
+`
+
+	file, err := manualParse(source, "test.cm")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	if len(file.Decls) != 2 {
+		t.Fatalf("expected 2 declarations, got %d", len(file.Decls))
+	}
+
+	for i, d := range file.Decls {
+		if d.Enum == nil {
+			t.Fatalf("declaration %d: expected enum", i)
+		}
+		if d.Enum.Name != "" {
+			t.Errorf("declaration %d: expected no enum name, got %q", i, d.Enum.Name)
+		}
+	}
+	if !file.Decls[0].Enum.Public || !strings.Contains(file.Decls[0].Enum.Body, "MAX_GROUPS") {
+		t.Errorf("unexpected first enum: %+v", file.Decls[0].Enum)
+	}
+}
+
 func TestParseTypedef(t *testing.T) {
 	source := `module "types"
 
@@ -351,7 +463,7 @@ pub func qsort(void* base, size_t n, int (*cmp)(void*, void*)) void {
 func TestParseFunctionPointerParamComplex(t *testing.T) {
 	source := `module "events"
 
-pub func register(int id, void (*handler)(int, char*), void* ctx) int {
+pub func register_handler(int id, void (*handler)(int, char*), void* ctx) int {
     return 0;
 }
 `
@@ -427,3 +539,125 @@ pub typedef void (*EventHandler)(int event_id, void* data);
 		t.Errorf("unexpected typedef body: %s", td2.Body)
 	}
 }
+
+func TestParseTypedefSharingLine(t *testing.T) {
+	source := `module "shapes"
+
+typedef int Count; pub func zero() Count {
+    return 0;
+}
+
+pub typedef struct { int w; int h; } Size; // dimensions
+typedef char Tag[4];
+`
+
+	file, err := manualParse(source, "test.cm")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	if len(file.Decls) != 4 {
+		t.Fatalf("expected 4 declarations, got %d", len(file.Decls))
+	}
+
+	if td := file.Decls[0].Typedef; td == nil || td.Body != "int Count" {
+		t.Errorf("unexpected first declaration: %+v", file.Decls[0])
+	}
+
+	fn := file.Decls[1].Function
+	if fn == nil {
+		t.Fatalf("expected function after typedef, got %+v", file.Decls[1])
+	}
+	if fn.Name != "zero" || !fn.Public || fn.ReturnType != "Count" || fn.Line != 3 {
+		t.Errorf("unexpected function: %+v", fn)
+	}
+
+	if td := file.Decls[2].Typedef; td == nil || !td.Public || td.Body != "struct { int w; int h; } Size" {
+		t.Errorf("unexpected struct typedef: %+v", file.Decls[2])
+	}
+	if td := file.Decls[3].Typedef; td == nil || td.Body != "char Tag[4]" {
+		t.Errorf("unexpected array typedef: %+v", file.Decls[3])
+	}
+}
+
+func TestParseFunctionPointerArrayParam(t *testing.T) {
+	tests := []struct {
+		param    string
+		wantName string
+		wantType string
+	}{
+		{"void (*table[4])(int)", "table", "void (*[4])(int)"},
+		{"void (*handlers[])(int)", "handlers", "void (*[])(int)"},
+		{"int (**pp)(void)", "pp", "int (**)(void)"},
+		{"int (*rows)[3]", "rows", "int (*)[3]"},
+	}
+
+	for _, tt := range tests {
+		params := parseParams(tt.param)
+		if len(params) != 1 {
+			t.Fatalf("%s: expected 1 param, got %d", tt.param, len(params))
+		}
+		if params[0].Name != tt.wantName || params[0].Type != tt.wantType {
+			t.Errorf("%s: got name %q type %q, want %q %q", tt.param, params[0].Name, params[0].Type, tt.wantName, tt.wantType)
+		}
+	}
+}
+
+func TestParseFunctionPointerArrayTypedef(t *testing.T) {
+	source := `module "events"
+
+pub typedef void (*Table[4])(int);
+`
+
+	file, err := manualParse(source, "test.cm")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if len(file.Decls) != 1 || file.Decls[0].Typedef == nil {
+		t.Fatalf("expected one typedef, got %+v", file.Decls)
+	}
+	if body := file.Decls[0].Typedef.Body; body != "void (*Table[4])(int)" {
+		t.Errorf("unexpected typedef body: %s", body)
+	}
+}
+
+func TestParsePragma(t *testing.T) {
+	source := `module "wire"
+
+#pragma pack(push, 1)
+pub struct Header {
+    char tag;
+    int length;
+};
+#pragma pack(pop)
+
+#pragma GCC diagnostic ignored "-Wunused-function"
+func helper() int {
+    return 0;
+}
+`
+
+	file, err := manualParse(source, "test.cm")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	if len(file.Decls) != 5 {
+		t.Fatalf("expected 5 declarations, got %d", len(file.Decls))
+	}
+	if p := file.Decls[0].Pragma; p == nil || p.Text != "#pragma pack(push, 1)" || p.Line != 3 {
+		t.Errorf("unexpected first declaration: %+v", file.Decls[0])
+	}
+	if file.Decls[1].Struct == nil {
+		t.Errorf("expected struct after pragma, got %+v", file.Decls[1])
+	}
+	if p := file.Decls[2].Pragma; p == nil || p.Text != "#pragma pack(pop)" {
+		t.Errorf("unexpected third declaration: %+v", file.Decls[2])
+	}
+	if p := file.Decls[3].Pragma; p == nil || p.Text != `#pragma GCC diagnostic ignored "-Wunused-function"` {
+		t.Errorf("unexpected fourth declaration: %+v", file.Decls[3])
+	}
+	if file.Decls[4].Function == nil {
+		t.Errorf("expected function last, got %+v", file.Decls[4])
+	}
+}
@@ -2,38 +2,179 @@
 package paths
 
 import (
+	"fmt"
 	"path/filepath"
+	"strconv"
 	"strings"
 )
 
+// Mangling schemes, selecting how import path segments and symbol names are
+// combined into C identifiers.
+const (
+	// ManglingUnderscore joins with "_": "a/b" + "c" -> "a_b_c". Module "a_b"
+	// with symbol "c" and module "a" with symbol "b_c" both give "a_b_c".
+	ManglingUnderscore = "underscore"
+	// ManglingDouble joins with "__": "a/b" + "c" -> "a__b__c", which keeps
+	// names distinct as long as paths and symbols avoid "__" themselves.
+	ManglingDouble = "double"
+	// ManglingLength prefixes every component with its length and brackets the
+	// module path with N...E: "a/b" + "c" -> "N1a1bE1c". Names never collide.
+	ManglingLength = "length"
+)
+
+// Naming selects how generated names and files are derived from import
+// paths: the mangling scheme and where .c files and their objects go. The
+// zero value is the default, underscore mangling with flat files. A build or
+// language server session carries its project's Naming rather than sharing
+// one per process.
+type Naming struct {
+	// Mangling is one of the Mangling constants; "" is ManglingUnderscore
+	Mangling string
+	// MirrorObjects puts generated .c files and their objects under obj/ in
+	// directories mirroring the module layout, so "a/b" + "file.cm" gives
+	// obj/a/b/file.c and obj/a/b/file.o, instead of flat in the build
+	// directory under mangled names. Mirrored names cannot collide.
+	MirrorObjects bool
+}
+
+// CheckMangling returns an error if name is not a known mangling scheme.
+// The empty string selects the default.
+func CheckMangling(name string) error {
+	switch name {
+	case "", ManglingUnderscore, ManglingDouble, ManglingLength:
+		return nil
+	}
+	return fmt.Errorf("unknown mangling scheme %q (want %s, %s, or %s)", name, ManglingUnderscore, ManglingDouble, ManglingLength)
+}
+
+// Mangle joins a sanitized module prefix and names using the mangling scheme.
+// For example, Mangle("math", "State", "IDLE") is "math_State_IDLE".
+func (n Naming) Mangle(prefix string, names ...string) string {
+	switch n.Mangling {
+	case ManglingLength:
+		var sb strings.Builder
+		sb.WriteString(prefix)
+		for _, name := range names {
+			sb.WriteString(strconv.Itoa(len(name)))
+			sb.WriteString(name)
+		}
+		return sb.String()
+	case ManglingDouble:
+		return strings.Join(append([]string{prefix}, names...), "__")
+	}
+	return strings.Join(append([]string{prefix}, names...), "_")
+}
+
+// CheckModulePath returns an error if importPath cannot name a module: it
+// must be "/"-separated segments of letters, digits, and underscores, not
+// starting with a digit, so that SanitizeModuleName gives a C identifier.
+func CheckModulePath(importPath string) error {
+	if importPath == "" {
+		return fmt.Errorf("module path is empty")
+	}
+	if importPath[0] >= '0' && importPath[0] <= '9' {
+		return fmt.Errorf("module path %q starts with a digit", importPath)
+	}
+	for _, seg := range strings.Split(importPath, "/") {
+		if seg == "" {
+			return fmt.Errorf("module path %q has an empty segment", importPath)
+		}
+		for _, r := range seg {
+			if r != '_' && !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') && !(r >= '0' && r <= '9') {
+				return fmt.Errorf("module path %q contains %q, which is not allowed in a C identifier", importPath, r)
+			}
+		}
+	}
+	return nil
+}
+
+// CheckRootModulePath returns an error if path cannot be a cm.mod module
+// path. It names the project, not a C prefix, so it may also use '.' and
+// '-' as in "github.com/user/my-project", but no whitespace or quotes.
+func CheckRootModulePath(path string) error {
+	if path == "" {
+		return fmt.Errorf("module path is empty")
+	}
+	for _, seg := range strings.Split(path, "/") {
+		if seg == "" {
+			return fmt.Errorf("module path %q has an empty segment", path)
+		}
+		for _, r := range seg {
+			if r != '_' && r != '.' && r != '-' && !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') && !(r >= '0' && r <= '9') {
+				return fmt.Errorf("module path %q contains %q", path, r)
+			}
+		}
+	}
+	return nil
+}
+
 // SanitizeModuleName converts an import path to a safe C identifier prefix.
 // For example, "fileio/ticketio" becomes "fileio_ticketio".
-func SanitizeModuleName(importPath string) string {
+func (n Naming) SanitizeModuleName(importPath string) string {
+	switch n.Mangling {
+	case ManglingLength:
+		var sb strings.Builder
+		sb.WriteString("N")
+		for _, seg := range strings.Split(importPath, "/") {
+			sb.WriteString(strconv.Itoa(len(seg)))
+			sb.WriteString(seg)
+		}
+		sb.WriteString("E")
+		return sb.String()
+	case ManglingDouble:
+		return strings.ReplaceAll(importPath, "/", "__")
+	}
 	return strings.ReplaceAll(importPath, "/", "_")
 }
 
 // ModuleHeaderPath returns the path to a module's public header file.
-func ModuleHeaderPath(buildDir, importPath string) string {
-	return filepath.Join(buildDir, SanitizeModuleName(importPath)+".h")
+func (n Naming) ModuleHeaderPath(buildDir, importPath string) string {
+	return filepath.Join(buildDir, n.SanitizeModuleName(importPath)+".h")
 }
 
 // ModuleInternalHeaderPath returns the path to a module's internal header file.
-func ModuleInternalHeaderPath(buildDir, importPath string) string {
-	return filepath.Join(buildDir, SanitizeModuleName(importPath)+"_internal.h")
+func (n Naming) ModuleInternalHeaderPath(buildDir, importPath string) string {
+	return filepath.Join(buildDir, n.Mangle(n.SanitizeModuleName(importPath), "internal.h"))
+}
+
+// ModulePCHPath returns the path to a module's precompiled internal header.
+// gcc looks for "<header>.gch" next to a header before reading the header itself.
+func (n Naming) ModulePCHPath(buildDir, importPath string) string {
+	return n.ModuleInternalHeaderPath(buildDir, importPath) + ".gch"
 }
 
 // ModuleCFilePath returns the path to a module's C source file for a given .cm file.
-func ModuleCFilePath(buildDir, importPath, cmFileName string) string {
+func (n Naming) ModuleCFilePath(buildDir, importPath, cmFileName string) string {
 	// Remove .cm extension
 	name := cmFileName
 	if strings.HasSuffix(name, ".cm") {
 		name = name[:len(name)-3]
 	}
-	return filepath.Join(buildDir, SanitizeModuleName(importPath)+"_"+name+".c")
+	if n.MirrorObjects {
+		return filepath.Join(buildDir, "obj", filepath.FromSlash(importPath), name+".c")
+	}
+	return filepath.Join(buildDir, n.Mangle(n.SanitizeModuleName(importPath), name)+".c")
 }
 
 // ModuleOFilePath returns the path to a module's object file for a given .cm file.
-func ModuleOFilePath(buildDir, importPath, cmFileName string) string {
-	cPath := ModuleCFilePath(buildDir, importPath, cmFileName)
+// See MirrorObjects for the two layouts.
+func (n Naming) ModuleOFilePath(buildDir, importPath, cmFileName string) string {
+	cPath := n.ModuleCFilePath(buildDir, importPath, cmFileName)
 	return cPath[:len(cPath)-2] + ".o"
 }
+
+// ModuleUnityCFilePath returns the path of the single translation unit that
+// includes every generated .c file of a module in a unity build.
+func (n Naming) ModuleUnityCFilePath(buildDir, importPath string) string {
+	if n.MirrorObjects {
+		return filepath.Join(buildDir, "obj", filepath.FromSlash(importPath), "module.unity.c")
+	}
+	return filepath.Join(buildDir, n.SanitizeModuleName(importPath)+".unity.c")
+}
+
+// ModuleDWOFilePath returns the path to the split DWARF file gcc writes next to
+// a module's object file when compiling with -gsplit-dwarf.
+func (n Naming) ModuleDWOFilePath(buildDir, importPath, cmFileName string) string {
+	oPath := n.ModuleOFilePath(buildDir, importPath, cmFileName)
+	return oPath[:len(oPath)-2] + ".dwo"
+}
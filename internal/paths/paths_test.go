@@ -6,6 +6,7 @@ import (
 )
 
 func TestSanitizeModuleName(t *testing.T) {
+	var n Naming
 	tests := []struct {
 		input    string
 		expected string
@@ -17,14 +18,41 @@ func TestSanitizeModuleName(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		result := SanitizeModuleName(tt.input)
+		result := n.SanitizeModuleName(tt.input)
 		if result != tt.expected {
-			t.Errorf("SanitizeModuleName(%q) = %q, expected %q", tt.input, result, tt.expected)
+			t.Errorf("n.SanitizeModuleName(%q) = %q, expected %q", tt.input, result, tt.expected)
+		}
+	}
+}
+
+func TestCheckModulePath(t *testing.T) {
+	for _, ok := range []string{"main", "math", "util/strings", "net/http2", "_internal"} {
+		if err := CheckModulePath(ok); err != nil {
+			t.Errorf("CheckModulePath(%q) = %v, want nil", ok, err)
+		}
+	}
+	for _, bad := range []string{"", "my util", "util/", "a//b", "2d", "my-lib", "util.v2"} {
+		if err := CheckModulePath(bad); err == nil {
+			t.Errorf("CheckModulePath(%q) = nil, want an error", bad)
+		}
+	}
+}
+
+func TestCheckRootModulePath(t *testing.T) {
+	for _, ok := range []string{"demo", "github.com/user/my-project", "test/lsp"} {
+		if err := CheckRootModulePath(ok); err != nil {
+			t.Errorf("CheckRootModulePath(%q) = %v, want nil", ok, err)
+		}
+	}
+	for _, bad := range []string{"", "my project", "a//b", "/abs", "quo\"te"} {
+		if err := CheckRootModulePath(bad); err == nil {
+			t.Errorf("CheckRootModulePath(%q) = nil, want an error", bad)
 		}
 	}
 }
 
 func TestModuleHeaderPath(t *testing.T) {
+	var n Naming
 	buildDir := "/build"
 	tests := []struct {
 		importPath string
@@ -35,14 +63,15 @@ func TestModuleHeaderPath(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		result := ModuleHeaderPath(buildDir, tt.importPath)
+		result := n.ModuleHeaderPath(buildDir, tt.importPath)
 		if result != tt.expected {
-			t.Errorf("ModuleHeaderPath(%q, %q) = %q, expected %q", buildDir, tt.importPath, result, tt.expected)
+			t.Errorf("n.ModuleHeaderPath(%q, %q) = %q, expected %q", buildDir, tt.importPath, result, tt.expected)
 		}
 	}
 }
 
 func TestModuleInternalHeaderPath(t *testing.T) {
+	var n Naming
 	buildDir := "/build"
 	tests := []struct {
 		importPath string
@@ -53,14 +82,24 @@ func TestModuleInternalHeaderPath(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		result := ModuleInternalHeaderPath(buildDir, tt.importPath)
+		result := n.ModuleInternalHeaderPath(buildDir, tt.importPath)
 		if result != tt.expected {
-			t.Errorf("ModuleInternalHeaderPath(%q, %q) = %q, expected %q", buildDir, tt.importPath, result, tt.expected)
+			t.Errorf("n.ModuleInternalHeaderPath(%q, %q) = %q, expected %q", buildDir, tt.importPath, result, tt.expected)
 		}
 	}
 }
 
+func TestModulePCHPath(t *testing.T) {
+	var n Naming
+	result := n.ModulePCHPath("/build", "fileio/ticketio")
+	expected := filepath.Join("/build", "fileio_ticketio_internal.h.gch")
+	if result != expected {
+		t.Errorf("ModulePCHPath = %q, expected %q", result, expected)
+	}
+}
+
 func TestModuleCFilePath(t *testing.T) {
+	var n Naming
 	buildDir := "/build"
 	tests := []struct {
 		importPath string
@@ -73,14 +112,15 @@ func TestModuleCFilePath(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		result := ModuleCFilePath(buildDir, tt.importPath, tt.cmFileName)
+		result := n.ModuleCFilePath(buildDir, tt.importPath, tt.cmFileName)
 		if result != tt.expected {
-			t.Errorf("ModuleCFilePath(%q, %q, %q) = %q, expected %q", buildDir, tt.importPath, tt.cmFileName, result, tt.expected)
+			t.Errorf("n.ModuleCFilePath(%q, %q, %q) = %q, expected %q", buildDir, tt.importPath, tt.cmFileName, result, tt.expected)
 		}
 	}
 }
 
 func TestModuleOFilePath(t *testing.T) {
+	var n Naming
 	buildDir := "/build"
 	tests := []struct {
 		importPath string
@@ -92,9 +132,97 @@ func TestModuleOFilePath(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		result := ModuleOFilePath(buildDir, tt.importPath, tt.cmFileName)
+		result := n.ModuleOFilePath(buildDir, tt.importPath, tt.cmFileName)
 		if result != tt.expected {
-			t.Errorf("ModuleOFilePath(%q, %q, %q) = %q, expected %q", buildDir, tt.importPath, tt.cmFileName, result, tt.expected)
+			t.Errorf("n.ModuleOFilePath(%q, %q, %q) = %q, expected %q", buildDir, tt.importPath, tt.cmFileName, result, tt.expected)
+		}
+	}
+}
+
+func TestModuleOFilePathMirrored(t *testing.T) {
+	n := Naming{MirrorObjects: true}
+
+	// "a/b" + "c_d.cm" and "a/b_c" + "d.cm" share a flat name but not a mirrored one
+	if got, want := n.ModuleOFilePath("/build", "a/b", "c_d.cm"), filepath.Join("/build", "obj", "a", "b", "c_d.o"); got != want {
+		t.Errorf("ModuleOFilePath = %q, expected %q", got, want)
+	}
+	if got, want := n.ModuleOFilePath("/build", "a/b_c", "d.cm"), filepath.Join("/build", "obj", "a", "b_c", "d.o"); got != want {
+		t.Errorf("ModuleOFilePath = %q, expected %q", got, want)
+	}
+	if got, want := n.ModuleCFilePath("/build", "a/b", "c_d.cm"), filepath.Join("/build", "obj", "a", "b", "c_d.c"); got != want {
+		t.Errorf("ModuleCFilePath = %q, expected %q", got, want)
+	}
+	if got, want := n.ModuleDWOFilePath("/build", "main", "main.cm"), filepath.Join("/build", "obj", "main", "main.dwo"); got != want {
+		t.Errorf("ModuleDWOFilePath = %q, expected %q", got, want)
+	}
+}
+
+func TestModuleDWOFilePath(t *testing.T) {
+	var n Naming
+	result := n.ModuleDWOFilePath("/build", "fileio/ticketio", "ticketio.cm")
+	expected := filepath.Join("/build", "fileio_ticketio_ticketio.dwo")
+	if result != expected {
+		t.Errorf("ModuleDWOFilePath = %q, expected %q", result, expected)
+	}
+}
+
+func TestManglingDouble(t *testing.T) {
+	var n Naming
+	// Module "a_b" with symbol "c" vs module "a" with symbol "b_c"
+	ambiguous := func() (string, string) {
+		return n.Mangle(n.SanitizeModuleName("a_b"), "c"), n.Mangle(n.SanitizeModuleName("a"), "b_c")
+	}
+
+	if x, y := ambiguous(); x != y {
+		t.Fatalf("expected default scheme to collide, got %q and %q", x, y)
+	}
+
+	n = Naming{Mangling: ManglingDouble}
+
+	x, y := ambiguous()
+	if x != "a_b__c" || y != "a__b_c" {
+		t.Errorf("expected a_b__c and a__b_c, got %q and %q", x, y)
+	}
+	if got := n.Mangle(n.SanitizeModuleName("utils/io"), "State", "IDLE"); got != "utils__io__State__IDLE" {
+		t.Errorf("unexpected enum value name %q", got)
+	}
+	if got := n.ModuleCFilePath("/build", "a/b", "c.cm"); got != filepath.Join("/build", "a__b__c.c") {
+		t.Errorf("unexpected C file path %q", got)
+	}
+}
+
+func TestManglingLength(t *testing.T) {
+	n := Naming{Mangling: ManglingLength}
+
+	tests := []struct {
+		module string
+		names  []string
+		want   string
+	}{
+		{"a_b", []string{"c"}, "N3a_bE1c"},
+		{"a", []string{"b_c"}, "N1aE3b_c"},
+		// Module "a/b" with symbol "c" vs module "a" with enum "b" member "c"
+		{"a/b", []string{"c"}, "N1a1bE1c"},
+		{"a", []string{"b", "c"}, "N1aE1b1c"},
+		{"utils/io", []string{"State", "IDLE"}, "N5utils2ioE5State4IDLE"},
+	}
+	for _, tt := range tests {
+		if got := n.Mangle(n.SanitizeModuleName(tt.module), tt.names...); got != tt.want {
+			t.Errorf("n.Mangle(%q, %q) = %q, want %q", tt.module, tt.names, got, tt.want)
 		}
 	}
+	if got := n.ModuleCFilePath("/build", "a/b", "c.cm"); got != filepath.Join("/build", "N1a1bE1c.c") {
+		t.Errorf("unexpected C file path %q", got)
+	}
+}
+
+func TestCheckMangling(t *testing.T) {
+	for _, ok := range []string{"", ManglingUnderscore, ManglingDouble, ManglingLength} {
+		if err := CheckMangling(ok); err != nil {
+			t.Errorf("CheckMangling(%q) = %v, want nil", ok, err)
+		}
+	}
+	if err := CheckMangling("hashed"); err == nil {
+		t.Error("expected an error for an unknown scheme")
+	}
 }
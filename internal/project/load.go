@@ -0,0 +1,55 @@
+package project
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/elijahmorgan/c_minus/internal/parser"
+)
+
+// LoadedProject is a discovered project with every module file parsed and
+// the declarations collected into a symbol table
+type LoadedProject struct {
+	*Project
+	Files   map[string][]*parser.File // Import path -> parsed files, in ModuleInfo.Files order
+	Symbols *SymbolTable
+}
+
+// Load discovers the project containing startDir with the given build
+// context (nil as for Discover) and parses all of its modules
+func Load(startDir string, ctx *BuildContext) (*LoadedProject, error) {
+	proj, err := DiscoverWithContext(startDir, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	loaded := &LoadedProject{Project: proj, Files: make(map[string][]*parser.File), Symbols: newSymbolTable()}
+	importPaths := make([]string, 0, len(proj.Modules))
+	for importPath := range proj.Modules {
+		importPaths = append(importPaths, importPath)
+	}
+	sort.Strings(importPaths)
+	for _, importPath := range importPaths {
+		for _, fpath := range proj.Modules[importPath].Files {
+			pf, err := parser.ParseFile(fpath)
+			if err != nil {
+				return nil, fmt.Errorf("parse %s: %w", fpath, err)
+			}
+			loaded.Files[importPath] = append(loaded.Files[importPath], pf)
+			if err := loaded.Symbols.add(importPath, pf, fpath, ""); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return loaded, nil
+}
+
+// Lookup returns the symbol name declared by module importPath
+func (p *LoadedProject) Lookup(importPath, name string) (Symbol, bool) {
+	for _, sym := range p.Symbols.Modules[importPath] {
+		if sym.Name == name {
+			return sym, true
+		}
+	}
+	return Symbol{}, false
+}
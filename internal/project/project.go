@@ -6,6 +6,10 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+
+	"github.com/elijahmorgan/c_minus/internal/diag"
+	"github.com/elijahmorgan/c_minus/internal/parser"
+	"github.com/elijahmorgan/c_minus/internal/paths"
 )
 
 // DefaultBuildContext returns a BuildContext based on the current runtime
@@ -49,6 +53,44 @@ type Project struct {
 	RootPath   string                 // Filesystem path to project root (where cm.mod is)
 	RootModule string                 // Module path from cm.mod (e.g., "github.com/user/myproject")
 	Modules    map[string]*ModuleInfo // Import path -> module info
+	Targets    []Target               // Build targets from cm.mod (empty = one executable of all modules)
+	Mangling   string                 // Mangling scheme from cm.mod (empty = default)
+}
+
+// Target kinds accepted in cm.mod
+const (
+	TargetExecutable = "exe" // Linked executable
+	TargetLibrary    = "lib" // Static library archive (lib<name>.a)
+)
+
+// Target is a build artifact declared in cm.mod as
+//
+//	target "name" exe "main"
+//
+// The artifact contains the root module and everything it imports.
+type Target struct {
+	Name string // Output name
+	Kind string // TargetExecutable or TargetLibrary
+	Root string // Import path of the root module
+}
+
+// modFile holds the contents of cm.mod
+type modFile struct {
+	Module   string
+	Targets  []Target
+	Requires []Require
+	Mangling string
+}
+
+// Require is a dependency declared in cm.mod as
+//
+//	require "../sibling-project"
+//	require "github.com/user/lib" v1.0.0
+//
+// Only local paths are resolved so far.
+type Require struct {
+	Path    string // Local directory (relative to cm.mod) or remote module path
+	Version string // Version of a remote module (empty for local paths)
 }
 
 // ModuleInfo represents a single module (directory with .cm files)
@@ -57,7 +99,7 @@ type ModuleInfo struct {
 	DirPath    string   // Filesystem path to module directory
 	Files      []string // All .cm files in this module (absolute paths)
 	Imports    []string // Dependencies (other module import paths)
-	External   bool     // True if external dependency (future)
+	External   bool     // True if the module comes from a required dependency
 }
 
 // BuildContext contains the current build configuration for tag matching
@@ -76,7 +118,7 @@ func Discover(startDir string) (*Project, error) {
 // DiscoverWithContext finds the project root and scans modules, filtering by build context
 func DiscoverWithContext(startDir string, ctx *BuildContext) (*Project, error) {
 	// Find project root by walking up directories
-	rootPath, rootModule, err := findProjectRoot(startDir)
+	rootPath, mf, err := findProjectRoot(startDir)
 	if err != nil {
 		return nil, err
 	}
@@ -89,8 +131,16 @@ func DiscoverWithContext(startDir string, ctx *BuildContext) (*Project, error) {
 
 	proj := &Project{
 		RootPath:   rootPath,
-		RootModule: rootModule,
+		RootModule: mf.Module,
 		Modules:    modules,
+		Targets:    mf.Targets,
+		Mangling:   mf.Mangling,
+	}
+
+	// Merge the modules of required projects
+	seen := map[string]bool{rootPath: true}
+	if err := loadRequires(proj, mf.Requires, rootPath, ctx, seen); err != nil {
+		return nil, err
 	}
 
 	// Validate module declarations and build dependency graph
@@ -106,11 +156,21 @@ func DiscoverWithContext(startDir string, ctx *BuildContext) (*Project, error) {
 	return proj, nil
 }
 
+// FindRoot walks up from startDir to the directory holding cm.mod and checks
+// that cm.mod parses, returning that directory and the declared module name
+func FindRoot(startDir string) (root, module string, err error) {
+	root, mf, err := findProjectRoot(startDir)
+	if err != nil {
+		return "", "", err
+	}
+	return root, mf.Module, nil
+}
+
 // findProjectRoot walks up from startDir to find cm.mod
-func findProjectRoot(startDir string) (string, string, error) {
+func findProjectRoot(startDir string) (string, *modFile, error) {
 	absPath, err := filepath.Abs(startDir)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to get absolute path: %w", err)
+		return "", nil, fmt.Errorf("failed to get absolute path: %w", err)
 	}
 
 	current := absPath
@@ -118,45 +178,147 @@ func findProjectRoot(startDir string) (string, string, error) {
 		modPath := filepath.Join(current, "cm.mod")
 		if _, err := os.Stat(modPath); err == nil {
 			// Found cm.mod, parse it
-			moduleName, err := parseModFile(modPath)
+			mf, err := parseModFile(modPath)
 			if err != nil {
-				return "", "", err
+				return "", nil, err
 			}
-			return current, moduleName, nil
+			return current, mf, nil
 		}
 
 		parent := filepath.Dir(current)
 		if parent == current {
 			// Reached filesystem root
-			return "", "", fmt.Errorf("no cm.mod found (searched up from %s)", absPath)
+			return "", nil, fmt.Errorf("no cm.mod found (searched up from %s)", absPath)
 		}
 		current = parent
 	}
 }
 
-// parseModFile parses cm.mod to extract the module declaration
-func parseModFile(path string) (string, error) {
-	data, err := os.ReadFile(path)
+// parseModFile parses cm.mod: the module declaration and any build targets
+func parseModFile(path string) (*modFile, error) {
+	data, err := readSource(path)
 	if err != nil {
-		return "", fmt.Errorf("failed to read cm.mod: %w", err)
+		return nil, fmt.Errorf("failed to read cm.mod: %w", err)
 	}
 
-	// Simple parsing: look for module "name"
-	lines := strings.Split(string(data), "\n")
+	mf := &modFile{}
+	seen := make(map[string]bool)
+	lines := strings.Split(data, "\n")
 	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if strings.HasPrefix(line, "module") {
+		line = parser.StripLineComment(strings.TrimSpace(line))
+		if strings.HasPrefix(line, "module") && mf.Module == "" {
 			// Extract quoted string
 			parts := strings.Fields(line)
 			if len(parts) != 2 {
-				return "", fmt.Errorf("invalid module declaration in cm.mod: %s", line)
+				return nil, fmt.Errorf("invalid module declaration in cm.mod: %s", line)
+			}
+			mf.Module = strings.Trim(parts[1], `"`)
+			if err := paths.CheckRootModulePath(mf.Module); err != nil {
+				return nil, fmt.Errorf("invalid module declaration in cm.mod: %w", err)
+			}
+		} else if strings.HasPrefix(line, "target") {
+			// target "name" kind "root"
+			parts := strings.Fields(line)
+			if len(parts) != 4 {
+				return nil, fmt.Errorf("invalid target in cm.mod (want target \"name\" exe|lib \"root\"): %s", line)
+			}
+			t := Target{
+				Name: strings.Trim(parts[1], `"`),
+				Kind: parts[2],
+				Root: strings.Trim(parts[3], `"`),
+			}
+			if t.Kind != TargetExecutable && t.Kind != TargetLibrary {
+				return nil, fmt.Errorf("invalid target kind %q in cm.mod (want %s or %s)", t.Kind, TargetExecutable, TargetLibrary)
+			}
+			if seen[t.Name] {
+				return nil, fmt.Errorf("duplicate target %q in cm.mod", t.Name)
+			}
+			seen[t.Name] = true
+			mf.Targets = append(mf.Targets, t)
+		} else if strings.HasPrefix(line, "mangling") {
+			// mangling "length"
+			parts := strings.Fields(line)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("invalid mangling in cm.mod: %s", line)
+			}
+			mf.Mangling = strings.Trim(parts[1], `"`)
+			if err := paths.CheckMangling(mf.Mangling); err != nil {
+				return nil, fmt.Errorf("cm.mod: %w", err)
 			}
-			moduleName := strings.Trim(parts[1], `"`)
-			return moduleName, nil
+		} else if strings.HasPrefix(line, "require") {
+			// require "path" [version]
+			parts := strings.Fields(line)
+			if len(parts) != 2 && len(parts) != 3 {
+				return nil, fmt.Errorf("invalid require in cm.mod (want require \"path\" [version]): %s", line)
+			}
+			r := Require{Path: strings.Trim(parts[1], `"`)}
+			if len(parts) == 3 {
+				r.Version = parts[2]
+			}
+			mf.Requires = append(mf.Requires, r)
 		}
 	}
 
-	return "", fmt.Errorf("no module declaration found in cm.mod")
+	if mf.Module == "" {
+		return nil, fmt.Errorf("no module declaration found in cm.mod")
+	}
+	return mf, nil
+}
+
+// loadRequires adds the modules of each required project to proj, following
+// their own requires. Modules keep the import paths they have in their own
+// project; the dependency's root directory (its "main") is not imported.
+// seen holds the project directories already loaded.
+func loadRequires(proj *Project, requires []Require, dir string, ctx *BuildContext, seen map[string]bool) error {
+	for _, req := range requires {
+		if !isLocalRequire(req.Path) {
+			return fmt.Errorf("require %q: remote dependencies are not supported yet, use a local path", req.Path)
+		}
+		depDir := req.Path
+		if !filepath.IsAbs(depDir) {
+			depDir = filepath.Join(dir, depDir)
+		}
+		depDir = filepath.Clean(depDir)
+		if seen[depDir] {
+			continue
+		}
+		seen[depDir] = true
+
+		if rel, err := filepath.Rel(proj.RootPath, depDir); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("require %q: %s is inside the project", req.Path, depDir)
+		}
+
+		mf, err := parseModFile(filepath.Join(depDir, "cm.mod"))
+		if err != nil {
+			return fmt.Errorf("require %q: %w", req.Path, err)
+		}
+		modules, err := scanModulesWithContext(depDir, ctx)
+		if err != nil {
+			return fmt.Errorf("require %q: %w", req.Path, err)
+		}
+
+		for importPath, mod := range modules {
+			if importPath == "main" {
+				continue
+			}
+			if existing, ok := proj.Modules[importPath]; ok {
+				return fmt.Errorf("require %q: module %q in %s conflicts with %s", req.Path, importPath, mod.DirPath, existing.DirPath)
+			}
+			mod.External = true
+			proj.Modules[importPath] = mod
+		}
+
+		if err := loadRequires(proj, mf.Requires, depDir, ctx, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isLocalRequire reports whether a require path names a local directory
+func isLocalRequire(path string) bool {
+	return filepath.IsAbs(path) || path == "." || path == ".." ||
+		strings.HasPrefix(path, "./") || strings.HasPrefix(path, "../")
 }
 
 // scanModules recursively finds all .cm files and groups them by directory
@@ -247,14 +409,14 @@ func validateModules(proj *Project) error {
 			if declaredModule == "" {
 				declaredModule = mod
 			} else if declaredModule != mod {
-				return fmt.Errorf("module mismatch in %s: expected %q, got %q",
-					filePath, declaredModule, mod)
+				return fmt.Errorf("module mismatch in %s: expected %q, got %q [%s]",
+					filePath, declaredModule, mod, diag.ModuleMismatch)
 			}
 
 			// Validate module path matches directory
 			if mod != importPath {
-				return fmt.Errorf("module path mismatch in %s: module declares %q but directory is %q",
-					filePath, mod, importPath)
+				return fmt.Errorf("module path mismatch in %s: module declares %q but directory is %q [%s]",
+					filePath, mod, importPath, diag.ModulePathMismatch)
 			}
 
 			// Collect imports
@@ -275,14 +437,14 @@ func validateModules(proj *Project) error {
 
 // fastScanFile quickly scans a file for module and import declarations
 func fastScanFile(path string) (module string, imports []string, err error) {
-	data, err := os.ReadFile(path)
+	data, err := readSource(path)
 	if err != nil {
 		return "", nil, fmt.Errorf("failed to read %s: %w", path, err)
 	}
 
-	lines := strings.Split(string(data), "\n")
+	lines := strings.Split(data, "\n")
 	for _, line := range lines {
-		line = strings.TrimSpace(line)
+		line = parser.StripLineComment(strings.TrimSpace(line))
 
 		// Parse module declaration
 		if strings.HasPrefix(line, "module") {
@@ -309,15 +471,25 @@ func fastScanFile(path string) (module string, imports []string, err error) {
 	return module, imports, nil
 }
 
+// readSource reads a .cm or cm.mod file without the UTF-8 byte order mark
+// some Windows editors write at its start
+func readSource(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(string(data), "\ufeff"), nil
+}
+
 // extractBuildTags reads a file and extracts build tags
 func extractBuildTags(path string) ([][]string, error) {
-	data, err := os.ReadFile(path)
+	data, err := readSource(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read %s: %w", path, err)
 	}
 
 	var buildTags [][]string
-	lines := strings.Split(string(data), "\n")
+	lines := strings.Split(data, "\n")
 
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
@@ -408,8 +580,13 @@ func detectCycles(proj *Project) error {
 		if _, exists := inDegree[path]; !exists {
 			inDegree[path] = 0
 		}
-		graph[path] = mod.Imports
+		// Imports of modules not in the project (e.g. excluded by build tags)
+		// cannot be part of a cycle; the build reports them separately
 		for _, imp := range mod.Imports {
+			if _, ok := proj.Modules[imp]; !ok {
+				continue
+			}
+			graph[path] = append(graph[path], imp)
 			inDegree[imp]++
 		}
 	}
@@ -438,7 +615,7 @@ func detectCycles(proj *Project) error {
 
 	// If we didn't process all modules, there's a cycle
 	if processed != len(proj.Modules) {
-		return fmt.Errorf("circular dependency detected among modules")
+		return fmt.Errorf("circular dependency detected among modules [%s]", diag.CircularDependency)
 	}
 
 	return nil
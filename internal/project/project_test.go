@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -25,7 +26,7 @@ func TestFindProjectRoot(t *testing.T) {
 	}
 
 	// Test finding from subdirectory
-	rootPath, rootModule, err := findProjectRoot(subDir)
+	rootPath, mf, err := findProjectRoot(subDir)
 	if err != nil {
 		t.Fatalf("findProjectRoot failed: %v", err)
 	}
@@ -34,8 +35,31 @@ func TestFindProjectRoot(t *testing.T) {
 		t.Errorf("expected root path %s, got %s", tmpDir, rootPath)
 	}
 
-	if rootModule != "github.com/test/project" {
-		t.Errorf("expected module github.com/test/project, got %s", rootModule)
+	if mf.Module != "github.com/test/project" {
+		t.Errorf("expected module github.com/test/project, got %s", mf.Module)
+	}
+}
+
+func TestFindRoot(t *testing.T) {
+	tmpDir := t.TempDir()
+	if _, _, err := FindRoot(tmpDir); err == nil {
+		t.Error("expected an error without cm.mod")
+	}
+
+	modPath := filepath.Join(tmpDir, "cm.mod")
+	if err := os.WriteFile(modPath, []byte("target \"app\"\n"), 0644); err != nil {
+		t.Fatalf("failed to create cm.mod: %v", err)
+	}
+	if _, _, err := FindRoot(tmpDir); err == nil {
+		t.Error("expected an error for an invalid cm.mod")
+	}
+
+	if err := os.WriteFile(modPath, []byte(`module "demo"`), 0644); err != nil {
+		t.Fatalf("failed to write cm.mod: %v", err)
+	}
+	root, module, err := FindRoot(tmpDir)
+	if err != nil || root != tmpDir || module != "demo" {
+		t.Errorf("FindRoot = %q, %q, %v; want %q, demo", root, module, err, tmpDir)
 	}
 }
 
@@ -192,6 +216,42 @@ func TestDetectCycles(t *testing.T) {
 	}
 }
 
+func TestDetectCyclesIgnoresMissingImport(t *testing.T) {
+	proj := &Project{Modules: map[string]*ModuleInfo{
+		"main": {ImportPath: "main", Imports: []string{"util", "trace"}},
+		"util": {ImportPath: "util"},
+	}}
+
+	// "trace" has no files (e.g. excluded by build tags); that is not a cycle
+	if err := detectCycles(proj); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestDiscoverWithContextDropsExcludedModule(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "cm.mod"), []byte("module \"tags\"\n"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "main.cm"), []byte("module \"main\"\n"), 0644)
+	os.MkdirAll(filepath.Join(tmpDir, "trace"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "trace", "trace.cm"), []byte("// +build trace\n\nmodule \"trace\"\n"), 0644)
+
+	proj, err := DiscoverWithContext(tmpDir, NewBuildContext(nil, false))
+	if err != nil {
+		t.Fatalf("DiscoverWithContext failed: %v", err)
+	}
+	if _, ok := proj.Modules["trace"]; ok || len(proj.Modules) != 1 {
+		t.Errorf("expected only main, got %v", proj.Modules)
+	}
+
+	proj, err = DiscoverWithContext(tmpDir, NewBuildContext([]string{"trace"}, false))
+	if err != nil {
+		t.Fatalf("DiscoverWithContext failed: %v", err)
+	}
+	if _, ok := proj.Modules["trace"]; !ok {
+		t.Error("expected trace with -tags trace")
+	}
+}
+
 func TestDetectNoCycles(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -347,3 +407,182 @@ func TestDefaultBuildContext(t *testing.T) {
 		t.Error("expected Tags to be initialized")
 	}
 }
+
+func TestFastScanFileTrailingComments(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "main.cm")
+	src := "module \"x\" // note\nimport \"y\"//note\nimport \"a//b\"\n"
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	module, imports, err := fastScanFile(path)
+	if err != nil {
+		t.Fatalf("fastScanFile failed: %v", err)
+	}
+	if module != "x" {
+		t.Errorf("expected module x, got %q", module)
+	}
+	if len(imports) != 2 || imports[0] != "y" || imports[1] != "a//b" {
+		t.Errorf("expected imports [y a//b], got %q", imports)
+	}
+}
+
+func TestDiscoverWithByteOrderMarks(t *testing.T) {
+	tmpDir := t.TempDir()
+	bom := "\ufeff"
+	os.WriteFile(filepath.Join(tmpDir, "cm.mod"), []byte(bom+"module \"bom\"\n"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "main.cm"), []byte(bom+"module \"main\"\n\nimport \"util\"\n"), 0644)
+	os.MkdirAll(filepath.Join(tmpDir, "util"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "util", "util.cm"), []byte(bom+"module \"util\"\n"), 0644)
+	os.MkdirAll(filepath.Join(tmpDir, "trace"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "trace", "trace.cm"), []byte(bom+"// +build trace\n\nmodule \"trace\"\n"), 0644)
+
+	proj, err := DiscoverWithContext(tmpDir, NewBuildContext(nil, false))
+	if err != nil {
+		t.Fatalf("DiscoverWithContext failed: %v", err)
+	}
+	if proj.RootModule != "bom" {
+		t.Errorf("expected cm.mod module bom, got %q", proj.RootModule)
+	}
+	if len(proj.Modules) != 2 || proj.Modules["main"] == nil || proj.Modules["util"] == nil {
+		t.Errorf("expected main and util, got %v", proj.Modules)
+	}
+}
+
+func TestParseModFileTargets(t *testing.T) {
+	tmpDir := t.TempDir()
+	modPath := filepath.Join(tmpDir, "cm.mod")
+	content := `module "github.com/test/project"
+
+target "app" exe "main"   // the program
+target "mathlib" lib "math"
+`
+	if err := os.WriteFile(modPath, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to create cm.mod: %v", err)
+	}
+
+	mf, err := parseModFile(modPath)
+	if err != nil {
+		t.Fatalf("parseModFile failed: %v", err)
+	}
+	want := []Target{
+		{Name: "app", Kind: TargetExecutable, Root: "main"},
+		{Name: "mathlib", Kind: TargetLibrary, Root: "math"},
+	}
+	if len(mf.Targets) != len(want) {
+		t.Fatalf("expected %d targets, got %v", len(want), mf.Targets)
+	}
+	for i := range want {
+		if mf.Targets[i] != want[i] {
+			t.Errorf("target %d: expected %v, got %v", i, want[i], mf.Targets[i])
+		}
+	}
+
+	for _, bad := range []string{
+		"module \"x\"\ntarget \"a\" dll \"main\"\n",
+		"module \"x\"\ntarget \"a\" exe\n",
+		"module \"x\"\ntarget \"a\" exe \"main\"\ntarget \"a\" lib \"math\"\n",
+		"module \"\"\n",
+		"module \"my project\"\n",
+		"module \"a//b\"\n",
+	} {
+		if err := os.WriteFile(modPath, []byte(bad), 0644); err != nil {
+			t.Fatalf("failed to write cm.mod: %v", err)
+		}
+		if _, err := parseModFile(modPath); err == nil {
+			t.Errorf("expected an error for cm.mod:\n%s", bad)
+		}
+	}
+}
+
+func TestDiscoverLocalRequire(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"app/cm.mod":           "module \"app\"\nrequire \"../geom\"\n",
+		"app/main.cm":          "module \"main\"\nimport \"shapes\"\n",
+		"geom/cm.mod":          "module \"geom\"\nrequire \"../units\"\n",
+		"geom/main.cm":         "module \"main\"\n",
+		"geom/shapes/shape.cm": "module \"shapes\"\nimport \"meters\"\n",
+		"units/cm.mod":         "module \"units\"\nrequire \"../geom\"\n",
+		"units/meters/m.cm":    "module \"meters\"\n",
+	}
+	for rel, content := range files {
+		path := filepath.Join(tmpDir, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	proj, err := Discover(filepath.Join(tmpDir, "app"))
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	if len(proj.Modules) != 3 {
+		t.Fatalf("expected main, shapes, and meters, got %v", proj.Modules)
+	}
+	if proj.Modules["main"].External || proj.Modules["main"].DirPath != filepath.Join(tmpDir, "app") {
+		t.Errorf("main must be the project's own module, got %+v", proj.Modules["main"])
+	}
+	for _, name := range []string{"shapes", "meters"} {
+		if mod := proj.Modules[name]; mod == nil || !mod.External {
+			t.Errorf("expected external module %q, got %+v", name, mod)
+		}
+	}
+
+	// A dependency module may not shadow one of the project's own
+	if err := os.MkdirAll(filepath.Join(tmpDir, "app", "meters"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "app", "meters", "m.cm"), []byte("module \"meters\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Discover(filepath.Join(tmpDir, "app")); err == nil || !strings.Contains(err.Error(), "conflicts") {
+		t.Errorf("expected a module conflict error, got %v", err)
+	}
+}
+
+func TestParseModFileRemoteRequire(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "cm.mod"), []byte("module \"app\"\nrequire \"github.com/user/lib\" v1.0.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mf, err := parseModFile(filepath.Join(tmpDir, "cm.mod"))
+	if err != nil {
+		t.Fatalf("parseModFile failed: %v", err)
+	}
+	if len(mf.Requires) != 1 || mf.Requires[0] != (Require{Path: "github.com/user/lib", Version: "v1.0.0"}) {
+		t.Errorf("unexpected requires %v", mf.Requires)
+	}
+
+	if _, err := Discover(tmpDir); err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Errorf("expected remote require to be rejected, got %v", err)
+	}
+}
+
+func TestParseModFileMangling(t *testing.T) {
+	tmpDir := t.TempDir()
+	modPath := filepath.Join(tmpDir, "cm.mod")
+
+	if err := os.WriteFile(modPath, []byte("module \"app\"\nmangling \"length\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mf, err := parseModFile(modPath)
+	if err != nil {
+		t.Fatalf("parseModFile failed: %v", err)
+	}
+	if mf.Mangling != "length" {
+		t.Errorf("expected mangling length, got %q", mf.Mangling)
+	}
+
+	if err := os.WriteFile(modPath, []byte("module \"app\"\nmangling \"hashed\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseModFile(modPath); err == nil {
+		t.Error("expected an unknown scheme to be rejected")
+	}
+}
@@ -0,0 +1,357 @@
+package project
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/elijahmorgan/c_minus/internal/parser"
+)
+
+// SymbolKind is the kind of top-level declaration a Symbol names
+type SymbolKind string
+
+const (
+	SymbolFunc    SymbolKind = "func"
+	SymbolStruct  SymbolKind = "struct"
+	SymbolUnion   SymbolKind = "union"
+	SymbolEnum    SymbolKind = "enum"
+	SymbolTypedef SymbolKind = "typedef"
+	SymbolGlobal  SymbolKind = "global"
+	SymbolDefine  SymbolKind = "define"
+)
+
+// Symbol is a top-level declaration of a module
+type Symbol struct {
+	Name      string
+	Kind      SymbolKind
+	File      string
+	Line1     int // 1-based
+	Char0     int // 0-based best-effort
+	Public    bool
+	Doc       string
+	Signature string
+	Value     string   // Replacement text of a #define
+	Params    []string // Parameter names of a function
+	Fields    []string // Member names of a struct or union
+	Opaque    bool     // Opaque struct: fields are hidden from other modules
+}
+
+// SymbolTable holds the declarations of every module of a project
+type SymbolTable struct {
+	Modules map[string][]Symbol // importPath -> symbols
+	Docs    map[string]string   // importPath -> module doc comment
+}
+
+// BuildSymbolTable parses every module file and collects its declarations.
+// openDocs maps file paths to unsaved contents used instead of the file on
+// disk.
+func BuildSymbolTable(proj *Project, openDocs map[string]string) (*SymbolTable, error) {
+	table := newSymbolTable()
+	for importPath, mod := range proj.Modules {
+		for _, fpath := range mod.Files {
+			content, ok := openDocs[fpath]
+			var pf *parser.File
+			var err error
+			if ok {
+				pf, err = parser.ParseSource(content, fpath)
+			} else {
+				pf, err = parser.ParseFile(fpath)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("parse %s: %w", fpath, err)
+			}
+			if err := table.add(importPath, pf, fpath, content); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return table, nil
+}
+
+func newSymbolTable() *SymbolTable {
+	return &SymbolTable{Modules: make(map[string][]Symbol), Docs: make(map[string]string)}
+}
+
+// add records the declarations of a parsed file of module importPath. src is
+// the file's content, read from disk when empty.
+func (t *SymbolTable) add(importPath string, pf *parser.File, filePath, src string) error {
+	syms, err := SymbolsFromFile(pf, filePath, src)
+	if err != nil {
+		return err
+	}
+	t.Modules[importPath] = append(t.Modules[importPath], syms...)
+	if pf.ModuleDoc != "" {
+		if t.Docs[importPath] != "" {
+			t.Docs[importPath] += "\n\n"
+		}
+		t.Docs[importPath] += pf.ModuleDoc
+	}
+	return nil
+}
+
+// SymbolsFromFile returns the declarations of a parsed file, with positions
+// found in src (the file's content, read from disk when empty)
+func SymbolsFromFile(pf *parser.File, filePath string, src string) ([]Symbol, error) {
+	if src == "" {
+		b, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		src = string(b)
+	}
+
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+
+	findLineChar := func(line1 int, needle string) (int, int) {
+		if line1 <= 0 || line1 > len(lines) {
+			return line1, 0
+		}
+		idx := indexOfIdentifier(lines[line1-1], needle)
+		if idx < 0 {
+			return line1, 0
+		}
+		return line1, idx
+	}
+
+	file := filepath.Clean(filePath)
+	var out []Symbol
+	for _, d := range pf.Decls {
+		switch {
+		case d.Function != nil:
+			line1, ch0 := findLineChar(d.Function.Line, d.Function.Name)
+			params := make([]string, len(d.Function.Params))
+			for i, p := range d.Function.Params {
+				params[i] = p.Name
+			}
+			out = append(out, Symbol{Name: d.Function.Name, Kind: SymbolFunc, File: file, Line1: line1, Char0: ch0, Public: d.Function.Public, Doc: d.Function.DocComment, Signature: FuncSignature(d.Function), Params: params})
+		case d.Struct != nil:
+			line1, ch0 := findDeclLineChar(lines, "struct", d.Struct.Name)
+			sig := "struct " + d.Struct.Name
+			if d.Struct.Packed {
+				sig = "packed " + sig
+			}
+			if d.Struct.Opaque {
+				sig = "opaque " + sig
+			}
+			out = append(out, Symbol{Name: d.Struct.Name, Kind: SymbolStruct, File: file, Line1: line1, Char0: ch0, Public: d.Struct.Public, Doc: d.Struct.DocComment, Signature: sig, Fields: MemberNames(d.Struct.Body), Opaque: d.Struct.Opaque})
+		case d.Union != nil:
+			line1, ch0 := findDeclLineChar(lines, "union", d.Union.Name)
+			sig := "union " + d.Union.Name
+			if d.Union.Packed {
+				sig = "packed " + sig
+			}
+			out = append(out, Symbol{Name: d.Union.Name, Kind: SymbolUnion, File: file, Line1: line1, Char0: ch0, Public: d.Union.Public, Doc: d.Union.DocComment, Signature: sig, Fields: MemberNames(d.Union.Body)})
+		case d.Enum != nil && d.Enum.Name != "":
+			line1, ch0 := findDeclLineChar(lines, "enum", d.Enum.Name)
+			out = append(out, Symbol{Name: d.Enum.Name, Kind: SymbolEnum, File: file, Line1: line1, Char0: ch0, Public: d.Enum.Public, Doc: d.Enum.DocComment, Signature: "enum " + d.Enum.Name})
+		case d.Typedef != nil:
+			if name := TypedefName(d.Typedef.Body); name != "" {
+				line1, ch0 := findLineChar(d.Typedef.Line, name)
+				out = append(out, Symbol{Name: name, Kind: SymbolTypedef, File: file, Line1: line1, Char0: ch0, Public: d.Typedef.Public, Doc: d.Typedef.DocComment, Signature: "typedef " + name})
+			}
+		case d.Global != nil:
+			line1, ch0 := findLineChar(d.Global.Line, d.Global.Name)
+			out = append(out, Symbol{Name: d.Global.Name, Kind: SymbolGlobal, File: file, Line1: line1, Char0: ch0, Public: d.Global.Public, Doc: d.Global.DocComment, Signature: d.Global.Type + " " + d.Global.Name + d.Global.Array})
+		case d.Define != nil:
+			line1, ch0 := findDeclLineChar(lines, "#define", d.Define.Name)
+			out = append(out, Symbol{Name: d.Define.Name, Kind: SymbolDefine, File: file, Line1: line1, Char0: ch0, Public: d.Define.Public, Doc: d.Define.DocComment, Signature: "#define " + d.Define.Name, Value: d.Define.Value})
+		}
+	}
+
+	return out, nil
+}
+
+// FuncSignature formats a function declaration as "ret name(type a, type b)"
+func FuncSignature(fn *parser.FuncDecl) string {
+	if fn == nil {
+		return ""
+	}
+
+	var b strings.Builder
+	if fn.ReturnType != "" {
+		b.WriteString(fn.ReturnType)
+		b.WriteByte(' ')
+	}
+	b.WriteString(fn.Name)
+	b.WriteByte('(')
+	for i, p := range fn.Params {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		// C-minus stores params as {Type, Name}
+		if p.Type != "" {
+			b.WriteString(p.Type)
+		}
+		if p.Name != "" {
+			if p.Type != "" {
+				b.WriteByte(' ')
+			}
+			b.WriteString(p.Name)
+		}
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// MemberNames returns the member names declared in a struct or union body,
+// e.g. "{ int x, *y; char name[8]; void (*cb)(int); unsigned flag : 1; }"
+// gives x, y, name, cb, flag. Nested bodies are skipped.
+func MemberNames(body string) []string {
+	body = strings.TrimSpace(body)
+	body = strings.TrimSuffix(strings.TrimPrefix(body, "{"), "}")
+
+	var names []string
+	for _, decl := range splitTopLevel(body, ';') {
+		decl = strings.TrimSpace(decl)
+		if decl == "" || strings.HasPrefix(decl, "#") || strings.HasPrefix(decl, "//") {
+			continue
+		}
+		// Function pointer member: the name follows "(*"
+		if i := strings.Index(decl, "(*"); i >= 0 {
+			if name, _ := firstIdentifier(decl[i+2:]); name != "" {
+				names = append(names, name)
+			}
+			continue
+		}
+		for _, declarator := range splitTopLevel(decl, ',') {
+			// Drop bit widths and array dimensions
+			if i := strings.Index(declarator, ":"); i >= 0 {
+				declarator = declarator[:i]
+			}
+			if i := strings.Index(declarator, "["); i >= 0 {
+				declarator = declarator[:i]
+			}
+			if name, _ := lastIdentifier(declarator); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// splitTopLevel splits s at sep outside of brackets
+func splitTopLevel(s string, sep byte) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '{', '(', '[':
+			depth++
+		case '}', ')', ']':
+			depth--
+		case sep:
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func findDeclLineChar(lines []string, keyword, name string) (line1 int, ch0 int) {
+	for i, line := range lines {
+		// very basic match
+		if strings.Contains(line, keyword) && indexOfIdentifier(line, name) >= 0 {
+			return i + 1, indexOfIdentifier(line, name)
+		}
+	}
+	return 1, 0
+}
+
+// TypedefName returns the name declared by a typedef's text, or "" if there
+// is none: the identifier after "(*" for a function pointer ("void
+// (*Handler)(int)", "void (*Table[4])(int)"), otherwise the last identifier
+// before any array dimensions ("int Row[WIDTH]" declares Row). A struct or
+// union body is skipped, so its members' function pointers do not count.
+func TypedefName(body string) string {
+	body = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(body), ";"))
+	if close := strings.LastIndex(body, "}"); close >= 0 {
+		body = strings.TrimSpace(body[close+1:])
+	}
+	for i := 0; i < len(body); i++ {
+		if body[i] != '(' {
+			continue
+		}
+		rest := strings.TrimLeft(body[i+1:], " \t")
+		if !strings.HasPrefix(rest, "*") {
+			continue
+		}
+		rest = strings.TrimLeft(rest, "* \t")
+		end := 0
+		for end < len(rest) && isIdentChar(rest[end]) {
+			end++
+		}
+		return rest[:end]
+	}
+	for strings.HasSuffix(body, "]") {
+		open := strings.LastIndex(body, "[")
+		if open < 0 {
+			break
+		}
+		body = strings.TrimSpace(body[:open])
+	}
+	start := len(body)
+	for start > 0 && isIdentChar(body[start-1]) {
+		start--
+	}
+	return body[start:]
+}
+
+func isIdentChar(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9') || b == '_'
+}
+
+// indexOfIdentifier returns the offset of ident as a whole word in line, or -1
+func indexOfIdentifier(line, ident string) int {
+	if ident == "" {
+		return -1
+	}
+	for i := 0; i+len(ident) <= len(line); i++ {
+		if line[i:i+len(ident)] != ident {
+			continue
+		}
+		beforeOK := i == 0 || !isIdentChar(line[i-1])
+		afterOK := i+len(ident) == len(line) || !isIdentChar(line[i+len(ident)])
+		if beforeOK && afterOK {
+			return i
+		}
+	}
+	return -1
+}
+
+// firstIdentifier returns the first identifier in s and its offset
+func firstIdentifier(s string) (string, int) {
+	for i := 0; i < len(s); i++ {
+		if isIdentChar(s[i]) {
+			end := i
+			for end < len(s) && isIdentChar(s[end]) {
+				end++
+			}
+			return s[i:end], i
+		}
+	}
+	return "", -1
+}
+
+// lastIdentifier returns the last identifier in line and its offset
+func lastIdentifier(line string) (string, int) {
+	end := -1
+	for i := len(line) - 1; i >= 0; i-- {
+		if isIdentChar(line[i]) {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return "", -1
+	}
+	start := end
+	for start >= 0 && isIdentChar(line[start]) {
+		start--
+	}
+	start++
+	return line[start : end+1], start
+}
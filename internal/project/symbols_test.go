@@ -0,0 +1,121 @@
+package project
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"cm.mod": `module "demo"`,
+		"main.cm": `module "main"
+
+import "geo"
+
+func main() int {
+    return geo.area(geo.origin());
+}
+`,
+		"geo/geo.cm": `// Package geo does geometry
+module "geo"
+
+// Point is a position
+pub struct Point {
+    int x, y;
+};
+
+pub func origin() Point {
+    Point p = {0, 0};
+    return p;
+}
+`,
+		"geo/area.cm": `module "geo"
+
+#define SCALE 2
+
+pub func area(Point p) int {
+    return p.x * p.y * SCALE;
+}
+`,
+	}
+	for rel, content := range files {
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	loaded, err := Load(root, nil)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if loaded.RootModule != "demo" || len(loaded.Modules) != 2 {
+		t.Fatalf("unexpected project %+v", loaded.Project)
+	}
+	if len(loaded.Files["geo"]) != 2 || len(loaded.Files["main"]) != 1 {
+		t.Errorf("expected parsed files per module, got %v", loaded.Files)
+	}
+	if loaded.Symbols.Docs["geo"] != "Package geo does geometry" {
+		t.Errorf("unexpected module doc %q", loaded.Symbols.Docs["geo"])
+	}
+
+	point, ok := loaded.Lookup("geo", "Point")
+	if !ok || point.Kind != SymbolStruct || !point.Public || point.Line1 != 5 || strings.Join(point.Fields, ",") != "x,y" {
+		t.Errorf("unexpected Point symbol %+v", point)
+	}
+	area, ok := loaded.Lookup("geo", "area")
+	if !ok || area.Kind != SymbolFunc || area.Signature != "int area(Point p)" || filepath.Base(area.File) != "area.cm" {
+		t.Errorf("unexpected area symbol %+v", area)
+	}
+	if scale, ok := loaded.Lookup("geo", "SCALE"); !ok || scale.Kind != SymbolDefine || scale.Public || scale.Value != "2" {
+		t.Errorf("unexpected SCALE symbol %+v", scale)
+	}
+	if main, ok := loaded.Lookup("main", "main"); !ok || main.Kind != SymbolFunc {
+		t.Errorf("expected main in module main, got %+v", main)
+	}
+	if _, ok := loaded.Lookup("main", "Point"); ok {
+		t.Error("Point is declared in geo, not main")
+	}
+
+	// A parse error fails the load
+	if err := os.WriteFile(filepath.Join(root, "geo", "bad.cm"), []byte("module \"geo\"\n\npub func broken(\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(root, nil); err == nil || !strings.Contains(err.Error(), "bad.cm") {
+		t.Errorf("expected a parse error naming bad.cm, got %v", err)
+	}
+}
+
+func TestMemberNames(t *testing.T) {
+	body := "{\n    int x, *y;\n    char name[8];\n    void (*cb)(int);\n    unsigned flag : 1;\n    geo.Point at;\n}"
+	got := MemberNames(body)
+	want := []string{"x", "y", "name", "cb", "flag", "at"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("MemberNames = %v, want %v", got, want)
+	}
+}
+
+func TestTypedefName(t *testing.T) {
+	tests := map[string]string{
+		"int Counter":                           "Counter",
+		"void (*Visit)(Point p)":                "Visit",
+		"char Name[16]":                         "Name",
+		"struct { int x; } Pair;":               "Pair",
+		"void (*Table[4])(int);":                "Table",
+		"int ( * Cmp)(int, int)":                "Cmp",
+		"int Grid[W][H]":                        "Grid",
+		"struct { void (*cb)(int); } Callbacks": "Callbacks",
+		"":                                      "",
+	}
+	for body, want := range tests {
+		if got := TypedefName(body); got != want {
+			t.Errorf("TypedefName(%q) = %q, want %q", body, got, want)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+// Package sourcemap records which .cm line each line of a generated .c file
+// came from, so tools can map compiler output and editor positions without
+// scanning the C for #line directives themselves.
+package sourcemap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Version is the format version written to every sourcemap
+const Version = 1
+
+// Suffix is appended to a generated .c path to name its sourcemap
+const Suffix = ".map"
+
+// Segment maps a run of consecutive generated lines to consecutive lines of
+// one source file
+type Segment struct {
+	GeneratedLine int    `json:"generated_line"` // 1-based first generated line
+	Lines         int    `json:"lines"`          // Number of generated lines covered
+	Source        string `json:"source"`         // .cm path from the #line directive
+	SourceLine    int    `json:"source_line"`    // 1-based source line of GeneratedLine
+}
+
+// Map is the sourcemap of one generated .c file. Lines outside every segment
+// (includes, #line directives) have no source.
+type Map struct {
+	Version  int       `json:"version"`
+	File     string    `json:"file"` // Generated .c path
+	Segments []Segment `json:"segments"`
+}
+
+// Path returns the sourcemap path for a generated .c file
+func Path(cPath string) string {
+	return cPath + Suffix
+}
+
+// FromC builds the sourcemap of generated C from its #line directives. A
+// directive maps the lines after it, up to the next directive, starting at
+// the line it names.
+func FromC(file string, r io.Reader) (*Map, error) {
+	m := &Map{Version: Version, File: file}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	outLine := 0
+	for scanner.Scan() {
+		outLine++
+		source, line, ok := parseLineDirective(scanner.Text())
+		if !ok {
+			continue
+		}
+		m.closeLast(outLine - 1)
+		m.Segments = append(m.Segments, Segment{GeneratedLine: outLine + 1, Source: source, SourceLine: line})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	m.closeLast(outLine)
+
+	// A directive on the last line maps nothing
+	if n := len(m.Segments); n > 0 && m.Segments[n-1].Lines == 0 {
+		m.Segments = m.Segments[:n-1]
+	}
+	return m, nil
+}
+
+// closeLast ends the open segment at generated line last
+func (m *Map) closeLast(last int) {
+	if n := len(m.Segments); n > 0 && m.Segments[n-1].Lines == 0 {
+		seg := &m.Segments[n-1]
+		seg.Lines = max(last-seg.GeneratedLine+1, 0)
+	}
+}
+
+// parseLineDirective parses `#line <number> "<path>"`
+func parseLineDirective(text string) (string, int, bool) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "#line ") {
+		return "", 0, false
+	}
+	rest := strings.TrimSpace(strings.TrimPrefix(text, "#line "))
+	num, quoted, ok := strings.Cut(rest, " ")
+	if !ok {
+		return "", 0, false
+	}
+	n, err := strconv.Atoi(num)
+	if err != nil {
+		return "", 0, false
+	}
+	quoted = strings.TrimSpace(quoted)
+	end := strings.LastIndex(quoted, "\"")
+	if !strings.HasPrefix(quoted, "\"") || end <= 0 {
+		return "", 0, false
+	}
+	return quoted[1:end], n, true
+}
+
+// Source returns the source file and line of a 1-based generated line
+func (m *Map) Source(generatedLine int) (string, int, bool) {
+	if m == nil {
+		return "", 0, false
+	}
+	for _, seg := range m.Segments {
+		if generatedLine >= seg.GeneratedLine && generatedLine < seg.GeneratedLine+seg.Lines {
+			return seg.Source, seg.SourceLine + (generatedLine - seg.GeneratedLine), true
+		}
+	}
+	return "", 0, false
+}
+
+// Generated returns the generated line for a 1-based line of source.
+// Segments of different files may interleave, and one file's segments may
+// overlap in source lines (a segment runs on past its source into the
+// generated blank lines before the next #line), so the segment starting
+// closest before the line wins.
+func (m *Map) Generated(source string, sourceLine int) (int, bool) {
+	if m == nil {
+		return 0, false
+	}
+	best := -1
+	for i, seg := range m.Segments {
+		if seg.Source != source || sourceLine < seg.SourceLine || sourceLine >= seg.SourceLine+seg.Lines {
+			continue
+		}
+		if best < 0 || seg.SourceLine > m.Segments[best].SourceLine {
+			best = i
+		}
+	}
+	if best < 0 {
+		return 0, false
+	}
+	seg := m.Segments[best]
+	return seg.GeneratedLine + (sourceLine - seg.SourceLine), true
+}
+
+// Write saves the sourcemap as JSON
+func (m *Map) Write(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// Load reads a sourcemap written by Write
+func Load(path string) (*Map, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m Map
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if m.Version != Version {
+		return nil, fmt.Errorf("%s: unsupported sourcemap version %d", path, m.Version)
+	}
+	return &m, nil
+}
@@ -0,0 +1,69 @@
+package sourcemap
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFromC(t *testing.T) {
+	c := strings.Join([]string{
+		"#include \"shapes.h\"",    // 1
+		"",                         // 2
+		"#line 3 \"/src/a.cm\"",    // 3
+		"int shapes_count = 0;",    // 4 -> a:3
+		"",                         // 5 -> a:4
+		"#line 7 \"/src/a.cm\"",    // 6
+		"int shapes_area(int s) {", // 7 -> a:7
+		"    return s * s;",        // 8 -> a:8
+		"}",                        // 9 -> a:9
+	}, "\n") + "\n"
+
+	m, err := FromC("/build/shapes_a.c", strings.NewReader(c))
+	if err != nil {
+		t.Fatalf("FromC: %v", err)
+	}
+	want := []Segment{
+		{GeneratedLine: 4, Lines: 2, Source: "/src/a.cm", SourceLine: 3},
+		{GeneratedLine: 7, Lines: 3, Source: "/src/a.cm", SourceLine: 7},
+	}
+	if !reflect.DeepEqual(m.Segments, want) {
+		t.Fatalf("segments = %+v, want %+v", m.Segments, want)
+	}
+
+	for _, line := range []int{1, 3, 6} {
+		if file, _, ok := m.Source(line); ok {
+			t.Errorf("expected generated line %d to be unmapped, got %s", line, file)
+		}
+	}
+	if file, line, ok := m.Source(8); !ok || file != "/src/a.cm" || line != 8 {
+		t.Errorf("Source(8) = %s:%d, %v", file, line, ok)
+	}
+	if out, ok := m.Generated("/src/a.cm", 8); !ok || out != 8 {
+		t.Errorf("Generated(a:8) = %d, %v", out, ok)
+	}
+	if _, ok := m.Generated("/src/a.cm", 5); ok {
+		t.Error("expected a:5, which no segment covers, to be unmapped")
+	}
+}
+
+func TestWriteLoadRoundTrip(t *testing.T) {
+	m := &Map{Version: Version, File: "main_main.c", Segments: []Segment{
+		{GeneratedLine: 5, Lines: 4, Source: "main.cm", SourceLine: 3},
+	}}
+	path := Path(filepath.Join(t.TempDir(), "main_main.c"))
+	if !strings.HasSuffix(path, "main_main.c.map") {
+		t.Errorf("unexpected sourcemap path %s", path)
+	}
+	if err := m.Write(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, m) {
+		t.Errorf("loaded %+v, want %+v", loaded, m)
+	}
+}
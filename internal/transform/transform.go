@@ -109,6 +109,40 @@ func TransformFunctionBodyWithEnums(body string, importMap ImportMap, enumValues
 	return TransformFunctionBodyFull(body, importMap, nil, enumValues, nil, nil)
 }
 
+// EnumTypeMap maps an imported module path to the enum type names it declares
+// Example: {"state": {"State": true}}
+// Qualified access continues through an enum type ("state.State.IDLE") but stops
+// after any other module symbol, so "config.settings.width" keeps ".width"
+type EnumTypeMap map[string]map[string]bool
+
+// BodyContext bundles the symbol tables used to transform a function body
+type BodyContext struct {
+	Imports    ImportMap               // c_minus module prefixes
+	CImports   CImportMap              // C header prefixes
+	EnumValues EnumValueMap            // Bare enum values of the current module
+	LocalEnums map[string]EnumValueMap // Enum types of the current module -> their values ("State.IDLE")
+	GlobalVars GlobalVarMap            // Non-static globals of the current module
+	Defines    DefineMap               // Public #defines of the current module
+	EnumTypes  EnumTypeMap             // Enum types declared by imported modules
+	Types      map[string]bool         // Struct, union, enum, and typedef names of the current module
+	Locals     map[string]bool         // Parameters of the function; they shadow import prefixes
+	C23        bool                    // bool, true, false, and nullptr are keywords and never substituted
+	Naming     paths.Naming            // How qualified names are mangled
+}
+
+// c23Keywords are identifiers that C23 turns into keywords
+var c23Keywords = map[string]bool{
+	"bool":    true,
+	"true":    true,
+	"false":   true,
+	"nullptr": true,
+}
+
+// IsC23Keyword reports whether name is a keyword under C23
+func IsC23Keyword(name string) bool {
+	return c23Keywords[name]
+}
+
 // TransformFunctionBodyFull transforms qualified symbol access, C imports, enum values, global variables, and defines
 // - For c_minus imports: "module.symbol" -> "module_symbol" (mangled)
 // - For C imports: "stdio.printf" -> "printf" (just strip prefix, no mangling)
@@ -116,60 +150,148 @@ func TransformFunctionBodyWithEnums(body string, importMap ImportMap, enumValues
 // - For global variables: "counter" -> "module_counter"
 // - For defines: "MAX_PATH" -> "module_MAX_PATH" (only public defines)
 func TransformFunctionBodyFull(body string, importMap ImportMap, cimportMap CImportMap, enumValues EnumValueMap, globalVars GlobalVarMap, defines DefineMap) string {
+	return TransformBody(body, &BodyContext{
+		Imports:    importMap,
+		CImports:   cimportMap,
+		EnumValues: enumValues,
+		GlobalVars: globalVars,
+		Defines:    defines,
+	})
+}
+
+// TransformFunctionBodyFullWithSubstitutions is TransformFunctionBodyFull that
+// also returns every rewrite it made, in body order
+func TransformFunctionBodyFullWithSubstitutions(body string, importMap ImportMap, cimportMap CImportMap, enumValues EnumValueMap, globalVars GlobalVarMap, defines DefineMap) (string, []Substitution) {
+	return TransformBodyWithSubstitutions(body, &BodyContext{
+		Imports:    importMap,
+		CImports:   cimportMap,
+		EnumValues: enumValues,
+		GlobalVars: globalVars,
+		Defines:    defines,
+	})
+}
+
+// Substitution kinds
+const (
+	SubstModule  = "module"  // "math.add" -> "math_add"
+	SubstCImport = "cimport" // "stdio.printf" -> "printf"
+	SubstEnum    = "enum"    // "TODO" or "Status.TODO" -> "todo_Status_TODO"
+	SubstGlobal  = "global"  // "counter" -> "state_counter"
+	SubstDefine  = "define"  // "MAX_PATH" -> "fileio_MAX_PATH"
+)
+
+// Substitution records one rewrite made in a function body
+type Substitution struct {
+	Kind   string // One of the Subst* kinds
+	From   string // Text replaced, e.g. "math.add"
+	To     string // Replacement, e.g. "math_add"
+	Offset int    // Byte offset of From in the original body
+}
+
+// TransformBody transforms a function body using the symbol tables in ctx
+// See TransformFunctionBodyFull for the rewrites performed
+func TransformBody(body string, ctx *BodyContext) string {
+	out, _ := transformBody(body, ctx, false)
+	return out
+}
+
+// TransformBodyWithSubstitutions is TransformBody that also returns every
+// rewrite it made, in body order
+func TransformBodyWithSubstitutions(body string, ctx *BodyContext) (string, []Substitution) {
+	return transformBody(body, ctx, true)
+}
+
+// transformBody implements TransformBody, recording substitutions when record is set
+func transformBody(body string, ctx *BodyContext, record bool) (string, []Substitution) {
 	// Tokenize the body
 	tokens := tokenize(body)
 
-	// Transform qualified access patterns
+	// Byte offset of each token; tokenize keeps every byte of the body
+	offsets := make([]int, len(tokens)+1)
+	for n, tok := range tokens {
+		offsets[n+1] = offsets[n] + len(tok.value)
+	}
+
 	var result strings.Builder
+	var subs []Substitution
+	// substitute writes replacement in place of tokens[from:to]
+	substitute := func(kind string, from, to int, replacement string) {
+		result.WriteString(replacement)
+		if record {
+			subs = append(subs, Substitution{Kind: kind, From: body[offsets[from]:offsets[to]], To: replacement, Offset: offsets[from]})
+		}
+	}
+
+	// Parameters and the locals in scope shadow import prefixes
+	locals := newLocalScopes(ctx.Locals)
+
+	// Transform qualified access patterns
 	i := 0
 
 	for i < len(tokens) {
 		tok := tokens[i]
+		if tok.kind == tokenIdent && declaresLocal(tokens, i, ctx) {
+			locals.declare(tok.value)
+		} else if tok.kind == tokenOther {
+			locals.scan(tok.value)
+		}
 
 		// Check for Ident.Ident or Ident.Ident.Ident patterns
-		if tok.kind == tokenIdent && i+1 < len(tokens) && tokens[i+1].kind == tokenDot {
+		if tok.kind == tokenIdent && isMemberName(tokens, i) {
+			// A field after "." or "->" ("get().count", "p->state") is never a
+			// module symbol, even when a global, enum value, or import shares its name
+			result.WriteString(tok.value)
+			i++
+		} else if tok.kind == tokenIdent && i+1 < len(tokens) && tokens[i+1].kind == tokenDot && locals.visible(tok.value) {
+			// A local variable named like an import prefix: plain field access
+			result.WriteString(tok.value)
+			i++
+		} else if tok.kind == tokenIdent && i+1 < len(tokens) && tokens[i+1].kind == tokenDot {
 			prefix := tok.value
 
 			// Check if this is a C import prefix (e.g., stdio.printf -> printf)
-			if _, ok := cimportMap[prefix]; ok {
+			if _, ok := ctx.CImports[prefix]; ok {
 				// This is a C import access - just strip the prefix
+				start := i
 				i += 2 // Skip prefix and dot
 
 				// Collect the symbol name (no mangling for C imports)
+				symbol := ""
 				if i < len(tokens) && tokens[i].kind == tokenIdent {
-					result.WriteString(tokens[i].value)
+					symbol = tokens[i].value
 					i++
 				}
-			} else if fullPath, ok := importMap[prefix]; ok {
+				substitute(SubstCImport, start, i, symbol)
+			} else if fullPath, ok := ctx.Imports[prefix]; ok {
 				// This is a c_minus module qualified access - transform with mangling
-				mangledPrefix := paths.SanitizeModuleName(fullPath)
+				mangledPrefix := ctx.Naming.SanitizeModuleName(fullPath)
 
 				// Skip the module prefix and dot
+				start := i
 				i += 2
 
-				// Collect the rest of the qualified name
-				var parts []string
-				parts = append(parts, mangledPrefix)
-
-				for i < len(tokens) {
-					if tokens[i].kind == tokenIdent {
-						parts = append(parts, tokens[i].value)
-						i++
+				// Collect the module symbol
+				parts := []string{mangledPrefix}
+				if i < len(tokens) && tokens[i].kind == tokenIdent {
+					symbol := tokens[i].value
+					parts = append(parts, symbol)
+					i++
 
-						// Check if there's another dot (for enum values)
-						if i < len(tokens) && tokens[i].kind == tokenDot {
-							i++ // Skip the dot
-							continue
-						} else {
-							break
-						}
-					} else {
-						break
+					// An enum type is followed by its member ("state.State.IDLE");
+					// anything else after the symbol is field access and is left intact
+					if ctx.EnumTypes[fullPath][symbol] && i+1 < len(tokens) &&
+						tokens[i].kind == tokenDot && tokens[i+1].kind == tokenIdent {
+						parts = append(parts, tokens[i+1].value)
+						i += 2
 					}
 				}
 
 				// Emit the mangled name
-				result.WriteString(strings.Join(parts, "_"))
+				substitute(SubstModule, start, i, ctx.Naming.Mangle(parts[0], parts[1:]...))
+			} else if values, ok := ctx.LocalEnums[prefix]; ok && i+2 < len(tokens) && tokens[i+2].kind == tokenIdent && values[tokens[i+2].value] != "" {
+				// Qualified member of one of this module's enums: "State.IDLE"
+				substitute(SubstEnum, i, i+3, values[tokens[i+2].value])
+				i += 3
 			} else {
 				// Not an imported module - could be struct field access, emit as-is
 				result.WriteString(tok.value)
@@ -177,14 +299,19 @@ func TransformFunctionBodyFull(body string, importMap ImportMap, cimportMap CImp
 			}
 		} else if tok.kind == tokenIdent {
 			// Check if this is an enum value that needs qualification
-			if replacement, ok := enumValues[tok.value]; ok {
-				result.WriteString(replacement)
-			} else if replacement, ok := globalVars[tok.value]; ok {
-				// Check if this is a global variable that needs mangling
-				result.WriteString(replacement)
-			} else if replacement, ok := defines[tok.value]; ok {
+			if (ctx.C23 && c23Keywords[tok.value]) || parser.IsCKeyword(tok.value) {
+				// Keywords are never module symbols, whatever the symbol tables say
+				result.WriteString(tok.value)
+			} else if replacement, ok := ctx.EnumValues[tok.value]; ok {
+				substitute(SubstEnum, i, i+1, replacement)
+			} else if replacement, ok := ctx.GlobalVars[tok.value]; ok && !ctx.Locals[tok.value] {
+				// Check if this is a global variable that needs mangling. A
+				// parameter of the same name shadows it; a declared local is
+				// renamed along with its uses, which C scopes correctly.
+				substitute(SubstGlobal, i, i+1, replacement)
+			} else if replacement, ok := ctx.Defines[tok.value]; ok {
 				// Check if this is a #define constant that needs mangling
-				result.WriteString(replacement)
+				substitute(SubstDefine, i, i+1, replacement)
 			} else {
 				result.WriteString(tok.value)
 			}
@@ -196,7 +323,170 @@ func TransformFunctionBodyFull(body string, importMap ImportMap, cimportMap CImp
 		}
 	}
 
-	return result.String()
+	return result.String(), subs
+}
+
+// isMemberName reports whether the identifier at tokens[i] follows "." or "->"
+func isMemberName(tokens []token, i int) bool {
+	if i == 0 {
+		return false
+	}
+	prev := tokens[i-1]
+	if prev.kind == tokenDot {
+		return true
+	}
+	return prev.kind == tokenOther && strings.HasSuffix(strings.TrimRight(prev.value, " \t\r\n"), "->")
+}
+
+// statementKeywords are identifiers that may directly precede an expression,
+// so "return config;" is not mistaken for a declaration of "config"
+var statementKeywords = map[string]bool{
+	"return": true,
+	"case":   true,
+	"goto":   true,
+	"sizeof": true,
+	"else":   true,
+	"do":     true,
+}
+
+// cTypeNames are the C keywords that name a type on their own
+var cTypeNames = map[string]bool{
+	"void": true, "char": true, "short": true, "int": true, "long": true,
+	"float": true, "double": true, "signed": true, "unsigned": true,
+	"bool": true, "_Bool": true, "_Complex": true,
+}
+
+// declaresLocal reports whether the identifier at tokens[i] is being declared,
+// e.g. "Vec3 config = ...", "int *state;" or "for (int stdio = 0; ...)".
+// The identifier must follow a type name (optionally with pointer stars) and be
+// followed by an initializer, terminator, separator, or array bound. With
+// stars, "y * config;" may be a multiplication, so the type must be known.
+func declaresLocal(tokens []token, i int, ctx *BodyContext) bool {
+	if i < 2 || i+1 >= len(tokens) || tokens[i+1].kind != tokenOther {
+		return false
+	}
+	next := strings.TrimLeft(tokens[i+1].value, " \t\r\n")
+	if next == "" || !strings.ContainsAny(next[:1], "=;,[") || strings.HasPrefix(next, "==") {
+		return false
+	}
+
+	// Only whitespace and pointer stars may separate the type from the name
+	if tokens[i-1].kind != tokenOther || strings.Trim(tokens[i-1].value, " \t\r\n*") != "" {
+		return false
+	}
+	typeTok := tokens[i-2]
+	if typeTok.kind != tokenIdent || statementKeywords[typeTok.value] {
+		return false
+	}
+	return !strings.Contains(tokens[i-1].value, "*") || knownType(tokens, i-2, ctx)
+}
+
+// localScopes tracks the locals in scope while a body is scanned in order.
+// A local goes out of scope at the "}" closing its block; one declared inside
+// parentheses ("for (int i = 0; ...)") belongs to the block that follows.
+// Parameters stay in scope throughout.
+type localScopes struct {
+	count   map[string]int // Name -> declarations in scope
+	byDepth [][]string     // Names declared at each brace depth
+	depth   int
+	parens  int
+}
+
+func newLocalScopes(params map[string]bool) *localScopes {
+	l := &localScopes{count: make(map[string]int, len(params))}
+	for name := range params {
+		l.count[name]++
+	}
+	return l
+}
+
+// declare brings name into scope in the current block
+func (l *localScopes) declare(name string) {
+	depth := l.depth
+	if l.parens > 0 {
+		depth++
+	}
+	for len(l.byDepth) <= depth {
+		l.byDepth = append(l.byDepth, nil)
+	}
+	l.byDepth[depth] = append(l.byDepth[depth], name)
+	l.count[name]++
+}
+
+// visible reports whether name is a parameter or a local in scope
+func (l *localScopes) visible(name string) bool {
+	return l.count[name] > 0
+}
+
+// scan follows the braces and parentheses in text, which is punctuation and
+// literals between identifiers, dropping the locals of each block it closes
+func (l *localScopes) scan(text string) {
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '"', '\'':
+			// Skip the literal; the tokenizer keeps each one whole
+			quote := text[i]
+			for i++; i < len(text) && text[i] != quote; i++ {
+				if text[i] == '\\' {
+					i++
+				}
+			}
+		case '(':
+			l.parens++
+		case ')':
+			if l.parens > 0 {
+				l.parens--
+			}
+		case '{':
+			l.depth++
+		case '}':
+			// A brace-less for body leaves its loop variable one level down
+			l.drop(l.depth + 1)
+			l.drop(l.depth)
+			if l.depth > 0 {
+				l.depth--
+			}
+		}
+	}
+}
+
+// drop takes the locals declared at depth out of scope
+func (l *localScopes) drop(depth int) {
+	if depth >= len(l.byDepth) {
+		return
+	}
+	for _, name := range l.byDepth[depth] {
+		if l.count[name]--; l.count[name] == 0 {
+			delete(l.count, name)
+		}
+	}
+	l.byDepth[depth] = nil
+}
+
+// knownType reports whether the identifier at tokens[j] names a type: a C
+// type keyword or standard "_t" typedef, a type of the current module, a tag
+// after struct, union, or enum, or a type qualified by an import ("geo.Vec3")
+func knownType(tokens []token, j int, ctx *BodyContext) bool {
+	name := tokens[j].value
+	if cTypeNames[name] || strings.HasSuffix(name, "_t") || ctx.Types[name] {
+		return true
+	}
+	if j < 2 {
+		return false
+	}
+	if tokens[j-1].kind == tokenDot {
+		prefix := tokens[j-2].value
+		_, imported := ctx.Imports[prefix]
+		_, cimported := ctx.CImports[prefix]
+		return imported || cimported
+	}
+	if strings.TrimSpace(tokens[j-1].value) == "" {
+		switch tokens[j-2].value {
+		case "struct", "union", "enum":
+			return true
+		}
+	}
+	return false
 }
 
 // Token types
@@ -330,16 +620,6 @@ func isIdentContinue(ch rune) bool {
 	return unicode.IsLetter(ch) || unicode.IsDigit(ch) || ch == '_'
 }
 
-// MangleTypeName mangles a type name with the module prefix
-func MangleTypeName(typeName string, modulePath string) string {
-	return paths.SanitizeModuleName(modulePath) + "_" + typeName
-}
-
-// MangleFunctionName mangles a function name with the module prefix
-func MangleFunctionName(funcName string, modulePath string) string {
-	return paths.SanitizeModuleName(modulePath) + "_" + funcName
-}
-
 // TransformTypeBody transforms type references within a type body
 // This handles types that reference other types from the same or other modules
 func TransformTypeBody(body string, importMap ImportMap, currentModule string) string {
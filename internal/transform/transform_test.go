@@ -114,3 +114,368 @@ func TestTransformFunctionBodyFull_MixedImports(t *testing.T) {
 		t.Errorf("expected %q, got %q", expected, result)
 	}
 }
+
+func TestTransformBody_QualifiedFieldAccess(t *testing.T) {
+	ctx := &BodyContext{
+		Imports:    ImportMap{"config": "config", "state": "app/state"},
+		EnumTypes:  EnumTypeMap{"app/state": {"State": true}},
+		EnumValues: EnumValueMap{"IDLE": "app_State_IDLE"},
+		GlobalVars: GlobalVarMap{"limit": "app_limit"},
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{
+			name:     "field of imported global",
+			body:     `{ int w = config.settings.width; }`,
+			expected: `{ int w = config_settings.width; }`,
+		},
+		{
+			name:     "nested fields of imported global",
+			body:     `{ config.settings.size.w = 1; }`,
+			expected: `{ config_settings.size.w = 1; }`,
+		},
+		{
+			name:     "enum member of imported enum type",
+			body:     `{ s = state.State.IDLE; }`,
+			expected: `{ s = app_state_State_IDLE; }`,
+		},
+		{
+			name:     "imported function call result",
+			body:     `{ int n = config.get().count; }`,
+			expected: `{ int n = config_get().count; }`,
+		},
+		{
+			name:     "nested fields of a returned struct",
+			body:     `{ int x = state.current().pos.x; }`,
+			expected: `{ int x = app_state_current().pos.x; }`,
+		},
+		{
+			name:     "fields named like module symbols",
+			body:     `{ int n = config.get().limit + config.get()->IDLE + p->limit; }`,
+			expected: `{ int n = config_get().limit + config_get()->IDLE + p->limit; }`,
+		},
+		{
+			name:     "field named like an import prefix",
+			body:     `{ int w = box.config.width; }`,
+			expected: `{ int w = box.config.width; }`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := TransformBody(tt.body, ctx)
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestTransformBody_LocalShadowsImport(t *testing.T) {
+	imports := ImportMap{"config": "config", "vec": "math/vec"}
+	cimports := CImportMap{"stdio": "stdio.h"}
+
+	tests := []struct {
+		name     string
+		body     string
+		locals   map[string]bool
+		expected string
+	}{
+		{
+			name:     "local declared with initializer",
+			body:     "{\n    vec.Vec3 vec = config.origin();\n    return vec.x;\n}",
+			expected: "{\n    math_vec_Vec3 vec = config_origin();\n    return vec.x;\n}",
+		},
+		{
+			name:     "pointer local",
+			body:     "{\n    struct Cfg *config;\n    config = load();\n    return config->width + config.height;\n}",
+			expected: "{\n    struct Cfg *config;\n    config = load();\n    return config->width + config.height;\n}",
+		},
+		{
+			name:     "parameter shadows import",
+			body:     "{ return config.width; }",
+			locals:   map[string]bool{"config": true},
+			expected: "{ return config.width; }",
+		},
+		{
+			name:     "use before declaration is module access",
+			body:     "{\n    int w = config.width;\n    int config = w;\n    return config;\n}",
+			expected: "{\n    int w = config_width;\n    int config = w;\n    return config;\n}",
+		},
+		{
+			name:     "return is not a declaration",
+			body:     "{ return config.width; }",
+			expected: "{ return config_width; }",
+		},
+		{
+			name:     "loop variable shadows cimport",
+			body:     "{ for (int stdio = 0; stdio < 3; stdio++) { s.stdio = stdio; } }",
+			expected: "{ for (int stdio = 0; stdio < 3; stdio++) { s.stdio = stdio; } }",
+		},
+		{
+			name:     "local in an inner block goes out of scope",
+			body:     "{\n    if (ok) {\n        Cfg config = load();\n        use(config.width);\n    }\n    return config.width;\n}",
+			expected: "{\n    if (ok) {\n        Cfg config = load();\n        use(config.width);\n    }\n    return config_width;\n}",
+		},
+		{
+			name:     "loop variable goes out of scope after the loop",
+			body:     "{ for (int config = 0; config < 3; config++) { s.config = config; } return config.width; }",
+			expected: "{ for (int config = 0; config < 3; config++) { s.config = config; } return config_width; }",
+		},
+		{
+			name:     "braces in literals do not close the block",
+			body:     "{ Cfg config = load(); puts(\"}\"); c = '}'; return config.width; }",
+			expected: "{ Cfg config = load(); puts(\"}\"); c = '}'; return config.width; }",
+		},
+		{
+			name:     "product is not a declaration",
+			body:     "{\n    y * config;\n    return config.width;\n}",
+			expected: "{\n    y * config;\n    return config_width;\n}",
+		},
+		{
+			name:     "pointer to a module type",
+			body:     "{\n    Cfg * config = load();\n    return config.width;\n}",
+			expected: "{\n    Cfg * config = load();\n    return config.width;\n}",
+		},
+		{
+			name:     "pointer to an imported type",
+			body:     "{ vec.Vec3 *vec = 0; return vec.x; }",
+			expected: "{ math_vec_Vec3 *vec = 0; return vec.x; }",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := &BodyContext{Imports: imports, CImports: cimports, Locals: tt.locals, Types: map[string]bool{"Cfg": true}}
+			result := TransformBody(tt.body, ctx)
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestTransformBody_GlobalShadowingAndKeywords(t *testing.T) {
+	ctx := &BodyContext{
+		GlobalVars: GlobalVarMap{"count": "stats_count", "index": "stats_index", "continue": "stats_continue"},
+		EnumValues: EnumValueMap{"break": "stats_Mode_break"},
+		Defines:    DefineMap{"default": "stats_default"},
+		Locals:     map[string]bool{"index": true},
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{
+			name:     "parameter shadows global",
+			body:     "{ return items[index] + count; }",
+			expected: "{ return items[index] + stats_count; }",
+		},
+		{
+			name:     "declared local is renamed with its uses",
+			body:     "{ for (int count = 0; count < 3; count++) { } return count; }",
+			expected: "{ for (int stats_count = 0; stats_count < 3; stats_count++) { } return stats_count; }",
+		},
+		{
+			name:     "keywords are never substituted",
+			body:     "{ switch (x) { case 1: break; default: continue; } }",
+			expected: "{ switch (x) { case 1: break; default: continue; } }",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := TransformBody(tt.body, ctx); result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestTransformBody_ControlFlow(t *testing.T) {
+	ctx := &BodyContext{
+		Imports:    ImportMap{"state": "app/state", "log": "log"},
+		EnumTypes:  EnumTypeMap{"app/state": {"State": true}},
+		EnumValues: EnumValueMap{"RUNNING": "job_Status_RUNNING", "DONE": "job_Status_DONE"},
+		GlobalVars: GlobalVarMap{"ticks": "job_ticks"},
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{
+			name:     "switch over local enum members",
+			body:     "{\n    switch (s) {\n    case RUNNING:\n        return 1;\n    case DONE: {\n        break;\n    }\n    default:\n        return 0;\n    }\n}",
+			expected: "{\n    switch (s) {\n    case job_Status_RUNNING:\n        return 1;\n    case job_Status_DONE: {\n        break;\n    }\n    default:\n        return 0;\n    }\n}",
+		},
+		{
+			name:     "case on imported enum member",
+			body:     "{ switch (st) { case state.State.IDLE: log.write(\"idle\"); break; } }",
+			expected: "{ switch (st) { case app_state_State_IDLE: log_write(\"idle\"); break; } }",
+		},
+		{
+			name:     "do-while loop",
+			body:     "{\n    do {\n        ticks++;\n    } while (ticks < 10 && s != DONE);\n}",
+			expected: "{\n    do {\n        job_ticks++;\n    } while (job_ticks < 10 && s != job_Status_DONE);\n}",
+		},
+		{
+			name:     "ternary",
+			body:     "{ return ticks > 0 ? RUNNING : state.State.IDLE; }",
+			expected: "{ return job_ticks > 0 ? job_Status_RUNNING : app_state_State_IDLE; }",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := TransformBody(tt.body, ctx)
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestTransformBody_CaseLabels(t *testing.T) {
+	ctx := &BodyContext{
+		Imports:    ImportMap{"config": "app/config"},
+		EnumValues: EnumValueMap{"DONE": "job_Status_DONE"},
+		Defines:    DefineMap{"MAX_RETRIES": "job_MAX_RETRIES", "default": "job_default"},
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{
+			name:     "enum constant and define labels are qualified",
+			body:     "{ switch (n) { case DONE: return 0; case MAX_RETRIES: return 1; } }",
+			expected: "{ switch (n) { case job_Status_DONE: return 0; case job_MAX_RETRIES: return 1; } }",
+		},
+		{
+			name:     "imported define label",
+			body:     "{ switch (n) { case config.LIMIT: return 2; } }",
+			expected: "{ switch (n) { case app_config_LIMIT: return 2; } }",
+		},
+		{
+			name:     "default is never touched",
+			body:     "{ switch (n) { case 1: return 1; default: return 0; } }",
+			expected: "{ switch (n) { case 1: return 1; default: return 0; } }",
+		},
+		{
+			name:     "literal and range labels are preserved",
+			body:     "{ switch (c) { case 'a': case 0x10: case 2 ... 4: case -1: return c; } }",
+			expected: "{ switch (c) { case 'a': case 0x10: case 2 ... 4: case -1: return c; } }",
+		},
+		{
+			name:     "private define label keeps its name",
+			body:     "{ switch (n) { case LOCAL_LIMIT: return 3; } }",
+			expected: "{ switch (n) { case LOCAL_LIMIT: return 3; } }",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := TransformBody(tt.body, ctx); result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestTransformBody_C23Keywords(t *testing.T) {
+	body := "{ bool ok = flag != nullptr; return ok ? true : false; }"
+	ctx := &BodyContext{
+		EnumValues: EnumValueMap{"true": "opt_Answer_true", "false": "opt_Answer_false"},
+		GlobalVars: GlobalVarMap{"nullptr": "opt_nullptr", "flag": "opt_flag"},
+	}
+
+	want := "{ bool ok = opt_flag != opt_nullptr; return ok ? opt_Answer_true : opt_Answer_false; }"
+	if got := TransformBody(body, ctx); got != want {
+		t.Errorf("without C23: expected %q, got %q", want, got)
+	}
+
+	ctx.C23 = true
+	want = "{ bool ok = opt_flag != nullptr; return ok ? true : false; }"
+	if got := TransformBody(body, ctx); got != want {
+		t.Errorf("with C23: expected %q, got %q", want, got)
+	}
+}
+
+func TestTransformBody_LocalEnumQualified(t *testing.T) {
+	ctx := &BodyContext{
+		EnumValues: EnumValueMap{"OK": "net_Result_OK"},
+		LocalEnums: map[string]EnumValueMap{
+			"Status": {"OK": "net_Status_OK"},
+			"Result": {"OK": "net_Result_OK"},
+		},
+		Locals: map[string]bool{"Result": true},
+	}
+
+	body := "{ if (s == Status.OK) { return OK; } return Status.MISSING + Result.code; }"
+	want := "{ if (s == net_Status_OK) { return net_Result_OK; } return Status.MISSING + Result.code; }"
+	if got := TransformBody(body, ctx); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestTransformBody_DefinesInLiterals(t *testing.T) {
+	ctx := &BodyContext{
+		Imports: ImportMap{"config": "config"},
+		Defines: DefineMap{"MSG": "app_MSG", "N": "app_N"},
+	}
+
+	body := `{ printf("MSG is %s, N=%d\n", MSG, N); char c = 'N'; printf("\"MSG\" N"); printf(config.MSG); }`
+	want := `{ printf("MSG is %s, N=%d\n", app_MSG, app_N); char c = 'N'; printf("\"MSG\" N"); printf(config_MSG); }`
+	if got := TransformBody(body, ctx); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestTransformBodyWithSubstitutions(t *testing.T) {
+	body := `{ stdio.printf("%d", util.scale(count)); p->count = MAX + Status.DONE + IDLE; }`
+	ctx := &BodyContext{
+		Imports:    ImportMap{"util": "lib/util"},
+		CImports:   CImportMap{"stdio": "stdio.h"},
+		EnumValues: EnumValueMap{"IDLE": "app_State_IDLE"},
+		LocalEnums: map[string]EnumValueMap{"Status": {"DONE": "app_Status_DONE"}},
+		GlobalVars: GlobalVarMap{"count": "app_count"},
+		Defines:    DefineMap{"MAX": "app_MAX"},
+	}
+
+	out, subs := TransformBodyWithSubstitutions(body, ctx)
+	if want := `{ printf("%d", lib_util_scale(app_count)); p->count = app_MAX + app_Status_DONE + app_State_IDLE; }`; out != want {
+		t.Fatalf("got %q, want %q", out, want)
+	}
+	if plain := TransformBody(body, ctx); plain != out {
+		t.Errorf("TransformBody = %q, differs from %q", plain, out)
+	}
+
+	want := []Substitution{
+		{Kind: SubstCImport, From: "stdio.printf", To: "printf", Offset: 2},
+		{Kind: SubstModule, From: "util.scale", To: "lib_util_scale", Offset: 21},
+		{Kind: SubstGlobal, From: "count", To: "app_count", Offset: 32},
+		{Kind: SubstDefine, From: "MAX", To: "app_MAX", Offset: 52},
+		{Kind: SubstEnum, From: "Status.DONE", To: "app_Status_DONE", Offset: 58},
+		{Kind: SubstEnum, From: "IDLE", To: "app_State_IDLE", Offset: 72},
+	}
+	if len(subs) != len(want) {
+		t.Fatalf("got %d substitutions %+v, want %d", len(subs), subs, len(want))
+	}
+	for i, sub := range subs {
+		if sub != want[i] {
+			t.Errorf("substitution %d = %+v, want %+v", i, sub, want[i])
+		}
+		if body[sub.Offset:sub.Offset+len(sub.From)] != sub.From {
+			t.Errorf("substitution %d offset %d does not point at %q", i, sub.Offset, sub.From)
+		}
+	}
+}
@@ -0,0 +1,1837 @@
+package integration
+
+import (
+	"debug/elf"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestBuildProfile verifies --profile prints a per-phase timing breakdown
+func TestBuildProfile(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/profile"`,
+		"math/math.cm": `module "math"
+
+pub func add(int a, int b) int {
+    return a + b;
+}
+`,
+		"main.cm": `module "main"
+
+import "math"
+
+func main() int {
+    return math.add(1, 2) - 3;
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build", "--profile")
+	if err != nil {
+		t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+	}
+
+	for _, want := range []string{"Build profile:", "discovery", "transpile", "compile", "math_math.c", "main_main.c", "link", "total"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("profile output missing %q, got:\n%s", want, output)
+		}
+	}
+
+	// Each module's parse and generation are one transpile entry
+	entries := 0
+	for _, line := range strings.Split(output, "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 && fields[0] == "math" {
+			entries++
+		}
+	}
+	if entries != 1 {
+		t.Errorf("expected one transpile entry for math, got %d:\n%s", entries, output)
+	}
+}
+
+// TestBuildDefines verifies -D macro definitions reach every compile in both forms
+func TestBuildDefines(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/defines"`,
+		"main.cm": `module "main"
+
+cimport "stdio.h"
+
+func main() int {
+#ifdef VERBOSE
+    stdio.printf("verbose\n");
+#endif
+    stdio.printf("feature=%d other=%d\n", FEATURE, OTHER);
+    return 0;
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build", "-DFEATURE=3", "-D", "OTHER=4", "-D", "VERBOSE")
+	if err != nil {
+		t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+	}
+
+	runOutput, err := exec.Command(filepath.Join(tmpDir, filepath.Base(tmpDir))).CombinedOutput()
+	if err != nil {
+		t.Fatalf("binary execution failed: %v\nOutput: %s", err, runOutput)
+	}
+	if got := string(runOutput); got != "verbose\nfeature=3 other=4\n" {
+		t.Errorf("unexpected output %q", got)
+	}
+
+	if output, err := runCMinus(t, tmpDir, "build", "-D", "1BAD"); err == nil {
+		t.Errorf("expected invalid macro name to fail, got:\n%s", output)
+	}
+}
+
+// TestBuildConfigFile verifies cm.build settings apply to the build and
+// command-line flags override them
+func TestBuildConfigFile(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/buildconfig"`,
+		"cm.build": `# Shared build settings
+output: bin/app
+define: FEATURE=3
+tags: fancy
+`,
+		"main.cm": `module "main"
+
+cimport "stdio.h"
+
+import "greet"
+
+func main() int {
+    stdio.printf("feature=%d level=%d\n", FEATURE, greet.level());
+    return 0;
+}
+`,
+		"greet/plain.cm": `// +build !fancy
+
+module "greet"
+
+pub func level() int {
+    return 1;
+}
+`,
+		"greet/fancy.cm": `// +build fancy
+
+module "greet"
+
+pub func level() int {
+    return 2;
+}
+`,
+	})
+
+	if err := os.MkdirAll(filepath.Join(tmpDir, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	output, err := runCMinus(t, tmpDir, "build")
+	if err != nil {
+		t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+	}
+	runOutput, err := exec.Command(filepath.Join(tmpDir, "bin", "app")).CombinedOutput()
+	if err != nil {
+		t.Fatalf("binary execution failed: %v\nOutput: %s", err, runOutput)
+	}
+	if got := string(runOutput); got != "feature=3 level=2\n" {
+		t.Errorf("unexpected output %q", got)
+	}
+
+	// -o replaces the configured output
+	output, err = runCMinus(t, tmpDir, "build", "-o", "override")
+	if err != nil {
+		t.Fatalf("c_minus build -o failed: %v\nOutput: %s", err, output)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "override")); err != nil {
+		t.Errorf("expected -o to override the configured output: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "cm.build"), []byte("optimize: 3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output, err = runCMinus(t, tmpDir, "build")
+	if err == nil || !strings.Contains(output, `cm.build:1: unknown key "optimize"`) {
+		t.Errorf("expected an unknown key error, got %v:\n%s", err, output)
+	}
+}
+
+// TestBuildPCH verifies --pch produces a precompiled internal header per module,
+// built with the module's #cgo CFLAGS so gcc accepts it, and only rebuilt when
+// its compile changes
+func TestBuildPCH(t *testing.T) {
+	files := map[string]string{
+		"cm.mod": `module "test/pch"`,
+		"math/math.cm": `module "math"
+
+#cgo CFLAGS: -fPIC -DSCALE
+
+pub func add(int a, int b) int {
+    return (a + b) * SCALE;
+}
+`,
+		"main.cm": `module "main"
+
+import "math"
+
+func main() int {
+    return math.add(1, 2) - 3;
+}
+`,
+	}
+	tmpDir := writeProject(t, files)
+
+	output, err := runCMinus(t, tmpDir, "build", "--pch")
+	if err != nil {
+		t.Fatalf("c_minus build --pch failed: %v\nOutput: %s", err, output)
+	}
+	if strings.Contains(output, "pch") {
+		t.Errorf("unexpected precompiled header warning:\n%s", output)
+	}
+
+	gchTimes := make(map[string]time.Time)
+	for _, name := range []string{"math_internal.h.gch", "main_internal.h.gch"} {
+		info, err := os.Stat(filepath.Join(tmpDir, ".c_minus", name))
+		if err != nil {
+			t.Fatalf("expected %s to be produced: %v", name, err)
+		}
+		gchTimes[name] = info.ModTime()
+	}
+
+	if out, err := exec.Command(filepath.Join(tmpDir, filepath.Base(tmpDir))).CombinedOutput(); err != nil {
+		t.Fatalf("binary execution failed: %v\nOutput: %s", err, out)
+	}
+
+	// A body edit regenerates the headers with the same contents: the .gch
+	// files are kept
+	time.Sleep(10 * time.Millisecond)
+	files["math/math.cm"] = strings.Replace(files["math/math.cm"], "(a + b) * SCALE", "SCALE * (a + b)", 1)
+	if err := os.WriteFile(filepath.Join(tmpDir, "math", "math.cm"), []byte(files["math/math.cm"]), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output, err = runCMinus(t, tmpDir, "build", "--pch")
+	if err != nil || strings.Contains(output, "pch") {
+		t.Fatalf("rebuild failed or warned: %v\nOutput: %s", err, output)
+	}
+	for name, mtime := range gchTimes {
+		info, err := os.Stat(filepath.Join(tmpDir, ".c_minus", name))
+		if err != nil || !info.ModTime().Equal(mtime) {
+			t.Errorf("expected %s to be reused, err %v", name, err)
+		}
+	}
+}
+
+// TestBuildWarnings verifies analysis warnings are printed, honor
+// "// cminus:ignore" comments, and fail the build under -Werror
+func TestBuildWarnings(t *testing.T) {
+	files := map[string]string{
+		"cm.mod": `module "test/warnings"`,
+		"util/util.cm": `module "util"
+
+pub func one() int {
+    return 1;
+}
+`,
+		"main.cm": `module "main"
+
+import "util"
+
+func main() int {
+    return 0;
+}
+`,
+	}
+
+	tmpDir := writeProject(t, files)
+	output, err := runCMinus(t, tmpDir, "build")
+	if err != nil {
+		t.Fatalf("warnings must not fail the build: %v\nOutput: %s", err, output)
+	}
+	if !strings.Contains(output, `main.cm:3: warning: import "util" is not used [unused-import]`) {
+		t.Errorf("expected unused import warning, got:\n%s", output)
+	}
+
+	output, err = runCMinus(t, tmpDir, "build", "-Werror")
+	if err == nil || !strings.Contains(output, "1 warning(s) treated as errors") {
+		t.Fatalf("expected -Werror to fail the build, got %v:\n%s", err, output)
+	}
+
+	files["main.cm"] = `module "main"
+
+// cminus:ignore unused-import
+import "util"
+
+func main() int {
+    return 0;
+}
+`
+	tmpDir = writeProject(t, files)
+	output, err = runCMinus(t, tmpDir, "build", "-Werror")
+	if err != nil {
+		t.Fatalf("suppressed warning must not fail -Werror: %v\nOutput: %s", err, output)
+	}
+	if strings.Contains(output, "warning:") {
+		t.Errorf("expected no warnings, got:\n%s", output)
+	}
+}
+
+// TestBuildMissingReturnWarning verifies a non-void function that can fall off
+// the end is reported with its location
+func TestBuildMissingReturnWarning(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/missingreturn"`,
+		"util/util.cm": `module "util"
+
+pub func pick(int x) int {
+    if (x) {
+        return 1;
+    }
+}
+
+pub func sign(int x) int {
+    if (x < 0) {
+        return -1;
+    }
+    return x > 0;
+}
+`,
+		"main.cm": `module "main"
+
+import "util"
+
+func main() int {
+    return util.sign(0) + util.pick(1) - 1;
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build")
+	if err != nil {
+		t.Fatalf("warnings must not fail the build: %v\nOutput: %s", err, output)
+	}
+	want := `util/util.cm:3: warning: function pick returns int but may reach the end of its body without a return [missing-return]`
+	if !strings.Contains(output, want) {
+		t.Errorf("expected missing return warning, got:\n%s", output)
+	}
+	if strings.Contains(output, "function sign") {
+		t.Errorf("unexpected warning for sign:\n%s", output)
+	}
+}
+
+// TestBuildSelfContained verifies --self-contained builds without internal headers
+func TestBuildSelfContained(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/selfcontained"`,
+		"math/math.cm": `module "math"
+
+#define BIAS 1
+
+int calls = 0;
+
+pub func calc(int a) int {
+    calls = calls + 1;
+    return a * 2 - BIAS + calls - 1;
+}
+`,
+		"main.cm": `module "main"
+
+import "math"
+
+func main() int {
+    return math.calc(2) - 3;
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build", "--self-contained")
+	if err != nil {
+		t.Fatalf("c_minus build --self-contained failed: %v\nOutput: %s", err, output)
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(tmpDir, ".c_minus", "*_internal.h"))
+	if len(matches) != 0 {
+		t.Errorf("expected no internal headers, found %v", matches)
+	}
+
+	if out, err := exec.Command(filepath.Join(tmpDir, filepath.Base(tmpDir))).CombinedOutput(); err != nil {
+		t.Fatalf("binary execution failed: %v\nOutput: %s", err, out)
+	}
+
+	if output, err := runCMinus(t, tmpDir, "build", "--self-contained", "--pch"); err == nil {
+		t.Errorf("expected --pch with --self-contained to fail, got:\n%s", output)
+	}
+}
+
+// TestBuildSplitDWARF verifies --split-dwarf leaves .dwo files in .c_minus
+func TestBuildSplitDWARF(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/splitdwarf"`,
+		"math/math.cm": `module "math"
+
+pub func add(int a, int b) int {
+    return a + b;
+}
+`,
+		"main.cm": `module "main"
+
+import "math"
+
+func main() int {
+    return math.add(1, 2) - 3;
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build", "--split-dwarf")
+	if err != nil {
+		t.Fatalf("c_minus build --split-dwarf failed: %v\nOutput: %s", err, output)
+	}
+
+	buildDir := filepath.Join(tmpDir, ".c_minus")
+	for _, name := range []string{"math_math.dwo", "main_main.dwo"} {
+		if _, err := os.Stat(filepath.Join(buildDir, name)); err != nil {
+			t.Errorf("expected %s in .c_minus: %v", name, err)
+		}
+	}
+	if matches, _ := filepath.Glob(filepath.Join(tmpDir, "*.dwo")); len(matches) != 0 {
+		t.Errorf("unexpected .dwo files outside .c_minus: %v", matches)
+	}
+
+	// A regular build drops the now-stale .dwo files
+	output, err = runCMinus(t, tmpDir, "build")
+	if err != nil {
+		t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(buildDir, "*.dwo")); len(matches) != 0 {
+		t.Errorf("expected stale .dwo files to be removed, found %v", matches)
+	}
+}
+
+// TestBuildSanitize verifies -sanitize instruments the compile and links the runtime
+func TestBuildSanitize(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/sanitize"`,
+		"main.cm": `module "main"
+
+cimport "stdlib.h"
+
+func main() int {
+    int *p = stdlib.malloc(4 * sizeof(int));
+    volatile int i = 4;
+    p[i] = 1;
+    stdlib.free(p);
+    return 0;
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build", "-sanitize=address,undefined")
+	if err != nil {
+		t.Fatalf("c_minus build -sanitize failed: %v\nOutput: %s", err, output)
+	}
+
+	runOutput, err := exec.Command(filepath.Join(tmpDir, filepath.Base(tmpDir))).CombinedOutput()
+	if err == nil {
+		t.Fatalf("expected the sanitizer to abort the program, got:\n%s", runOutput)
+	}
+	if !strings.Contains(string(runOutput), "AddressSanitizer: heap-buffer-overflow") {
+		t.Errorf("expected an AddressSanitizer report, got:\n%s", runOutput)
+	}
+	if !strings.Contains(string(runOutput), "main.cm") && !strings.Contains(string(runOutput), "main_main.c") {
+		t.Errorf("expected the report to name the source file, got:\n%s", runOutput)
+	}
+}
+
+// TestBuildHarden verifies --harden passes the hardening flags to the compile
+// and -pie to the link, and that the result is a position-independent executable
+func TestBuildHarden(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/harden"`,
+		"main.cm": `module "main"
+
+cimport "string.h"
+
+func main() int {
+    char buf[8];
+    string.strcpy(buf, "ok");
+    return string.strlen(buf) == 2 ? 0 : 1;
+}
+`,
+	})
+	logPath := filepath.Join(tmpDir, "cc.log")
+	wrapper := filepath.Join(tmpDir, "mycc.sh")
+	script := "#!/bin/sh\necho \"$@\" >> \"" + logPath + "\"\nexec gcc \"$@\"\n"
+	if err := os.WriteFile(wrapper, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := runCMinus(t, tmpDir, "build", "--harden", "-cc", wrapper, "-o", "app")
+	if err != nil {
+		t.Fatalf("c_minus build --harden failed: %v\nOutput: %s", err, output)
+	}
+	logged, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("expected the compiler wrapper to run: %v", err)
+	}
+	var compile, link string
+	for _, line := range strings.Split(strings.TrimSpace(string(logged)), "\n") {
+		if strings.Contains(line, " -c ") || strings.HasPrefix(line, "-c ") {
+			compile = line
+		} else {
+			link = line
+		}
+	}
+	for _, want := range []string{"-fstack-protector-strong", "-D_FORTIFY_SOURCE=2", "-fPIE"} {
+		if !strings.Contains(compile, want) {
+			t.Errorf("expected %s in the compile, got: %s", want, compile)
+		}
+	}
+	if !strings.Contains(link, "-pie") || strings.Contains(compile, "-pie") {
+		t.Errorf("expected -pie in the link only, got compile %q, link %q", compile, link)
+	}
+
+	bin := filepath.Join(tmpDir, "app")
+	f, err := elf.Open(bin)
+	if err != nil {
+		t.Fatalf("open binary: %v", err)
+	}
+	defer f.Close()
+	if f.Type != elf.ET_DYN {
+		t.Errorf("expected a position-independent executable, got ELF type %v", f.Type)
+	}
+	if err := exec.Command(bin).Run(); err != nil {
+		t.Errorf("hardened binary failed to run: %v", err)
+	}
+}
+
+// TestBuildMissingCompiler verifies a missing C compiler is reported before building
+func TestBuildMissingCompiler(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/nocc"`,
+		"main.cm": `module "main"
+
+func main() int {
+    return 0;
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build", "-cc", "no-such-cc")
+	if err == nil {
+		t.Fatalf("expected the build to fail without a compiler, got:\n%s", output)
+	}
+	if !strings.Contains(string(output), `C compiler "no-such-cc" not found: install gcc or clang`) {
+		t.Errorf("expected an actionable missing compiler error, got:\n%s", output)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, ".c_minus")); err == nil {
+		t.Errorf("expected no build directory when the compiler is missing")
+	}
+}
+
+// TestBuildCompilerWithLauncher verifies a compiler command with a launcher
+// ("ccache gcc") is found by its program and run with its arguments
+func TestBuildCompilerWithLauncher(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/launcher"`,
+		"main.cm": `module "main"
+
+func main() int {
+    return 0;
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build", "-cc", "env gcc", "-o", "app")
+	if err != nil {
+		t.Fatalf("c_minus build with a launcher failed: %v\nOutput: %s", err, output)
+	}
+	if err := exec.Command(filepath.Join(tmpDir, "app")).Run(); err != nil {
+		t.Errorf("binary failed to run: %v", err)
+	}
+}
+
+// TestBuildLinker verifies -linker links with a different command than the compiler
+func TestBuildLinker(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/linker"`,
+		"main.cm": `module "main"
+
+func main() int {
+    return 0;
+}
+`,
+	})
+	wrapper := filepath.Join(tmpDir, "mylink.sh")
+	script := "#!/bin/sh\necho \"$@\" > \"" + filepath.Join(tmpDir, "link.log") + "\"\nexec gcc \"$@\"\n"
+	if err := os.WriteFile(wrapper, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := runCMinus(t, tmpDir, "build", "-linker", wrapper, "-o", "app")
+	if err != nil {
+		t.Fatalf("build failed: %v\n%s", err, output)
+	}
+	logged, err := os.ReadFile(filepath.Join(tmpDir, "link.log"))
+	if err != nil {
+		t.Fatalf("expected the linker wrapper to run: %v", err)
+	}
+	if !strings.Contains(string(logged), "main.o") || strings.Contains(string(logged), " -c ") {
+		t.Errorf("expected the wrapper to link objects only, got: %s", logged)
+	}
+	if err := exec.Command(filepath.Join(tmpDir, "app")).Run(); err != nil {
+		t.Errorf("linked binary failed to run: %v", err)
+	}
+
+	output, err = runCMinus(t, tmpDir, "build", "-linker", "no-such-ld", "-o", "app2")
+	if err == nil || !strings.Contains(output, `linker "no-such-ld" not found`) {
+		t.Errorf("expected a missing linker error, got %v\n%s", err, output)
+	}
+}
+
+// TestBuildUnity verifies --unity compiles one object per module and links
+// a working binary
+func TestBuildUnity(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/unity"`,
+		"math/add.cm": `module "math"
+
+static int calls = 0;
+
+pub func add(int a, int b) int {
+    calls++;
+    return a + b;
+}
+`,
+		"math/mul.cm": `module "math"
+
+pub func mul(int a, int b) int {
+    return a * b;
+}
+`,
+		"main.cm": `module "main"
+
+import "math"
+
+func main() int {
+    return math.add(2, math.mul(4, 10));
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build", "--unity", "-o", "app")
+	if err != nil {
+		t.Fatalf("c_minus build --unity failed: %v\nOutput: %s", err, output)
+	}
+
+	objects, err := filepath.Glob(filepath.Join(tmpDir, ".c_minus", "*.o"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, o := range objects {
+		names = append(names, filepath.Base(o))
+	}
+	if got := strings.Join(names, " "); got != "main.unity.o math.unity.o" {
+		t.Errorf("expected one object per module, got %q", got)
+	}
+
+	err = exec.Command(filepath.Join(tmpDir, "app")).Run()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 42 {
+		t.Fatalf("expected exit code 42, got %v", err)
+	}
+
+	// A static of the same name in another file would be redefined
+	mul := "module \"math\"\n\nstatic int calls = 0;\n\npub func mul(int a, int b) int {\n    calls++;\n    return a * b;\n}\n"
+	if err := os.WriteFile(filepath.Join(tmpDir, "math", "mul.cm"), []byte(mul), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output, err = runCMinus(t, tmpDir, "build", "--unity", "-o", "app")
+	if err == nil || !strings.Contains(output, `static global "calls" in module math is declared in two files`) {
+		t.Errorf("expected a static collision error, got %v\nOutput: %s", err, output)
+	}
+	if output, err := runCMinus(t, tmpDir, "build", "-o", "app"); err != nil {
+		t.Errorf("expected the build without --unity to succeed: %v\nOutput: %s", err, output)
+	}
+}
+
+// TestBuildDepfiles verifies --depfiles writes a gcc depfile per object and a
+// combined deps.d tying objects to their .cm sources and generated headers
+func TestBuildDepfiles(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/depfiles"`,
+		"math/math.cm": `module "math"
+
+pub func add(int a, int b) int {
+    return a + b;
+}
+`,
+		"main.cm": `module "main"
+
+import "math"
+
+func main() int {
+    return math.add(1, 2) == 3 ? 0 : 1;
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build", "--depfiles")
+	if err != nil {
+		t.Fatalf("c_minus build --depfiles failed: %v\nOutput: %s", err, output)
+	}
+
+	buildDir := filepath.Join(tmpDir, ".c_minus")
+	mainDep, err := os.ReadFile(filepath.Join(buildDir, "main_main.d"))
+	if err != nil {
+		t.Fatalf("expected a depfile for main_main.o: %v", err)
+	}
+	for _, want := range []string{filepath.Join(buildDir, "main_main.o") + ":", "math.h", "main_internal.h"} {
+		if !strings.Contains(string(mainDep), want) {
+			t.Errorf("expected %q in main_main.d:\n%s", want, mainDep)
+		}
+	}
+
+	deps, err := os.ReadFile(filepath.Join(buildDir, "deps.d"))
+	if err != nil {
+		t.Fatalf("expected deps.d: %v", err)
+	}
+	wantRule := filepath.Join(buildDir, "math_math.o") + ": " + filepath.Join(tmpDir, "math", "math.cm")
+	if !strings.Contains(string(deps), wantRule) {
+		t.Errorf("expected %q in deps.d:\n%s", wantRule, deps)
+	}
+	if !strings.Contains(string(deps), "math_internal.h") {
+		t.Errorf("expected the collected gcc depfiles in deps.d:\n%s", deps)
+	}
+
+	// A rebuild with nothing changed keeps the depfiles
+	if output, err := runCMinus(t, tmpDir, "build", "--depfiles"); err != nil {
+		t.Fatalf("second build failed: %v\nOutput: %s", err, output)
+	}
+	if _, err := os.Stat(filepath.Join(buildDir, "math_math.d")); err != nil {
+		t.Errorf("expected math_math.d to remain: %v", err)
+	}
+}
+
+// TestBuildSkipsUnchangedObjects verifies a rebuild does not recompile an
+// object whose regenerated C is identical, and does after a real change
+func TestBuildSkipsUnchangedObjects(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/hashes"`,
+		"math/math.cm": `module "math"
+
+pub func add(int a, int b) int {
+    return a + b;
+}
+`,
+		"main.cm": `module "main"
+
+import "math"
+
+func main() int {
+    return math.add(1, 2) == 3 ? 0 : 1;
+}
+`,
+	})
+
+	buildDir := filepath.Join(tmpDir, ".c_minus")
+	modTime := func(name string) time.Time {
+		info, err := os.Stat(filepath.Join(buildDir, name))
+		if err != nil {
+			t.Fatalf("stat %s: %v", name, err)
+		}
+		return info.ModTime()
+	}
+	build := func() {
+		if output, err := runCMinus(t, tmpDir, "build"); err != nil {
+			t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+		}
+	}
+
+	build()
+	if _, err := os.Stat(filepath.Join(buildDir, ".hashes")); err != nil {
+		t.Fatalf("expected recorded hashes: %v", err)
+	}
+	mathObj, mainObj := modTime("math_math.o"), modTime("main_main.o")
+
+	// A trailing comment does not change the generated C
+	time.Sleep(20 * time.Millisecond)
+	mathPath := filepath.Join(tmpDir, "math", "math.cm")
+	src, err := os.ReadFile(mathPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(mathPath, append(src, "\n// add is exported\n"...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	build()
+	if !modTime("math_math.o").Equal(mathObj) || !modTime("main_main.o").Equal(mainObj) {
+		t.Errorf("expected unchanged objects not to be recompiled")
+	}
+
+	// Changing the body recompiles only math
+	if err := os.WriteFile(mathPath, []byte(strings.Replace(string(src), "a + b", "b + a", 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	build()
+	if modTime("math_math.o").Equal(mathObj) {
+		t.Errorf("expected the changed module to be recompiled")
+	}
+	if !modTime("main_main.o").Equal(mainObj) {
+		t.Errorf("expected main, whose C and headers are unchanged, not to be recompiled")
+	}
+}
+
+// TestBuildNoOpRebuildCompilesNothing verifies a module with several imports
+// gets the same headers on every build, so an unchanged rebuild recompiles
+// no object
+func TestBuildNoOpRebuildCompilesNothing(t *testing.T) {
+	files := map[string]string{
+		"cm.mod": `module "test/noop"`,
+		"app/app.cm": `module "app"
+
+import "alpha"
+import "beta"
+import "gamma"
+import "delta"
+
+pub func run() int {
+    return alpha.get() + beta.get() + gamma.get() + delta.get();
+}
+`,
+		"main.cm": `module "main"
+
+import "app"
+
+func main() int {
+    return app.run() - 10;
+}
+`,
+	}
+	for i, name := range []string{"alpha", "beta", "gamma", "delta"} {
+		files[name+"/"+name+".cm"] = "module \"" + name + "\"\n\npub func get() int {\n    return " + string(rune('1'+i)) + ";\n}\n"
+	}
+	tmpDir := writeProject(t, files)
+
+	if output, err := runCMinus(t, tmpDir, "build"); err != nil {
+		t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+	}
+	objects, _ := filepath.Glob(filepath.Join(tmpDir, ".c_minus", "*.o"))
+	if len(objects) != 6 {
+		t.Fatalf("expected 6 objects, got %v", objects)
+	}
+	mtimes := make(map[string]time.Time)
+	for _, o := range objects {
+		info, err := os.Stat(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mtimes[o] = info.ModTime()
+	}
+
+	for range 4 {
+		if output, err := runCMinus(t, tmpDir, "build"); err != nil {
+			t.Fatalf("c_minus rebuild failed: %v\nOutput: %s", err, output)
+		}
+		for _, o := range objects {
+			if info, err := os.Stat(o); err != nil || !info.ModTime().Equal(mtimes[o]) {
+				t.Fatalf("expected %s not to be recompiled", filepath.Base(o))
+			}
+		}
+	}
+}
+
+// TestBuildRecompilesForChangedCImportHeader verifies that editing a project
+// header a module cimports through a #cgo CFLAGS -I directory recompiles the
+// module, even without --depfiles
+func TestBuildRecompilesForChangedCImportHeader(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod":                 `module "test/cimportheader"`,
+		"include/config.h":       "#include \"limits_local.h\"\n",
+		"include/limits_local.h": "#define LIMIT 3\n",
+		"main.cm":                "module \"main\"\n\n#cgo CFLAGS: -Iinclude\n\ncimport \"config.h\"\n\nfunc main() int {\n    return LIMIT;\n}\n",
+	})
+	binaryPath := filepath.Join(tmpDir, filepath.Base(tmpDir))
+	exitCode := func() int {
+		t.Helper()
+		if output, err := runCMinus(t, tmpDir, "build"); err != nil {
+			t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+		}
+		err := exec.Command(binaryPath).Run()
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return exitErr.ExitCode()
+		}
+		if err != nil {
+			t.Fatalf("binary execution failed: %v", err)
+		}
+		return 0
+	}
+
+	if code := exitCode(); code != 3 {
+		t.Fatalf("expected exit code 3, got %d", code)
+	}
+	// The header included by the cimported one changes the result
+	if err := os.WriteFile(filepath.Join(tmpDir, "include", "limits_local.h"), []byte("#define LIMIT 4\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if code := exitCode(); code != 4 {
+		t.Errorf("expected the edited header to be compiled in (exit code 4), got %d", code)
+	}
+}
+
+// TestBuildGroupErrors verifies --group-errors shows one error per .cm line
+func TestBuildGroupErrors(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/grouperrors"`,
+		"main.cm": `module "main"
+
+func main() int {
+    int x = missing_a + missing_b;
+    return x + missing_c;
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build", "--group-errors")
+	if err == nil {
+		t.Fatalf("expected the build to fail, got:\n%s", output)
+	}
+	out := string(output)
+	if !strings.Contains(out, "main.cm:4:") || !strings.Contains(out, "main.cm:5:") {
+		t.Errorf("expected an error on each of lines 4 and 5, got:\n%s", out)
+	}
+	if n := strings.Count(out, "main.cm:4:13: error:") + strings.Count(out, "main.cm:4:25: error:"); n != 1 {
+		t.Errorf("expected one reported error on line 4, got %d:\n%s", n, out)
+	}
+	if !strings.Contains(out, "(1 more error on this line)") {
+		t.Errorf("expected the second error on line 4 to be collapsed, got:\n%s", out)
+	}
+	if strings.Contains(out, "^") {
+		t.Errorf("expected source excerpts to be dropped, got:\n%s", out)
+	}
+}
+
+// TestBuildTraceIncludes verifies --trace-includes explains each generated include
+func TestBuildTraceIncludes(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/traceincludes"`,
+		"math/math.cm": `module "math"
+
+pub func add(int a, int b) int {
+    return a + b;
+}
+`,
+		"main.cm": `module "main"
+
+cimport "stdio.h"
+import "math"
+
+func main() int {
+    stdio.printf("%d\n", math.add(1, 2));
+    return 0;
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build", "--trace-includes")
+	if err != nil {
+		t.Fatalf("c_minus build --trace-includes failed: %v\nOutput: %s", err, output)
+	}
+	for _, want := range []string{
+		"main_main.c (from ",
+		`#include "main_internal.h"  (own module's internal header)`,
+		`math.h  (main imports "math")`,
+		`#include <stdio.h>  (cimport "stdio.h" on line 3)`,
+		`#include "math.h"  (import "math" on line 4, already included)`,
+		"math_math.c (from ",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("trace missing %q, got:\n%s", want, output)
+		}
+	}
+
+	// Without the flag the build is quiet about includes
+	output, err = runCMinus(t, tmpDir, "build")
+	if err != nil || strings.Contains(output, "#include") {
+		t.Errorf("unexpected include trace without the flag (err %v):\n%s", err, output)
+	}
+}
+
+// TestBuildMirrorObjects verifies --mirror-objects places generated files in per-module
+// directories, so names that collide when flattened still link
+func TestBuildMirrorObjects(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/mirror"`,
+		"a/b/c_d.cm": `module "a/b"
+
+pub func one() int {
+    return 1;
+}
+`,
+		"a/b_c/d.cm": `module "a/b_c"
+
+pub func two() int {
+    return 2;
+}
+`,
+		"main.cm": `module "main"
+
+import "a/b"
+import "a/b_c"
+
+func main() int {
+    return b.one() + b_c.two() - 3;
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build", "--mirror-objects")
+	if err != nil {
+		t.Fatalf("c_minus build --mirror-objects failed: %v\nOutput: %s", err, output)
+	}
+
+	buildDir := filepath.Join(tmpDir, ".c_minus")
+	for _, obj := range []string{"obj/a/b/c_d.o", "obj/a/b_c/d.o", "obj/main/main.o"} {
+		if _, err := os.Stat(filepath.Join(buildDir, filepath.FromSlash(obj))); err != nil {
+			t.Errorf("expected %s: %v", obj, err)
+		}
+	}
+	if matches, _ := filepath.Glob(filepath.Join(buildDir, "*.o")); len(matches) != 0 {
+		t.Errorf("unexpected flat objects: %v", matches)
+	}
+
+	if out, err := exec.Command(filepath.Join(tmpDir, filepath.Base(tmpDir))).CombinedOutput(); err != nil {
+		t.Fatalf("binary execution failed: %v\nOutput: %s", err, out)
+	}
+}
+
+// TestBuildChecks verifies --checks reports an undefined identifier before gcc runs
+func TestBuildChecks(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/checks"`,
+		"main.cm": `module "main"
+
+cimport "stdlib.h"
+
+func main() int {
+    int count = stdlib.abs(-2);
+    return count - cuont;
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build", "--checks", "-Werror")
+	if err == nil {
+		t.Fatalf("expected build to fail, got:\n%s", output)
+	}
+	if !strings.Contains(output, `main.cm:7: warning: "cuont" is not declared in main [undefined-identifier]`) {
+		t.Errorf("expected undefined identifier warning, got:\n%s", output)
+	}
+	if strings.Contains(output, "gcc failed") {
+		t.Errorf("expected the check to stop the build before gcc, got:\n%s", output)
+	}
+}
+
+// TestBuildUnused verifies --unused warns about dead private code and that
+// -Werror turns the warning into a build failure
+func TestBuildUnused(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/unused"`,
+		"main.cm": `module "main"
+
+func leftover() int {
+    return 1;
+}
+
+func main() int {
+    return 0;
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build", "--unused")
+	if err != nil {
+		t.Fatalf("warnings alone must not fail the build: %v\nOutput: %s", err, output)
+	}
+	want := `main.cm:3: warning: private function "leftover" is never used [unused-private]`
+	if !strings.Contains(output, want) {
+		t.Errorf("expected unused warning, got:\n%s", output)
+	}
+
+	output, err = runCMinus(t, tmpDir, "build", "--unused", "-Werror")
+	if err == nil {
+		t.Fatalf("expected -Werror to fail the build, got:\n%s", output)
+	}
+}
+
+// TestBuildNoUnusedImports verifies --no-unused-imports and its cm.build key
+// turn off the unused-import warning, so -Werror no longer fails on it
+func TestBuildNoUnusedImports(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/noimports"`,
+		"util/util.cm": `module "util"
+
+pub func one() int {
+    return 1;
+}
+`,
+		"main.cm": `module "main"
+
+import "util"
+
+func main() int {
+    return 0;
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build", "-Werror")
+	if err == nil || !strings.Contains(output, "[unused-import]") {
+		t.Fatalf("expected the unused import to fail -Werror, got: %v\n%s", err, output)
+	}
+
+	output, err = runCMinus(t, tmpDir, "build", "-Werror", "--no-unused-imports")
+	if err != nil {
+		t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+	}
+	if strings.Contains(output, "unused-import") {
+		t.Errorf("expected no unused-import warning, got:\n%s", output)
+	}
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "cm.build"), []byte("no-unused-imports: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output, err = runCMinus(t, tmpDir, "vet")
+	if err != nil {
+		t.Fatalf("expected vet to honor cm.build: %v\nOutput: %s", err, output)
+	}
+}
+
+// TestBuildReportsAllParseErrors verifies a build with syntax errors in
+// several files reports every one of them, not just the first
+func TestBuildReportsAllParseErrors(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/parseerrors"`,
+		"main.cm": `module "main"
+
+import "util"
+
+func main( int {
+    return 0;
+}
+`,
+		"util/util.cm": `module "util"
+
+pub func (int a) int {
+    return a;
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build")
+	if err == nil {
+		t.Fatalf("expected build to fail, got:\n%s", output)
+	}
+	for _, want := range []string{"main.cm:5", "expected ')' after parameters", "util.cm:3", "missing function name"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q in output:\n%s", want, output)
+		}
+	}
+}
+
+// TestBuildRejectsCKeywordNames verifies a declaration named after a C
+// keyword is reported at its .cm line instead of as a gcc syntax error
+func TestBuildRejectsCKeywordNames(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/keywords"`,
+		"main.cm": `module "main"
+
+import "util"
+
+func main() int {
+    return 0;
+}
+`,
+		"util/util.cm": `module "util"
+
+pub int default = 1;
+
+pub func switch(int a) int {
+    return a;
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build")
+	if err == nil {
+		t.Fatalf("expected build to fail, got:\n%s", output)
+	}
+	if !strings.Contains(output, "util.cm:3:1: global name \"default\" is a reserved C keyword") {
+		t.Errorf("expected the keyword error for default in output:\n%s", output)
+	}
+	if strings.Contains(output, "gcc") || strings.Contains(output, "expected identifier") {
+		t.Errorf("expected c_minus to reject the name before compiling:\n%s", output)
+	}
+}
+
+// TestBuildMangling verifies --mangling double keeps names distinct that the
+// default scheme maps to the same C symbol
+func TestBuildMangling(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/mangling"`,
+		"a_b/a_b.cm": `module "a_b"
+
+pub func c() int {
+    return 1;
+}
+`,
+		"a/a.cm": `module "a"
+
+pub func b_c() int {
+    return 2;
+}
+`,
+		"main.cm": `module "main"
+
+import "a_b"
+import "a"
+
+func main() int {
+    return a_b.c() + a.b_c() - 3;
+}
+`,
+	})
+
+	// Both functions are a_b_c under the default scheme
+	if output, err := runCMinus(t, tmpDir, "build"); err == nil {
+		t.Fatalf("expected the default scheme to fail with a duplicate symbol\nOutput: %s", output)
+	}
+
+	output, err := runCMinus(t, tmpDir, "build", "--mangling", "double")
+	if err != nil {
+		t.Fatalf("c_minus build --mangling double failed: %v\nOutput: %s", err, output)
+	}
+
+	header, err := os.ReadFile(filepath.Join(tmpDir, ".c_minus", "a_b.h"))
+	if err != nil {
+		t.Fatalf("failed to read a_b.h: %v", err)
+	}
+	if !strings.Contains(string(header), "int a_b__c(void)") {
+		t.Errorf("expected a_b__c in header:\n%s", header)
+	}
+
+	if out, err := exec.Command(filepath.Join(tmpDir, filepath.Base(tmpDir))).CombinedOutput(); err != nil {
+		t.Fatalf("binary execution failed: %v\nOutput: %s", err, out)
+	}
+
+	// The length-prefixed scheme can be selected in cm.mod instead
+	modPath := filepath.Join(tmpDir, "cm.mod")
+	if err := os.WriteFile(modPath, []byte("module \"test/mangling\"\nmangling \"length\"\n"), 0644); err != nil {
+		t.Fatalf("failed to write cm.mod: %v", err)
+	}
+	if err := os.RemoveAll(filepath.Join(tmpDir, ".c_minus")); err != nil {
+		t.Fatalf("failed to clean .c_minus: %v", err)
+	}
+	output, err = runCMinus(t, tmpDir, "build")
+	if err != nil {
+		t.Fatalf("c_minus build with mangling \"length\" failed: %v\nOutput: %s", err, output)
+	}
+	header, err = os.ReadFile(filepath.Join(tmpDir, ".c_minus", "N3a_bE.h"))
+	if err != nil {
+		t.Fatalf("failed to read N3a_bE.h: %v", err)
+	}
+	if !strings.Contains(string(header), "int N3a_bE1c(void)") {
+		t.Errorf("expected N3a_bE1c in header:\n%s", header)
+	}
+	if out, err := exec.Command(filepath.Join(tmpDir, filepath.Base(tmpDir))).CombinedOutput(); err != nil {
+		t.Fatalf("binary execution failed: %v\nOutput: %s", err, out)
+	}
+}
+
+// TestBuildTargets verifies cm.mod targets produce an executable and a static
+// library from one build, and -target-name selects a single one
+func TestBuildTargets(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/targets"
+
+target "app" exe "main"
+target "vec" lib "math"
+`,
+		"math/math.cm": `module "math"
+
+pub func add(int a, int b) int {
+    return a + b;
+}
+`,
+		"main.cm": `module "main"
+
+import "math"
+
+func main() int {
+    return math.add(1, 2) - 3;
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build")
+	if err != nil {
+		t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+	}
+
+	if out, err := exec.Command(filepath.Join(tmpDir, "app")).CombinedOutput(); err != nil {
+		t.Fatalf("binary execution failed: %v\nOutput: %s", err, out)
+	}
+
+	members, err := exec.Command("ar", "t", filepath.Join(tmpDir, "libvec.a")).CombinedOutput()
+	if err != nil {
+		t.Fatalf("ar t failed: %v\nOutput: %s", err, members)
+	}
+	if got := strings.TrimSpace(string(members)); got != "math_math.o" {
+		t.Errorf("expected only math_math.o in libvec.a, got %q", got)
+	}
+
+	if err := os.Remove(filepath.Join(tmpDir, "app")); err != nil {
+		t.Fatalf("failed to remove app: %v", err)
+	}
+	output, err = runCMinus(t, tmpDir, "build", "-target-name", "vec")
+	if err != nil {
+		t.Fatalf("c_minus build -target-name vec failed: %v\nOutput: %s", err, output)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "app")); !os.IsNotExist(err) {
+		t.Errorf("expected app not to be rebuilt, stat returned %v", err)
+	}
+
+	if output, err := runCMinus(t, tmpDir, "build", "-target-name", "nope"); err == nil {
+		t.Errorf("expected unknown target to fail\nOutput: %s", output)
+	}
+}
+
+// TestBuildLibraryOnlyProject verifies a project whose modules all live in
+// subdirectories builds as a static library, and that an executable target
+// without a main module fails clearly
+func TestBuildLibraryOnlyProject(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/libonly"`,
+		"math/math.cm": `module "math"
+
+pub func add(int a, int b) int {
+    return a + b;
+}
+`,
+		"text/text.cm": `module "text"
+
+import "math"
+
+pub func twice(int a) int {
+    return math.add(a, a);
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build")
+	if err != nil {
+		t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+	}
+	lib := filepath.Join(tmpDir, "lib"+filepath.Base(tmpDir)+".a")
+	members, err := exec.Command("ar", "t", lib).CombinedOutput()
+	if err != nil {
+		t.Fatalf("ar t failed: %v\nOutput: %s", err, members)
+	}
+	if got := strings.Fields(string(members)); strings.Join(got, " ") != "math_math.o text_text.o" {
+		t.Errorf("expected both modules in the library, got %q", got)
+	}
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "cm.mod"), []byte("module \"test/libonly\"\n\ntarget \"app\" exe \"main\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output, err = runCMinus(t, tmpDir, "build")
+	if err == nil || !strings.Contains(output, "target app is an executable, but the project has no main module") {
+		t.Errorf("expected a clear error for an executable without main, got %v\nOutput: %s", err, output)
+	}
+}
+
+// TestBuildLocalRequire verifies a module from a project required by local
+// path can be imported and linked into the binary
+func TestBuildLocalRequire(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"app/cm.mod": `module "test/app"
+
+require "../geom"
+`,
+		"app/main.cm": `module "main"
+
+import "shapes"
+
+func main() int {
+    shapes.Rect r = {3, 4};
+    return shapes.area(r);
+}
+`,
+		"geom/cm.mod": `module "test/geom"`,
+		"geom/shapes/shapes.cm": `module "shapes"
+
+pub struct Rect { int w; int h; };
+
+pub func area(Rect r) int {
+    return r.w * r.h;
+}
+`,
+	})
+	appDir := filepath.Join(tmpDir, "app")
+
+	output, err := runCMinus(t, appDir, "build")
+	if err != nil {
+		t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+	}
+
+	err = exec.Command(filepath.Join(appDir, "app")).Run()
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok || exitErr.ExitCode() != 12 {
+		t.Fatalf("expected exit code 12, got %v", err)
+	}
+}
+
+// TestBuildPubInMain verifies pub in the main module is reported as a warning
+// without failing the build
+func TestBuildPubInMain(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/pubmain"`,
+		"main.cm": `module "main"
+
+pub func helper() int {
+    return 0;
+}
+
+func main() int {
+    return 0;
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build")
+	if err != nil {
+		t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+	}
+	if !strings.Contains(output, `main.cm:3: warning: pub function "helper" in module main cannot be imported [pub-in-main]`) {
+		t.Errorf("expected pub-in-main warning, got:\n%s", output)
+	}
+}
+
+// TestBuildDuplicateEnumMember verifies enums sharing a member name are
+// reported, and that qualified access picks the right one
+func TestBuildDuplicateEnumMember(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/enums"`,
+		"main.cm": `module "main"
+
+enum Status { OK = 3, FAILED };
+enum Result { ERR, OK };
+
+func main() int {
+    return Status.OK - Result.OK - 2;
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build")
+	if err != nil {
+		t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+	}
+	if !strings.Contains(output, `enum member "OK" is declared in both Status and Result`) {
+		t.Errorf("expected duplicate-enum-member warning, got:\n%s", output)
+	}
+
+	if out, err := exec.Command(filepath.Join(tmpDir, filepath.Base(tmpDir))).CombinedOutput(); err != nil {
+		t.Fatalf("binary execution failed: %v\nOutput: %s", err, out)
+	}
+}
+
+// TestBuildTagExcludedModule verifies a module whose files are all excluded by
+// build tags is not linked, even when an earlier tagged build left its objects
+func TestBuildTagExcludedModule(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/tagmodule"`,
+		"trace/trace.cm": `// +build trace
+
+module "trace"
+
+pub func level() int {
+    return 3;
+}
+`,
+		"main_trace.cm": `// +build trace
+
+module "main"
+
+import "trace"
+
+func main() int {
+    return trace.level() - 3;
+}
+`,
+		"main_plain.cm": `// +build !trace
+
+module "main"
+
+func main() int {
+    return 0;
+}
+`,
+	})
+
+	if output, err := runCMinus(t, tmpDir, "build", "-tags", "trace"); err != nil {
+		t.Fatalf("c_minus build -tags trace failed: %v\nOutput: %s", err, output)
+	}
+	binary := filepath.Join(tmpDir, filepath.Base(tmpDir))
+	if !hasSymbol(t, binary, "trace_level") {
+		t.Fatal("expected trace_level in the tagged build")
+	}
+
+	if output, err := runCMinus(t, tmpDir, "build"); err != nil {
+		t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+	}
+	if hasSymbol(t, binary, "trace_level") {
+		t.Error("trace module was linked although build tags exclude it")
+	}
+
+	// Importing a module that the tags exclude is reported before gcc runs
+	if err := os.WriteFile(filepath.Join(tmpDir, "main_plain.cm"), []byte("// +build !trace\n\nmodule \"main\"\n\nimport \"trace\"\n\nfunc main() int {\n    return trace.level();\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output, err := runCMinus(t, tmpDir, "build")
+	if err == nil {
+		t.Fatalf("expected build to fail, got:\n%s", output)
+	}
+	if !strings.Contains(output, `module main imports "trace", which has no files in this build`) {
+		t.Errorf("unexpected output:\n%s", output)
+	}
+}
+
+// hasSymbol reports whether the ELF binary at path defines the named symbol
+func hasSymbol(t *testing.T, path, name string) bool {
+	t.Helper()
+	f, err := elf.Open(path)
+	if err != nil {
+		t.Fatalf("open %s: %v", path, err)
+	}
+	defer f.Close()
+	syms, err := f.Symbols()
+	if err != nil {
+		t.Fatalf("symbols of %s: %v", path, err)
+	}
+	for _, s := range syms {
+		if s.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCGoPkgConfig(t *testing.T) {
+	if _, err := exec.LookPath("pkg-config"); err != nil {
+		t.Skip("pkg-config not installed")
+	}
+	dir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/pkgconfig"`,
+		"pc/greet.pc": "Name: greet\nDescription: test package\nVersion: 1.0\n" +
+			"Cflags: -DGREETING=42\nLibs: -lm\n",
+		"main.cm": "module \"main\"\n\n#cgo pkg-config: greet\n\ncimport \"math.h\"\n\n" +
+			"func main() int {\n    return GREETING + (int)math.sqrt(0.0);\n}\n",
+	})
+	t.Setenv("PKG_CONFIG_PATH", filepath.Join(dir, "pc"))
+
+	if out, err := runCMinus(t, dir, "build", "-o", "app"); err != nil {
+		t.Fatalf("build failed: %v\n%s", err, out)
+	}
+	err := exec.Command(filepath.Join(dir, "app")).Run()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 42 {
+		t.Fatalf("expected exit code 42 from the pkg-config define, got %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "main.cm"), []byte("module \"main\"\n\n#cgo pkg-config: no-such-package\n\nfunc main() int {\n    return 0;\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := runCMinus(t, dir, "build")
+	if err == nil || !strings.Contains(out, "package no-such-package not found") {
+		t.Errorf("expected a missing package error, got %v\n%s", err, out)
+	}
+}
+
+// TestClean verifies clean removes what the build generated, including the
+// binary, and leaves files the user placed in .c_minus
+func TestClean(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/clean"`,
+		"math/math.cm": `module "math"
+
+pub func add(int a, int b) int {
+    return a + b;
+}
+`,
+		"main.cm": `module "main"
+
+import "math"
+
+func main() int {
+    return math.add(1, -1);
+}
+`,
+	})
+
+	if output, err := runCMinus(t, tmpDir, "build"); err != nil {
+		t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+	}
+	binary := filepath.Join(tmpDir, filepath.Base(tmpDir))
+	if _, err := os.Stat(binary); err != nil {
+		t.Fatalf("expected the binary: %v", err)
+	}
+	notes := filepath.Join(tmpDir, ".c_minus", "notes.txt")
+	if err := os.WriteFile(notes, []byte("keep me"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if output, err := runCMinus(t, tmpDir, "clean"); err != nil {
+		t.Fatalf("c_minus clean failed: %v\nOutput: %s", err, output)
+	}
+	if _, err := os.Stat(binary); !os.IsNotExist(err) {
+		t.Errorf("expected the binary to be removed, stat returned %v", err)
+	}
+	entries, err := os.ReadDir(filepath.Join(tmpDir, ".c_minus"))
+	if err != nil {
+		t.Fatalf("expected .c_minus to remain for notes.txt: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "notes.txt" {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("expected only notes.txt to remain, got %v", names)
+	}
+}
+
+// TestBuildConditionalBlocks verifies a function defined in both branches of
+// an #if block builds either way, and that a type inside one is reported
+// instead of being redefined in the header
+func TestBuildConditionalBlocks(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/conditional"`,
+		"util/util.cm": `module "util"
+
+#ifdef WIDE
+static int width = 8;
+
+pub func size() int {
+    return width;
+}
+#else
+pub func size() int {
+    return 4;
+}
+#endif
+`,
+		"main.cm": `module "main"
+
+import "util"
+
+func main() int {
+    return util.size();
+}
+`,
+	})
+
+	for _, tc := range []struct {
+		args []string
+		want int
+	}{
+		{nil, 4},
+		{[]string{"-DWIDE"}, 8},
+	} {
+		if output, err := runCMinus(t, tmpDir, append([]string{"build", "-o", "app"}, tc.args...)...); err != nil {
+			t.Fatalf("c_minus build %v failed: %v\nOutput: %s", tc.args, err, output)
+		}
+		err := exec.Command(filepath.Join(tmpDir, "app")).Run()
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != tc.want {
+			t.Errorf("build %v: expected exit code %d, got %v", tc.args, tc.want, err)
+		}
+	}
+
+	src := "module \"util\"\n\n#ifdef WIDE\npub struct Size { long v; };\n#else\npub struct Size { int v; };\n#endif\n"
+	if err := os.WriteFile(filepath.Join(tmpDir, "util", "util.cm"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output, err := runCMinus(t, tmpDir, "build")
+	if err == nil || !strings.Contains(output, "struct Size in module util is inside an #if block") {
+		t.Errorf("expected the conditional struct to be reported, got %v:\n%s", err, output)
+	}
+}
+
+// TestBuildErrorDirective verifies a top-level #error fails the build at its
+// .cm line, and that an #if around it is honored
+func TestBuildErrorDirective(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/errordirective"`,
+		"main.cm": `module "main"
+
+#ifndef ALLOW_BUILD
+#error "define ALLOW_BUILD to build this"
+#endif
+
+func main() int {
+    return 0;
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build")
+	if err == nil {
+		t.Fatalf("expected #error to fail the build, got:\n%s", output)
+	}
+	if !strings.Contains(output, "main.cm:4") || !strings.Contains(output, "define ALLOW_BUILD to build this") {
+		t.Errorf("expected the #error message at main.cm:4, got:\n%s", output)
+	}
+
+	if output, err := runCMinus(t, tmpDir, "build", "-DALLOW_BUILD"); err != nil {
+		t.Errorf("expected the guarded #error to be skipped: %v\n%s", err, output)
+	}
+}
+
+// TestBuildExternGlobal verifies a pub extern global is declared for
+// importers and defined only by the C linked in with #cgo
+func TestBuildExternGlobal(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod":             `module "test/externglobal"`,
+		"counter.c":          "int counter_shared_counter = 41;\n",
+		"main.cm":            "module \"main\"\n\nimport \"counter\"\n\nfunc main() int {\n    return counter.bump();\n}\n",
+		"counter/counter.cm": "module \"counter\"\n\n#cgo LDFLAGS: COUNTER_C\n\npub extern int shared_counter;\n\npub func bump() int {\n    return ++shared_counter;\n}\n",
+	})
+	cmPath := filepath.Join(tmpDir, "counter", "counter.cm")
+	src, err := os.ReadFile(cmPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src = []byte(strings.Replace(string(src), "COUNTER_C", filepath.Join(tmpDir, "counter.c"), 1))
+	if err := os.WriteFile(cmPath, src, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if output, err := runCMinus(t, tmpDir, "build", "-o", "app"); err != nil {
+		t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+	}
+	err = exec.Command(filepath.Join(tmpDir, "app")).Run()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 42 {
+		t.Fatalf("expected exit code 42 from the C definition, got %v", err)
+	}
+}
+
+func TestVetConstParams(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/vet"`,
+		"geo/geo.cm": `module "geo"
+
+pub struct Point { int x; int y; };
+
+pub func dot(Point* a, Point* b) int {
+    return a->x * b->x + a->y * b->y;
+}
+
+pub func scale(Point* p, int k) void {
+    p->x *= k;
+    p->y *= k;
+}
+`,
+		"main.cm": `module "main"
+
+import "geo"
+
+func main() int {
+    geo.Point p = {1, 2};
+    geo.scale(&p, 2);
+    return geo.dot(&p, &p) - 20;
+}
+`,
+	})
+
+	// Without the flag there is nothing to report
+	output, err := runCMinus(t, tmpDir, "vet")
+	if err != nil {
+		t.Fatalf("c_minus vet failed: %v\nOutput: %s", err, output)
+	}
+
+	output, err = runCMinus(t, tmpDir, "vet", "--const-params")
+	if err == nil {
+		t.Fatalf("expected vet --const-params to fail on warnings\nOutput: %s", output)
+	}
+	for _, want := range []string{
+		"geo/geo.cm:5: warning: parameter a of dot is only read through; declare it const Point* [const-param]",
+		"geo/geo.cm:5: warning: parameter b of dot is only read through; declare it const Point* [const-param]",
+		"2 warning(s)",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q, got:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, "scale") {
+		t.Errorf("scale writes through p and must not be reported:\n%s", output)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, ".c_minus")); err == nil {
+		t.Errorf("vet must not generate code")
+	}
+}
+
+func TestBuildIncompleteSwitchWarning(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/switches"`,
+		"job/job.cm": `module "job"
+
+pub enum Status {
+    PENDING,
+    RUNNING,
+    DONE,
+};
+
+pub func score(Status s) int {
+    switch (s) {
+    case PENDING:
+        return 1;
+    case DONE:
+        return 2;
+    }
+    return 0;
+}
+`,
+		"main.cm": `module "main"
+
+import "job"
+
+func main() int {
+    return job.score(job.Status.DONE) - 2;
+}
+`,
+	})
+
+	want := "job/job.cm:10: warning: switch over Status has no default and does not handle RUNNING [incomplete-switch]"
+	output, err := runCMinus(t, tmpDir, "build")
+	if err != nil {
+		t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+	}
+	if strings.Contains(output, "incomplete-switch") {
+		t.Errorf("the check must only run with --checks:\n%s", output)
+	}
+
+	output, err = runCMinus(t, tmpDir, "build", "--checks")
+	if err != nil {
+		t.Fatalf("c_minus build --checks failed: %v\nOutput: %s", err, output)
+	}
+	if !strings.Contains(output, want) {
+		t.Errorf("expected %q, got:\n%s", want, output)
+	}
+}
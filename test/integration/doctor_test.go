@@ -0,0 +1,185 @@
+package integration
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestDoctor verifies doctor passes in a valid project and fails on a cycle
+func TestDoctor(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/doctor"`,
+		"math/math.cm": `module "math"
+
+pub func add(int a, int b) int {
+    return a + b;
+}
+`,
+		"main.cm": `module "main"
+
+import "math"
+
+func main() int {
+    return math.add(0, 0);
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "doctor")
+	if err != nil {
+		t.Fatalf("c_minus doctor failed: %v\nOutput: %s", err, output)
+	}
+	if strings.Contains(output, "[FAIL]") {
+		t.Errorf("expected every check to pass, got:\n%s", output)
+	}
+	for _, want := range []string{"[ok]   gcc", "[ok]   cm.mod", `(module "test/doctor")`, "2 module(s), no cycles"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q in output, got:\n%s", want, output)
+		}
+	}
+
+	// The compiler checked is the one a build would use, launcher included
+	if err := os.WriteFile(filepath.Join(tmpDir, "cm.build"), []byte("cc: env gcc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output, err = runCMinus(t, tmpDir, "doctor")
+	if err != nil || !strings.Contains(output, "[ok]   env gcc") || !strings.Contains(output, "(gcc") {
+		t.Errorf("expected cm.build's cc to be checked, got %v:\n%s", err, output)
+	}
+	output, err = runCMinus(t, tmpDir, "doctor", "-cc", "no-such-cc")
+	if err == nil || !strings.Contains(output, "[FAIL] no-such-cc not found in PATH") {
+		t.Errorf("expected -cc to select the compiler checked, got %v:\n%s", err, output)
+	}
+
+	cycleDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/doctor"`,
+		"a/a.cm": "module \"a\"\n\nimport \"b\"\n",
+		"b/b.cm": "module \"b\"\n\nimport \"a\"\n",
+	})
+	output, err = runCMinus(t, cycleDir, "doctor")
+	if err == nil {
+		t.Fatalf("expected doctor to fail on a cycle, got:\n%s", output)
+	}
+	if !strings.Contains(output, "[FAIL] modules") || !strings.Contains(output, "circular dependency") {
+		t.Errorf("expected a failed modules check, got:\n%s", output)
+	}
+}
+
+// TestDoc verifies doc prints a module's public API with its doc comments
+// and lists private declarations only with -all
+func TestDoc(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/doc"`,
+		"math/math.cm": `// Package math does arithmetic
+module "math"
+
+// add returns the sum of a and b
+pub func add(int a, int b) int {
+    return clamp(a + b);
+}
+
+// clamp is an internal helper
+func clamp(int n) int {
+    return n;
+}
+`,
+		"main.cm": `module "main"
+
+import "math"
+
+func main() int {
+    return math.add(0, 0);
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "doc", "math")
+	if err != nil {
+		t.Fatalf("c_minus doc failed: %v\nOutput: %s", err, output)
+	}
+	for _, want := range []string{"Package math does arithmetic", "pub func add(int a, int b) int\n    add returns the sum of a and b"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q in output, got:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, "clamp") {
+		t.Errorf("private clamp must not be listed, got:\n%s", output)
+	}
+
+	output, err = runCMinus(t, tmpDir, "doc", "-all", "math")
+	if err != nil {
+		t.Fatalf("c_minus doc -all failed: %v\nOutput: %s", err, output)
+	}
+	if !strings.Contains(output, "func clamp(int n) int\n    clamp is an internal helper") {
+		t.Errorf("expected clamp with -all, got:\n%s", output)
+	}
+
+	output, err = runCMinus(t, tmpDir, "doc")
+	if err != nil {
+		t.Fatalf("c_minus doc failed: %v\nOutput: %s", err, output)
+	}
+	if !strings.Contains(output, "math  Package math does arithmetic") {
+		t.Errorf("expected the module list, got:\n%s", output)
+	}
+
+	if output, err = runCMinus(t, tmpDir, "doc", "nope"); err == nil {
+		t.Errorf("expected doc to fail for an unknown module, got:\n%s", output)
+	}
+}
+
+// TestModules verifies modules lists each module's files and imports for the
+// selected build tags, as does build --list-modules
+func TestModules(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/modules"`,
+		"math/math.cm": `module "math"
+
+pub func add(int a, int b) int {
+    return a + b;
+}
+`,
+		"math/fast.cm": `// +build fast
+
+module "math"
+
+pub func add_fast(int a, int b) int {
+    return a + b;
+}
+`,
+		"main.cm": `module "main"
+
+import "math"
+
+func main() int {
+    return math.add(0, 0);
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "modules")
+	if err != nil {
+		t.Fatalf("c_minus modules failed: %v\nOutput: %s", err, output)
+	}
+	want := "main  .\n    files:   main.cm\n    imports: math\nmath  math\n    files:   math.cm\n"
+	if output != want {
+		t.Errorf("modules output:\n%s\nwant:\n%s", output, want)
+	}
+
+	output, err = runCMinus(t, tmpDir, "modules", "-tags", "fast")
+	if err != nil {
+		t.Fatalf("c_minus modules -tags failed: %v\nOutput: %s", err, output)
+	}
+	if !strings.Contains(output, "files:   fast.cm math.cm") {
+		t.Errorf("expected fast.cm with the fast tag, got:\n%s", output)
+	}
+
+	output, err = runCMinus(t, tmpDir, "build", "--list-modules")
+	if err != nil {
+		t.Fatalf("c_minus build --list-modules failed: %v\nOutput: %s", err, output)
+	}
+	if !strings.Contains(output, "math  math\n    files:   math.cm") || strings.Contains(output, "Build succeeded") {
+		t.Errorf("expected the module list without building, got:\n%s", output)
+	}
+}
@@ -0,0 +1,110 @@
+package integration
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestExplain verifies explain prints a diagnostic by code or by rule name
+func TestExplain(t *testing.T) {
+	dir := t.TempDir()
+
+	output, err := runCMinus(t, dir, "explain", "CM0012")
+	if err != nil {
+		t.Fatalf("c_minus explain failed: %v\nOutput: %s", err, output)
+	}
+	for _, want := range []string{"CM0012 circular-dependency", "Example fix:"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q in output, got:\n%s", want, output)
+		}
+	}
+
+	output, err = runCMinus(t, dir, "explain", "unused-import")
+	if err != nil || !strings.Contains(output, "CM0001 unused-import") {
+		t.Errorf("expected explanation by rule name, got %v:\n%s", err, output)
+	}
+
+	output, err = runCMinus(t, dir, "explain")
+	if err != nil || !strings.Contains(output, "CM0013  duplicate-global ") {
+		t.Errorf("expected code listing, got %v:\n%s", err, output)
+	}
+
+	if output, err := runCMinus(t, dir, "explain", "CM9999"); err == nil {
+		t.Errorf("expected unknown code to fail, got:\n%s", output)
+	}
+}
+
+// TestCircularDependencyHasCode verifies the error names its explain code
+func TestCircularDependencyHasCode(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/cycle"`,
+		"a/a.cm": `module "a"
+
+import "b"
+
+pub func fa() int {
+    return b.fb();
+}
+`,
+		"b/b.cm": `module "b"
+
+import "a"
+
+pub func fb() int {
+    return 1;
+}
+`,
+		"main.cm": `module "main"
+
+import "a"
+
+func main() int {
+    return a.fa();
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build")
+	if err == nil {
+		t.Fatalf("expected build to fail, got:\n%s", output)
+	}
+	if !strings.Contains(output, "circular dependency detected among modules [CM0012]") {
+		t.Errorf("expected coded error, got:\n%s", output)
+	}
+}
+
+// TestPrivateTypeInPublicSignature verifies a pub function exposing a private
+// type fails in its own module instead of in every importer
+func TestPrivateTypeInPublicSignature(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/visibility"`,
+		"list/list.cm": `module "list"
+
+struct Node {
+    int value;
+};
+
+pub func head_value(Node* n) int {
+    return n->value;
+}
+`,
+		"main.cm": `module "main"
+
+import "list"
+
+func main() int {
+    return list.head_value(0);
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build")
+	if err == nil {
+		t.Fatalf("expected build to fail, got:\n%s", output)
+	}
+	for _, want := range []string{"pub func head_value in module list uses private struct Node [CM0014]", "list.cm:7: function declared here", "list.cm:3: Node declared here"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q in output, got:\n%s", want, output)
+		}
+	}
+}
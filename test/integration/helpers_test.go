@@ -0,0 +1,35 @@
+package integration
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// writeProject creates a project in a temp dir from a map of relative path to content
+func writeProject(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	tmpDir := t.TempDir()
+	for rel, content := range files {
+		path := filepath.Join(tmpDir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create dir for %s: %v", rel, err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to create %s: %v", rel, err)
+		}
+	}
+	return tmpDir
+}
+
+// runCMinus runs the c_minus binary in dir and returns its combined output
+func runCMinus(t *testing.T, dir string, args ...string) (string, error) {
+	t.Helper()
+
+	cmd := exec.Command(findCMinusBinary(t), args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
@@ -166,7 +166,7 @@ func main() int {
 	}
 
 	// Should contain private helper (with name mangling)
-	if !strings.Contains(mathInternalContent, "int math_helper()") {
+	if !strings.Contains(mathInternalContent, "int math_helper(void)") {
 		t.Error("math_internal.h should contain helper declaration")
 	}
 }
@@ -728,6 +728,45 @@ func main() int {
 	}
 }
 
+// TestDefineNameInStringLiteral checks that a define's name inside a string
+// literal is left alone while real uses, local and imported, are mangled
+func TestDefineNameInStringLiteral(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/definestrings"`,
+		"config/config.cm": `module "config"
+
+pub #define MSG "hello"
+`,
+		"main.cm": `module "main"
+
+cimport "stdio.h"
+
+import "config"
+
+pub #define LIMIT 3
+
+func main() int {
+    stdio.printf("LIMIT=%d MSG=", LIMIT);
+    stdio.printf(config.MSG);
+    stdio.printf(" 'config.MSG'\n");
+    return 0;
+}
+`,
+	})
+
+	if out, err := runCMinus(t, tmpDir, "build"); err != nil {
+		t.Fatalf("c_minus build failed: %v\nOutput: %s", err, out)
+	}
+
+	runOutput, err := exec.Command(filepath.Join(tmpDir, filepath.Base(tmpDir))).CombinedOutput()
+	if err != nil {
+		t.Fatalf("binary failed: %v\nOutput: %s", err, runOutput)
+	}
+	if want := "LIMIT=3 MSG=hello 'config.MSG'\n"; string(runOutput) != want {
+		t.Errorf("expected output %q, got %q", want, runOutput)
+	}
+}
+
 // TestGlobalVariables tests global variable support
 func TestGlobalVariables(t *testing.T) {
 	tmpDir := t.TempDir()
@@ -1034,7 +1073,7 @@ func main() int {
 	}
 	platformHContent := string(platformH)
 
-	if !strings.Contains(platformHContent, "void platform_print_name()") {
+	if !strings.Contains(platformHContent, "void platform_print_name(void)") {
 		t.Errorf("platform.h missing print_name, got:\n%s", platformHContent)
 	}
 	if strings.Contains(platformHContent, "feature_func") {
@@ -1090,7 +1129,7 @@ func main() int {
 	}
 	platformHContent = string(platformH)
 
-	if !strings.Contains(platformHContent, "void platform_feature_func()") {
+	if !strings.Contains(platformHContent, "void platform_feature_func(void)") {
 		t.Errorf("platform.h should contain feature_func when built with -tags feature_x, got:\n%s", platformHContent)
 	}
 	if strings.Contains(platformHContent, "experimental_func") {
@@ -1145,10 +1184,10 @@ func main() int {
 	}
 	platformHContent = string(platformH)
 
-	if !strings.Contains(platformHContent, "void platform_feature_func()") {
+	if !strings.Contains(platformHContent, "void platform_feature_func(void)") {
 		t.Errorf("platform.h should contain feature_func, got:\n%s", platformHContent)
 	}
-	if !strings.Contains(platformHContent, "void platform_experimental_func()") {
+	if !strings.Contains(platformHContent, "void platform_experimental_func(void)") {
 		t.Errorf("platform.h should contain experimental_func, got:\n%s", platformHContent)
 	}
 
@@ -1435,3 +1474,995 @@ func main() int {
 		t.Errorf("unexpected output, expected 'sum=7 product=12', got: %s", runOutput)
 	}
 }
+
+// TestParameterShadowsGlobal verifies a parameter named like a module global
+// refers to the parameter, while other functions still reach the global
+func TestParameterShadowsGlobal(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/shadow"`,
+		"stats/stats.cm": `module "stats"
+
+pub int count = 10;
+
+pub func add(int count) int {
+    return count + 1;
+}
+
+pub func total() int {
+    int sum = 0;
+    for (int count = 0; count < 3; count++) {
+        sum += count;
+    }
+    return sum + count;
+}
+`,
+		"main.cm": `module "main"
+
+import "stats"
+
+func main() int {
+    if (stats.add(4) != 5) {
+        return 1;
+    }
+    if (stats.total() != 13) {
+        return 2;
+    }
+    return 0;
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build")
+	if err != nil {
+		t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+	}
+	if out, err := exec.Command(filepath.Join(tmpDir, filepath.Base(tmpDir))).CombinedOutput(); err != nil {
+		t.Fatalf("binary execution failed: %v\nOutput: %s", err, out)
+	}
+}
+
+// TestSwitchCaseLabels verifies enum constants and defines used as case labels
+// are qualified while default and literal cases compile unchanged
+func TestSwitchCaseLabels(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/cases"`,
+		"job/job.cm": `module "job"
+
+pub #define MAX_RETRIES 3
+
+pub enum Status {
+    PENDING,
+    DONE,
+};
+
+pub func score(Status s, int retries) int {
+    switch (s) {
+    case PENDING:
+        return 1;
+    case DONE:
+        break;
+    default:
+        return -1;
+    }
+    switch (retries) {
+    case 0:
+        return 10;
+    case MAX_RETRIES:
+        return 30;
+    default:
+        return 20;
+    }
+}
+`,
+		"main.cm": `module "main"
+
+import "job"
+
+func main() int {
+    switch (job.score(job.Status.DONE, job.MAX_RETRIES)) {
+    case job.MAX_RETRIES * 10:
+        break;
+    default:
+        return 1;
+    }
+    if (job.score(job.Status.PENDING, 0) != 1) {
+        return 2;
+    }
+    if (job.score(job.Status.DONE, 0) != 10) {
+        return 3;
+    }
+    return 0;
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build")
+	if err != nil {
+		t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+	}
+	if out, err := exec.Command(filepath.Join(tmpDir, filepath.Base(tmpDir))).CombinedOutput(); err != nil {
+		t.Fatalf("binary execution failed: %v\nOutput: %s", err, out)
+	}
+}
+
+// TestByteOrderMarks verifies files saved with a UTF-8 byte order mark build
+func TestByteOrderMarks(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod":       "\ufeffmodule \"test/bom\"",
+		"util/util.cm": "\ufeffmodule \"util\"\n\npub func two() int {\n    return 2;\n}\n",
+		"main.cm":      "\ufeffmodule \"main\"\n\nimport \"util\"\n\nfunc main() int {\n    return util.two() - 2;\n}\n",
+	})
+
+	output, err := runCMinus(t, tmpDir, "build")
+	if err != nil {
+		t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+	}
+	if out, err := exec.Command(filepath.Join(tmpDir, filepath.Base(tmpDir))).CombinedOutput(); err != nil {
+		t.Fatalf("binary execution failed: %v\nOutput: %s", err, out)
+	}
+}
+
+// TestDuplicateGlobalsInModule verifies globals declared in two files of one module
+// are reported with both locations, while file-local statics are allowed
+func TestDuplicateGlobalsInModule(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/dupglobals"`,
+		"state/a.cm": `module "state"
+
+static int scratch = 1;
+
+pub int counter = 0;
+`,
+		"state/b.cm": `module "state"
+
+static int scratch = 2;
+
+int counter = 1;
+`,
+		"main.cm": `module "main"
+
+import "state"
+
+func main() int {
+    return state.counter;
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build")
+	if err == nil {
+		t.Fatalf("expected build to fail on duplicate global, got:\n%s", output)
+	}
+	for _, want := range []string{`duplicate global "counter" in module state`, "a.cm:5", "b.cm:5"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("error output missing %q, got:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, "scratch") {
+		t.Errorf("static globals must not be flagged, got:\n%s", output)
+	}
+}
+
+// TestOpaqueStruct verifies an opaque struct is usable through pointers from
+// other modules while by-value use fails to compile
+func TestOpaqueStruct(t *testing.T) {
+	files := map[string]string{
+		"cm.mod": `module "test/opaque"`,
+		"counter/counter.cm": `module "counter"
+
+cimport "stdlib.h"
+
+pub opaque struct Counter {
+    int value;
+};
+
+// Counter holds a single int, zeroed by calloc
+pub func create() Counter* {
+    return stdlib.calloc(1, sizeof(int));
+}
+
+pub func incr(Counter* c) int {
+    c->value = c->value + 1;
+    return c->value;
+}
+`,
+		"main.cm": `module "main"
+
+import "counter"
+
+func main() int {
+    counter.Counter* c = counter.create();
+    counter.incr(c);
+    return counter.incr(c);
+}
+`,
+	}
+
+	tmpDir := writeProject(t, files)
+	output, err := runCMinus(t, tmpDir, "build")
+	if err != nil {
+		t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+	}
+
+	runErr := exec.Command(filepath.Join(tmpDir, filepath.Base(tmpDir))).Run()
+	exitErr, ok := runErr.(*exec.ExitError)
+	if !ok || exitErr.ExitCode() != 2 {
+		t.Fatalf("expected exit code 2, got %v", runErr)
+	}
+
+	// Dereferencing the handle outside its module must not compile
+	files["main.cm"] = `module "main"
+
+import "counter"
+
+func main() int {
+    counter.Counter* c = counter.create();
+    return c->value;
+}
+`
+	tmpDir = writeProject(t, files)
+	output, err = runCMinus(t, tmpDir, "build")
+	if err == nil {
+		t.Fatalf("expected build to fail when dereferencing an opaque struct, got:\n%s", output)
+	}
+	if !strings.Contains(output, "incomplete") {
+		t.Errorf("expected an incomplete type error, got:\n%s", output)
+	}
+}
+
+// TestPragmaPack verifies top-level #pragma pack reaches the struct definition
+// in the header, so every module sees the packed layout
+func TestPragmaPack(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/pragma"`,
+		"wire/wire.cm": `module "wire"
+
+#pragma pack(push, 1)
+pub struct Header {
+    char tag;
+    int length;
+};
+#pragma pack(pop)
+`,
+		"main.cm": `module "main"
+
+import "wire"
+
+func main() int {
+    return sizeof(wire.Header);
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build")
+	if err != nil {
+		t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+	}
+
+	runErr := exec.Command(filepath.Join(tmpDir, filepath.Base(tmpDir))).Run()
+	exitErr, ok := runErr.(*exec.ExitError)
+	if !ok || exitErr.ExitCode() != 5 {
+		t.Fatalf("expected packed size 5 as exit code, got %v", runErr)
+	}
+}
+
+// TestGlobalNamedLikeFunc verifies globals whose names contain "func" are
+// not mistaken for function declarations
+func TestGlobalNamedLikeFunc(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/funcnames"`,
+		"stats/stats.cm": `module "stats"
+
+pub int func_count = 2;
+int funcs[4];
+
+pub func bump() int {
+    funcs[0] = func_count;
+    return funcs[0] + 1;
+}
+`,
+		"main.cm": `module "main"
+
+import "stats"
+
+func main() int {
+    return stats.bump() == stats.func_count + 1 ? 0 : 1;
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build")
+	if err != nil {
+		t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+	}
+	if out, err := exec.Command(filepath.Join(tmpDir, filepath.Base(tmpDir))).CombinedOutput(); err != nil {
+		t.Fatalf("binary execution failed: %v\nOutput: %s", err, out)
+	}
+}
+
+// TestVoidMain verifies a void main builds as an int main that exits 0,
+// including through a bare return
+func TestVoidMain(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/voidmain"`,
+		"main.cm": `module "main"
+
+cimport "stdio.h"
+
+func main(int argc, char** argv) void {
+    if (argc > 1) {
+        stdio.printf("early\n");
+        return;
+    }
+    stdio.printf("done\n");
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build")
+	if err != nil {
+		t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+	}
+	if strings.Contains(output, "warning") {
+		t.Errorf("expected no compiler warnings, got:\n%s", output)
+	}
+
+	binaryPath := filepath.Join(tmpDir, filepath.Base(tmpDir))
+	for _, args := range [][]string{nil, {"x"}} {
+		out, err := exec.Command(binaryPath, args...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("binary with args %v failed: %v\nOutput: %s", args, err, out)
+		}
+	}
+	cContent, err := os.ReadFile(filepath.Join(tmpDir, ".c_minus", "main_main.c"))
+	if err != nil {
+		t.Fatalf("failed to read main_main.c: %v", err)
+	}
+	if !strings.Contains(string(cContent), "int main(int argc, char** argv)") || !strings.Contains(string(cContent), "return 0;") {
+		t.Errorf("expected an int main returning 0, got:\n%s", cContent)
+	}
+}
+
+// TestPackedStruct verifies packed structs and unions compile with the
+// attribute in the typedef and have no padding
+func TestPackedStruct(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/packed"`,
+		"wire/wire.cm": `module "wire"
+
+pub packed struct Header {
+    char tag;
+    int length;
+};
+
+pub packed union Word {
+    char bytes[3];
+    short half;
+};
+
+pub opaque packed struct Conn {
+    char kind;
+    int fd;
+};
+
+pub func conn_size(Conn* c) int {
+    return sizeof(*c);
+}
+`,
+		"main.cm": `module "main"
+
+import "wire"
+
+func main() int {
+    if (sizeof(wire.Header) != 5) {
+        return 1;
+    }
+    if (sizeof(wire.Word) != 3) {
+        return 2;
+    }
+    if (wire.conn_size(0) != 5) {
+        return 3;
+    }
+    return 0;
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build")
+	if err != nil {
+		t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+	}
+	if out, err := exec.Command(filepath.Join(tmpDir, filepath.Base(tmpDir))).CombinedOutput(); err != nil {
+		t.Fatalf("binary execution failed: %v\nOutput: %s", err, out)
+	}
+}
+
+// TestAlignmentSpecifiers verifies _Alignas on globals and struct fields
+// survives into the generated C
+func TestAlignmentSpecifiers(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/align"`,
+		"ring/ring.cm": `module "ring"
+
+pub struct Slot {
+    char tag;
+    _Alignas(64) int head;
+};
+
+pub _Alignas(64) int count = 0;
+`,
+		"main.cm": `module "main"
+
+import "ring"
+
+func main() int {
+    if ((unsigned long)&ring.count % 64 != 0) {
+        return 1;
+    }
+    if (_Alignof(ring.Slot) != 64) {
+        return 2;
+    }
+    return 0;
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build")
+	if err != nil {
+		t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+	}
+	if out, err := exec.Command(filepath.Join(tmpDir, filepath.Base(tmpDir))).CombinedOutput(); err != nil {
+		t.Fatalf("binary execution failed: %v\nOutput: %s", err, out)
+	}
+}
+
+// TestAnonymousEnum verifies tag-less enum constants are usable bare in their
+// module and qualified from importers
+func TestAnonymousEnum(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/anonenum"`,
+		"limits/limits.cm": `module "limits"
+
+pub enum { MAX_USERS = 64, MAX_GROUPS };
+
+pub func capacity() int {
+    return MAX_USERS + MAX_GROUPS;
+}
+`,
+		"main.cm": `module "main"
+
+import "limits"
+
+func main() int {
+    return limits.capacity() - limits.MAX_USERS - limits.MAX_GROUPS;
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build")
+	if err != nil {
+		t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+	}
+	if out, err := exec.Command(filepath.Join(tmpDir, filepath.Base(tmpDir))).CombinedOutput(); err != nil {
+		t.Fatalf("binary execution failed: %v\nOutput: %s", err, out)
+	}
+}
+
+// TestArrayGlobalAcrossModules verifies a string-initialized char array global
+// links when used from another module
+func TestArrayGlobalAcrossModules(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/arrays"`,
+		"text/text.cm": `module "text"
+
+pub char greeting[] = "hello";
+
+pub func length() int {
+    return sizeof(greeting) - 1;
+}
+`,
+		"main.cm": `module "main"
+
+import "text"
+
+func main() int {
+    if (text.greeting[4] != 'o') {
+        return 1;
+    }
+    return text.length() - 5;
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build")
+	if err != nil {
+		t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+	}
+	if out, err := exec.Command(filepath.Join(tmpDir, filepath.Base(tmpDir))).CombinedOutput(); err != nil {
+		t.Fatalf("binary execution failed: %v\nOutput: %s", err, out)
+	}
+}
+
+// TestArrayGlobalSizedByDefine verifies a global array sized by the module's
+// pub define compiles and keeps its size in an importer
+func TestArrayGlobalSizedByDefine(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/arraysize"`,
+		"util/util.cm": `module "util"
+
+pub #define SIZE 4
+
+pub int grid[SIZE][SIZE];
+
+pub func fill() int {
+    grid[SIZE - 1][SIZE - 1] = 7;
+    return grid[3][3];
+}
+`,
+		"main.cm": `module "main"
+
+import "util"
+
+func main() int {
+    if (sizeof(util.grid) != util.SIZE * util.SIZE * sizeof(int)) {
+        return 1;
+    }
+    return util.fill() - util.grid[3][3];
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build")
+	if err != nil {
+		t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+	}
+	if out, err := exec.Command(filepath.Join(tmpDir, filepath.Base(tmpDir))).CombinedOutput(); err != nil {
+		t.Fatalf("binary execution failed: %v\nOutput: %s", err, out)
+	}
+}
+
+// TestFieldAccessOnCallResult verifies fields of a struct returned from an
+// imported function keep their names, even when a global shares one
+func TestFieldAccessOnCallResult(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/fields"`,
+		"geo/geo.cm": `module "geo"
+
+pub struct Point { int x; int y; };
+pub struct Segment { Point from; Point to; };
+
+pub func raise(Segment s) Segment {
+    s.to.y = s.to.y + 2;
+    return s;
+}
+`,
+		"main.cm": `module "main"
+
+import "geo"
+
+int y = 2;
+
+func main() int {
+    geo.Segment seg = { { 0, 0 }, { 1, 0 } };
+    return geo.raise(seg).to.y - y + geo.raise(seg).from.x;
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build")
+	if err != nil {
+		t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+	}
+	if out, err := exec.Command(filepath.Join(tmpDir, filepath.Base(tmpDir))).CombinedOutput(); err != nil {
+		t.Fatalf("binary execution failed: %v\nOutput: %s", err, out)
+	}
+}
+
+// TestUnionHoldsSiblingStruct verifies a union holding a struct by value
+// compiles when the struct is declared in a later file of the module
+func TestUnionHoldsSiblingStruct(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/unionorder"`,
+		"geo/a_value.cm": `module "geo"
+
+pub union Value {
+    Vec2 point;
+    float scalar;
+};
+
+pub func sum(Value v) float {
+    return v.point.x + v.point.y;
+}
+`,
+		"geo/b_vec.cm": `module "geo"
+
+pub struct Vec2 {
+    float x;
+    float y;
+};
+`,
+		"main.cm": `module "main"
+
+import "geo"
+
+func main() int {
+    geo.Value v;
+    v.point.x = 1.0f;
+    v.point.y = 2.0f;
+    return (int)geo.sum(v) - 3;
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build")
+	if err != nil {
+		t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+	}
+	if out, err := exec.Command(filepath.Join(tmpDir, filepath.Base(tmpDir))).CombinedOutput(); err != nil {
+		t.Fatalf("binary execution failed: %v\nOutput: %s", err, out)
+	}
+}
+
+// TestExtendedPrimitiveParams verifies multi-word, extended, and qualified
+// primitive types in signatures compile across modules
+func TestExtendedPrimitiveParams(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/primitives"`,
+		"num/num.cm": `module "num"
+
+pub func half(long double x) long double {
+    return x / 2;
+}
+
+pub func total(const long long* values, unsigned long long n) long long {
+    long long sum = 0;
+    for (unsigned long long i = 0; i < n; i++) {
+        sum += values[i];
+    }
+    return sum;
+}
+
+pub func real_part(_Complex double z) double {
+    return __real__ z;
+}
+`,
+		"main.cm": `module "main"
+
+import "num"
+
+func main() int {
+    long long values[3] = {1, 2, 3};
+    if (num.half(8.0L) != 4.0L) {
+        return 1;
+    }
+    if (num.real_part(2.0) != 2.0) {
+        return 2;
+    }
+    return (int)num.total(values, 3) - 6;
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build")
+	if err != nil {
+		t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+	}
+	if out, err := exec.Command(filepath.Join(tmpDir, filepath.Base(tmpDir))).CombinedOutput(); err != nil {
+		t.Fatalf("binary execution failed: %v\nOutput: %s", err, out)
+	}
+}
+
+// TestInlineFunctionAcrossModules verifies a pub inline func is defined in the
+// public header and callable from an importer
+func TestInlineFunctionAcrossModules(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/inline"`,
+		"num/num.cm": `module "num"
+
+cimport "stdlib.h"
+
+// clamp limits x to [0, hi].
+pub inline func clamp(int x, int hi) int {
+    return x < 0 ? 0 : (x > hi ? hi : x);
+}
+
+pub inline func distance(int a, int b) int {
+    return stdlib.abs(a - b);
+}
+`,
+		"main.cm": `module "main"
+
+import "num"
+
+func main() int {
+    if (num.clamp(12, 10) != 10 || num.clamp(-3, 10) != 0) {
+        return 1;
+    }
+    if (num.distance(3, 7) != 4) {
+        return 2;
+    }
+    return 0;
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build")
+	if err != nil {
+		t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+	}
+	if out, err := exec.Command(filepath.Join(tmpDir, filepath.Base(tmpDir))).CombinedOutput(); err != nil {
+		t.Fatalf("binary execution failed: %v\nOutput: %s", err, out)
+	}
+
+	header, err := os.ReadFile(filepath.Join(tmpDir, ".c_minus", "num.h"))
+	if err != nil {
+		t.Fatalf("failed to read num.h: %v", err)
+	}
+	if !strings.Contains(string(header), "static inline int num_clamp(int x, int hi) {") {
+		t.Errorf("expected clamp to be defined in num.h:\n%s", header)
+	}
+}
+
+// TestPublicInlineUsesModuleSymbols verifies a pub inline body that uses the
+// module's pub globals and defines compiles in both the module and its
+// importer, and one that uses a private symbol is reported
+func TestPublicInlineUsesModuleSymbols(t *testing.T) {
+	files := map[string]string{
+		"cm.mod": `module "test/inlinesyms"`,
+		"util/state.cm": `module "util"
+
+pub int counter = 2;
+
+pub #define LIMIT 3
+
+int hidden = 7;
+`,
+		"util/util.cm": `module "util"
+
+pub inline func get() int {
+    return counter + LIMIT;
+}
+
+pub func bump() int {
+    counter = counter + 1;
+    return counter;
+}
+`,
+		"main.cm": `module "main"
+
+import "util"
+
+func main() int {
+    if (util.get() != 5) {
+        return 1;
+    }
+    if (util.bump() != 3 || util.get() != 6) {
+        return 2;
+    }
+    return 0;
+}
+`,
+	}
+	tmpDir := writeProject(t, files)
+
+	output, err := runCMinus(t, tmpDir, "build")
+	if err != nil {
+		t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+	}
+	if out, err := exec.Command(filepath.Join(tmpDir, filepath.Base(tmpDir))).CombinedOutput(); err != nil {
+		t.Fatalf("binary execution failed: %v\nOutput: %s", err, out)
+	}
+
+	files["util/util.cm"] = strings.Replace(files["util/util.cm"], "return counter + LIMIT;", "return counter + hidden;", 1)
+	tmpDir = writeProject(t, files)
+	output, err = runCMinus(t, tmpDir, "build")
+	if err == nil {
+		t.Fatalf("expected build to fail, got:\n%s", output)
+	}
+	for _, want := range []string{"pub inline func get in module util uses private global hidden [CM0015]", "util.cm:3: function declared here", "state.cm:7: hidden declared here"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q in output, got:\n%s", want, output)
+		}
+	}
+}
+
+// TestHeaderOnlyModule verifies a module of only inline functions lives in
+// its public header, including the headers of modules its bodies call into
+func TestHeaderOnlyModule(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/headeronly"`,
+		"base/base.cm": `module "base"
+
+pub struct pair {
+    int a;
+    int b;
+};
+
+pub func twice(int x) int {
+    return x * 2;
+}
+`,
+		"mathx/mathx.cm": `module "mathx"
+
+import "base"
+cimport "stdlib.h"
+
+inline pub func sum(base.pair p) int {
+    return base.twice(p.a) + abs(p.b);
+}
+`,
+		"main.cm": `module "main"
+
+import "base"
+import "mathx"
+
+func main() int {
+    base.pair p = {1, -2};
+    return mathx.sum(p) == 4 ? 0 : 1;
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build")
+	if err != nil {
+		t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+	}
+	if out, err := exec.Command(filepath.Join(tmpDir, filepath.Base(tmpDir))).CombinedOutput(); err != nil {
+		t.Fatalf("binary execution failed: %v\nOutput: %s", err, out)
+	}
+
+	header, err := os.ReadFile(filepath.Join(tmpDir, ".c_minus", "mathx.h"))
+	if err != nil {
+		t.Fatalf("failed to read mathx.h: %v", err)
+	}
+	if !strings.Contains(string(header), "#include \"base.h\"") || !strings.Contains(string(header), "static inline int mathx_sum(base_pair p) {") {
+		t.Errorf("expected sum to be defined in mathx.h after base.h:\n%s", header)
+	}
+	cFile, err := os.ReadFile(filepath.Join(tmpDir, ".c_minus", "mathx_mathx.c"))
+	if err != nil {
+		t.Fatalf("failed to read mathx_mathx.c: %v", err)
+	}
+	if strings.Contains(string(cFile), "mathx_sum") {
+		t.Errorf("expected no definition of sum in mathx_mathx.c:\n%s", cFile)
+	}
+}
+
+// TestAttributeOnImportedFunction verifies a cminus:attr attribute reaches the
+// public header, so gcc warns where an importer uses a deprecated function
+func TestAttributeOnImportedFunction(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/attrs"`,
+		"lib/lib.cm": `module "lib"
+
+// cminus:attr __attribute__((deprecated("use lib.fresh")))
+pub func old() int {
+    return 1;
+}
+
+pub func fresh() int {
+    return 1;
+}
+`,
+		"main.cm": `module "main"
+
+import "lib"
+
+func main() int {
+    return lib.old() - lib.fresh();
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build")
+	if err != nil {
+		t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+	}
+	if !strings.Contains(string(output), "'lib_old' is deprecated: use lib.fresh") {
+		t.Errorf("expected a deprecation warning at the call site, got:\n%s", output)
+	}
+	if out, err := exec.Command(filepath.Join(tmpDir, filepath.Base(tmpDir))).CombinedOutput(); err != nil {
+		t.Fatalf("binary execution failed: %v\nOutput: %s", err, out)
+	}
+}
+
+// TestReexportedFunction verifies a function re-exported with pub use is
+// callable through the re-exporting module by a module that never imports the original
+func TestReexportedFunction(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/reexport"`,
+		"geo/math/math.cm": `module "geo/math"
+
+pub func add(int a, int b) int {
+    return a + b;
+}
+
+pub func twice(int* v) void {
+    *v = *v * 2;
+}
+`,
+		"shapes/shapes.cm": `module "shapes"
+
+import "geo/math"
+
+pub use math.add;
+pub use math.twice;
+`,
+		"main.cm": `module "main"
+
+import "shapes"
+
+func main() int {
+    int v = shapes.add(1, 2);
+    shapes.twice(&v);
+    return v - 6;
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build")
+	if err != nil {
+		t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+	}
+	if strings.Contains(output, "unused-import") {
+		t.Errorf("pub use must count as a use of the import:\n%s", output)
+	}
+	if out, err := exec.Command(filepath.Join(tmpDir, filepath.Base(tmpDir))).CombinedOutput(); err != nil {
+		t.Fatalf("binary execution failed: %v\nOutput: %s", err, out)
+	}
+}
+
+// TestGlobalInitializersUseImports checks that global initializers may refer
+// to imported defines, enum values, and globals
+func TestGlobalInitializersUseImports(t *testing.T) {
+	tmpDir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/globalinit"`,
+		"config/config.cm": `module "config"
+
+pub #define MAX 64
+
+pub enum Level {
+    LOW,
+    HIGH,
+};
+
+pub int table[4] = {1, 2, 3, 4};
+`,
+		"settings/settings.cm": `module "settings"
+
+import "config"
+
+pub int limit = config.MAX * 2;
+pub int level = config.Level.HIGH;
+pub int* first = &config.table[0];
+pub const char* name = "config.MAX";
+`,
+		"main.cm": `module "main"
+
+import "settings"
+
+func main() int {
+    if (settings.limit != 128) {
+        return 1;
+    }
+    if (settings.level != 1) {
+        return 2;
+    }
+    if (*settings.first != 1) {
+        return 3;
+    }
+    if (settings.name[0] != 'c') {
+        return 4;
+    }
+    return 0;
+}
+`,
+	})
+
+	output, err := runCMinus(t, tmpDir, "build")
+	if err != nil {
+		t.Fatalf("c_minus build failed: %v\nOutput: %s", err, output)
+	}
+	if out, err := exec.Command(filepath.Join(tmpDir, filepath.Base(tmpDir))).CombinedOutput(); err != nil {
+		t.Fatalf("binary execution failed: %v\nOutput: %s", err, out)
+	}
+}
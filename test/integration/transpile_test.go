@@ -0,0 +1,229 @@
+package integration
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestTranspileSingleFile verifies transpile prints the C for one file
+// without a cm.mod
+func TestTranspileSingleFile(t *testing.T) {
+	dir := t.TempDir()
+	src := `module "geo"
+
+import "log"
+
+pub struct Size { int w; int h; };
+
+pub func area(Size s) int {
+    log.info("area");
+    return s.w * s.h;
+}
+`
+	if err := os.WriteFile(filepath.Join(dir, "geo.cm"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := runCMinus(t, dir, "transpile", "geo.cm")
+	if err != nil {
+		t.Fatalf("c_minus transpile failed: %v\nOutput: %s", err, output)
+	}
+	for _, want := range []string{
+		"// ==> geo.h <==",
+		"int geo_area(geo_Size s);",
+		"// ==> geo_internal.h <==",
+		"// ==> geo_geo.c <==",
+		`log_info("area");`,
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q in output:\n%s", want, output)
+		}
+	}
+
+	if output, err := runCMinus(t, dir, "transpile", "missing.cm"); err == nil {
+		t.Errorf("expected a missing file to fail, got:\n%s", output)
+	}
+}
+
+// TestTranspileSingleFileImportedEnum verifies transpile of a file inside a
+// project qualifies the members of an imported module's enum
+func TestTranspileSingleFileImportedEnum(t *testing.T) {
+	dir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/single_enum"`,
+		"state/state.cm": `module "state"
+
+pub enum State { IDLE, RUNNING };
+
+pub struct Config { int width; };
+
+pub Config config;
+`,
+		"main.cm": `module "main"
+
+import "state"
+
+func main() int {
+    state.State s = state.State.RUNNING;
+    return s + state.config.width;
+}
+`,
+	})
+
+	output, err := runCMinus(t, dir, "transpile", "main.cm")
+	if err != nil {
+		t.Fatalf("c_minus transpile failed: %v\nOutput: %s", err, output)
+	}
+	for _, want := range []string{"state_State_RUNNING;", "state_config.width"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q in output:\n%s", want, output)
+		}
+	}
+}
+
+// TestTranspileSingleFileMangling verifies transpile of a file inside a
+// project mangles names and names files with the project's scheme, as a
+// build does
+func TestTranspileSingleFileMangling(t *testing.T) {
+	dir := writeProject(t, map[string]string{
+		"cm.mod": "module \"test/single_mangling\"\nmangling \"double\"\n",
+		"geo/geo.cm": `module "geo"
+
+pub func area(int w, int h) int {
+    return w * h;
+}
+`,
+	})
+
+	output, err := runCMinus(t, dir, "transpile", filepath.Join("geo", "geo.cm"))
+	if err != nil {
+		t.Fatalf("c_minus transpile failed: %v\nOutput: %s", err, output)
+	}
+	for _, want := range []string{"// ==> geo.h <==", "int geo__area(int w, int h);", "// ==> geo__geo.c <=="} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q in output:\n%s", want, output)
+		}
+	}
+
+	// cm.build's scheme, then --mangling, take precedence over cm.mod's
+	if err := os.WriteFile(filepath.Join(dir, "cm.build"), []byte("mangling: length\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output, err = runCMinus(t, dir, "transpile", filepath.Join("geo", "geo.cm"))
+	if err != nil || !strings.Contains(output, "int N3geoE4area(int w, int h);") {
+		t.Errorf("expected cm.build's mangling, got %v:\n%s", err, output)
+	}
+	output, err = runCMinus(t, dir, "transpile", "--mangling", "underscore", filepath.Join("geo", "geo.cm"))
+	if err != nil || !strings.Contains(output, "int geo_area(int w, int h);") {
+		t.Errorf("expected --mangling to override, got %v:\n%s", err, output)
+	}
+}
+
+// TestTranspileStdin verifies transpile - reads the source from stdin and
+// names the output after --path
+func TestTranspileStdin(t *testing.T) {
+	dir := t.TempDir()
+	cmd := exec.Command(findCMinusBinary(t), "transpile", "--path", "shapes/area.cm", "-")
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(`module "shapes"
+
+pub func square(int s) int {
+    return s * s;
+}
+`)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("c_minus transpile - failed: %v\nOutput: %s", err, output)
+	}
+	for _, want := range []string{
+		"// ==> shapes_area.c <==",
+		"int shapes_square(int s) {",
+		filepath.Join(dir, "shapes", "area.cm"),
+	} {
+		if !strings.Contains(string(output), want) {
+			t.Errorf("expected %q in output:\n%s", want, output)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("expected transpile - to leave the directory untouched, found %v", entries)
+	}
+}
+
+// TestTranspileProjectToDirectory verifies transpile -o writes the project's C
+// and a compile_commands.json whose commands build a working program
+func TestTranspileProjectToDirectory(t *testing.T) {
+	dir := writeProject(t, map[string]string{
+		"cm.mod": `module "test/export"`,
+		"util/text/text.cm": `module "util/text"
+
+pub func width() int {
+    return 7;
+}
+`,
+		"main.cm": `module "main"
+
+import "util/text"
+
+func main() int {
+    return text.width() == 7 ? 0 : 1;
+}
+`,
+	})
+
+	outDir := filepath.Join(t.TempDir(), "gen")
+	output, err := runCMinus(t, dir, "transpile", "-o", outDir, "--mirror-objects", "-DEXPORTED=1")
+	if err != nil {
+		t.Fatalf("c_minus transpile -o failed: %v\nOutput: %s", err, output)
+	}
+	for _, rel := range []string{"util_text.h", "main_internal.h", "obj/util/text/text.c", "obj/main/main.c"} {
+		if _, err := os.Stat(filepath.Join(outDir, rel)); err != nil {
+			t.Errorf("expected %s in the output directory: %v", rel, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".c_minus")); err == nil {
+		t.Error("expected transpile -o to leave the project's build directory alone")
+	}
+
+	data, err := os.ReadFile(filepath.Join(outDir, "compile_commands.json"))
+	if err != nil {
+		t.Fatalf("expected compile_commands.json: %v", err)
+	}
+	var cmds []struct {
+		Directory string   `json:"directory"`
+		File      string   `json:"file"`
+		Arguments []string `json:"arguments"`
+	}
+	if err := json.Unmarshal(data, &cmds); err != nil {
+		t.Fatalf("invalid compile_commands.json: %v\n%s", err, data)
+	}
+	if len(cmds) != 2 {
+		t.Fatalf("expected 2 compile commands, got %d:\n%s", len(cmds), data)
+	}
+
+	// The commands are enough to build the program without c_minus
+	var objects []string
+	for _, c := range cmds {
+		if !strings.Contains(strings.Join(c.Arguments, " "), "-DEXPORTED=1") {
+			t.Errorf("expected the -D flag in %v", c.Arguments)
+		}
+		if !strings.Contains(strings.Join(c.Arguments, " "), "-std=gnu11") {
+			t.Errorf("expected the default -std flag in %v", c.Arguments)
+		}
+		cmd := exec.Command(c.Arguments[0], c.Arguments[1:]...)
+		cmd.Dir = c.Directory
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("compiling %s failed: %v\n%s", c.File, err, out)
+		}
+		objects = append(objects, strings.TrimSuffix(c.File, ".c")+".o")
+	}
+	binary := filepath.Join(outDir, "app")
+	if out, err := exec.Command("gcc", append(objects, "-o", binary)...).CombinedOutput(); err != nil {
+		t.Fatalf("linking failed: %v\n%s", err, out)
+	}
+	if out, err := exec.Command(binary).CombinedOutput(); err != nil {
+		t.Fatalf("binary execution failed: %v\nOutput: %s", err, out)
+	}
+}
@@ -0,0 +1,119 @@
+package lsp_integration
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCompileOnSavePublishesWarnings enables compileOnSave and checks that a
+// warning only a real compile with -Wall reports shows up on the .cm file
+func TestCompileOnSavePublishesWarnings(t *testing.T) {
+	if _, err := exec.LookPath("gcc"); err != nil {
+		t.Skip("gcc not installed")
+	}
+	tmpDir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "cm.mod"), []byte(`module "test/lsp"`), 0644); err != nil {
+		t.Fatalf("write cm.mod: %v", err)
+	}
+	mainCM := strings.Join([]string{
+		`module "main"`,
+		"",
+		"func main() int {",
+		"    int unused = 0;",
+		"    return 0;",
+		"}",
+		"",
+	}, "\n")
+	mainPath := filepath.Join(tmpDir, "main.cm")
+	if err := os.WriteFile(mainPath, []byte(mainCM), 0644); err != nil {
+		t.Fatalf("write main.cm: %v", err)
+	}
+
+	lspBin := findLSPBinary(t)
+	cmd := exec.Command(lspBin)
+	cmd.Dir = tmpDir
+	cmd.Env = append(os.Environ(), "CC=gcc")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatalf("stdin pipe: %v", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("stdout pipe: %v", err)
+	}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start c_minus_lsp: %v", err)
+	}
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+
+	client := newLSPClient(t, stdout, stdin)
+	initResp := client.request("initialize", map[string]any{
+		"rootUri":      fileURIForPath(t, tmpDir),
+		"capabilities": map[string]any{},
+		"initializationOptions": map[string]any{
+			"disableClangd":      true,
+			"compileOnSave":      true,
+			"compileOnSaveFlags": []string{"-Wunused-variable"},
+		},
+	})
+	if initResp.Error != nil {
+		t.Fatalf("initialize error: %s", initResp.Error.Message)
+	}
+	var init struct {
+		Capabilities struct {
+			TextDocumentSync struct {
+				Save *struct{} `json:"save"`
+			} `json:"textDocumentSync"`
+		} `json:"capabilities"`
+	}
+	if err := json.Unmarshal(initResp.Result, &init); err != nil {
+		t.Fatalf("unmarshal initialize: %v", err)
+	}
+	if init.Capabilities.TextDocumentSync.Save == nil {
+		t.Errorf("expected save notifications to be requested, got %s", string(initResp.Result))
+	}
+	client.notify("initialized", map[string]any{})
+
+	docURI := fileURIForPath(t, mainPath)
+	client.notify("textDocument/didOpen", map[string]any{
+		"textDocument": map[string]any{
+			"uri":        docURI,
+			"languageId": "cminus",
+			"version":    1,
+			"text":       mainCM,
+		},
+	})
+	client.notify("textDocument/didSave", map[string]any{
+		"textDocument": map[string]any{"uri": docURI},
+	})
+
+	msg := client.waitForDiagnostics(docURI, "unused variable", 20*time.Second)
+	var params struct {
+		Diagnostics []struct {
+			Range struct {
+				Start struct {
+					Line int `json:"line"`
+				} `json:"start"`
+			} `json:"range"`
+			Severity int    `json:"severity"`
+			Source   string `json:"source"`
+		} `json:"diagnostics"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		t.Fatalf("unmarshal diagnostics: %v", err)
+	}
+	d := params.Diagnostics[0]
+	if d.Range.Start.Line != 3 || d.Severity != 2 || d.Source != "cc" {
+		t.Errorf("expected a cc warning on line 3, got %s", string(msg.Params))
+	}
+}
@@ -0,0 +1,187 @@
+package lsp_integration
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestDisableClangdKeepsNativeFeatures runs the server with clangd disabled and
+// no clangd on PATH: symbols, rename, and hover still work natively
+func TestDisableClangdKeepsNativeFeatures(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "cm.mod"), []byte(`module "test/lsp"`), 0644); err != nil {
+		t.Fatalf("write cm.mod: %v", err)
+	}
+	mathDir := filepath.Join(tmpDir, "math")
+	if err := os.MkdirAll(mathDir, 0755); err != nil {
+		t.Fatalf("mkdir math: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(mathDir, "math.cm"), []byte("module \"math\"\n\n// twice doubles x.\npub func twice(int x) int {\n    return x * 2;\n}\n"), 0644); err != nil {
+		t.Fatalf("write math.cm: %v", err)
+	}
+
+	mainCM := strings.Join([]string{
+		`module "main"`,
+		"",
+		`import "math"`,
+		"",
+		"func helper(int a) int {",
+		"    return math.twice(a);",
+		"}",
+		"",
+		"func main() int {",
+		"    return helper(1);",
+		"}",
+		"",
+	}, "\n")
+	mainPath := filepath.Join(tmpDir, "main.cm")
+	if err := os.WriteFile(mainPath, []byte(mainCM), 0644); err != nil {
+		t.Fatalf("write main.cm: %v", err)
+	}
+
+	lspBin := findLSPBinary(t)
+	cmd := exec.Command(lspBin)
+	cmd.Dir = tmpDir
+	// No clangd to start, even by accident
+	cmd.Env = append(os.Environ(), "PATH="+t.TempDir())
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatalf("stdin pipe: %v", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("stdout pipe: %v", err)
+	}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start c_minus_lsp: %v", err)
+	}
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+
+	client := newLSPClient(t, stdout, stdin)
+	rootURI := fileURIForPath(t, tmpDir)
+	initResp := client.request("initialize", map[string]any{
+		"rootUri":               rootURI,
+		"capabilities":          map[string]any{},
+		"initializationOptions": map[string]any{"disableClangd": true},
+	})
+	if initResp.Error != nil {
+		t.Fatalf("initialize error: %s", initResp.Error.Message)
+	}
+	var init struct {
+		Capabilities struct {
+			HoverProvider      bool `json:"hoverProvider"`
+			ReferencesProvider bool `json:"referencesProvider"`
+		} `json:"capabilities"`
+	}
+	if err := json.Unmarshal(initResp.Result, &init); err != nil {
+		t.Fatalf("unmarshal initialize: %v", err)
+	}
+	if !init.Capabilities.HoverProvider || !init.Capabilities.ReferencesProvider {
+		t.Errorf("expected hover and references to be advertised, got %s", string(initResp.Result))
+	}
+	client.notify("initialized", map[string]any{})
+
+	docURI := fileURIForPath(t, mainPath)
+	client.notify("textDocument/didOpen", map[string]any{
+		"textDocument": map[string]any{
+			"uri":        docURI,
+			"languageId": "cminus",
+			"version":    1,
+			"text":       mainCM,
+		},
+	})
+
+	// Wait for generated output.
+	cPath := filepath.Join(tmpDir, ".c_minus", "main_main.c")
+	deadline := time.Now().Add(20 * time.Second)
+	for {
+		if _, err := os.Stat(cPath); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for generated file %s", cPath)
+		}
+		time.Sleep(25 * time.Millisecond)
+	}
+
+	dsResp := client.request("textDocument/documentSymbol", map[string]any{
+		"textDocument": map[string]any{"uri": docURI},
+	})
+	if dsResp.Error != nil {
+		t.Fatalf("documentSymbol error: %s", dsResp.Error.Message)
+	}
+	if !strings.Contains(string(dsResp.Result), `"helper"`) {
+		t.Errorf("expected helper among the document symbols, got %s", string(dsResp.Result))
+	}
+
+	// Native hover on the imported call: "    return math.twice(a);"
+	hoverResp := client.request("textDocument/hover", map[string]any{
+		"textDocument": map[string]any{"uri": docURI},
+		"position":     map[string]any{"line": 5, "character": 17},
+	})
+	if hoverResp.Error != nil {
+		t.Fatalf("hover error: %s", hoverResp.Error.Message)
+	}
+	if !strings.Contains(string(hoverResp.Result), "int twice(int x)") {
+		t.Errorf("expected the native hover for twice, got %s", string(hoverResp.Result))
+	}
+
+	// A position with no native answer gets null, not an error
+	hoverResp = client.request("textDocument/hover", map[string]any{
+		"textDocument": map[string]any{"uri": docURI},
+		"position":     map[string]any{"line": 5, "character": 25},
+	})
+	if hoverResp.Error != nil || string(hoverResp.Result) != "null" {
+		t.Errorf("expected a null hover, got %s (error %v)", string(hoverResp.Result), hoverResp.Error)
+	}
+
+	// Native references reach math.cm, which was never opened
+	refResp := client.request("textDocument/references", map[string]any{
+		"textDocument": map[string]any{"uri": docURI},
+		"position":     map[string]any{"line": 5, "character": 17},
+		"context":      map[string]any{"includeDeclaration": true},
+	})
+	if refResp.Error != nil {
+		t.Fatalf("references error: %s", refResp.Error.Message)
+	}
+	var refs []struct {
+		URI string `json:"uri"`
+	}
+	if err := json.Unmarshal(refResp.Result, &refs); err != nil {
+		t.Fatalf("unmarshal references: %v", err)
+	}
+	mathURI := fileURIForPath(t, filepath.Join(mathDir, "math.cm"))
+	if len(refs) != 2 || refs[0].URI != docURI || refs[1].URI != mathURI {
+		t.Errorf("expected the call in main.cm and the declaration in math.cm, got %s", string(refResp.Result))
+	}
+
+	rnResp := client.request("textDocument/rename", map[string]any{
+		"textDocument": map[string]any{"uri": docURI},
+		"position":     map[string]any{"line": 9, "character": 12}, // on helper(1)
+		"newName":      "assist",
+	})
+	if rnResp.Error != nil {
+		t.Fatalf("rename error: %s", rnResp.Error.Message)
+	}
+	var edit struct {
+		Changes map[string][]struct {
+			NewText string `json:"newText"`
+		} `json:"changes"`
+	}
+	if err := json.Unmarshal(rnResp.Result, &edit); err != nil {
+		t.Fatalf("unmarshal rename: %v", err)
+	}
+	if len(edit.Changes[docURI]) != 2 {
+		t.Errorf("expected both uses of helper renamed, got %s", string(rnResp.Result))
+	}
+}
@@ -0,0 +1,114 @@
+package lsp_integration
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStructFieldCompletionAfterArrow(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "cm.mod"), []byte(`module "test/lsp"`), 0644); err != nil {
+		t.Fatalf("write cm.mod: %v", err)
+	}
+
+	mainCM := strings.Join([]string{
+		"module \"main\"",
+		"",
+		"struct Tree {",
+		"    int size;",
+		"    struct Tree* left;",
+		"    struct Tree* right;",
+		"};",
+		"",
+		"func count(Tree* t) int {",
+		"    return t->",
+		"}",
+		"",
+		"func main() int {",
+		"    return 0;",
+		"}",
+		"",
+	}, "\n")
+	mainPath := filepath.Join(tmpDir, "main.cm")
+	if err := os.WriteFile(mainPath, []byte(mainCM), 0644); err != nil {
+		t.Fatalf("write main.cm: %v", err)
+	}
+
+	lspBin := findLSPBinary(t)
+	cmd := exec.Command(lspBin)
+	cmd.Dir = tmpDir
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatalf("stdin pipe: %v", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("stdout pipe: %v", err)
+	}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start c_minus_lsp: %v", err)
+	}
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+
+	client := newLSPClient(t, stdout, stdin)
+	rootURI := fileURIForPath(t, tmpDir)
+	initResp := client.request("initialize", map[string]any{"rootUri": rootURI, "capabilities": map[string]any{}})
+	if initResp.Error != nil {
+		t.Fatalf("initialize error: %s", initResp.Error.Message)
+	}
+	client.notify("initialized", map[string]any{})
+
+	docURI := fileURIForPath(t, mainPath)
+	client.notify("textDocument/didOpen", map[string]any{
+		"textDocument": map[string]any{
+			"uri":        docURI,
+			"languageId": "cminus",
+			"version":    1,
+			"text":       mainCM,
+		},
+	})
+
+	cPath := filepath.Join(tmpDir, ".c_minus", "main_main.c")
+	deadline := time.Now().Add(20 * time.Second)
+	for {
+		if _, err := os.Stat(cPath); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for generated file %s", cPath)
+		}
+		time.Sleep(25 * time.Millisecond)
+	}
+
+	// Completion after t->
+	compResp := client.request("textDocument/completion", map[string]any{
+		"textDocument": map[string]any{"uri": docURI},
+		"position":     map[string]any{"line": 9, "character": len("    return t->")},
+		"context":      map[string]any{"triggerKind": 2, "triggerCharacter": ">"},
+	})
+	if compResp.Error != nil {
+		t.Fatalf("completion error: %s", compResp.Error.Message)
+	}
+
+	labels := extractCompletionLabels(t, compResp.Result)
+	for _, want := range []string{"size", "left", "right"} {
+		found := false
+		for _, label := range labels {
+			if label == want {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected field %q after t->, got %v", want, labels)
+		}
+	}
+}
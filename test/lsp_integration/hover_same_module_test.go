@@ -0,0 +1,123 @@
+package lsp_integration
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHoverOnSameModuleFunctionShowsSourceSignature(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "cm.mod"), []byte(`module "test/lsp"`), 0644); err != nil {
+		t.Fatalf("write cm.mod: %v", err)
+	}
+
+	// module geom, whose functions call each other unqualified
+	geomDir := filepath.Join(tmpDir, "geom")
+	if err := os.MkdirAll(geomDir, 0755); err != nil {
+		t.Fatalf("mkdir geom: %v", err)
+	}
+	geomCM := strings.Join([]string{
+		`module "geom"`,
+		"",
+		"// area returns the area of a w by h rectangle.",
+		"func area(int w, int h) int {",
+		"    return w * h;",
+		"}",
+		"",
+		"pub func square(int side) int {",
+		"    return area(side, side);",
+		"}",
+		"",
+	}, "\n")
+	geomPath := filepath.Join(geomDir, "geom.cm")
+	if err := os.WriteFile(geomPath, []byte(geomCM), 0644); err != nil {
+		t.Fatalf("write geom.cm: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "main.cm"), []byte("module \"main\"\n\nimport \"geom\"\n\nfunc main() int {\n    return geom.square(2) == 4 ? 0 : 1;\n}\n"), 0644); err != nil {
+		t.Fatalf("write main.cm: %v", err)
+	}
+
+	lspBin := findLSPBinary(t)
+	cmd := exec.Command(lspBin)
+	cmd.Dir = tmpDir
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatalf("stdin pipe: %v", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("stdout pipe: %v", err)
+	}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start c_minus_lsp: %v", err)
+	}
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+
+	client := newLSPClient(t, stdout, stdin)
+	rootURI := fileURIForPath(t, tmpDir)
+	initResp := client.request("initialize", map[string]any{"rootUri": rootURI, "capabilities": map[string]any{}})
+	if initResp.Error != nil {
+		t.Fatalf("initialize error: %s", initResp.Error.Message)
+	}
+	client.notify("initialized", map[string]any{})
+
+	docURI := fileURIForPath(t, geomPath)
+	client.notify("textDocument/didOpen", map[string]any{
+		"textDocument": map[string]any{
+			"uri":        docURI,
+			"languageId": "cminus",
+			"version":    1,
+			"text":       geomCM,
+		},
+	})
+
+	// Wait for generated output.
+	cPath := filepath.Join(tmpDir, ".c_minus", "geom_geom.c")
+	deadline := time.Now().Add(20 * time.Second)
+	for {
+		if _, err := os.Stat(cPath); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for generated file %s", cPath)
+		}
+		time.Sleep(25 * time.Millisecond)
+	}
+
+	// Hover over area in "    return area(side, side);" (line 8, 0-based)
+	hoverResp := client.request("textDocument/hover", map[string]any{
+		"textDocument": map[string]any{"uri": docURI},
+		"position":     map[string]any{"line": 8, "character": 13},
+	})
+	if hoverResp.Error != nil {
+		t.Fatalf("hover error: %s", hoverResp.Error.Message)
+	}
+
+	var h struct {
+		Contents struct {
+			Value string `json:"value"`
+		} `json:"contents"`
+	}
+	if err := json.Unmarshal(hoverResp.Result, &h); err != nil {
+		t.Fatalf("unmarshal hover: %v (%s)", err, string(hoverResp.Result))
+	}
+	if !strings.Contains(h.Contents.Value, "int area(int w, int h)") {
+		t.Errorf("expected the source signature of area, got %q", h.Contents.Value)
+	}
+	if !strings.Contains(h.Contents.Value, "area returns the area") {
+		t.Errorf("expected the doc comment of area, got %q", h.Contents.Value)
+	}
+	if strings.Contains(h.Contents.Value, "geom_area") {
+		t.Errorf("expected no mangled C name in the hover, got %q", h.Contents.Value)
+	}
+}
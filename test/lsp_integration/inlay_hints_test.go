@@ -0,0 +1,104 @@
+package lsp_integration
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestInlayHintsNameCallParameters(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "cm.mod"), []byte(`module "test/lsp"`), 0644); err != nil {
+		t.Fatalf("write cm.mod: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(tmpDir, "math"), 0755); err != nil {
+		t.Fatalf("mkdir math: %v", err)
+	}
+	mathCM := "module \"math\"\n\npub func scale(int value, int factor) int {\n    return value * factor;\n}\n"
+	if err := os.WriteFile(filepath.Join(tmpDir, "math", "math.cm"), []byte(mathCM), 0644); err != nil {
+		t.Fatalf("write math.cm: %v", err)
+	}
+
+	mainCM := "module \"main\"\n\nimport \"math\"\n\nfunc main() int {\n    return math.scale(3, 0);\n}\n"
+	mainPath := filepath.Join(tmpDir, "main.cm")
+	if err := os.WriteFile(mainPath, []byte(mainCM), 0644); err != nil {
+		t.Fatalf("write main.cm: %v", err)
+	}
+
+	lspBin := findLSPBinary(t)
+	cmd := exec.Command(lspBin)
+	cmd.Dir = tmpDir
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatalf("stdin pipe: %v", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("stdout pipe: %v", err)
+	}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start c_minus_lsp: %v", err)
+	}
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+
+	client := newLSPClient(t, stdout, stdin)
+	rootURI := fileURIForPath(t, tmpDir)
+	initResp := client.request("initialize", map[string]any{"rootUri": rootURI, "capabilities": map[string]any{}})
+	if initResp.Error != nil {
+		t.Fatalf("initialize error: %s", initResp.Error.Message)
+	}
+	var init struct {
+		Capabilities struct {
+			InlayHintProvider bool `json:"inlayHintProvider"`
+		} `json:"capabilities"`
+	}
+	if err := json.Unmarshal(initResp.Result, &init); err != nil || !init.Capabilities.InlayHintProvider {
+		t.Fatalf("expected inlayHintProvider to be advertised, got %s", initResp.Result)
+	}
+	client.notify("initialized", map[string]any{})
+
+	docURI := fileURIForPath(t, mainPath)
+	client.notify("textDocument/didOpen", map[string]any{
+		"textDocument": map[string]any{
+			"uri":        docURI,
+			"languageId": "cminus",
+			"version":    1,
+			"text":       mainCM,
+		},
+	})
+
+	resp := client.request("textDocument/inlayHint", map[string]any{
+		"textDocument": map[string]any{"uri": docURI},
+		"range": map[string]any{
+			"start": map[string]any{"line": 5, "character": 0},
+			"end":   map[string]any{"line": 6, "character": 0},
+		},
+	})
+	if resp.Error != nil {
+		t.Fatalf("inlayHint error: %s", resp.Error.Message)
+	}
+
+	var hints []struct {
+		Label    string `json:"label"`
+		Position struct {
+			Line      int `json:"line"`
+			Character int `json:"character"`
+		} `json:"position"`
+	}
+	if err := json.Unmarshal(resp.Result, &hints); err != nil {
+		t.Fatalf("unmarshal hints: %v (%s)", err, resp.Result)
+	}
+	if len(hints) != 2 || hints[0].Label != "value:" || hints[1].Label != "factor:" {
+		t.Fatalf("expected value: and factor: hints, got %s", resp.Result)
+	}
+	if hints[0].Position.Line != 5 || hints[0].Position.Character != 22 {
+		t.Errorf("expected value: hint at 5:22, got %d:%d", hints[0].Position.Line, hints[0].Position.Character)
+	}
+}
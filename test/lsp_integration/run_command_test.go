@@ -0,0 +1,88 @@
+package lsp_integration
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunCommandStreamsProgramOutput(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "cm.mod"), []byte(`module "test/run"`), 0644); err != nil {
+		t.Fatalf("write cm.mod: %v", err)
+	}
+	mainCM := strings.Join([]string{
+		`module "main"`,
+		"",
+		`cimport "stdio.h"`,
+		"",
+		"func main() int {",
+		`    stdio.printf("hello from run\n");`,
+		"    return 3;",
+		"}",
+		"",
+	}, "\n")
+	if err := os.WriteFile(filepath.Join(tmpDir, "main.cm"), []byte(mainCM), 0644); err != nil {
+		t.Fatalf("write main.cm: %v", err)
+	}
+
+	lspBin := findLSPBinary(t)
+	cmd := exec.Command(lspBin)
+	cmd.Dir = tmpDir
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatalf("stdin pipe: %v", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("stdout pipe: %v", err)
+	}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start c_minus_lsp: %v", err)
+	}
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+
+	client := newLSPClient(t, stdout, stdin)
+	initResp := client.request("initialize", map[string]any{"rootUri": fileURIForPath(t, tmpDir), "capabilities": map[string]any{}})
+	if initResp.Error != nil {
+		t.Fatalf("initialize error: %s", initResp.Error.Message)
+	}
+	if !strings.Contains(string(initResp.Result), `"c_minus.run"`) {
+		t.Fatalf("expected c_minus.run in executeCommandProvider, got %s", initResp.Result)
+	}
+	client.notify("initialized", map[string]any{})
+
+	runResp := client.request("workspace/executeCommand", map[string]any{"command": "c_minus.run"})
+	if runResp.Error != nil {
+		t.Fatalf("executeCommand error: %s", runResp.Error.Message)
+	}
+	var result struct {
+		ExitCode int `json:"exitCode"`
+	}
+	if err := json.Unmarshal(runResp.Result, &result); err != nil {
+		t.Fatalf("unmarshal result %s: %v", runResp.Result, err)
+	}
+	if result.ExitCode != 3 {
+		t.Errorf("expected exit code 3, got %d", result.ExitCode)
+	}
+
+	for {
+		msg := client.waitForNotification("window/logMessage", 5*time.Second)
+		var params struct {
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(msg.Params, &params)
+		if params.Message == "hello from run" {
+			break
+		}
+	}
+}